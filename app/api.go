@@ -1,12 +1,16 @@
 package app
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,6 +19,7 @@ import (
 	"github.com/opnlaas/opnlaas/config"
 	"github.com/opnlaas/opnlaas/db"
 	"github.com/opnlaas/opnlaas/iso"
+	"github.com/stmcginnis/gofish/redfish"
 )
 
 func apiLogin(c *fiber.Ctx) (err error) {
@@ -72,6 +77,8 @@ type authProfile struct {
 	Groups      []string `json:"groups,omitempty"`
 	Permissions string   `json:"permissions"`
 	IsAdmin     bool     `json:"is_admin"`
+
+	CanCreateBookings bool `json:"can_create_bookings"`
 }
 
 func apiAuthMe(c *fiber.Ctx) (err error) {
@@ -86,6 +93,8 @@ func apiAuthMe(c *fiber.Ctx) (err error) {
 		DisplayName: user.Username,
 		Permissions: perms.String(),
 		IsAdmin:     perms >= auth.AuthPermsAdministrator,
+
+		CanCreateBookings: perms >= auth.AuthPermsBookingCreator,
 	}
 
 	if user.LDAPConn != nil {
@@ -105,6 +114,24 @@ func apiAuthMe(c *fiber.Ctx) (err error) {
 	return c.JSON(profile)
 }
 
+// apiAuthMeQuota reports the caller's quota limits, what they hold and what they have left.
+func apiAuthMeQuota(c *fiber.Ctx) (err error) {
+	var (
+		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		quota *db.Quota
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if quota, err = db.UserQuota(user.Username, user.Groups()); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(quota)
+}
+
 // Enums API
 
 func apiEnumsVendorNames(c *fiber.Ctx) (err error) {
@@ -155,16 +182,79 @@ func apiEnumsBookingRequestStatusNames(c *fiber.Ctx) (err error) {
 	return c.JSON(db.BookingRequestStatusNameReverses)
 }
 
+func apiEnumsJobKindNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.JobKindNameReverses)
+}
+
+func apiEnumsJobStatusNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.JobStatusNameReverses)
+}
+
+func apiEnumsBookingNoticeKindNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.BookingNoticeKindNameReverses)
+}
+
+func apiEnumsWipeMethodNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.WipeMethodNameReverses)
+}
+
+func apiEnumsWipeStatusNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.WipeStatusNameReverses)
+}
+
+func apiEnumsFirmwareCategoryNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.FirmwareCategoryNameReverses)
+}
+
+func apiEnumsFirmwareUpdateMethodNames(c *fiber.Ctx) (err error) {
+	return c.JSON(db.FirmwareUpdateMethodNameReverses)
+}
+
 // Hosts API
 
+// parseHostQuery reads the host filter, sort order and page from the query string.
+func parseHostQuery(c *fiber.Ctx) (filter db.HostFilter, options db.HostListOptions, err error) {
+	if err = c.QueryParser(&filter); err == nil {
+		err = c.QueryParser(&options)
+	}
+
+	return
+}
+
+// sendHostPage sorts and pages hosts, the total number of matches is sent in the X-Total-Count header.
+func sendHostPage(c *fiber.Ctx, hosts []*db.Host, options db.HostListOptions) (err error) {
+	var total int
+	if hosts, total, err = options.Apply(hosts); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	c.Set("X-Total-Count", strconv.Itoa(total))
+	return c.JSON(hosts)
+}
+
 func apiHostsAll(c *fiber.Ctx) (err error) {
-	var hostList []*db.Host = make([]*db.Host, 0)
+	var (
+		user     *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		owner    string
+		groups   []string
+		hostList []*db.Host
+		filter   db.HostFilter
+		options  db.HostListOptions
+	)
 
-	if hostList, err = db.Hosts.SelectAll(); err == nil {
-		err = c.JSON(hostList)
+	if filter, options, err = parseHostQuery(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid host filter"})
 	}
 
-	return
+	if user != nil {
+		owner, groups = user.Username, user.Groups()
+	}
+
+	if hostList, err = db.SearchHosts(owner, groups, filter); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return sendHostPage(c, hostList, options)
 }
 
 func apiHostByManagementIP(c *fiber.Ctx) (err error) {
@@ -180,33 +270,25 @@ func apiHostByManagementIP(c *fiber.Ctx) (err error) {
 	return
 }
 
-func apiHostCreate(c *fiber.Ctx) (err error) {
-	var (
-		newHost *db.Host
-		body    struct {
-			ManagementIP   string            `json:"management_ip"`
-			ManagementType db.ManagementType `json:"management_type"`
-		}
-	)
-
-	if err = c.BodyParser(&body); err != nil {
+// registerHost connects to a new host's BMC, collects its inventory and stores it.
+func registerHost(managementIP string, managementType db.ManagementType) (newHost *db.Host, status int, err error) {
+	if existingHost, _ := db.Hosts.Select(managementIP); existingHost != nil {
+		status = fiber.StatusConflict
+		err = fmt.Errorf("host with the same management IP already exists")
 		return
 	}
 
-	if existingHost, _ := db.Hosts.Select(body.ManagementIP); existingHost != nil {
-		err = fiber.NewError(fiber.StatusConflict, "host with the same management IP already exists")
-		return c.SendStatus(409)
-	}
-
 	newHost = &db.Host{
-		ManagementIP:   body.ManagementIP,
-		ManagementType: body.ManagementType,
+		ManagementIP:   managementIP,
+		ManagementType: managementType,
 	}
 
-	if newHost.Management, err = db.NewHostManagementClient(newHost); err != nil {
-		err = fiber.NewError(fiber.StatusInternalServerError, "failed to create management client: "+err.Error())
+	status = fiber.StatusInternalServerError
+
+	if newHost.Management, err = db.AcquireHostManagementClient(newHost); err != nil {
 		log.Errorf("failed to create management client for host %s: %v", newHost.ManagementIP, err)
-		return c.SendStatus(500)
+		err = fmt.Errorf("failed to create management client: %w", err)
+		return
 	} else {
 		defer newHost.Management.Close()
 	}
@@ -215,381 +297,2341 @@ func apiHostCreate(c *fiber.Ctx) (err error) {
 		return
 	}
 
+	// A missing firmware inventory shouldn't keep the host out, it is collected again periodically
+	firmware, errFirmware := newHost.Management.FirmwareInventory()
+	if errFirmware != nil {
+		log.Warnf("failed to read firmware inventory for host %s: %v", newHost.ManagementIP, errFirmware)
+	} else {
+		newHost.FirmwareCollectedAt = time.Now()
+	}
+
 	if newHost.LastKnownPowerState, err = newHost.Management.PowerState(true); err != nil {
 		return
 	}
 
 	newHost.LastKnownPowerStateTime = time.Now()
+	db.EnsureHostEventSubscription(newHost)
+
+	if err = db.Hosts.Insert(newHost); err != nil {
+		return
+	}
 
-	if err = db.Hosts.Insert(newHost); err == nil {
-		err = c.JSON(newHost)
+	status = fiber.StatusOK
+	if errFirmware == nil {
+		if errFirmware = db.SaveHostFirmware(newHost.ManagementIP, firmware, newHost.FirmwareCollectedAt); errFirmware != nil {
+			log.Warnf("failed to save firmware inventory for host %s: %v", newHost.ManagementIP, errFirmware)
+		}
 	}
 
 	return
 }
 
-func apiHostDelete(c *fiber.Ctx) (err error) {
+func apiHostCreate(c *fiber.Ctx) (err error) {
 	var (
-		hostID string = c.Params("management_ip")
+		newHost *db.Host
+		status  int
+		body    struct {
+			ManagementIP   string            `json:"management_ip"`
+			ManagementType db.ManagementType `json:"management_type"`
+		}
 	)
 
-	err = db.Hosts.Delete(hostID)
-	return
+	if err = c.BodyParser(&body); err != nil {
+		return
+	}
+
+	if newHost, status, err = registerHost(body.ManagementIP, body.ManagementType); err != nil {
+		return c.Status(status).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	return c.JSON(newHost)
 }
 
-func apiHostPowerControl(c *fiber.Ctx) (err error) {
+func apiHostsDiscover(c *fiber.Ctx) (err error) {
 	var (
-		hostID                string = c.Params("management_ip")
-		powerActionStr        string = c.Params("action")
-		powerActionInt        int64
-		powerAction           db.PowerAction
-		host                  *db.Host
-		hostCurrentPowerState db.PowerState
-		waitPowerState        db.PowerState
+		candidates []*db.DiscoveryCandidate
+		body       struct {
+			CIDR string `json:"cidr"`
+		}
 	)
 
-	sendPowerError := func(status int, msg string, logErr error) error {
-		if logErr != nil {
-			log.Errorf("power control error for host %s: %v", hostID, logErr)
-		}
-		return c.Status(status).JSON(fiber.Map{"message": msg})
+	if err = c.BodyParser(&body); err != nil || len(body.CIDR) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cidr is required"})
 	}
 
-	if host, err = db.Hosts.Select(hostID); err != nil {
-		return sendPowerError(fiber.StatusInternalServerError, "Failed to retrieve host", err)
-	} else if host == nil {
-		return sendPowerError(fiber.StatusNotFound, "Host not found", nil)
+	if candidates, err = db.DiscoverBMCs(body.CIDR); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	if powerActionInt, err = strconv.ParseInt(powerActionStr, 0, 16); err != nil {
-		return sendPowerError(fiber.StatusBadRequest, "Invalid power action", err)
+	return c.JSON(candidates)
+}
+
+func apiHostsDiscoverAccept(c *fiber.Ctx) (err error) {
+	type acceptResult struct {
+		ManagementIP string   `json:"management_ip"`
+		Accepted     bool     `json:"accepted"`
+		Error        string   `json:"error,omitempty"`
+		Host         *db.Host `json:"host,omitempty"`
 	}
 
-	powerAction = db.PowerAction(powerActionInt)
+	type acceptCandidate struct {
+		ManagementIP   string            `json:"management_ip"`
+		ManagementType db.ManagementType `json:"management_type"`
+	}
 
-	if host.Management == nil {
-		if host.Management, err = db.NewHostManagementClient(host); err != nil {
-			return sendPowerError(fiber.StatusBadGateway, "Failed to create management client", err)
-		} else {
-			defer host.Management.Close()
+	var (
+		body struct {
+			Hosts []acceptCandidate `json:"hosts"`
 		}
-	}
+		results []acceptResult
+		wg      sync.WaitGroup
+		slots   chan struct{}   = make(chan struct{}, max(config.Config.Management.DiscoveryAcceptConcurrency, 1))
+		seen    map[string]bool = map[string]bool{}
+	)
 
-	if hostCurrentPowerState, err = host.Management.PowerState(false); err != nil {
-		return sendPowerError(fiber.StatusBadGateway, "Failed to read current power state", err)
+	if err = c.BodyParser(&body); err != nil || len(body.Hosts) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "hosts are required"})
 	}
 
-	switch powerAction {
-	case db.PowerActionPowerOn:
-		waitPowerState = db.PowerStateOn
-		if hostCurrentPowerState == db.PowerStateOn {
-			return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Host already powered on"})
-		}
+	// The same IP submitted twice would race on the same insert, only the first entry is registered
+	body.Hosts = slices.DeleteFunc(body.Hosts, func(candidate acceptCandidate) (duplicate bool) {
+		duplicate, seen[candidate.ManagementIP] = seen[candidate.ManagementIP], true
+		return
+	})
 
-		if err = host.Management.SetPowerState(db.PowerStateOn, false); err != nil {
-			return sendPowerError(fiber.StatusBadGateway, "Failed to power on host", err)
-		}
-	case db.PowerActionGracefulShutdown:
-		waitPowerState = db.PowerStateOff
-		if hostCurrentPowerState == db.PowerStateOff {
-			return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Host already powered off"})
-		}
+	results = make([]acceptResult, len(body.Hosts))
+	for i, candidate := range body.Hosts {
+		wg.Add(1)
+		go func(index int, managementIP string, managementType db.ManagementType) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var result acceptResult = acceptResult{ManagementIP: managementIP}
+			if host, _, errRegister := registerHost(managementIP, managementType); errRegister != nil {
+				result.Error = errRegister.Error()
+			} else {
+				result.Accepted = true
+				result.Host = host
+			}
 
-		if err = host.Management.SetPowerState(db.PowerStateOff, false); err != nil {
-			return sendPowerError(fiber.StatusBadGateway, "Failed to gracefully shut down host", err)
-		}
-	case db.PowerActionPowerOff:
-		waitPowerState = db.PowerStateOff
-		if hostCurrentPowerState == db.PowerStateOff {
-			return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Host already powered off"})
-		}
+			results[index] = result
+		}(i, candidate.ManagementIP, candidate.ManagementType)
+	}
 
-		if err = host.Management.SetPowerState(db.PowerStateOff, true); err != nil {
-			return sendPowerError(fiber.StatusBadGateway, "Failed to force power off host", err)
-		}
-	case db.PowerActionGracefulRestart:
-		waitPowerState = db.PowerStateOn
-		if err = host.Management.ResetPowerState(false); err != nil {
-			return sendPowerError(fiber.StatusBadGateway, "Failed to gracefully restart host", err)
-		}
-	case db.PowerActionForceRestart:
-		waitPowerState = db.PowerStateOn
-		if err = host.Management.ResetPowerState(true); err != nil {
-			return sendPowerError(fiber.StatusBadGateway, "Failed to force restart host", err)
+	wg.Wait()
+	return c.JSON(results)
+}
+
+// apiHostDelete archives a host and removes it from the lab. Hosts in use are refused unless ?force=true, which
+// releases them from their booking, carts and pending requests.
+func apiHostDelete(c *fiber.Ctx) (err error) {
+	var (
+		user     *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		archived *db.ArchivedHost
+	)
+
+	if archived, err = db.RemoveHost(c.Params("management_ip"), user.Username, c.QueryBool("force")); err != nil {
+		switch {
+		case errors.Is(err, db.ErrHostNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
+		case errors.Is(err, db.ErrHostInUse), errors.Is(err, db.ErrHostFirmwareUpdating), errors.Is(err, db.ErrHostWiping):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+		default:
+			return c.SendStatus(fiber.StatusInternalServerError)
 		}
-	default:
-		return sendPowerError(fiber.StatusBadRequest, "Unsupported power action", nil)
 	}
 
-	// Wait for desired power state
-	if err = host.Management.WaitSystemPowerState(waitPowerState, 120); err != nil {
-		fmt.Println(err)
-		return sendPowerError(fiber.StatusGatewayTimeout, fmt.Sprintf("Timed out waiting for host to reach %s power state", waitPowerState.String()), err)
+	return c.JSON(archived)
+}
+
+func apiHostsArchived(c *fiber.Ctx) (err error) {
+	var records []*db.ArchivedHost
+
+	if records, err = db.ArchivedHosts(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	// Update host power state in DB
-	if host.LastKnownPowerState, err = host.Management.PowerState(true); err != nil {
-		log.Warnf("failed to update last known power state for host %s: %v", host.ManagementIP, err)
-	} else {
-		host.LastKnownPowerStateTime = time.Now()
-		if err = db.Hosts.Update(host); err != nil {
-			log.Warnf("failed to save updated power state for host %s: %v", host.ManagementIP, err)
-		}
+	if records == nil {
+		records = make([]*db.ArchivedHost, 0)
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Power action completed successfully", "power_state": host.LastKnownPowerState})
+	return c.JSON(records)
 }
 
-// ISO Images API
+func apiManagementPool(c *fiber.Ctx) (err error) {
+	return c.JSON(db.ManagementPoolSnapshot())
+}
 
-func apiISOImagesCreate(c *fiber.Ctx) (err error) {
+func apiHostBMCRetry(c *fiber.Ctx) (err error) {
 	var (
-		fileHeader *multipart.FileHeader
+		hostID string = c.Params("management_ip")
+		host   *db.Host
 	)
 
-	if fileHeader, err = c.FormFile("iso_image"); err != nil {
-		return
+	if host, err = db.Hosts.Select(hostID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve host"})
+	} else if host == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
 	}
 
-	// Save file to temp location
-	var tempFilePath string = fmt.Sprintf("%s/%s", os.TempDir(), filepath.Base(fileHeader.Filename))
-	if err = c.SaveFile(fileHeader, tempFilePath); err != nil {
-		return
-	}
+	db.ResetBMCBackoff(hostID)
 
-	// Extract ISO
-	var isoFS *db.StoredISOImage
-	if isoFS, err = iso.ExtractISO(tempFilePath, config.Config.ISOs.StorageDir); err != nil {
-		return
+	if host.Management, err = db.AcquireHostManagementClient(host); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": err.Error(), "bmc_reachable": false})
 	}
 
-	if err = db.StoredISOImages.Insert(isoFS); err != nil {
-		return
+	host.Management.Close()
+
+	if _, err = db.UpdateHost(hostID, func(stored *db.Host) error {
+		stored.BMCReachable, stored.BMCCheckedAt, stored.BMCLastError = host.BMCReachable, host.BMCCheckedAt, host.BMCLastError
+		return nil
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to save host"})
 	}
 
-	return c.JSON(isoFS)
+	return c.JSON(fiber.Map{"message": "BMC reachable", "bmc_reachable": true})
 }
 
-func apiISOImagesList(c *fiber.Ctx) (err error) {
-	var isoList []*db.StoredISOImage
+func apiHostEvents(c *fiber.Ctx) (err error) {
+	var (
+		hostID  string = c.Params("management_ip")
+		limit   int    = c.QueryInt("limit", 100)
+		host    *db.Host
+		records []*db.HostEvent
+	)
 
-	if isoList, err = db.StoredISOImages.SelectAll(); err != nil {
-		return
+	if host, err = db.Hosts.Select(hostID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve host"})
+	} else if host == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
 	}
 
-	return c.JSON(isoList)
+	if records, err = db.HostEventList(hostID, limit); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to list host events"})
+	}
+
+	return c.JSON(fiber.Map{
+		"subscribed": host.EventSubscriptionURI != "",
+		"events":     records,
+	})
 }
 
-// Booking API
+// apiRedfishEventListener receives events pushed by subscribed BMCs. It is not behind a login, the event
+// context is a per-host secret handed to the BMC when subscribing.
+func apiRedfishEventListener(c *fiber.Ctx) (err error) {
+	var event redfish.Event
+	if err = json.Unmarshal(c.Body(), &event); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid event payload"})
+	}
 
-func apiBookingCreate(c *fiber.Ctx) (err error) {
+	if _, err = db.HandleRedfishEvent(&event); errors.Is(err, db.ErrUnknownEventContext) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Unknown event context"})
+	} else if err != nil {
+		log.Errorf("failed to handle redfish event: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to handle event"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func apiHostPowerControl(c *fiber.Ctx) (err error) {
 	var (
-		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
-		body struct {
-			Name        string `json:"name"`
-			Description string `json:"description"`
-			Duration    int    `json:"duration_days"`
-		}
-		newBooking db.Booking
+		user           *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		hostID         string         = c.Params("management_ip")
+		powerActionStr string         = c.Params("action")
+		powerActionInt int64
+		powerAction    db.PowerAction
+		host           *db.Host
+		job            *db.Job
 	)
 
-	if user == nil {
-		return c.SendStatus(fiber.StatusUnauthorized)
-	}
-
-	if err = c.BodyParser(&body); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	sendPowerError := func(status int, msg string, logErr error) error {
+		if logErr != nil {
+			log.Errorf("power control error for host %s: %v", hostID, logErr)
+		}
+		return c.Status(status).JSON(fiber.Map{"message": msg})
 	}
 
-	if len(body.Name) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "name is required"})
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	now := time.Now()
-	newBooking = db.Booking{
-		Name:        body.Name,
-		Description: body.Description,
-		Status:      db.BookingStatusActive,
-		StartTime:   now,
+	if host, err = db.Hosts.Select(hostID); err != nil {
+		return sendPowerError(fiber.StatusInternalServerError, "Failed to retrieve host", err)
+	} else if host == nil {
+		return sendPowerError(fiber.StatusNotFound, "Host not found", nil)
 	}
 
-	if body.Duration > 0 {
-		newBooking.EndTime = now.Add(time.Duration(body.Duration) * 24 * time.Hour)
+	if powerActionInt, err = strconv.ParseInt(powerActionStr, 0, 16); err != nil {
+		return sendPowerError(fiber.StatusBadRequest, "Invalid power action", err)
 	}
 
-	if err = db.CreateBooking(&newBooking); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "failed to create booking"})
+	powerAction = db.PowerAction(powerActionInt)
+	if _, err = db.PowerActionTargetState(powerAction); err != nil {
+		return sendPowerError(fiber.StatusBadRequest, "Unsupported power action", nil)
 	}
 
-	owner := &db.BookingPerson{
-		Username:        user.Username,
-		BookingID:       newBooking.ID,
-		PermissionLevel: db.BookingPermissionLevelOwner,
-	}
+	if job, err = db.EnqueueJob(db.JobKindHostPower, host.ManagementIP, user.Username, func(handle *db.JobHandle) error {
+		state, err := db.RunHostPowerAction(host.ManagementIP, powerAction, handle.Progress)
+		if err != nil {
+			return err
+		}
 
-	if err = db.AddBookingPerson(owner); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "failed to set booking owner"})
+		return handle.SetResult(fiber.Map{"power_state": state})
+	}); err != nil {
+		return sendPowerError(fiber.StatusInternalServerError, "Failed to queue power action", err)
 	}
 
-	newBooking.People = append(newBooking.People, owner.ID)
-
-	return c.JSON(newBooking)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Power action queued", "job_id": job.ID, "job": job})
 }
 
-func apiBookingList(c *fiber.Ctx) (err error) {
+func apiHostsBulkPower(c *fiber.Ctx) (err error) {
 	var (
-		bookings []*db.Booking
-		user     *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			ManagementIPs []string       `json:"management_ips"`
+			Action        db.PowerAction `json:"action"`
+		}
+		job *db.Job
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if bookings, err = db.BookingList(); err != nil {
-		return c.SendStatus(fiber.StatusInternalServerError)
+	if err = c.BodyParser(&body); err != nil || len(body.ManagementIPs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "management_ips are required"})
 	}
 
-	return c.JSON(bookings)
+	if _, err = db.PowerActionTargetState(body.Action); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Unsupported power action"})
+	}
+
+	if job, err = db.EnqueueJob(db.JobKindBulkPower, strings.Join(body.ManagementIPs, ","), user.Username, func(handle *db.JobHandle) error {
+		return handle.SetResult(db.BulkHostPowerAction(body.ManagementIPs, body.Action, handle.Progress))
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to queue power action"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Power action queued", "job_id": job.ID, "job": job})
 }
 
-func apiBookingCartSnapshot(c *fiber.Ctx) (err error) {
+// Jobs API
+
+func apiJobByID(c *fiber.Ctx) (err error) {
 	var (
-		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
-		cart *db.BookingCart
+		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		job   *db.Job
+		jobID int
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if cart, err = db.BookingCartSnapshot(user.Username); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "cart not found"})
+	if jobID, err = c.ParamsInt("id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid job id"})
 	}
 
-	return c.JSON(cart)
+	if job, err = db.JobByID(jobID); err != nil {
+		if errors.Is(err, db.ErrJobNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+		}
+
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if job.CreatedBy != user.Username && user.Permissions() < auth.AuthPermsAdministrator {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	return c.JSON(job)
 }
 
-func apiBookingCartCounts(c *fiber.Ctx) (err error) {
+func apiJobsList(c *fiber.Ctx) (err error) {
 	var (
-		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		user    *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		jobList []*db.Job
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if hosts, virtual, errCount := db.CartCounts(user.Username); errCount != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "cart not found"})
+	if c.Query("all") == "1" && user.Permissions() >= auth.AuthPermsAdministrator {
+		jobList, err = db.JobList()
 	} else {
-		return c.JSON(fiber.Map{
-			"hosts":    hosts,
-			"virtual":  virtual,
-			"total":    hosts + virtual,
+		jobList, err = db.JobsCreatedBy(user.Username)
+	}
+
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if jobList == nil {
+		jobList = make([]*db.Job, 0)
+	}
+
+	return c.JSON(jobList)
+}
+
+// Power policy API
+
+// powerScheduleError maps power schedule validation errors to an HTTP status.
+func powerScheduleError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ErrPowerScheduleNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrInvalidCronSpec), errors.Is(err, db.ErrUnsupportedPowerAction), errors.Is(err, db.ErrHostNotFound):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+func apiPowerSchedulesList(c *fiber.Ctx) (err error) {
+	var schedules []*db.PowerSchedule
+	if schedules, err = db.PowerScheduleList(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if schedules == nil {
+		schedules = make([]*db.PowerSchedule, 0)
+	}
+
+	return c.JSON(schedules)
+}
+
+func apiPowerScheduleCreate(c *fiber.Ctx) (err error) {
+	var (
+		user     *auth.AuthUser    = auth.IsAuthenticated(c, jwtSigningKey)
+		schedule *db.PowerSchedule = &db.PowerSchedule{}
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = c.BodyParser(schedule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid power schedule"})
+	}
+
+	schedule.ID = 0
+	schedule.CreatedBy = user.Username
+	schedule.LastRunAt = time.Time{}
+
+	if err = db.CreatePowerSchedule(schedule); err != nil {
+		return powerScheduleError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(schedule)
+}
+
+func apiPowerScheduleUpdate(c *fiber.Ctx) (err error) {
+	var (
+		scheduleID int
+		existing   *db.PowerSchedule
+		body       struct {
+			ManagementIP     *string         `json:"management_ip"`
+			Cron             *string         `json:"cron"`
+			Action           *db.PowerAction `json:"action"`
+			Enabled          *bool           `json:"enabled"`
+			AllowWhileBooked *bool           `json:"allow_while_booked"`
+		}
+	)
+
+	if scheduleID, err = c.ParamsInt("schedule_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid schedule id"})
+	}
+
+	if existing, err = db.PowerScheduleByID(scheduleID); err != nil {
+		return powerScheduleError(c, err)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid power schedule"})
+	}
+
+	if body.ManagementIP != nil {
+		existing.ManagementIP = *body.ManagementIP
+	}
+
+	if body.Cron != nil {
+		existing.Cron = *body.Cron
+	}
+
+	if body.Action != nil {
+		existing.Action = *body.Action
+	}
+
+	if body.Enabled != nil {
+		existing.Enabled = *body.Enabled
+	}
+
+	if body.AllowWhileBooked != nil {
+		existing.AllowWhileBooked = *body.AllowWhileBooked
+	}
+
+	if err = db.UpdatePowerSchedule(existing); err != nil {
+		return powerScheduleError(c, err)
+	}
+
+	return c.JSON(existing)
+}
+
+func apiPowerScheduleDelete(c *fiber.Ctx) (err error) {
+	var scheduleID int
+	if scheduleID, err = c.ParamsInt("schedule_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid schedule id"})
+	}
+
+	if err = db.DeletePowerSchedule(scheduleID); err != nil {
+		return powerScheduleError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func apiPowerPolicyHistory(c *fiber.Ctx) (err error) {
+	var jobList []*db.Job
+	if jobList, err = db.PowerPolicyJobs(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if jobList == nil {
+		jobList = make([]*db.Job, 0)
+	}
+
+	return c.JSON(jobList)
+}
+
+// ISO Images API
+
+func apiISOImagesCreate(c *fiber.Ctx) (err error) {
+	var (
+		fileHeader *multipart.FileHeader
+	)
+
+	if fileHeader, err = c.FormFile("iso_image"); err != nil {
+		return
+	}
+
+	// Save file to temp location
+	var tempFilePath string = fmt.Sprintf("%s/%s", os.TempDir(), filepath.Base(fileHeader.Filename))
+	if err = c.SaveFile(fileHeader, tempFilePath); err != nil {
+		return
+	}
+
+	// Extract ISO
+	var isoFS *db.StoredISOImage
+	if isoFS, err = iso.ExtractISO(tempFilePath, config.Config.ISOs.StorageDir); err != nil {
+		return
+	}
+
+	if err = db.StoredISOImages.Insert(isoFS); err != nil {
+		return
+	}
+
+	return c.JSON(isoFS)
+}
+
+func apiISOImagesList(c *fiber.Ctx) (err error) {
+	var isoList []*db.StoredISOImage
+
+	if isoList, err = db.StoredISOImages.SelectAll(); err != nil {
+		return
+	}
+
+	return c.JSON(isoList)
+}
+
+// Firmware API
+
+func apiHostFirmware(c *fiber.Ctx) (err error) {
+	var (
+		hostID  string = c.Params("management_ip")
+		host    *db.Host
+		records []*db.HostFirmware
+	)
+
+	if host, err = db.Hosts.Select(hostID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve host"})
+	} else if host == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
+	}
+
+	if records, err = db.HostFirmwareList(hostID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to list host firmware"})
+	}
+
+	if records == nil {
+		records = make([]*db.HostFirmware, 0)
+	}
+
+	return c.JSON(fiber.Map{
+		"collected_at": host.FirmwareCollectedAt,
+		"updating":     host.FirmwareUpdating,
+		"firmware":     records,
+	})
+}
+
+func apiHostFirmwareRefresh(c *fiber.Ctx) (err error) {
+	var records []*db.HostFirmware
+
+	if records, err = db.RefreshHostFirmware(c.Params("management_ip")); errors.Is(err, db.ErrHostNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if records == nil {
+		records = make([]*db.HostFirmware, 0)
+	}
+
+	return c.JSON(records)
+}
+
+func apiHostSpecsRefresh(c *fiber.Ctx) (err error) {
+	var host *db.Host
+
+	if host, err = db.RefreshHostSpecs(c.Params("management_ip")); errors.Is(err, db.ErrHostNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	return c.JSON(host)
+}
+
+func apiHostSetProvisioningNIC(c *fiber.Ctx) (err error) {
+	var (
+		host *db.Host
+		body struct {
+			MACAddress string `json:"mac_address"`
+		}
+	)
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body"})
+	}
+
+	switch host, err = db.SetHostProvisioningNIC(c.Params("management_ip"), body.MACAddress); {
+	case errors.Is(err, db.ErrHostNotFound), errors.Is(err, db.ErrNICNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrInvalidMACAddress), errors.Is(err, db.ErrNICNotProvisioning):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case err != nil:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(host)
+}
+
+// hostMetadataResponse maps errors from host tag and location edits to responses.
+func hostMetadataResponse(c *fiber.Ctx, host *db.Host, err error) error {
+	switch {
+	case errors.Is(err, db.ErrHostNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
+	case errors.Is(err, db.ErrInvalidTag), errors.Is(err, db.ErrInvalidLocation):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrLocationTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	case err != nil:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(host)
+}
+
+func apiHostSetTags(c *fiber.Ctx) (err error) {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body"})
+	}
+
+	host, err := db.SetHostTags(c.Params("management_ip"), body.Tags)
+	return hostMetadataResponse(c, host, err)
+}
+
+func apiHostAddTag(c *fiber.Ctx) (err error) {
+	host, err := db.AddHostTag(c.Params("management_ip"), c.Params("tag"))
+	return hostMetadataResponse(c, host, err)
+}
+
+func apiHostRemoveTag(c *fiber.Ctx) (err error) {
+	host, err := db.RemoveHostTag(c.Params("management_ip"), c.Params("tag"))
+	return hostMetadataResponse(c, host, err)
+}
+
+func apiHostSetLocation(c *fiber.Ctx) (err error) {
+	var location db.HostLocation
+
+	if err = c.BodyParser(&location); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body"})
+	}
+
+	host, err := db.SetHostLocation(c.Params("management_ip"), location)
+	return hostMetadataResponse(c, host, err)
+}
+
+func apiRacks(c *fiber.Ctx) (err error) {
+	var racks []*db.Rack
+
+	if racks, err = db.RackLayout(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if racks == nil {
+		racks = make([]*db.Rack, 0)
+	}
+
+	return c.JSON(racks)
+}
+
+func apiTagsList(c *fiber.Ctx) (err error) {
+	var tags []*db.TagSummary
+
+	if tags, err = db.TagList(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if tags == nil {
+		tags = make([]*db.TagSummary, 0)
+	}
+
+	return c.JSON(tags)
+}
+
+func apiTagRestrictionsList(c *fiber.Ctx) (err error) {
+	var restrictions []*db.TagRestriction
+
+	if restrictions, err = db.TagRestrictionList(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if restrictions == nil {
+		restrictions = make([]*db.TagRestriction, 0)
+	}
+
+	return c.JSON(restrictions)
+}
+
+func apiTagRestrictionSet(c *fiber.Ctx) (err error) {
+	var (
+		user        *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		restriction *db.TagRestriction
+		body        struct {
+			AllowedGroups []string `json:"allowed_groups"`
+		}
+	)
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body"})
+	}
+
+	if restriction, err = db.SetTagRestriction(c.Params("tag"), body.AllowedGroups, user.Username); errors.Is(err, db.ErrInvalidTag) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(restriction)
+}
+
+func apiTagRestrictionDelete(c *fiber.Ctx) (err error) {
+	if err = db.DeleteTagRestriction(c.Params("tag")); errors.Is(err, db.ErrTagRestrictionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Quota API
+
+func apiQuotaPoliciesList(c *fiber.Ctx) (err error) {
+	var records []*db.QuotaPolicy
+	if records, err = db.QuotaPolicyList(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if records == nil {
+		records = make([]*db.QuotaPolicy, 0)
+	}
+
+	return c.JSON(records)
+}
+
+// apiQuotaPolicySet sets the limits of the user or group named in the path, replacing any earlier ones.
+func apiQuotaPolicySet(c *fiber.Ctx) (err error) {
+	var (
+		user   *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		policy db.QuotaPolicy
+		record *db.QuotaPolicy
+	)
+
+	if err = c.BodyParser(&policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body"})
+	}
+
+	policy.Scope = db.QuotaScope(c.Params("scope"))
+	policy.Subject = c.Params("subject")
+
+	if record, err = db.SetQuotaPolicy(&policy, user.Username); errors.Is(err, db.ErrInvalidQuotaPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(record)
+}
+
+func apiQuotaPolicyDelete(c *fiber.Ctx) (err error) {
+	if err = db.DeleteQuotaPolicy(db.QuotaScope(c.Params("scope")), c.Params("subject")); errors.Is(err, db.ErrQuotaPolicyNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Maintenance API
+
+// maintenanceError maps maintenance window errors to an HTTP status.
+func maintenanceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ErrHostNotFound), errors.Is(err, db.ErrMaintenanceWindowNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrInvalidMaintenanceWindow):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrMaintenanceWindowOverlap):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+func apiHostMaintenanceList(c *fiber.Ctx) (err error) {
+	var (
+		host    *db.Host
+		windows []*db.MaintenanceWindow
+	)
+
+	if host, err = db.Hosts.Select(c.Params("management_ip")); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if host == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Host not found"})
+	}
+
+	if windows, err = db.MaintenanceWindowsForHost(host.ManagementIP); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if windows == nil {
+		windows = make([]*db.MaintenanceWindow, 0)
+	}
+
+	return c.JSON(fiber.Map{
+		"maintenance": host.Maintenance,
+		"windows":     windows,
+	})
+}
+
+func apiHostMaintenanceSchedule(c *fiber.Ctx) (err error) {
+	var (
+		user   *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		window *db.MaintenanceWindow
+		body   struct {
+			Reason    string    `json:"reason"`
+			StartTime time.Time `json:"start_time"`
+			EndTime   time.Time `json:"end_time"`
+		}
+	)
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid maintenance window"})
+	}
+
+	if window, err = db.ScheduleMaintenance(c.Params("management_ip"), body.Reason, body.StartTime, body.EndTime, user.Username); err != nil {
+		return maintenanceError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(window)
+}
+
+func apiMaintenanceUpcoming(c *fiber.Ctx) (err error) {
+	var windows []*db.MaintenanceWindow
+	if windows, err = db.UpcomingMaintenanceWindows(time.Now()); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if windows == nil {
+		windows = make([]*db.MaintenanceWindow, 0)
+	}
+
+	return c.JSON(windows)
+}
+
+// apiMaintenanceEnd ends a window in effect, or cancels one that has yet to start.
+func apiMaintenanceEnd(c *fiber.Ctx) (err error) {
+	var (
+		windowID int
+		window   *db.MaintenanceWindow
+	)
+
+	if windowID, err = c.ParamsInt("window_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid window id"})
+	}
+
+	if window, err = db.EndMaintenance(windowID); err != nil {
+		return maintenanceError(c, err)
+	}
+
+	return c.JSON(window)
+}
+
+// wipeError maps host wipe and BIOS profile errors to an HTTP status.
+func wipeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ErrHostNotFound), errors.Is(err, db.ErrWipeNotFound), errors.Is(err, db.ErrBIOSProfileNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrHostNotIdle), errors.Is(err, db.ErrHostWiping), errors.Is(err, db.ErrHostFirmwareUpdating), errors.Is(err, db.ErrWipeNotInProgress):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrWipeNotConfigured), errors.Is(err, db.ErrBIOSNotSupported), errors.Is(err, db.ErrInvalidMACAddress):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrWipeVerification):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrWipeSourceRejected):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// apiHostWipe wipes an idle host by hand, for instance to retry a wipe that failed on release.
+func apiHostWipe(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		wipe *db.HostWipe
+		job  *db.Job
+	)
+
+	if wipe, job, err = db.StartHostWipe(c.Params("management_ip"), 0, user.Username); err != nil {
+		return wipeError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Host wipe queued", "job_id": job.ID, "job": job, "wipe": wipe})
+}
+
+func apiHostWipeHistory(c *fiber.Ctx) (err error) {
+	var records []*db.HostWipe
+
+	if records, err = db.HostWipeHistory(c.Params("management_ip")); err != nil {
+		return wipeError(c, err)
+	}
+
+	if records == nil {
+		records = make([]*db.HostWipe, 0)
+	}
+
+	return c.JSON(records)
+}
+
+func apiHostBIOSProfile(c *fiber.Ctx) (err error) {
+	var profile *db.BIOSProfile
+
+	if profile, err = db.BIOSProfileFor(c.Params("management_ip")); err != nil {
+		return wipeError(c, err)
+	}
+
+	return c.JSON(profile)
+}
+
+// apiHostBIOSProfileCapture records the host's current BIOS settings as the ones restored after each wipe.
+func apiHostBIOSProfileCapture(c *fiber.Ctx) (err error) {
+	var (
+		user    *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		profile *db.BIOSProfile
+	)
+
+	if profile, err = db.CaptureBIOSProfile(c.Params("management_ip"), user.Username); errors.Is(err, db.ErrHostNotFound) || errors.Is(err, db.ErrBIOSNotSupported) {
+		return wipeError(c, err)
+	} else if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	return c.JSON(profile)
+}
+
+// apiWipeBootScript serves the iPXE script of hosts being wiped, so the PXE chain can hand them the wipe image.
+func apiWipeBootScript(c *fiber.Ctx) (err error) {
+	var script string
+
+	if script, err = db.WipeBootScript(c.Params("mac_address"), c.IP()); err != nil {
+		return wipeError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(script)
+}
+
+func apiWipePlan(c *fiber.Ctx) (err error) {
+	var plan *db.WipePlan
+
+	if plan, err = db.WipePlanFor(c.Params("token"), c.IP()); err != nil {
+		return wipeError(c, err)
+	}
+
+	return c.JSON(plan)
+}
+
+func apiWipeReport(c *fiber.Ctx) (err error) {
+	var (
+		report db.WipeReport
+		wipe   *db.HostWipe
+	)
+
+	if err = c.BodyParser(&report); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid wipe report"})
+	}
+
+	if wipe, err = db.SubmitWipeReport(c.Params("token"), c.IP(), report); err != nil {
+		return wipeError(c, err)
+	}
+
+	return c.JSON(wipe)
+}
+
+// apiHostByMACAddress lets DHCP and PXE services map a booting machine back to its host.
+func apiHostByMACAddress(c *fiber.Ctx) (err error) {
+	var (
+		host         *db.Host
+		provisioning bool
+	)
+
+	switch host, provisioning, err = db.HostByMACAddress(c.Params("mac_address")); {
+	case errors.Is(err, db.ErrInvalidMACAddress):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrHostNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "No host has this MAC address"})
+	case err != nil:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{
+		"management_ip": host.ManagementIP,
+		"provisioning":  provisioning,
+		"host":          host,
+	})
+}
+
+func apiFirmwarePackagesList(c *fiber.Ctx) (err error) {
+	var packages []*db.FirmwarePackage
+
+	if packages, err = db.FirmwarePackageList(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if packages == nil {
+		packages = make([]*db.FirmwarePackage, 0)
+	}
+
+	return c.JSON(packages)
+}
+
+func apiFirmwarePackageCreate(c *fiber.Ctx) (err error) {
+	var (
+		user       *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		fileHeader *multipart.FileHeader
+		category   int
+		pkg        *db.FirmwarePackage
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if fileHeader, err = c.FormFile("firmware_image"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "firmware_image is required"})
+	}
+
+	if category, err = strconv.Atoi(c.FormValue("category", "0")); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid firmware category"})
+	} else if _, ok := db.FirmwareCategoryNames[db.FirmwareCategory(category)]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid firmware category"})
+	}
+
+	pkg = &db.FirmwarePackage{
+		Name:       c.FormValue("name", fileHeader.Filename),
+		Category:   db.FirmwareCategory(category),
+		Version:    strings.TrimSpace(c.FormValue("version")),
+		FileName:   fileHeader.Filename,
+		UploadedBy: user.Username,
+	}
+
+	if pkg.Version == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "version is required"})
+	}
+
+	// Models are separated with "|" like array values in the .env file
+	for _, model := range strings.Split(c.FormValue("models"), "|") {
+		if model = strings.TrimSpace(model); model != "" {
+			pkg.Models = append(pkg.Models, model)
+		}
+	}
+
+	var tempFilePath string = fmt.Sprintf("%s/%s", os.TempDir(), filepath.Base(fileHeader.Filename))
+	if err = c.SaveFile(fileHeader, tempFilePath); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to save firmware image"})
+	}
+
+	if err = db.ImportFirmwarePackage(pkg, tempFilePath); err != nil {
+		os.Remove(tempFilePath)
+		log.Errorf("failed to import firmware package %s: %v", pkg.Name, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to store firmware package"})
+	}
+
+	return c.JSON(pkg)
+}
+
+func apiFirmwarePackageDelete(c *fiber.Ctx) (err error) {
+	var packageID int
+
+	if packageID, err = c.ParamsInt("package_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid package id"})
+	}
+
+	if err = db.DeleteFirmwarePackage(packageID); errors.Is(err, db.ErrFirmwarePackageNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func apiFirmwarePackageApply(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			ManagementIPs []string                `json:"management_ips"`
+			Method        db.FirmwareUpdateMethod `json:"method"`
+		}
+		packageID int
+		job       *db.Job
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if packageID, err = c.ParamsInt("package_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid package id"})
+	}
+
+	if err = c.BodyParser(&body); err != nil || len(body.ManagementIPs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "management_ips are required"})
+	}
+
+	if job, err = db.QueueFirmwareUpdate(packageID, body.ManagementIPs, body.Method, user.Username); err != nil {
+		switch {
+		case errors.Is(err, db.ErrFirmwarePackageNotFound), errors.Is(err, db.ErrHostNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+		case errors.Is(err, db.ErrHostNotIdle), errors.Is(err, db.ErrHostFirmwareUpdating):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+		case errors.Is(err, db.ErrInvalidState), errors.Is(err, db.ErrNoUpdateService), errors.Is(err, db.ErrFirmwareBaseURLNotSet):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+		}
+
+		log.Errorf("failed to queue firmware update: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to queue firmware update"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Firmware update queued", "job_id": job.ID, "job": job})
+}
+
+func apiFirmwareOutdated(c *fiber.Ctx) (err error) {
+	var records []db.OutdatedFirmware
+
+	if records, err = db.OutdatedFirmwareList(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if records == nil {
+		records = make([]db.OutdatedFirmware, 0)
+	}
+
+	return c.JSON(records)
+}
+
+// apiFirmwareImage serves package images to BMCs performing a SimpleUpdate. It is not behind a login, BMCs
+// can't authenticate against it, the download token in the URL is unique per package instead.
+func apiFirmwareImage(c *fiber.Ctx) (err error) {
+	var pkg *db.FirmwarePackage
+
+	if pkg, err = db.FirmwarePackageByToken(c.Params("token")); errors.Is(err, db.ErrFirmwarePackageNotFound) {
+		return c.SendStatus(fiber.StatusNotFound)
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.Download(pkg.FilePath, pkg.FileName)
+}
+
+// Booking API
+
+// paramBookingID parses the :booking_id route parameter.
+func paramBookingID(c *fiber.Ctx) (bookingID int, err error) {
+	var bookingID64 int64
+	if bookingID64, err = strconv.ParseInt(c.Params("booking_id"), 10, 32); err == nil {
+		bookingID = int(bookingID64)
+	}
+
+	return
+}
+
+// bookingPermissionLevel resolves the caller's permission on a booking. Administrators act as owners.
+func bookingPermissionLevel(user *auth.AuthUser, bookingID int) (level db.BookingPermissionLevel, err error) {
+	if user.Permissions() >= auth.AuthPermsAdministrator {
+		level = db.BookingPermissionLevelOwner
+		return
+	}
+
+	level, err = db.BookingPermissionFor(bookingID, user.Username)
+	return
+}
+
+func apiBookingCreate(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			Name        string    `json:"name"`
+			Description string    `json:"description"`
+			Duration    int       `json:"duration_days"`
+			StartTime   time.Time `json:"start_time"`
+			EndTime     time.Time `json:"end_time"`
+		}
+		newBooking db.Booking
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	if len(body.Name) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "name is required"})
+	}
+
+	now := time.Now()
+	if err = db.ValidateBookingWindow(body.StartTime, body.EndTime, now); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	newBooking = db.Booking{
+		Name:        body.Name,
+		Description: body.Description,
+		Status:      db.BookingStatusActive,
+		StartTime:   now,
+		EndTime:     body.EndTime,
+	}
+
+	// Bookings starting later hold their hosts as reservations until the activator starts them
+	if body.StartTime.After(now) {
+		newBooking.Status = db.BookingStatusScheduled
+		newBooking.StartTime = body.StartTime
+	}
+
+	if body.EndTime.IsZero() && body.Duration > 0 {
+		newBooking.EndTime = newBooking.StartTime.Add(time.Duration(body.Duration) * 24 * time.Hour)
+	}
+
+	if err = db.CheckBookingQuota(user.Username, user.Groups(), newBooking.StartTime, newBooking.EndTime); errors.Is(err, db.ErrQuotaExceeded) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if err = db.CreateBooking(&newBooking); errors.Is(err, db.ErrBookingNoNetwork) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "failed to create booking"})
+	}
+
+	owner := &db.BookingPerson{
+		Username:        user.Username,
+		BookingID:       newBooking.ID,
+		PermissionLevel: db.BookingPermissionLevelOwner,
+	}
+
+	if err = db.AddBookingPerson(owner); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "failed to set booking owner"})
+	}
+
+	newBooking.People = append(newBooking.People, owner.ID)
+
+	return c.JSON(newBooking)
+}
+
+// apiBookingList lists the bookings the caller is a member of, admins see every booking with ?all=1.
+func apiBookingList(c *fiber.Ctx) (err error) {
+	var (
+		bookings []*db.Booking
+		user     *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if c.Query("all") == "1" && user.Permissions() >= auth.AuthPermsAdministrator {
+		bookings, err = db.BookingList()
+	} else {
+		bookings, err = db.BookingsFor(user.Username)
+	}
+
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if bookings == nil {
+		bookings = make([]*db.Booking, 0)
+	}
+
+	return c.JSON(bookings)
+}
+
+// apiBookingDetails shows a booking with its people, hosts, containers, VMs and requests.
+func apiBookingDetails(c *fiber.Ctx) (err error) {
+	var (
+		user      *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID int
+		level     db.BookingPermissionLevel
+		details   *db.BookingDetails
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelViewer {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if details, err = db.BookingDetailsByID(bookingID); errors.Is(err, db.ErrBookingNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(details)
+}
+
+func apiBookingCartSnapshot(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		cart *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if cart, err = db.BookingCartSnapshot(user.Username); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "cart not found"})
+	}
+
+	return c.JSON(cart)
+}
+
+func apiBookingCartCounts(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if hosts, virtual, errCount := db.CartCounts(user.Username); errCount != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "cart not found"})
+	} else {
+		return c.JSON(fiber.Map{
+			"hosts":    hosts,
+			"virtual":  virtual,
+			"total":    hosts + virtual,
 			"has_cart": true,
 		})
 	}
 }
 
-func apiBookingCartAddHost(c *fiber.Ctx) (err error) {
+func apiBookingCartAddHost(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body db.BookingRequestHost
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	if len(body.ManagementIP) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "management_ip is required"})
+	}
+
+	if err = db.AddHostToCart(user.Username, user.Groups(), body); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, db.ErrHostAlreadyBooked) || errors.Is(err, db.ErrHostReserved) || errors.Is(err, db.ErrMaintenanceOverlap) || errors.Is(err, db.ErrHostFirmwareUpdating) || errors.Is(err, db.ErrHostInMaintenance) || errors.Is(err, db.ErrHostWiping) {
+			status = fiber.StatusConflict
+		} else if errors.Is(err, db.ErrHostRestricted) || errors.Is(err, db.ErrQuotaExceeded) {
+			status = fiber.StatusForbidden
+		} else if errors.Is(err, db.ErrCartNotFound) {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func apiBookingCartRemoveHost(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = db.RemoveHostFromCart(user.Username, c.Params("management_ip")); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// apiBookingCartWindow sets the window the cart's hosts are wanted for, an empty start time clears it.
+func apiBookingCartWindow(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			StartTime time.Time `json:"start_time"`
+			EndTime   time.Time `json:"end_time"`
+		}
+		cart *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	if err = db.SetBookingCartWindow(user.Username, body.StartTime, body.EndTime); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, db.ErrInvalidBookingWindow) {
+			status = fiber.StatusBadRequest
+		} else if errors.Is(err, db.ErrHostAlreadyBooked) || errors.Is(err, db.ErrHostReserved) || errors.Is(err, db.ErrMaintenanceOverlap) || errors.Is(err, db.ErrProxmoxCapacity) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if cart, err = db.BookingCartSnapshot(user.Username); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(cart)
+}
+
+// apiBookingCartTemplates lists the container templates and ISOs the cart's containers and VMs may use.
+func apiBookingCartTemplates(c *fiber.Ctx) (err error) {
+	var (
+		images []*db.StoredISOImage
+		isos   []string = make([]string, 0)
+	)
+
+	if images, err = db.AvailableISOImages(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	for _, image := range images {
+		isos = append(isos, image.Name)
+	}
+
+	slices.Sort(isos)
+
+	var templates []string = db.CartTemplates()
+	if templates == nil {
+		templates = make([]string, 0)
+	}
+
+	return c.JSON(fiber.Map{"templates": templates, "isos": isos})
+}
+
+// cartItemResponse answers a cart container or VM change with the cart, or maps its error to an HTTP status.
+func cartItemResponse(c *fiber.Ctx, cart *db.BookingCart, err error) error {
+	switch {
+	case err == nil:
+		return c.JSON(cart)
+	case errors.Is(err, db.ErrInvalidCartItem):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrCartItemNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrProxmoxCapacity):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// paramCartIndex parses the :index route parameter.
+func paramCartIndex(c *fiber.Ctx) (index int, err error) {
+	index, err = strconv.Atoi(c.Params("index"))
+	return
+}
+
+func apiBookingCartAddContainer(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body db.BookingRequestCT
+		cart *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	cart, err = db.AddContainerToCart(user.Username, body)
+	return cartItemResponse(c, cart, err)
+}
+
+func apiBookingCartUpdateContainer(c *fiber.Ctx) (err error) {
+	var (
+		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body  db.BookingRequestCT
+		index int
+		cart  *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if index, err = paramCartIndex(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid index"})
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	cart, err = db.UpdateCartContainer(user.Username, index, body)
+	return cartItemResponse(c, cart, err)
+}
+
+func apiBookingCartRemoveContainer(c *fiber.Ctx) (err error) {
+	var (
+		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		index int
+		cart  *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if index, err = paramCartIndex(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid index"})
+	}
+
+	cart, err = db.RemoveContainerFromCart(user.Username, index)
+	return cartItemResponse(c, cart, err)
+}
+
+func apiBookingCartAddVM(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body db.BookingRequestVM
+		cart *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	cart, err = db.AddVMToCart(user.Username, body)
+	return cartItemResponse(c, cart, err)
+}
+
+func apiBookingCartUpdateVM(c *fiber.Ctx) (err error) {
+	var (
+		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body  db.BookingRequestVM
+		index int
+		cart  *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if index, err = paramCartIndex(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid index"})
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	cart, err = db.UpdateCartVM(user.Username, index, body)
+	return cartItemResponse(c, cart, err)
+}
+
+func apiBookingCartRemoveVM(c *fiber.Ctx) (err error) {
+	var (
+		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		index int
+		cart  *db.BookingCart
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if index, err = paramCartIndex(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid index"})
+	}
+
+	cart, err = db.RemoveVMFromCart(user.Username, index)
+	return cartItemResponse(c, cart, err)
+}
+
+func apiBookingCartAvailableHosts(c *fiber.Ctx) (err error) {
+	var (
+		user    *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		hosts   []*db.Host
+		filter  db.HostFilter
+		options db.HostListOptions
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if filter, options, err = parseHostQuery(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid host filter"})
+	}
+
+	if hosts, err = db.AvailableHostsForCart(user.Username, user.Groups(), filter); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return sendHostPage(c, hosts, options)
+}
+
+func apiBookingCreateRequest(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			Justification string                `json:"justification"`
+			Containers    []db.BookingRequestCT `json:"containers"`
+			VMs           []db.BookingRequestVM `json:"vms"`
+		}
+		bookingID int
+		level     db.BookingPermissionLevel
+		request   *db.BookingRequest
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOwner {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	if request, err = db.BuildBookingRequestFromCart(user.Username, bookingID, body.Justification, user.Username, user.Groups(), body.Containers, body.VMs); err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, db.ErrCartNotFound) || errors.Is(err, db.ErrBookingNotFound) {
+			status = fiber.StatusNotFound
+		} else if errors.Is(err, db.ErrInvalidCartItem) {
+			status = fiber.StatusBadRequest
+		} else if errors.Is(err, db.ErrQuotaExceeded) {
+			status = fiber.StatusForbidden
+		} else if errors.Is(err, db.ErrMaintenanceOverlap) || errors.Is(err, db.ErrHostAlreadyBooked) || errors.Is(err, db.ErrHostReserved) || errors.Is(err, db.ErrProxmoxCapacity) || errors.Is(err, db.ErrBookingEnded) {
+			status = fiber.StatusConflict
+		}
+		return c.Status(status).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if err = db.AddBookingRequest(request); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "failed to add booking request"})
+	}
+
+	db.ResetBookingCart(user.Username)
+	return c.JSON(request)
+}
+
+func apiBookingPowerControl(c *fiber.Ctx) (err error) {
+	var (
+		user           *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID      int
+		booking        *db.Booking
+		level          db.BookingPermissionLevel
+		powerActionInt int64
+		powerAction    db.PowerAction
+		job            *db.Job
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if booking, err = db.BookingByID(bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if booking == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": db.ErrBookingNotFound.Error()})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOperator {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if powerActionInt, err = strconv.ParseInt(c.Params("action"), 0, 16); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid power action"})
+	}
+
+	powerAction = db.PowerAction(powerActionInt)
+	if _, err = db.PowerActionTargetState(powerAction); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Unsupported power action"})
+	}
+
+	if job, err = db.EnqueueJob(db.JobKindBulkPower, fmt.Sprintf("booking:%d", bookingID), user.Username, func(handle *db.JobHandle) error {
+		outcomes, err := db.BookingPowerAction(bookingID, powerAction, handle.Progress)
+		if err != nil {
+			return err
+		}
+
+		return handle.SetResult(outcomes)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to queue power action"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Power action queued", "job_id": job.ID, "job": job})
+}
+
+func apiBookingNotices(c *fiber.Ctx) (err error) {
+	var (
+		user      *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID int
+		level     db.BookingPermissionLevel
+		notices   []*db.BookingNotice
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelViewer {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if notices, err = db.BookingNoticesForBooking(bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if notices == nil {
+		notices = make([]*db.BookingNotice, 0)
+	}
+
+	return c.JSON(notices)
+}
+
+// apiBookingRequests lists the requests of a booking along with their review and fulfillment.
+func apiBookingRequests(c *fiber.Ctx) (err error) {
+	var (
+		user      *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID int
+		level     db.BookingPermissionLevel
+		requests  []*db.BookingRequest
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelViewer {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if requests, err = db.BookingRequestsForBooking(bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if requests == nil {
+		requests = make([]*db.BookingRequest, 0)
+	}
+
+	return c.JSON(requests)
+}
+
+// extensionError maps booking extension errors to an HTTP status.
+func extensionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ErrBookingNotFound), errors.Is(err, db.ErrBookingExtensionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrBookingEnded), errors.Is(err, db.ErrBookingNoEndTime), errors.Is(err, db.ErrBookingExtensionPending), errors.Is(err, db.ErrBookingExtensionReviewed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// apiBookingExtend asks to extend a booking. Extensions within the configured limits are applied right away, the
+// others are accepted for review.
+func apiBookingExtend(c *fiber.Ctx) (err error) {
 	var (
 		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
-		body db.BookingRequestHost
+		body struct {
+			Days          int    `json:"days"`
+			Justification string `json:"justification"`
+		}
+		bookingID int
+		level     db.BookingPermissionLevel
+		extension *db.BookingExtension
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOwner {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
 	if err = c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	} else if body.Days < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "days must be at least 1"})
 	}
 
-	if len(body.ManagementIP) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "management_ip is required"})
+	if extension, err = db.RequestBookingExtension(bookingID, body.Days, strings.TrimSpace(body.Justification), user.Username, user.Groups()); err != nil {
+		return extensionError(c, err)
 	}
 
-	if err = db.AddHostToCart(user.Username, body); err != nil {
-		status := fiber.StatusInternalServerError
-		if errors.Is(err, db.ErrHostAlreadyBooked) {
-			status = fiber.StatusConflict
-		} else if errors.Is(err, db.ErrCartNotFound) {
-			status = fiber.StatusNotFound
-		}
-		return c.Status(status).JSON(fiber.Map{"message": err.Error()})
+	if !extension.AutoApproved {
+		return c.Status(fiber.StatusAccepted).JSON(extension)
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.JSON(extension)
 }
 
-func apiBookingCartRemoveHost(c *fiber.Ctx) (err error) {
+// apiBookingExtensions lists the extensions asked for a booking, the approved ones are the history of its end time.
+func apiBookingExtensions(c *fiber.Ctx) (err error) {
 	var (
-		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		user       *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID  int
+		level      db.BookingPermissionLevel
+		extensions []*db.BookingExtension
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	db.RemoveHostFromCart(user.Username, c.Params("management_ip"))
-	return c.SendStatus(fiber.StatusOK)
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelViewer {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if extensions, err = db.BookingExtensionsForBooking(bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if extensions == nil {
+		extensions = make([]*db.BookingExtension, 0)
+	}
+
+	return c.JSON(extensions)
 }
 
-func apiBookingCartAvailableHosts(c *fiber.Ctx) (err error) {
+// membershipError maps booking membership errors to an HTTP status.
+func membershipError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ErrBookingNotFound), errors.Is(err, db.ErrBookingPersonNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrInvalidBookingPermission):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrBookingPersonExists), errors.Is(err, db.ErrBookingNeedsOwner):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// apiBookingPeople lists the members of a booking and their levels.
+func apiBookingPeople(c *fiber.Ctx) (err error) {
 	var (
-		user  *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
-		hosts []*db.Host
+		user      *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID int
+		level     db.BookingPermissionLevel
+		people    []*db.BookingPerson
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if hosts, err = db.AvailableHostsForCart(user.Username); err != nil {
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelViewer {
+		return c.SendStatus(fiber.StatusForbidden)
 	}
 
-	return c.JSON(hosts)
+	if people, err = db.BookingPeopleForBooking(bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if people == nil {
+		people = make([]*db.BookingPerson, 0)
+	}
+
+	return c.JSON(people)
 }
 
-func apiBookingCreateRequest(c *fiber.Ctx) (err error) {
+// apiBookingInvite adds a user to a booking, the username has to exist in the directory.
+func apiBookingInvite(c *fiber.Ctx) (err error) {
 	var (
 		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
 		body struct {
-			Justification string                `json:"justification"`
-			Containers    []db.BookingRequestCT `json:"containers"`
-			VMs           []db.BookingRequestVM `json:"vms"`
+			Username        string                    `json:"username"`
+			PermissionLevel db.BookingPermissionLevel `json:"permission_level"`
 		}
 		bookingID int
-		request   *db.BookingRequest
+		level     db.BookingPermissionLevel
+		exists    bool
+		person    *db.BookingPerson
 	)
 
 	if user == nil {
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if bookingID64, errConv := strconv.ParseInt(c.Params("booking_id"), 10, 32); errConv != nil {
+	if bookingID, err = paramBookingID(c); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
-	} else {
-		bookingID = int(bookingID64)
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOwner {
+		return c.SendStatus(fiber.StatusForbidden)
 	}
 
 	if err = c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
 	}
 
-	if request, err = db.BuildBookingRequestFromCart(user.Username, bookingID, body.Justification, user.Username, body.Containers, body.VMs); err != nil {
-		status := fiber.StatusInternalServerError
-		if errors.Is(err, db.ErrCartNotFound) {
-			status = fiber.StatusNotFound
+	if body.Username = strings.TrimSpace(body.Username); body.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "username is required"})
+	}
+
+	if exists, err = auth.UserExists(body.Username); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "failed to look up user"})
+	} else if !exists {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": fmt.Sprintf("user %s not found", body.Username)})
+	}
+
+	if person, err = db.InviteBookingPerson(bookingID, body.Username, body.PermissionLevel); err != nil {
+		return membershipError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(person)
+}
+
+// apiBookingPersonUpdate changes the level of a booking member.
+func apiBookingPersonUpdate(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			PermissionLevel db.BookingPermissionLevel `json:"permission_level"`
 		}
-		return c.Status(status).JSON(fiber.Map{"message": err.Error()})
+		bookingID int
+		level     db.BookingPermissionLevel
+		person    *db.BookingPerson
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if err = db.AddBookingRequest(request); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "failed to add booking request"})
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOwner {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if err = c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+	}
+
+	if person, err = db.SetBookingPersonLevel(bookingID, c.Params("username"), body.PermissionLevel); err != nil {
+		return membershipError(c, err)
+	}
+
+	return c.JSON(person)
+}
+
+// apiBookingPersonRemove removes a member from a booking.
+func apiBookingPersonRemove(c *fiber.Ctx) (err error) {
+	var (
+		user      *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID int
+		level     db.BookingPermissionLevel
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOwner {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if err = db.RemoveBookingMember(bookingID, c.Params("username")); err != nil {
+		return membershipError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"message": "Member removed"})
+}
+
+// apiBookingRelease ends a booking early, releasing its hosts, containers and VMs.
+func apiBookingRelease(c *fiber.Ctx) (err error) {
+	var (
+		user      *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		bookingID int
+		level     db.BookingPermissionLevel
+		job       *db.Job
+	)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if bookingID, err = paramBookingID(c); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid booking id"})
+	}
+
+	if level, err = bookingPermissionLevel(user, bookingID); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if level < db.BookingPermissionLevelOwner {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if job, err = db.ReleaseBooking(bookingID, user.Username); errors.Is(err, db.ErrBookingNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	} else if errors.Is(err, db.ErrBookingEnded) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	} else if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	} else if job == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": db.ErrBookingEnded.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Booking release queued", "job_id": job.ID, "job": job})
+}
+
+// Calendar API
+
+// apiCalendar shows what takes each host between from and to, RFC 3339 times defaulting to the coming week.
+func apiCalendar(c *fiber.Ctx) (err error) {
+	var (
+		from     time.Time = time.Now()
+		to       time.Time
+		calendar *db.Calendar
+	)
+
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid from time"})
+		}
+	}
+
+	to = from.Add(7 * 24 * time.Hour)
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid to time"})
+		}
+	}
+
+	if !to.After(from) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "to must come after from"})
+	}
+
+	if calendar, err = db.BookingCalendar(from, to); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(calendar)
+}
+
+// Review API
+
+// reviewError maps booking request review errors to an HTTP status.
+func reviewError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, db.ErrBookingRequestNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrQuotaExceeded):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, db.ErrBookingRequestReviewed), errors.Is(err, db.ErrHostAlreadyBooked), errors.Is(err, db.ErrHostReserved),
+		errors.Is(err, db.ErrMaintenanceOverlap), errors.Is(err, db.ErrProxmoxCapacity):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+	default:
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// apiReviewQueue lists the booking requests awaiting review, oldest first.
+func apiReviewQueue(c *fiber.Ctx) (err error) {
+	var requests []*db.BookingRequest
+
+	if requests, err = db.PendingBookingRequests(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if requests == nil {
+		requests = make([]*db.BookingRequest, 0)
+	}
+
+	return c.JSON(requests)
+}
+
+func apiReviewRequest(c *fiber.Ctx) (err error) {
+	var (
+		requestID int
+		request   *db.BookingRequest
+	)
+
+	if requestID, err = c.ParamsInt("request_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid request id"})
+	}
+
+	if request, err = db.BookingRequestByID(requestID); err != nil {
+		return reviewError(c, err)
+	}
+
+	return c.JSON(request)
+}
+
+// apiReviewApprove approves a request and queues its fulfillment, or reserves its hosts when the booking has yet to
+// start.
+func apiReviewApprove(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			Comment string `json:"comment"`
+		}
+		requestID int
+		request   *db.BookingRequest
+		job       *db.Job
+	)
+
+	if requestID, err = c.ParamsInt("request_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid request id"})
+	}
+
+	if len(c.Body()) > 0 {
+		if err = c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+		}
+	}
+
+	if request, job, err = db.ApproveBookingRequest(requestID, user.Username, body.Comment); err != nil {
+		return reviewError(c, err)
+	}
+
+	if job == nil {
+		return c.JSON(fiber.Map{"message": "Booking request approved, its hosts are reserved until the booking starts", "request": request})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "Booking request approved", "job_id": job.ID, "job": job, "request": request})
+}
+
+// apiReviewReject rejects a request, a comment explaining why is required.
+func apiReviewReject(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			Comment string `json:"comment"`
+		}
+		requestID int
+		request   *db.BookingRequest
+	)
+
+	if requestID, err = c.ParamsInt("request_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid request id"})
+	}
+
+	if err = c.BodyParser(&body); err != nil || strings.TrimSpace(body.Comment) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "a comment is required to reject a request"})
+	}
+
+	if request, err = db.RejectBookingRequest(requestID, user.Username, strings.TrimSpace(body.Comment)); err != nil {
+		return reviewError(c, err)
 	}
 
-	db.ResetBookingCart(user.Username)
 	return c.JSON(request)
 }
+
+// apiReviewExtensions lists the booking extensions awaiting review, oldest first.
+func apiReviewExtensions(c *fiber.Ctx) (err error) {
+	var extensions []*db.BookingExtension
+
+	if extensions, err = db.PendingBookingExtensions(); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if extensions == nil {
+		extensions = make([]*db.BookingExtension, 0)
+	}
+
+	return c.JSON(extensions)
+}
+
+// apiReviewExtensionApprove approves an extension and moves the booking's end time.
+func apiReviewExtensionApprove(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			Comment string `json:"comment"`
+		}
+		extensionID int
+		extension   *db.BookingExtension
+	)
+
+	if extensionID, err = c.ParamsInt("extension_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid extension id"})
+	}
+
+	if len(c.Body()) > 0 {
+		if err = c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid body"})
+		}
+	}
+
+	if extension, err = db.ApproveBookingExtension(extensionID, user.Username, body.Comment); err != nil {
+		return extensionError(c, err)
+	}
+
+	return c.JSON(extension)
+}
+
+// apiReviewExtensionReject rejects an extension, a comment explaining why is required.
+func apiReviewExtensionReject(c *fiber.Ctx) (err error) {
+	var (
+		user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+		body struct {
+			Comment string `json:"comment"`
+		}
+		extensionID int
+		extension   *db.BookingExtension
+	)
+
+	if extensionID, err = c.ParamsInt("extension_id"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "invalid extension id"})
+	}
+
+	if err = c.BodyParser(&body); err != nil || strings.TrimSpace(body.Comment) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "a comment is required to reject an extension"})
+	}
+
+	if extension, err = db.RejectBookingExtension(extensionID, user.Username, strings.TrimSpace(body.Comment)); err != nil {
+		return extensionError(c, err)
+	}
+
+	return c.JSON(extension)
+}
@@ -31,6 +31,7 @@ func CreateApp() (app *fiber.App) {
 	// Auth API
 	app.Post("/api/auth/login", apiLogin)
 	app.Get("/api/auth/me", apiMustBeLoggedIn, apiAuthMe)
+	app.Get("/api/auth/me/quota", apiMustBeLoggedIn, apiAuthMeQuota)
 	app.Post("/api/auth/logout", apiMustBeLoggedIn, apiLogout)
 
 	// Enums API
@@ -46,27 +47,134 @@ func CreateApp() (app *fiber.App) {
 	app.Get("/api/enums/booking-permission-levels", apiEnumsBookingPermissionLevelNames)
 	app.Get("/api/enums/booking-statuses", apiEnumsBookingStatusNames)
 	app.Get("/api/enums/booking-request-statuses", apiEnumsBookingRequestStatusNames)
+	app.Get("/api/enums/job-kinds", apiEnumsJobKindNames)
+	app.Get("/api/enums/job-statuses", apiEnumsJobStatusNames)
+	app.Get("/api/enums/firmware-categories", apiEnumsFirmwareCategoryNames)
+	app.Get("/api/enums/firmware-update-methods", apiEnumsFirmwareUpdateMethodNames)
+	app.Get("/api/enums/booking-notice-kinds", apiEnumsBookingNoticeKindNames)
+	app.Get("/api/enums/wipe-methods", apiEnumsWipeMethodNames)
+	app.Get("/api/enums/wipe-statuses", apiEnumsWipeStatusNames)
 
 	// Hosts API
 	app.Get("/api/hosts", apiHostsAll)
+	app.Get("/api/hosts/archived", apiMustBeLoggedIn, apiMustBeAdmin, apiHostsArchived)
 	app.Get("/api/hosts/:management_ip", apiHostByManagementIP)
+	app.Get("/api/hosts/by-mac/:mac_address", apiHostByMACAddress)
 	app.Post("/api/hosts", apiMustBeLoggedIn, apiMustBeAdmin, apiHostCreate)
+	app.Post("/api/hosts/discover", apiMustBeLoggedIn, apiMustBeAdmin, apiHostsDiscover)
+	app.Post("/api/hosts/discover/accept", apiMustBeLoggedIn, apiMustBeAdmin, apiHostsDiscoverAccept)
+	app.Post("/api/hosts/power", apiMustBeLoggedIn, apiMustBeAdmin, apiHostsBulkPower)
 	app.Delete("/api/hosts/:management_ip", apiMustBeLoggedIn, apiMustBeAdmin, apiHostDelete)
 	app.Post("/api/hosts/:management_ip/power/:action", apiMustBeLoggedIn, apiMustBeAdmin, apiHostPowerControl)
+	app.Get("/api/hosts/:management_ip/events", apiMustBeLoggedIn, apiMustBeAdmin, apiHostEvents)
+	app.Post("/api/hosts/:management_ip/bmc/retry", apiMustBeLoggedIn, apiMustBeAdmin, apiHostBMCRetry)
+	app.Get("/api/hosts/:management_ip/firmware", apiMustBeLoggedIn, apiMustBeAdmin, apiHostFirmware)
+	app.Post("/api/hosts/:management_ip/firmware/refresh", apiMustBeLoggedIn, apiMustBeAdmin, apiHostFirmwareRefresh)
+	app.Post("/api/hosts/:management_ip/specs/refresh", apiMustBeLoggedIn, apiMustBeAdmin, apiHostSpecsRefresh)
+	app.Put("/api/hosts/:management_ip/provisioning-nic", apiMustBeLoggedIn, apiMustBeAdmin, apiHostSetProvisioningNIC)
+	app.Put("/api/hosts/:management_ip/tags", apiMustBeLoggedIn, apiMustBeAdmin, apiHostSetTags)
+	app.Post("/api/hosts/:management_ip/tags/:tag", apiMustBeLoggedIn, apiMustBeAdmin, apiHostAddTag)
+	app.Delete("/api/hosts/:management_ip/tags/:tag", apiMustBeLoggedIn, apiMustBeAdmin, apiHostRemoveTag)
+	app.Put("/api/hosts/:management_ip/location", apiMustBeLoggedIn, apiMustBeAdmin, apiHostSetLocation)
+	app.Get("/api/hosts/:management_ip/maintenance", apiMustBeLoggedIn, apiMustBeAdmin, apiHostMaintenanceList)
+	app.Post("/api/hosts/:management_ip/maintenance", apiMustBeLoggedIn, apiMustBeAdmin, apiHostMaintenanceSchedule)
+	app.Post("/api/hosts/:management_ip/wipe", apiMustBeLoggedIn, apiMustBeAdmin, apiHostWipe)
+	app.Get("/api/hosts/:management_ip/wipes", apiMustBeLoggedIn, apiMustBeAdmin, apiHostWipeHistory)
+	app.Get("/api/hosts/:management_ip/bios/profile", apiMustBeLoggedIn, apiMustBeAdmin, apiHostBIOSProfile)
+	app.Post("/api/hosts/:management_ip/bios/profile", apiMustBeLoggedIn, apiMustBeAdmin, apiHostBIOSProfileCapture)
+
+	app.Get("/api/maintenance", apiMustBeLoggedIn, apiMustBeAdmin, apiMaintenanceUpcoming)
+	app.Delete("/api/maintenance/:window_id", apiMustBeLoggedIn, apiMustBeAdmin, apiMaintenanceEnd)
+
+	app.Get("/api/racks", apiMustBeLoggedIn, apiRacks)
+	app.Get("/api/tags", apiMustBeLoggedIn, apiTagsList)
+	app.Get("/api/tags/restrictions", apiMustBeLoggedIn, apiMustBeAdmin, apiTagRestrictionsList)
+	app.Put("/api/tags/restrictions/:tag", apiMustBeLoggedIn, apiMustBeAdmin, apiTagRestrictionSet)
+	app.Delete("/api/tags/restrictions/:tag", apiMustBeLoggedIn, apiMustBeAdmin, apiTagRestrictionDelete)
+
+	// Quota API
+	app.Get("/api/quotas", apiMustBeLoggedIn, apiMustBeAdmin, apiQuotaPoliciesList)
+	app.Put("/api/quotas/:scope/:subject", apiMustBeLoggedIn, apiMustBeAdmin, apiQuotaPolicySet)
+	app.Delete("/api/quotas/:scope/:subject", apiMustBeLoggedIn, apiMustBeAdmin, apiQuotaPolicyDelete)
+
+	app.Get("/api/management/pool", apiMustBeLoggedIn, apiMustBeAdmin, apiManagementPool)
+
+	// BMC event listener, authenticated by the per-host event context
+	app.Post("/api/events/redfish", apiRedfishEventListener)
+
+	// Firmware API
+	app.Get("/api/firmware/packages", apiMustBeLoggedIn, apiMustBeAdmin, apiFirmwarePackagesList)
+	app.Post("/api/firmware/packages", apiMustBeLoggedIn, apiMustBeAdmin, apiFirmwarePackageCreate)
+	app.Delete("/api/firmware/packages/:package_id", apiMustBeLoggedIn, apiMustBeAdmin, apiFirmwarePackageDelete)
+	app.Post("/api/firmware/packages/:package_id/apply", apiMustBeLoggedIn, apiMustBeAdmin, apiFirmwarePackageApply)
+	app.Get("/api/firmware/outdated", apiMustBeLoggedIn, apiMustBeAdmin, apiFirmwareOutdated)
+
+	// Package downloads for BMCs, authenticated by the per-package token
+	app.Get("/api/firmware/images/:token/:filename", apiFirmwareImage)
+
+	// Wipe image endpoints, only served to the address that fetched the boot script from a wipe image network. The
+	// boot script is looked up by MAC like by-mac.
+	app.Get("/api/wipe/boot/:mac_address", apiWipeBootScript)
+	app.Get("/api/wipe/:token/plan", apiWipePlan)
+	app.Post("/api/wipe/:token/report", apiWipeReport)
+
+	// Power policy API
+	app.Get("/api/power/schedules", apiMustBeLoggedIn, apiMustBeAdmin, apiPowerSchedulesList)
+	app.Post("/api/power/schedules", apiMustBeLoggedIn, apiMustBeAdmin, apiPowerScheduleCreate)
+	app.Put("/api/power/schedules/:schedule_id", apiMustBeLoggedIn, apiMustBeAdmin, apiPowerScheduleUpdate)
+	app.Delete("/api/power/schedules/:schedule_id", apiMustBeLoggedIn, apiMustBeAdmin, apiPowerScheduleDelete)
+	app.Get("/api/power/history", apiMustBeLoggedIn, apiMustBeAdmin, apiPowerPolicyHistory)
+
+	// Jobs API
+	app.Get("/api/jobs", apiMustBeLoggedIn, apiJobsList)
+	app.Get("/api/jobs/:id", apiMustBeLoggedIn, apiJobByID)
 
 	// ISO Images API
 	app.Post("/api/iso-images", apiMustBeLoggedIn, apiMustBeAdmin, apiISOImagesCreate)
 	app.Get("/api/iso-images", apiMustBeLoggedIn, apiMustBeAdmin, apiISOImagesList)
 
 	// Booking API
-	app.Post("/api/bookings", apiMustBeLoggedIn, apiBookingCreate)
+	app.Post("/api/bookings", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCreate)
 	app.Get("/api/bookings", apiMustBeLoggedIn, apiBookingList)
-	app.Post("/api/bookings/:booking_id/requests", apiMustBeLoggedIn, apiBookingCreateRequest)
-	app.Get("/api/bookings/cart", apiMustBeLoggedIn, apiBookingCartSnapshot)
-	app.Post("/api/bookings/cart/hosts", apiMustBeLoggedIn, apiBookingCartAddHost)
-	app.Delete("/api/bookings/cart/hosts/:management_ip", apiMustBeLoggedIn, apiBookingCartRemoveHost)
-	app.Get("/api/bookings/cart/counts", apiMustBeLoggedIn, apiBookingCartCounts)
-	app.Get("/api/bookings/cart/hosts/available", apiMustBeLoggedIn, apiBookingCartAvailableHosts)
+	app.Post("/api/bookings/:booking_id/requests", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCreateRequest)
+	app.Post("/api/bookings/:booking_id/power/:action", apiMustBeLoggedIn, apiBookingPowerControl)
+	app.Get("/api/bookings/:booking_id/requests", apiMustBeLoggedIn, apiBookingRequests)
+	app.Post("/api/bookings/:booking_id/extend", apiMustBeLoggedIn, apiBookingExtend)
+	app.Get("/api/bookings/:booking_id/extensions", apiMustBeLoggedIn, apiBookingExtensions)
+	app.Get("/api/bookings/:booking_id/notices", apiMustBeLoggedIn, apiBookingNotices)
+	app.Post("/api/bookings/:booking_id/release", apiMustBeLoggedIn, apiBookingRelease)
+	app.Get("/api/bookings/:booking_id/people", apiMustBeLoggedIn, apiBookingPeople)
+	app.Post("/api/bookings/:booking_id/people", apiMustBeLoggedIn, apiBookingInvite)
+	app.Put("/api/bookings/:booking_id/people/:username", apiMustBeLoggedIn, apiBookingPersonUpdate)
+	app.Delete("/api/bookings/:booking_id/people/:username", apiMustBeLoggedIn, apiBookingPersonRemove)
+	app.Get("/api/bookings/cart", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartSnapshot)
+	app.Post("/api/bookings/cart/hosts", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartAddHost)
+	app.Delete("/api/bookings/cart/hosts/:management_ip", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartRemoveHost)
+	app.Get("/api/bookings/cart/counts", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartCounts)
+	app.Get("/api/bookings/cart/hosts/available", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartAvailableHosts)
+	app.Put("/api/bookings/cart/window", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartWindow)
+	app.Get("/api/bookings/cart/templates", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartTemplates)
+	app.Post("/api/bookings/cart/containers", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartAddContainer)
+	app.Put("/api/bookings/cart/containers/:index", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartUpdateContainer)
+	app.Delete("/api/bookings/cart/containers/:index", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartRemoveContainer)
+	app.Post("/api/bookings/cart/vms", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartAddVM)
+	app.Put("/api/bookings/cart/vms/:index", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartUpdateVM)
+	app.Delete("/api/bookings/cart/vms/:index", apiMustBeLoggedIn, apiMustBeBookingCreator, apiBookingCartRemoveVM)
+
+	// Registered after the cart routes so /api/bookings/cart is not taken for a booking ID
+	app.Get("/api/bookings/:booking_id", apiMustBeLoggedIn, apiBookingDetails)
+
+	// Calendar API
+	app.Get("/api/calendar", apiMustBeLoggedIn, apiCalendar)
+
+	// Review API
+	app.Get("/api/review/requests", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewQueue)
+	app.Get("/api/review/requests/:request_id", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewRequest)
+	app.Post("/api/review/requests/:request_id/approve", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewApprove)
+	app.Post("/api/review/requests/:request_id/reject", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewReject)
+	app.Get("/api/review/extensions", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewExtensions)
+	app.Post("/api/review/extensions/:extension_id/approve", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewExtensionApprove)
+	app.Post("/api/review/extensions/:extension_id/reject", apiMustBeLoggedIn, apiMustBeAdmin, apiReviewExtensionReject)
 
 	return
 }
@@ -45,6 +45,16 @@ func apiMustBeAdmin(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+func apiMustBeBookingCreator(c *fiber.Ctx) error {
+	var user *auth.AuthUser = auth.IsAuthenticated(c, jwtSigningKey)
+
+	if user == nil || user.Permissions() < auth.AuthPermsBookingCreator {
+		return c.SendStatus(403)
+	}
+
+	return c.Next()
+}
+
 func routesMustBeLoggedIn(c *fiber.Ctx) error {
 	if auth.IsAuthenticated(c, jwtSigningKey) == nil {
 		return c.Redirect("/login")
@@ -16,15 +16,18 @@ import (
 type authPerms uint8
 
 const (
-	AuthPermsNone          authPerms = iota // No permissions, cannot log in
-	AuthPermsUser                           // Can view but not edit
-	AuthPermsAdministrator                  // Can do everything
+	AuthPermsNone           authPerms = iota // No permissions, cannot log in
+	AuthPermsUser                            // Can view but not edit
+	AuthPermsBookingCreator                  // Can also create bookings, fill a cart and submit booking requests
+	AuthPermsAdministrator                   // Can do everything
 )
 
 func (p authPerms) String() string {
 	switch p {
 	case AuthPermsAdministrator:
 		return "administrator"
+	case AuthPermsBookingCreator:
+		return "booking creator"
 	case AuthPermsUser:
 		return "user"
 	default:
@@ -38,8 +41,23 @@ type AuthUser struct {
 	Expiry   time.Time
 	Username string
 	perms    authPerms
+	groups   []string
 }
 
+// Groups returns the directory groups the user belongs to. They are looked up once per login.
+func (user *AuthUser) Groups() []string {
+	if user.groups != nil || user.LDAPConn == nil {
+		return user.groups
+	}
+
+	if groups, err := user.LDAPConn.Groups(); err == nil {
+		user.groups = append(make([]string, 0, len(groups)), groups...)
+	}
+
+	return user.groups
+}
+
+// Permissions resolves the user's tier from the first of the admin, booking creator and user groups they belong to.
 func (user *AuthUser) Permissions() authPerms {
 	if user.perms != AuthPermsNone {
 		return user.perms
@@ -59,6 +77,13 @@ func (user *AuthUser) Permissions() authPerms {
 			}
 		}
 
+		for _, gName := range config.Config.LDAP.CreateBookingGroups {
+			if slices.Contains(groups, gName) {
+				user.perms = AuthPermsBookingCreator
+				return user.perms
+			}
+		}
+
 		for _, gName := range config.Config.LDAP.UserGroups {
 			if slices.Contains(groups, gName) {
 				user.perms = AuthPermsUser
@@ -175,6 +200,9 @@ func IsAuthenticated(r *fiber.Ctx, jwtSecret []byte) *AuthUser {
 }
 
 func Authenticate(username, password string) (*AuthUser, error) {
+	// Callers may pass strings backed by reused request buffers, the username is kept as a session key
+	username = strings.Clone(username)
+
 	if injection := GetUserInjection(username, password); injection != nil {
 		user := &AuthUser{
 			LDAPConn: nil,
@@ -182,6 +210,7 @@ func Authenticate(username, password string) (*AuthUser, error) {
 			Expiry:   time.Now().Add(time.Hour),
 			Username: username,
 			perms:    injection.Permissions,
+			groups:   append(make([]string, 0, len(injection.Groups)), injection.Groups...),
 		}
 
 		usersLock.Lock()
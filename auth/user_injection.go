@@ -1,23 +1,34 @@
 package auth
 
-import "github.com/z46-dev/go-logger"
+import (
+	"sync"
+
+	"github.com/z46-dev/go-logger"
+)
 
 // WARNING: User injection should never be done in prod. This lets you inject credentials of "username:password:permission level" into the system for testing ONLY.
 type UserInjection struct {
 	Username    string
 	Password    string
 	Permissions authPerms
+	Groups      []string
 }
 
-var userInjections map[string]*UserInjection = make(map[string]*UserInjection)
+var (
+	userInjections     map[string]*UserInjection = make(map[string]*UserInjection)
+	userInjectionsLock sync.RWMutex
+)
 
 // WARNING: User injection should never be done in prod. This lets you inject credentials of "username:password:permission level" into the system for testing ONLY.
-func AddUserInjection(username, password string, perms authPerms) {
+func AddUserInjection(username, password string, perms authPerms, groups ...string) {
+	userInjectionsLock.Lock()
 	userInjections[username] = &UserInjection{
 		Username:    username,
 		Password:    password,
 		Permissions: perms,
+		Groups:      groups,
 	}
+	userInjectionsLock.Unlock()
 
 	var ueLog *logger.Logger = logger.NewLogger().SetPrefix("[WARNING: UNSAFE USER INJECTION]", logger.BoldRed).IncludeTimestamp()
 	ueLog.Warningf("User injection added for username '%s' with permissions level %d. DO NOT USE THIS IN PRODUCTION!\n", username, perms)
@@ -25,11 +36,17 @@ func AddUserInjection(username, password string, perms authPerms) {
 
 // WARNING: User injection should never be done in prod. This lets you inject credentials of "username:password:permission level" into the system for testing ONLY.
 func DeleteUserInjection(username string) {
+	userInjectionsLock.Lock()
+	defer userInjectionsLock.Unlock()
+
 	delete(userInjections, username)
 }
 
 // WARNING: User injection should never be done in prod. This lets you inject credentials of "username:password:permission level" into the system for testing ONLY.
 func GetUserInjection(username, password string) *UserInjection {
+	userInjectionsLock.RLock()
+	defer userInjectionsLock.RUnlock()
+
 	if injection, ok := userInjections[username]; ok {
 		if injection.Password == password {
 			return injection
@@ -38,3 +55,12 @@ func GetUserInjection(username, password string) *UserInjection {
 
 	return nil
 }
+
+// WARNING: User injection should never be done in prod. This lets you inject credentials of "username:password:permission level" into the system for testing ONLY.
+func HasUserInjection(username string) bool {
+	userInjectionsLock.RLock()
+	defer userInjectionsLock.RUnlock()
+
+	_, ok := userInjections[username]
+	return ok
+}
@@ -58,6 +58,27 @@ type Configuration struct {
 		TestingRunManagement     bool     `env:"MGMT_TESTING_RUN_MGMT,default=false"`
 		TestingRunLongManagement bool     `env:"MGMT_TESTING_RUN_LONG_MGMT,default=false"`
 		TestingLongManagementIP  string   `env:"MGMT_TESTING_LONG_MGMT_IP,default="`
+
+		DiscoveryWorkers   int `env:"MGMT_DISCOVERY_WORKERS,default=32"`
+		DiscoveryTimeoutMS int `env:"MGMT_DISCOVERY_TIMEOUT_MS,default=1500"`
+
+		// Accepted discovery candidates registered at once, each logs in to its BMC and pulls its specs
+		DiscoveryAcceptConcurrency int `env:"MGMT_DISCOVERY_ACCEPT_CONCURRENCY,default=8"`
+
+		BulkPowerConcurrency int `env:"MGMT_BULK_POWER_CONCURRENCY,default=8"`
+
+		// Public URL of /api/events/redfish that BMCs post events to, empty disables event subscriptions.
+		// Most BMCs (iDRAC included) only deliver to https destinations.
+		EventListenerURL   string `env:"MGMT_EVENT_LISTENER_URL,default="`
+		EventResyncMinutes int    `env:"MGMT_EVENT_RESYNC_MINUTES,default=60"`
+		EventRetentionDays int    `env:"MGMT_EVENT_RETENTION_DAYS,default=30"`
+
+		// Management sessions are pooled per BMC, older BMCs only have a handful of session slots
+		PoolMaxSessionsPerBMC int `env:"MGMT_POOL_MAX_SESSIONS_PER_BMC,default=2"`
+		PoolIdleSeconds       int `env:"MGMT_POOL_IDLE_SECONDS,default=120"`
+		PoolAcquireSeconds    int `env:"MGMT_POOL_ACQUIRE_SECONDS,default=180"`
+		BackoffBaseSeconds    int `env:"MGMT_BACKOFF_BASE_SECONDS,default=5"`
+		BackoffMaxSeconds     int `env:"MGMT_BACKOFF_MAX_SECONDS,default=600"`
 	}
 
 	Proxmox struct {
@@ -67,6 +88,23 @@ type Configuration struct {
 		TokenID string `env:"PROXMOX_API_TOKEN_ID,default=root@pam!laas-api-token"`
 		Secret  string `env:"PROXMOX_API_TOKEN_SECRET,default=supersecretproxmoxapitokensecret"`
 
+		// Where containers and VMs created for bookings live, and the resolver their containers use
+		Storage    string `env:"PROXMOX_STORAGE,default=local-lvm"`
+		ISOStorage string `env:"PROXMOX_ISO_STORAGE,default=local"`
+		DNS        string `env:"PROXMOX_DNS,default=1.1.1.1"`
+
+		// Container templates bookings may pick from, separated with "|" in the .env file
+		// (e.g. PROXMOX_CT_TEMPLATES=local:vztmpl/ubuntu-22.04-standard_22.04-1_amd64.tar.zst)
+		Templates []string `env:"PROXMOX_CT_TEMPLATES,default="`
+
+		// Network booking containers are addressed from, each booking is given its own block of BookingPrefix bits
+		BookingNetwork string `env:"PROXMOX_BOOKING_NETWORK,default=172.16.0.0/12"`
+		BookingPrefix  int    `env:"PROXMOX_BOOKING_PREFIX,default=24"`
+
+		// Cores and memory bookings may claim for containers and VMs at any one time, zero is unlimited
+		CapacityCores    int `env:"PROXMOX_CAPACITY_CORES,default=0"`
+		CapacityMemoryMB int `env:"PROXMOX_CAPACITY_MEMORY_MB,default=0"`
+
 		Testing struct {
 			Enabled        bool   `env:"PROXMOX_TESTING_ENABLED,default=false"`
 			Subnet         string `env:"PROXMOX_TESTING_SUBNET,default=10.255.255.0/24"`
@@ -78,6 +116,60 @@ type Configuration struct {
 		}
 	}
 
+	PowerPolicy struct {
+		// Automatic idle power-off and pre-start power-on. Admin defined schedules run regardless.
+		Enabled           bool `env:"POWER_POLICY_ENABLED,default=false"`
+		IdleOffMinutes    int  `env:"POWER_POLICY_IDLE_OFF_MINUTES,default=120"`
+		PreStartOnMinutes int  `env:"POWER_POLICY_PRESTART_ON_MINUTES,default=15"`
+	}
+
+	Firmware struct {
+		StorageDir string `env:"FIRMWARE_STORAGE_DIR,default=./firmware"`
+		// Public base URL of this server that BMCs download packages from for SimpleUpdate (e.g. https://laas.example.com).
+		// Empty limits updates to multipart push.
+		BaseURL               string `env:"FIRMWARE_BASE_URL,default="`
+		UpdateConcurrency     int    `env:"FIRMWARE_UPDATE_CONCURRENCY,default=4"`
+		TaskTimeoutMinutes    int    `env:"FIRMWARE_TASK_TIMEOUT_MINUTES,default=60"`
+		InventoryRefreshHours int    `env:"FIRMWARE_INVENTORY_REFRESH_HOURS,default=24"`
+	}
+
+	Wipe struct {
+		// Released hosts are PXE booted into the wipe image before returning to the pool. Disabled, they return immediately.
+		Enabled bool `env:"WIPE_ENABLED,default=false"`
+		// Public base URL of this server that the wipe image fetches its plan from and reports to (e.g. https://laas.example.com)
+		BaseURL        string `env:"WIPE_BASE_URL,default="`
+		KernelURL      string `env:"WIPE_KERNEL_URL,default="`
+		InitrdURL      string `env:"WIPE_INITRD_URL,default="`
+		TimeoutMinutes int    `env:"WIPE_TIMEOUT_MINUTES,default=240"`
+		// Networks hosts boot the wipe image from in CIDR notation, separated with "|" in the .env file (e.g. the
+		// provisioning network). The boot script is only served to these addresses.
+		ImageNetworks []string `env:"WIPE_IMAGE_NETWORKS,default="`
+	}
+
+	Expiry struct {
+		// Bookings past their end time are torn down once the grace period is over, releasing their hosts and
+		// deleting their containers and VMs.
+		Enabled bool `env:"BOOKING_EXPIRY_ENABLED,default=true"`
+		// Hours before the end time that bookings are warned at, separated with "|" in the .env file
+		WarningHours []int `env:"BOOKING_EXPIRY_WARNING_HOURS,default=72|24|1"`
+		GraceHours   int   `env:"BOOKING_EXPIRY_GRACE_HOURS,default=24"`
+	}
+
+	Extensions struct {
+		// Extensions keeping a booking within these limits are approved right away, the others wait for an admin
+		MaxTotalDays int `env:"BOOKING_EXTENSION_MAX_TOTAL_DAYS,default=90"`
+		MaxCount     int `env:"BOOKING_EXTENSION_MAX_COUNT,default=3"`
+	}
+
+	Carts struct {
+		// Carts hold their hosts until left untouched this long, zero keeps them until emptied or submitted
+		TTLMinutes int `env:"BOOKING_CART_TTL_MINUTES,default=120"`
+	}
+
+	Jobs struct {
+		MaxConcurrent int `env:"JOBS_MAX_CONCURRENT,default=16"`
+	}
+
 	JWT struct {
 		Secret string `env:"JWT_SECRET,required=true"`
 	}
@@ -1,14 +1,20 @@
 package db
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"maps"
+	"net"
 	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/ssh"
 	"github.com/z46-dev/gomysql"
 )
 
@@ -25,12 +31,31 @@ var (
 	ErrBookingNotFound   = errors.New("booking not found")
 	ErrHostAlreadyBooked = errors.New("host already booked or reserved")
 	ErrCartNotFound      = errors.New("cart not found")
+	ErrBookingEnded      = errors.New("booking has ended")
+	ErrCartItemNotFound  = errors.New("cart item not found")
+	ErrInvalidCartItem   = errors.New("invalid cart item")
+
+	ErrBookingPersonNotFound    = errors.New("user is not a member of the booking")
+	ErrBookingPersonExists      = errors.New("user is already a member of the booking")
+	ErrInvalidBookingPermission = errors.New("invalid booking permission level")
+	ErrBookingNeedsOwner        = errors.New("booking must keep at least one owner")
 )
 
 type BookingCart struct {
 	Owner     string                        `json:"owner"`
 	Hosts     map[string]BookingRequestHost `json:"hosts"`
 	UpdatedAt time.Time                     `json:"updated_at"`
+
+	// Window the hosts are wanted for, a zero start is right away and a zero end is open-ended
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+
+	// When the cart is released if left untouched, zero when carts do not expire
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Containers and VMs the booking request built from the cart asks for
+	Containers []BookingRequestCT `json:"containers"`
+	VMs        []BookingRequestVM `json:"vms"`
 }
 
 // newBookingCart allocates a fresh cart for an owner.
@@ -51,6 +76,11 @@ func (c *BookingCart) clone() *BookingCart {
 	cloned := newBookingCart(c.Owner)
 	maps.Copy(cloned.Hosts, c.Hosts)
 	cloned.UpdatedAt = c.UpdatedAt
+	cloned.StartTime = c.StartTime
+	cloned.EndTime = c.EndTime
+	cloned.ExpiresAt = c.ExpiresAt
+	cloned.Containers = slices.Clone(c.Containers)
+	cloned.VMs = slices.Clone(c.VMs)
 
 	return cloned
 }
@@ -69,6 +99,12 @@ func withBookingLock(bookingID int, fn func() error) error {
 	return fn()
 }
 
+// bookingEnded reports whether the booking is done or being torn down. Teardown only releases what the booking held
+// when it started, so nothing may be added to it from then on.
+func bookingEnded(booking *Booking) bool {
+	return booking.Status == BookingStatusDone || !booking.TornDownAt.IsZero()
+}
+
 func appendUniqueInt(values []int, v int) []int {
 	if slices.Contains(values, v) {
 		return values
@@ -122,7 +158,8 @@ func deleteBookingPerson(record *BookingPerson) (err error) {
 
 // Booking lifecycle helpers
 
-// CreateBooking inserts a new booking record, defaulting the start time when missing.
+// CreateBooking inserts a new booking record, defaulting the start time when missing and giving it a network block
+// from the booking network when it has none.
 func CreateBooking(record *Booking) (err error) {
 	bookingCreationLock.Lock()
 	defer bookingCreationLock.Unlock()
@@ -131,10 +168,61 @@ func CreateBooking(record *Booking) (err error) {
 		record.StartTime = time.Now()
 	}
 
+	if record.CIDRBlock == "" {
+		if record.CIDRBlock, err = nextBookingBlock(); err != nil {
+			return
+		}
+	}
+
 	err = bookings.Insert(record)
 	return
 }
 
+// nextBookingBlock picks the first block of the booking network no booking was given. Blocks are never handed out
+// twice, ended bookings keep theirs on record. The caller must hold bookingCreationLock.
+func nextBookingBlock() (cidr string, err error) {
+	var network *net.IPNet
+	if _, network, err = net.ParseCIDR(config.Config.Proxmox.BookingNetwork); err != nil || network.IP.To4() == nil {
+		err = fmt.Errorf("%w: booking network %q is not an IPv4 block", ErrBookingNoNetwork, config.Config.Proxmox.BookingNetwork)
+		return
+	}
+
+	var ones, _ = network.Mask.Size()
+	if prefix := config.Config.Proxmox.BookingPrefix; prefix < ones || prefix > 30 {
+		err = fmt.Errorf("%w: booking prefix /%d does not fit in %s", ErrBookingNoNetwork, prefix, network)
+		return
+	}
+
+	var records []*Booking
+	if records, err = bookings.SelectAll(); err != nil {
+		return
+	}
+
+	var used []string
+	for _, booking := range records {
+		used = append(used, booking.CIDRBlock)
+	}
+
+	var (
+		base  uint32 = binary.BigEndian.Uint32(network.IP.To4())
+		size  uint32 = 1 << (32 - config.Config.Proxmox.BookingPrefix)
+		count uint32 = 1 << (config.Config.Proxmox.BookingPrefix - ones)
+	)
+
+	for i := range count {
+		var block net.IP = make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(block, base+i*size)
+
+		if candidate := fmt.Sprintf("%s/%d", block, config.Config.Proxmox.BookingPrefix); !slices.Contains(used, candidate) {
+			cidr = candidate
+			return
+		}
+	}
+
+	err = fmt.Errorf("%w: every block of %s is taken", ErrBookingNoNetwork, network)
+	return
+}
+
 // BookingByID fetches a booking by its ID.
 func BookingByID(bookingID int) (record *Booking, err error) {
 	record, err = bookings.Select(bookingID)
@@ -147,6 +235,109 @@ func BookingList() (records []*Booking, err error) {
 	return
 }
 
+// BookingsFor returns the bookings a user is a member of.
+func BookingsFor(username string) (records []*Booking, err error) {
+	var persons []*BookingPerson
+	if persons, err = bookingPersonsFor(username); err != nil {
+		return
+	}
+
+	var bookingIDs []int
+	for _, person := range persons {
+		bookingIDs = appendUniqueInt(bookingIDs, person.BookingID)
+	}
+
+	sort.Ints(bookingIDs)
+	for _, bookingID := range bookingIDs {
+		var booking *Booking
+		if booking, err = bookings.Select(bookingID); err != nil {
+			return
+		}
+
+		if booking != nil {
+			records = append(records, booking)
+		}
+	}
+
+	return
+}
+
+// BookingDetails is a booking along with its people and the resources it holds or asked for.
+type BookingDetails struct {
+	Booking      *Booking            `json:"booking"`
+	People       []*BookingPerson    `json:"people"`
+	Hosts        []*Host             `json:"hosts"`
+	Reservations []*HostReservation  `json:"reservations"`
+	Containers   []*BookingContainer `json:"containers"`
+	VMs          []*BookingVM        `json:"vms"`
+	Requests     []*BookingRequest   `json:"requests"`
+}
+
+// BookingDetailsByID expands a booking's people, hosts, host reservations, containers, VMs and requests.
+func BookingDetailsByID(bookingID int) (details *BookingDetails, err error) {
+	details = &BookingDetails{Hosts: []*Host{}}
+
+	if details.Booking, err = bookings.Select(bookingID); err != nil {
+		return
+	} else if details.Booking == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingNotFound, bookingID)
+		return
+	}
+
+	if details.People, err = BookingPeopleForBooking(bookingID); err != nil {
+		return
+	}
+
+	for _, managementIP := range details.Booking.OwnedHostManagementIPs {
+		var host *Host
+		if host, err = Hosts.Select(managementIP); err != nil {
+			return
+		}
+
+		if host != nil {
+			details.Hosts = append(details.Hosts, host)
+		}
+	}
+
+	if details.Reservations, err = HostReservationsForBooking(bookingID); err != nil {
+		return
+	}
+
+	if details.Containers, err = BookingContainersForBooking(bookingID); err != nil {
+		return
+	}
+
+	if details.VMs, err = BookingVMsForBooking(bookingID); err != nil {
+		return
+	}
+
+	if details.Requests, err = BookingRequestsForBooking(bookingID); err != nil {
+		return
+	}
+
+	if details.People == nil {
+		details.People = make([]*BookingPerson, 0)
+	}
+
+	if details.Reservations == nil {
+		details.Reservations = make([]*HostReservation, 0)
+	}
+
+	if details.Containers == nil {
+		details.Containers = make([]*BookingContainer, 0)
+	}
+
+	if details.VMs == nil {
+		details.VMs = make([]*BookingVM, 0)
+	}
+
+	if details.Requests == nil {
+		details.Requests = make([]*BookingRequest, 0)
+	}
+
+	return
+}
+
 // UpdateBooking updates a booking using its per-booking lock for safety.
 func UpdateBooking(record *Booking) (err error) {
 	err = withBookingLock(record.ID, func() error {
@@ -155,11 +346,15 @@ func UpdateBooking(record *Booking) (err error) {
 	return
 }
 
-// DeleteBooking deletes a booking using its per-booking lock.
+// DeleteBooking deletes a booking using its per-booking lock, along with its host reservations.
 func DeleteBooking(bookingID int) (err error) {
-	err = withBookingLock(bookingID, func() error {
+	if err = withBookingLock(bookingID, func() error {
 		return bookings.Delete(bookingID)
-	})
+	}); err != nil {
+		return
+	}
+
+	err = releaseHostReservations(bookingID, "")
 	return
 }
 
@@ -177,6 +372,22 @@ func BookingPeopleForBooking(bookingID int) (records []*BookingPerson, err error
 	return
 }
 
+// BookingPermissionFor returns the highest permission level a user holds on a booking.
+func BookingPermissionFor(bookingID int, username string) (level BookingPermissionLevel, err error) {
+	var records []*BookingPerson
+	if records, err = BookingPeopleForBooking(bookingID); err != nil {
+		return
+	}
+
+	for _, record := range records {
+		if record.Username == username && record.PermissionLevel > level {
+			level = record.PermissionLevel
+		}
+	}
+
+	return
+}
+
 // AddBookingPerson adds a booking-person relation and mirrors it on the booking.
 func AddBookingPerson(record *BookingPerson) (err error) {
 	err = withBookingLock(record.BookingID, func() error {
@@ -227,6 +438,128 @@ func RemoveBookingPerson(bookingPersonID int) (err error) {
 	return
 }
 
+// bookingMember finds a user's relation to a booking among its people, nil when they are not a member.
+func bookingMember(people []*BookingPerson, username string) *BookingPerson {
+	for _, person := range people {
+		if person.Username == username {
+			return person
+		}
+	}
+
+	return nil
+}
+
+// ownersExcept counts the booking's owners other than the given user.
+func ownersExcept(people []*BookingPerson, username string) (owners int) {
+	for _, person := range people {
+		if person.Username != username && person.PermissionLevel == BookingPermissionLevelOwner {
+			owners++
+		}
+	}
+
+	return
+}
+
+// InviteBookingPerson adds a user to a booking at the given level.
+func InviteBookingPerson(bookingID int, username string, level BookingPermissionLevel) (record *BookingPerson, err error) {
+	if level < BookingPermissionLevelViewer || level > BookingPermissionLevelOwner {
+		err = fmt.Errorf("%w: %d", ErrInvalidBookingPermission, level)
+		return
+	}
+
+	err = withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil {
+			return err
+		}
+
+		if booking == nil {
+			return ErrBookingNotFound
+		}
+
+		people, err := BookingPeopleForBooking(bookingID)
+		if err != nil {
+			return err
+		}
+
+		if bookingMember(people, username) != nil {
+			return fmt.Errorf("%w: %s", ErrBookingPersonExists, username)
+		}
+
+		record = &BookingPerson{Username: username, BookingID: bookingID, PermissionLevel: level}
+		if err = insertBookingPerson(record); err != nil {
+			return err
+		}
+
+		booking.People = appendUniqueInt(booking.People, record.ID)
+		return bookings.Update(booking)
+	})
+	return
+}
+
+// SetBookingPersonLevel changes a member's level, refusing to demote the booking's last owner.
+func SetBookingPersonLevel(bookingID int, username string, level BookingPermissionLevel) (record *BookingPerson, err error) {
+	if level < BookingPermissionLevelViewer || level > BookingPermissionLevelOwner {
+		err = fmt.Errorf("%w: %d", ErrInvalidBookingPermission, level)
+		return
+	}
+
+	err = withBookingLock(bookingID, func() error {
+		people, err := BookingPeopleForBooking(bookingID)
+		if err != nil {
+			return err
+		}
+
+		if record = bookingMember(people, username); record == nil {
+			return fmt.Errorf("%w: %s", ErrBookingPersonNotFound, username)
+		}
+
+		if level != BookingPermissionLevelOwner && ownersExcept(people, username) == 0 {
+			return ErrBookingNeedsOwner
+		}
+
+		record.PermissionLevel = level
+		return bookingPeople.Update(record)
+	})
+	return
+}
+
+// RemoveBookingMember removes a user from a booking, refusing to remove its last owner.
+func RemoveBookingMember(bookingID int, username string) (err error) {
+	err = withBookingLock(bookingID, func() error {
+		people, err := BookingPeopleForBooking(bookingID)
+		if err != nil {
+			return err
+		}
+
+		record := bookingMember(people, username)
+		if record == nil {
+			return fmt.Errorf("%w: %s", ErrBookingPersonNotFound, username)
+		}
+
+		if ownersExcept(people, username) == 0 {
+			return ErrBookingNeedsOwner
+		}
+
+		if err = deleteBookingPerson(record); err != nil {
+			return err
+		}
+
+		booking, err := bookings.Select(bookingID)
+		if err != nil {
+			return err
+		}
+
+		if booking == nil {
+			return ErrBookingNotFound
+		}
+
+		booking.People = removeInt(booking.People, record.ID)
+		return bookings.Update(booking)
+	})
+	return
+}
+
 // Booking request helpers
 
 // BookingRequestsForBooking lists all requests for a booking.
@@ -255,12 +588,16 @@ func AddBookingRequest(record *BookingRequest) (err error) {
 			return ErrBookingNotFound
 		}
 
+		if booking.Status == BookingStatusDone {
+			return fmt.Errorf("%w: %d", ErrBookingEnded, booking.ID)
+		}
+
 		if err := bookingRequests.Insert(record); err != nil {
 			return err
 		}
 
 		booking.Requests = appendUniqueInt(booking.Requests, record.ID)
-		if booking.Status != BookingStatusActiveWithRequestPending {
+		if booking.Status != BookingStatusActiveWithRequestPending && booking.Status != BookingStatusScheduled {
 			booking.Status = BookingStatusActiveWithRequestPending
 		}
 
@@ -323,6 +660,8 @@ func AddBookingContainer(record *BookingContainer) (err error) {
 
 		if booking == nil {
 			return ErrBookingNotFound
+		} else if bookingEnded(booking) {
+			return fmt.Errorf("%w: %d", ErrBookingEnded, booking.ID)
 		}
 
 		if err := bookingContainers.Insert(record); err != nil {
@@ -335,6 +674,14 @@ func AddBookingContainer(record *BookingContainer) (err error) {
 	return
 }
 
+// UpdateBookingContainer updates a container record under its booking's lock.
+func UpdateBookingContainer(record *BookingContainer) (err error) {
+	err = withBookingLock(record.BookingID, func() error {
+		return bookingContainers.Update(record)
+	})
+	return
+}
+
 // RemoveBookingContainer deletes a container and removes it from the booking owner list.
 func RemoveBookingContainer(proxmoxID int) (err error) {
 	var record *BookingContainer
@@ -379,6 +726,8 @@ func AddBookingVM(record *BookingVM) (err error) {
 
 		if booking == nil {
 			return ErrBookingNotFound
+		} else if bookingEnded(booking) {
+			return fmt.Errorf("%w: %d", ErrBookingEnded, booking.ID)
 		}
 
 		if err := bookingVMs.Insert(record); err != nil {
@@ -429,25 +778,32 @@ func AssignHostToBooking(bookingID int, managementIP string) (err error) {
 
 		if booking == nil {
 			return ErrBookingNotFound
+		} else if bookingEnded(booking) {
+			return fmt.Errorf("%w: %d", ErrBookingEnded, bookingID)
 		}
 
-		host, err := Hosts.Select(managementIP)
-		if err != nil {
-			return err
-		}
+		if _, err := UpdateHost(managementIP, func(host *Host) error {
+			if removingHosts[managementIP] {
+				return fmt.Errorf("%w: %s is being removed", ErrHostNotFound, managementIP)
+			}
 
-		if host == nil {
-			return fmt.Errorf("host %s not found", managementIP)
-		}
+			if host.IsBooked && host.ActiveBookingID != bookingID {
+				return ErrHostAlreadyBooked
+			}
 
-		if host.IsBooked && host.ActiveBookingID != bookingID {
-			return ErrHostAlreadyBooked
-		}
+			if host.Wiping {
+				return fmt.Errorf("%w: %s", ErrHostWiping, managementIP)
+			}
 
-		host.IsBooked = true
-		host.ActiveBookingID = bookingID
+			if host.InMaintenance() && host.ActiveBookingID != bookingID {
+				return fmt.Errorf("%w: %s", ErrHostInMaintenance, managementIP)
+			}
 
-		if err := Hosts.Update(host); err != nil {
+			host.IsBooked = true
+			host.ActiveBookingID = bookingID
+			host.IdleSince = time.Time{}
+			return nil
+		}); err != nil {
 			return err
 		}
 
@@ -457,9 +813,18 @@ func AssignHostToBooking(bookingID int, managementIP string) (err error) {
 	return
 }
 
-// ReleaseHostFromBooking frees a host and removes it from the booking.
+// ReleaseHostFromBooking removes a host from the booking. With wiping enabled the host is wiped before it
+// returns to the pool, otherwise it is freed right away. Nothing changes when wiping is enabled but not configured.
 func ReleaseHostFromBooking(bookingID int, managementIP string) (err error) {
-	err = withBookingLock(bookingID, func() error {
+	var wipe bool
+
+	// Checked up front, the host would otherwise be held for a wipe that can't start
+	if config.Config.Wipe.Enabled && !wipeConfigured() {
+		err = ErrWipeNotConfigured
+		return
+	}
+
+	if err = withBookingLock(bookingID, func() error {
 		booking, err := bookings.Select(bookingID)
 		if err != nil {
 			return err
@@ -469,44 +834,90 @@ func ReleaseHostFromBooking(bookingID int, managementIP string) (err error) {
 			return ErrBookingNotFound
 		}
 
-		host, err := Hosts.Select(managementIP)
-		if err != nil {
-			return err
-		}
-
-		if host != nil {
+		if _, err := UpdateHost(managementIP, func(host *Host) error {
 			host.IsBooked = false
 			host.ActiveBookingID = 0
-			if err := Hosts.Update(host); err != nil {
-				return err
+			// The host is held for the wipe so it can't be taken before the wipe is queued
+			if wipe = config.Config.Wipe.Enabled; wipe {
+				host.Wiping = true
+			} else {
+				host.IdleSince = time.Now()
 			}
+
+			return nil
+		}); err != nil && !errors.Is(err, ErrHostNotFound) {
+			return err
 		}
 
 		booking.OwnedHostManagementIPs = removeString(booking.OwnedHostManagementIPs, managementIP)
 		return bookings.Update(booking)
-	})
+	}); err != nil || !wipe {
+		return
+	}
+
+	var started *HostWipe
+	if started, _, err = StartHostWipe(managementIP, bookingID, WipeCreatorRelease); err != nil && started == nil {
+		// Without a wipe record there is nothing to retry from, so the hold is lifted
+		log.Warnf("failed to start the wipe of host %s released from booking %d, returning it to the pool: %v", managementIP, bookingID, err)
+		if _, errUndo := UpdateHost(managementIP, func(host *Host) error {
+			host.Wiping = false
+			host.IdleSince = time.Now()
+			return nil
+		}); errUndo != nil {
+			log.Errorf("failed to return host %s to the pool: %v", managementIP, errUndo)
+		}
+	}
+
 	return
 }
 
 // Booking cart helpers
 
-// availableHostsForCart filters hosts that are free or reserved by the owner.
-func availableHostsForCart(owner string) (records []*Host, err error) {
-	var hosts []*Host
+// hostAvailableTo reports whether owner could add the host to their cart. Without a start time the host must be free
+// right away, otherwise it must be free from start to end. The caller must hold bookingCartLock.
+func hostAvailableTo(h *Host, owner string, start, end time.Time) bool {
+	if holder, reserved := hostCartOwners[h.ManagementIP]; reserved && holder != owner {
+		return false
+	}
+
+	if !start.IsZero() {
+		return !h.FirmwareUpdating && HostConflicts([]string{h.ManagementIP}, start, end, 0) == nil
+	}
+
+	return !((h.IsBooked && h.ActiveBookingID != 0) || h.FirmwareUpdating || h.Wiping || h.InMaintenance())
+}
+
+// cartWindow is the window of the owner's cart, zero when the owner has no cart. The caller must hold
+// bookingCartLock.
+func cartWindow(owner string) (start, end time.Time) {
+	if cart, ok := bookingCarts[owner]; ok && cart != nil {
+		start, end = cart.StartTime, cart.EndTime
+	}
+
+	return
+}
+
+// availableHostsForCart filters hosts that are free or reserved by the owner, not in maintenance, not restricted
+// away from their groups, and match the filter. The caller must hold bookingCartLock.
+func availableHostsForCart(owner string, groups []string, filter HostFilter) (records []*Host, err error) {
+	var (
+		hosts        []*Host
+		restrictions map[string]*TagRestriction
+	)
+
 	if hosts, err = Hosts.SelectAll(); err != nil {
 		return
 	}
 
-	for _, h := range hosts {
-		if h.IsBooked && h.ActiveBookingID != 0 {
-			continue
-		}
+	if restrictions, err = tagRestrictionMap(); err != nil {
+		return
+	}
 
-		if holder, reserved := hostCartOwners[h.ManagementIP]; reserved && holder != owner {
-			continue
+	var start, end = cartWindow(owner)
+	for _, h := range hosts {
+		if _, restricted := hostRestrictedFor(h, groups, restrictions); !restricted && hostAvailableTo(h, owner, start, end) && filter.matches(h, true) {
+			records = append(records, h)
 		}
-
-		records = append(records, h)
 	}
 
 	sort.Slice(records, func(i, j int) bool { return records[i].ManagementIP < records[j].ManagementIP })
@@ -514,8 +925,11 @@ func availableHostsForCart(owner string) (records []*Host, err error) {
 }
 
 // AvailableHostsForCart is the exported helper for cart host discovery.
-func AvailableHostsForCart(owner string) (records []*Host, err error) {
-	records, err = availableHostsForCart(owner)
+func AvailableHostsForCart(owner string, groups []string, filter HostFilter) (records []*Host, err error) {
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	records, err = availableHostsForCart(owner, groups, filter)
 	return
 }
 
@@ -556,19 +970,18 @@ func ResetBookingCart(owner string) {
 	bookingCartLock.Lock()
 	defer bookingCartLock.Unlock()
 
-	if cart, ok := bookingCarts[owner]; ok && cart != nil {
-		for ip, holder := range hostCartOwners {
-			if holder == owner {
-				delete(hostCartOwners, ip)
-			}
-		}
-
-		delete(bookingCarts, owner)
+	if err := forgetBookingCart(owner); err != nil {
+		log.Errorf("failed to clear the cart of %s: %v", owner, err)
 	}
 }
 
-// AddHostToCart validates and reserves a host in the owner's cart.
-func AddHostToCart(owner string, host BookingRequestHost) (err error) {
+// AddHostToCart validates and reserves a host in the owner's cart, within the owner's host quota.
+func AddHostToCart(owner string, groups []string, host BookingRequestHost) (err error) {
+	var restrictions map[string]*TagRestriction
+	if restrictions, err = tagRestrictionMap(); err != nil {
+		return
+	}
+
 	bookingCartLock.Lock()
 	defer bookingCartLock.Unlock()
 
@@ -582,9 +995,30 @@ func AddHostToCart(owner string, host BookingRequestHost) (err error) {
 		return
 	}
 
-	if dbHost.IsBooked {
+	if tag, restricted := hostRestrictedFor(dbHost, groups, restrictions); restricted {
+		err = fmt.Errorf("%w: tagged %s", ErrHostRestricted, tag)
+		return
+	}
+
+	if dbHost.FirmwareUpdating {
+		err = ErrHostFirmwareUpdating
+		return
+	}
+
+	// Hosts wanted for later only need to be free by then
+	if start, end := cartWindow(owner); !start.IsZero() {
+		if err = HostConflicts([]string{dbHost.ManagementIP}, start, end, 0); err != nil {
+			return
+		}
+	} else if dbHost.IsBooked {
 		err = ErrHostAlreadyBooked
 		return
+	} else if dbHost.Wiping {
+		err = ErrHostWiping
+		return
+	} else if dbHost.InMaintenance() {
+		err = fmt.Errorf("%w: %s", ErrHostInMaintenance, dbHost.Maintenance.Reason)
+		return
 	}
 
 	if holder, reserved := hostCartOwners[host.ManagementIP]; reserved && holder != owner {
@@ -602,28 +1036,248 @@ func AddHostToCart(owner string, host BookingRequestHost) (err error) {
 		}
 	}
 
+	var cartHosts int = 1
+	if cart, ok := bookingCarts[owner]; ok && cart != nil {
+		if _, inCart := cart.Hosts[host.ManagementIP]; !inCart {
+			cartHosts += len(cart.Hosts)
+		} else {
+			cartHosts = len(cart.Hosts)
+		}
+	}
+
+	if err = checkCartQuota(owner, groups, cartHosts); err != nil {
+		return
+	}
+
+	if err = persistCartHost(owner, host); err != nil {
+		return
+	}
+
 	cart := getOrCreateCart(owner)
 	cart.Hosts[host.ManagementIP] = host
-	cart.UpdatedAt = time.Now()
+	cart.touch(time.Now())
 	hostCartOwners[host.ManagementIP] = owner
+
+	err = persistBookingCart(cart)
+	return
+}
+
+// SetBookingCartWindow sets the window the owner's cart hosts are wanted for. A zero start clears it. The hosts
+// already in the cart must be free during the new window.
+func SetBookingCartWindow(owner string, start, end time.Time) (err error) {
+	if start.IsZero() {
+		end = time.Time{}
+	} else if err = ValidateBookingWindow(start, end, time.Now()); err != nil {
+		return
+	}
+
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	cart := getOrCreateCart(owner)
+	if !start.IsZero() {
+		if err = HostConflicts(slices.Sorted(maps.Keys(cart.Hosts)), start, end, 0); err != nil {
+			return
+		}
+	}
+
+	window := cart.clone()
+	window.StartTime, window.EndTime = start, end
+	if err = cartCapacityConflicts(window); err != nil {
+		return
+	}
+
+	cart.StartTime = start
+	cart.EndTime = end
+	cart.touch(time.Now())
+
+	err = persistBookingCart(cart)
 	return
 }
 
 // RemoveHostFromCart releases a host reservation from the owner's cart.
-func RemoveHostFromCart(owner string, managementIP string) {
+func RemoveHostFromCart(owner string, managementIP string) (err error) {
 	bookingCartLock.Lock()
 	defer bookingCartLock.Unlock()
 
 	if cart, ok := bookingCarts[owner]; ok && cart != nil {
 		delete(cart.Hosts, managementIP)
 		if holder, reserved := hostCartOwners[managementIP]; reserved && holder == owner {
-			delete(hostCartOwners, managementIP)
+			if err = forgetCartHost(managementIP); err != nil {
+				return
+			}
 		}
-		cart.UpdatedAt = time.Now()
+
+		cart.touch(time.Now())
+		err = persistBookingCart(cart)
 	}
+
+	return
 }
 
-// CartCounts returns the number of hosts in the cart (virtual always zero).
+// CartTemplates lists the container templates bookings may pick from.
+func CartTemplates() (templates []string) {
+	for _, template := range config.Config.Proxmox.Templates {
+		if template = strings.TrimSpace(template); template != "" {
+			templates = append(templates, template)
+		}
+	}
+
+	return
+}
+
+// validateCartContainer checks that a container is sized, uses an offered template and has a key to log in with.
+func validateCartContainer(ct BookingRequestCT) (err error) {
+	if ct.Cores < 1 || ct.MemoryMB < 1 || ct.DiskGB < 1 {
+		err = fmt.Errorf("%w: containers need cores, memory and disk", ErrInvalidCartItem)
+	} else if !slices.Contains(CartTemplates(), ct.Template) {
+		err = fmt.Errorf("%w: template %q is not offered", ErrInvalidCartItem, ct.Template)
+	} else if _, errKey := ssh.NormalizeAuthorizedKey(ct.SSHPublicKey); errKey != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidCartItem, errKey)
+	}
+
+	return
+}
+
+// validateCartVM checks that a VM is sized and boots a stored ISO, VMs without one start empty.
+func validateCartVM(machine BookingRequestVM) (err error) {
+	if machine.Cores < 1 || machine.MemoryMB < 1 || machine.DiskGB < 1 {
+		err = fmt.Errorf("%w: VMs need cores, memory and disk", ErrInvalidCartItem)
+		return
+	}
+
+	if machine.ISOSelection != "" {
+		var iso *StoredISOImage
+		if iso, err = StoredISOImages.Select(machine.ISOSelection); err == nil && iso == nil {
+			err = fmt.Errorf("%w: iso %s not found", ErrInvalidCartItem, machine.ISOSelection)
+		}
+	}
+
+	return
+}
+
+// cartCapacityConflicts checks the cart's containers and VMs against the Proxmox capacity left during its window,
+// from now on when it has none.
+func cartCapacityConflicts(cart *BookingCart) error {
+	var start time.Time = cart.StartTime
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	return ProxmoxCapacityConflicts(start, cart.EndTime, cart.Containers, cart.VMs)
+}
+
+// editCartResources applies edit to a copy of the owner's cart and keeps the copy when edit succeeds.
+func editCartResources(owner string, edit func(cart *BookingCart) error) (snapshot *BookingCart, err error) {
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	var cart *BookingCart = newBookingCart(owner)
+	if current, ok := bookingCarts[owner]; ok && current != nil {
+		cart = current.clone()
+	}
+
+	if err = edit(cart); err != nil {
+		return
+	}
+
+	cart.touch(time.Now())
+	if err = persistBookingCart(cart); err != nil {
+		return
+	}
+
+	bookingCarts[owner] = cart
+	snapshot = cart.clone()
+	return
+}
+
+// AddContainerToCart adds a container to the owner's cart if it fits in the Proxmox capacity left.
+func AddContainerToCart(owner string, ct BookingRequestCT) (cart *BookingCart, err error) {
+	if err = validateCartContainer(ct); err != nil {
+		return
+	}
+
+	cart, err = editCartResources(owner, func(cart *BookingCart) error {
+		cart.Containers = append(cart.Containers, ct)
+		return cartCapacityConflicts(cart)
+	})
+	return
+}
+
+// UpdateCartContainer replaces the container at index in the owner's cart.
+func UpdateCartContainer(owner string, index int, ct BookingRequestCT) (cart *BookingCart, err error) {
+	if err = validateCartContainer(ct); err != nil {
+		return
+	}
+
+	cart, err = editCartResources(owner, func(cart *BookingCart) error {
+		if index < 0 || index >= len(cart.Containers) {
+			return fmt.Errorf("%w: container %d", ErrCartItemNotFound, index)
+		}
+
+		cart.Containers[index] = ct
+		return cartCapacityConflicts(cart)
+	})
+	return
+}
+
+// RemoveContainerFromCart removes the container at index from the owner's cart.
+func RemoveContainerFromCart(owner string, index int) (cart *BookingCart, err error) {
+	cart, err = editCartResources(owner, func(cart *BookingCart) error {
+		if index < 0 || index >= len(cart.Containers) {
+			return fmt.Errorf("%w: container %d", ErrCartItemNotFound, index)
+		}
+
+		cart.Containers = slices.Delete(cart.Containers, index, index+1)
+		return nil
+	})
+	return
+}
+
+// AddVMToCart adds a VM to the owner's cart if it fits in the Proxmox capacity left.
+func AddVMToCart(owner string, machine BookingRequestVM) (cart *BookingCart, err error) {
+	if err = validateCartVM(machine); err != nil {
+		return
+	}
+
+	cart, err = editCartResources(owner, func(cart *BookingCart) error {
+		cart.VMs = append(cart.VMs, machine)
+		return cartCapacityConflicts(cart)
+	})
+	return
+}
+
+// UpdateCartVM replaces the VM at index in the owner's cart.
+func UpdateCartVM(owner string, index int, machine BookingRequestVM) (cart *BookingCart, err error) {
+	if err = validateCartVM(machine); err != nil {
+		return
+	}
+
+	cart, err = editCartResources(owner, func(cart *BookingCart) error {
+		if index < 0 || index >= len(cart.VMs) {
+			return fmt.Errorf("%w: VM %d", ErrCartItemNotFound, index)
+		}
+
+		cart.VMs[index] = machine
+		return cartCapacityConflicts(cart)
+	})
+	return
+}
+
+// RemoveVMFromCart removes the VM at index from the owner's cart.
+func RemoveVMFromCart(owner string, index int) (cart *BookingCart, err error) {
+	cart, err = editCartResources(owner, func(cart *BookingCart) error {
+		if index < 0 || index >= len(cart.VMs) {
+			return fmt.Errorf("%w: VM %d", ErrCartItemNotFound, index)
+		}
+
+		cart.VMs = slices.Delete(cart.VMs, index, index+1)
+		return nil
+	})
+	return
+}
+
+// CartCounts returns the number of hosts and of containers and VMs in the cart.
 func CartCounts(owner string) (hostCount int, virtualCount int, err error) {
 	var cart *BookingCart
 	if cart, err = BookingCartSnapshot(owner); err != nil {
@@ -631,23 +1285,84 @@ func CartCounts(owner string) (hostCount int, virtualCount int, err error) {
 	}
 
 	hostCount = len(cart.Hosts)
-	virtualCount = 0
+	virtualCount = len(cart.Containers) + len(cart.VMs)
 	return
 }
 
-// BuildBookingRequestFromCart builds a request using cart hosts plus provided virtual resources.
-func BuildBookingRequestFromCart(owner string, bookingID int, justification string, requestedBy string, containers []BookingRequestCT, vms []BookingRequestVM) (request *BookingRequest, err error) {
+// BuildBookingRequestFromCart builds a request using the cart's hosts, containers and VMs plus those provided. Hosts
+// with maintenance scheduled during the booking or held by another booking by then are refused, as are containers and
+// VMs past the Proxmox capacity left. The containers and VMs provided are validated like those added to a cart. The
+// request must fit in the quota of requestedBy, whose groups are kept on the request.
+func BuildBookingRequestFromCart(owner string, bookingID int, justification string, requestedBy string, groups []string, containers []BookingRequestCT, vms []BookingRequestVM) (request *BookingRequest, err error) {
+	for _, ct := range containers {
+		if err = validateCartContainer(ct); err != nil {
+			return
+		}
+	}
+
+	for _, machine := range vms {
+		if err = validateCartVM(machine); err != nil {
+			return
+		}
+	}
+
 	var cart *BookingCart
 	if cart, err = BookingCartSnapshot(owner); err != nil {
 		return
 	}
 
+	containers = append(cart.Containers, containers...)
+	vms = append(cart.VMs, vms...)
+
+	var booking *Booking
+	if booking, err = BookingByID(bookingID); err != nil {
+		return
+	} else if booking == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingNotFound, bookingID)
+		return
+	} else if booking.Status == BookingStatusDone {
+		err = fmt.Errorf("%w: %d", ErrBookingEnded, bookingID)
+		return
+	}
+
+	if err = HostConflicts(slices.Sorted(maps.Keys(cart.Hosts)), booking.StartTime, booking.EndTime, bookingID); err != nil {
+		return
+	}
+
+	if err = ProxmoxCapacityConflicts(booking.StartTime, booking.EndTime, containers, vms); err != nil {
+		return
+	}
+
+	var (
+		limits QuotaLimits
+		usage  QuotaUsage
+	)
+
+	if limits, err = EffectiveQuotaLimits(requestedBy, groups); err != nil {
+		return
+	}
+
+	if err = limits.checkDuration(booking.StartTime, booking.EndTime); err != nil {
+		return
+	}
+
+	if usage, err = quotaUsage(requestedBy); err != nil {
+		return
+	}
+
+	usage.Hosts += len(cart.Hosts)
+	usage.add(containers, vms)
+	if err = limits.check(usage); err != nil {
+		return
+	}
+
 	request = &BookingRequest{
-		BookingID:     bookingID,
-		RequestedAt:   time.Now(),
-		RequestedBy:   requestedBy,
-		Justification: justification,
-		Status:        BookingRequestStatusPending,
+		BookingID:       bookingID,
+		RequestedAt:     time.Now(),
+		RequestedBy:     requestedBy,
+		RequesterGroups: slices.Clone(groups),
+		Justification:   justification,
+		Status:          BookingRequestStatusPending,
 	}
 
 	for _, host := range cart.Hosts {
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+)
+
+// Carts are served from bookingCarts and hostCartOwners, every change is written through to bookingCartRecords and
+// bookingCartHosts so carts survive restarts.
+
+// cartTTL is how long a cart may be left untouched before it is released, zero never releases it.
+func cartTTL() time.Duration {
+	return time.Duration(max(config.Config.Carts.TTLMinutes, 0)) * time.Minute
+}
+
+// touch records activity on the cart and pushes its expiry back.
+func (c *BookingCart) touch(now time.Time) {
+	c.UpdatedAt = now
+	c.ExpiresAt = time.Time{}
+
+	if ttl := cartTTL(); ttl > 0 {
+		c.ExpiresAt = now.Add(ttl)
+	}
+}
+
+// loadBookingCarts rebuilds the carts from the database. Hosts whose cart record is missing get a fresh cart.
+func loadBookingCarts() (err error) {
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	var (
+		records []*BookingCartRecord
+		hosts   []*BookingCartHost
+	)
+
+	if records, err = bookingCartRecords.SelectAll(); err != nil {
+		return
+	}
+
+	if hosts, err = bookingCartHosts.SelectAll(); err != nil {
+		return
+	}
+
+	bookingCarts = map[string]*BookingCart{}
+	hostCartOwners = map[string]string{}
+
+	for _, record := range records {
+		cart := newBookingCart(record.Owner)
+		cart.StartTime = record.StartTime
+		cart.EndTime = record.EndTime
+		cart.UpdatedAt = record.UpdatedAt
+		cart.ExpiresAt = record.ExpiresAt
+		cart.Containers = record.Containers
+		cart.VMs = record.VMs
+		bookingCarts[record.Owner] = cart
+	}
+
+	for _, host := range hosts {
+		cart, ok := bookingCarts[host.Owner]
+		if !ok {
+			cart = newBookingCart(host.Owner)
+			cart.touch(time.Now())
+			bookingCarts[host.Owner] = cart
+
+			if err = persistBookingCart(cart); err != nil {
+				return
+			}
+		}
+
+		cart.Hosts[host.ManagementIP] = BookingRequestHost{ManagementIP: host.ManagementIP, ISOSelection: host.ISOSelection}
+		hostCartOwners[host.ManagementIP] = host.Owner
+	}
+
+	return
+}
+
+// persistBookingCart writes the cart's window, activity, containers and VMs to its record. The caller must hold
+// bookingCartLock.
+func persistBookingCart(cart *BookingCart) (err error) {
+	var (
+		existing *BookingCartRecord
+		record   *BookingCartRecord = &BookingCartRecord{
+			Owner:      cart.Owner,
+			StartTime:  cart.StartTime,
+			EndTime:    cart.EndTime,
+			UpdatedAt:  cart.UpdatedAt,
+			ExpiresAt:  cart.ExpiresAt,
+			Containers: cart.Containers,
+			VMs:        cart.VMs,
+		}
+	)
+
+	if existing, err = bookingCartRecords.Select(cart.Owner); err != nil {
+		return
+	}
+
+	if existing == nil {
+		err = bookingCartRecords.Insert(record)
+	} else {
+		err = bookingCartRecords.Update(record)
+	}
+
+	return
+}
+
+// persistCartHost records that the owner holds a host in their cart. The caller must hold bookingCartLock.
+func persistCartHost(owner string, host BookingRequestHost) (err error) {
+	var (
+		existing *BookingCartHost
+		record   *BookingCartHost = &BookingCartHost{
+			ManagementIP: host.ManagementIP,
+			Owner:        owner,
+			ISOSelection: host.ISOSelection,
+			AddedAt:      time.Now(),
+		}
+	)
+
+	if existing, err = bookingCartHosts.Select(host.ManagementIP); err != nil {
+		return
+	}
+
+	if existing == nil {
+		err = bookingCartHosts.Insert(record)
+	} else {
+		record.AddedAt = existing.AddedAt
+		err = bookingCartHosts.Update(record)
+	}
+
+	return
+}
+
+// forgetCartHost drops a host from whichever cart holds it. The caller must hold bookingCartLock.
+func forgetCartHost(managementIP string) (err error) {
+	delete(hostCartOwners, managementIP)
+
+	var existing *BookingCartHost
+	if existing, err = bookingCartHosts.Select(managementIP); err == nil && existing != nil {
+		err = bookingCartHosts.Delete(managementIP)
+	}
+
+	return
+}
+
+// forgetBookingCart drops the owner's cart and releases its hosts. The caller must hold bookingCartLock.
+func forgetBookingCart(owner string) (err error) {
+	if cart, ok := bookingCarts[owner]; ok && cart != nil {
+		for _, managementIP := range slices.Sorted(maps.Keys(cart.Hosts)) {
+			if holder := hostCartOwners[managementIP]; holder != owner {
+				continue
+			}
+
+			if err = forgetCartHost(managementIP); err != nil {
+				return
+			}
+		}
+	}
+
+	delete(bookingCarts, owner)
+
+	var existing *BookingCartRecord
+	if existing, err = bookingCartRecords.Select(owner); err == nil && existing != nil {
+		err = bookingCartRecords.Delete(owner)
+	}
+
+	return
+}
+
+// ExpireBookingCarts releases the carts left untouched past their expiry and returns their owners.
+func ExpireBookingCarts(now time.Time) (expired []string, err error) {
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	for _, owner := range slices.Sorted(maps.Keys(bookingCarts)) {
+		var cart *BookingCart = bookingCarts[owner]
+		if cart == nil || cart.ExpiresAt.IsZero() || now.Before(cart.ExpiresAt) {
+			continue
+		}
+
+		if err = forgetBookingCart(owner); err != nil {
+			return
+		}
+
+		log.Infof("released the cart of %s, untouched since %s", owner, cart.UpdatedAt.Format(time.RFC3339))
+		expired = append(expired, owner)
+	}
+
+	return
+}
@@ -0,0 +1,408 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/vm"
+)
+
+const (
+	BookingReaper = "booking-reaper"
+
+	TeardownActionRelease = "release"
+	TeardownActionStop    = "stop"
+	TeardownActionDelete  = "delete"
+)
+
+var bookingExpiryLock sync.Mutex
+
+// expiryGrace is how long an ended booking keeps its resources.
+func expiryGrace() time.Duration {
+	return time.Duration(max(config.Config.Expiry.GraceHours, 0)) * time.Hour
+}
+
+// ReapExpiredBookings warns bookings nearing their end time, notifies the ones that ended and queues a teardown
+// job for those past the grace period. The queued jobs are returned.
+func ReapExpiredBookings(now time.Time) (queued []*Job, err error) {
+	if !config.Config.Expiry.Enabled {
+		return
+	}
+
+	bookingExpiryLock.Lock()
+	defer bookingExpiryLock.Unlock()
+
+	var records []*Booking
+	if records, err = bookings.SelectAll(); err != nil {
+		return
+	}
+
+	for _, booking := range records {
+		if !booking.TornDownAt.IsZero() {
+			continue
+		}
+
+		// A teardown that left hosts booked is started again until every host is released
+		if booking.Status == BookingStatusDone {
+			if job, err := startBookingTeardown(booking.ID, BookingReaper, "the booking has ended"); err != nil {
+				log.Errorf("failed to retry teardown of booking %d: %v", booking.ID, err)
+			} else if job != nil {
+				queued = append(queued, job)
+			}
+
+			continue
+		}
+
+		if booking.EndTime.IsZero() {
+			continue
+		}
+
+		if now.Before(booking.EndTime) {
+			if err := warnExpiringBooking(booking.ID, now); err != nil {
+				log.Errorf("failed to warn booking %d of its expiry: %v", booking.ID, err)
+			}
+
+			continue
+		}
+
+		if booking.ExpiredAt.IsZero() {
+			if err := markBookingExpired(booking.ID, now); err != nil {
+				log.Errorf("failed to mark booking %d as expired: %v", booking.ID, err)
+				continue
+			}
+		}
+
+		if now.Before(booking.EndTime.Add(expiryGrace())) {
+			continue
+		}
+
+		if job, err := startBookingTeardown(booking.ID, BookingReaper, "the booking has ended"); err != nil {
+			log.Errorf("failed to start teardown of booking %d: %v", booking.ID, err)
+		} else if job != nil {
+			queued = append(queued, job)
+		}
+	}
+
+	return
+}
+
+// warnExpiringBooking sends a warning once the booking crosses one of the configured thresholds. Thresholds
+// crossed together, after downtime or a short booking, are covered by a single warning.
+func warnExpiringBooking(bookingID int, now time.Time) (err error) {
+	var (
+		due = -1
+		end time.Time
+	)
+
+	if err = withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil || booking == nil {
+			return err
+		}
+
+		for _, hours := range config.Config.Expiry.WarningHours {
+			if hours <= 0 || slices.Contains(booking.ExpiryWarningsSent, hours) || now.Before(booking.EndTime.Add(-time.Duration(hours)*time.Hour)) {
+				continue
+			}
+
+			booking.ExpiryWarningsSent = appendUniqueInt(booking.ExpiryWarningsSent, hours)
+			if due == -1 || hours < due {
+				due = hours
+			}
+		}
+
+		if due == -1 {
+			return nil
+		}
+
+		end = booking.EndTime
+		return bookings.Update(booking)
+	}); err != nil || due == -1 {
+		return
+	}
+
+	notifyBooking(bookingID, BookingNoticeExpiryWarning, "", fmt.Sprintf("This booking ends at %s, its hosts, containers and VMs are released %s later", end.Format(time.RFC3339), expiryGrace()))
+	return
+}
+
+// markBookingExpired records that the booking ended and notifies its members of the grace period.
+func markBookingExpired(bookingID int, now time.Time) (err error) {
+	var release time.Time
+
+	if err = withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil || booking == nil {
+			return err
+		}
+
+		booking.ExpiredAt = now
+		release = booking.EndTime.Add(expiryGrace())
+		return bookings.Update(booking)
+	}); err != nil {
+		return
+	}
+
+	notifyBooking(bookingID, BookingNoticeExpired, "", fmt.Sprintf("This booking has ended, its hosts, containers and VMs are released at %s", release.Format(time.RFC3339)))
+	return
+}
+
+// ReleaseBooking ends a booking ahead of its end time, queueing the job releasing its resources on behalf of the
+// member releasing it.
+func ReleaseBooking(bookingID int, releasedBy string) (job *Job, err error) {
+	bookingExpiryLock.Lock()
+	defer bookingExpiryLock.Unlock()
+
+	var booking *Booking
+	if booking, err = BookingByID(bookingID); err != nil {
+		return
+	} else if booking == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingNotFound, bookingID)
+		return
+	} else if booking.Status == BookingStatusDone || !booking.TornDownAt.IsZero() {
+		err = fmt.Errorf("%w: %d", ErrBookingEnded, bookingID)
+		return
+	}
+
+	job, err = startBookingTeardown(bookingID, releasedBy, "the booking was released")
+	return
+}
+
+// startBookingTeardown rejects the booking's pending requests and extensions, marks it done and queues the job
+// releasing its resources. Nothing is queued while an earlier teardown job is still queued or running, a teardown
+// interrupted by a restart is started again.
+func startBookingTeardown(bookingID int, startedBy, reason string) (job *Job, err error) {
+	var requests []*BookingRequest
+	if requests, err = BookingRequestsForBooking(bookingID); err != nil {
+		return
+	}
+
+	for _, request := range requests {
+		if request.Status != BookingRequestStatusPending {
+			continue
+		}
+
+		if _, err = RejectBookingRequest(request.ID, startedBy, reason); err != nil && !errors.Is(err, ErrBookingRequestReviewed) {
+			return
+		}
+	}
+
+	var extensions []*BookingExtension
+	if extensions, err = BookingExtensionsForBooking(bookingID); err != nil {
+		return
+	}
+
+	for _, extension := range extensions {
+		if extension.Status != BookingRequestStatusPending {
+			continue
+		}
+
+		if _, err = RejectBookingExtension(extension.ID, startedBy, reason); err != nil && !errors.Is(err, ErrBookingExtensionReviewed) {
+			return
+		}
+	}
+
+	err = withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil || booking == nil || !booking.TornDownAt.IsZero() {
+			return err
+		}
+
+		if booking.TeardownJobID != 0 {
+			if previous, err := JobByID(booking.TeardownJobID); err == nil && (previous.Status == JobStatusQueued || previous.Status == JobStatusRunning) {
+				return nil
+			}
+		}
+
+		if job, err = EnqueueJob(JobKindBookingTeardown, fmt.Sprintf("booking:%d", bookingID), startedBy, func(handle *JobHandle) error {
+			steps, err := TeardownBooking(bookingID, handle.Progress)
+			if err != nil {
+				return err
+			}
+
+			return handle.SetResult(steps)
+		}); err != nil {
+			return err
+		}
+
+		booking.Status = BookingStatusDone
+		booking.TeardownJobID = job.ID
+		return bookings.Update(booking)
+	})
+
+	return
+}
+
+// TeardownBooking releases the booking's hosts through the wipe path, drops its host reservations and stops and deletes its containers and
+// VMs. Each step is recorded on the booking and failed steps do not stop the others. The booking is only marked torn
+// down once every host is released, so the reaper retries it, other failures are left for an admin to clean up. The
+// progress callback may be nil.
+func TeardownBooking(bookingID int, progress func(percent int, message string)) (steps []BookingTeardownStep, err error) {
+	var (
+		booking    *Booking
+		containers []*BookingContainer
+		machines   []*BookingVM
+		retry      bool
+	)
+
+	if booking, err = BookingByID(bookingID); err != nil {
+		return
+	} else if booking == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingNotFound, bookingID)
+		return
+	}
+
+	if containers, err = BookingContainersForBooking(bookingID); err != nil {
+		return
+	}
+
+	if machines, err = BookingVMsForBooking(bookingID); err != nil {
+		return
+	}
+
+	var (
+		total int = len(booking.OwnedHostManagementIPs) + len(containers) + len(machines)
+		done  int
+	)
+
+	record := func(resourceType, resource, action string, err error) bool {
+		var step BookingTeardownStep = BookingTeardownStep{ResourceType: resourceType, Resource: resource, Action: action, At: time.Now()}
+		if err != nil {
+			step.Error = err.Error()
+		} else {
+			step.Success = true
+		}
+
+		steps = append(steps, step)
+		return step.Success
+	}
+
+	advance := func() {
+		done++
+		if progress != nil {
+			progress(done*100/max(total, 1), fmt.Sprintf("%d of %d resources released", done, total))
+		}
+	}
+
+	if err := releaseHostReservations(bookingID, ""); err != nil {
+		log.Errorf("failed to drop the host reservations of booking %d: %v", bookingID, err)
+	}
+
+	var hostsReleased bool = true
+	for _, managementIP := range booking.OwnedHostManagementIPs {
+		if !record(FulfillmentResourceHost, managementIP, TeardownActionRelease, ReleaseHostFromBooking(bookingID, managementIP)) {
+			hostsReleased = false
+		}
+
+		advance()
+	}
+
+	if len(containers) > 0 || len(machines) > 0 {
+		var api, errProxmox = vm.SharedProxmox()
+
+		for _, ct := range containers {
+			teardownBookingContainer(api, errProxmox, ct.ProxmoxID, func(action string, err error) bool {
+				return record(FulfillmentResourceContainer, strconv.Itoa(ct.ProxmoxID), action, err)
+			})
+			advance()
+		}
+
+		for _, machine := range machines {
+			teardownBookingVM(api, errProxmox, machine.ProxmoxID, func(action string, err error) bool {
+				return record(FulfillmentResourceVM, strconv.Itoa(machine.ProxmoxID), action, err)
+			})
+			advance()
+		}
+	}
+
+	if err = withBookingLock(bookingID, func() error {
+		current, err := bookings.Select(bookingID)
+		if err != nil || current == nil {
+			return err
+		}
+
+		// Hosts left booked would never return to the pool, the reaper retries the teardown while TornDownAt is unset
+		retry = len(current.Teardown) > 0
+		current.Teardown = append(current.Teardown, steps...)
+		if hostsReleased {
+			current.TornDownAt = time.Now()
+		}
+
+		return bookings.Update(current)
+	}); err != nil {
+		return
+	}
+
+	var failures []string
+	for _, step := range steps {
+		if !step.Success {
+			failures = append(failures, fmt.Sprintf("%s %s %s: %s", step.Action, step.ResourceType, step.Resource, step.Error))
+		}
+	}
+
+	if len(failures) == 0 {
+		notifyBooking(bookingID, BookingNoticeTornDown, "", "The hosts, containers and VMs of this booking were released")
+	} else if !retry {
+		notifyBooking(bookingID, BookingNoticeTornDown, "", fmt.Sprintf("The resources of this booking were partially released, %d steps failed: %s", len(failures), strings.Join(failures, "; ")))
+	}
+
+	return
+}
+
+// teardownBookingContainer stops and deletes a booking container. The record is kept when either step fails.
+func teardownBookingContainer(api *vm.ProxmoxAPI, errProxmox error, proxmoxID int, record func(action string, err error) bool) {
+	if errProxmox != nil {
+		record(TeardownActionDelete, errProxmox)
+		return
+	}
+
+	ct, err := api.Container(proxmoxID)
+	if err != nil {
+		record(TeardownActionDelete, err)
+		return
+	}
+
+	if ct.Status == "running" && !record(TeardownActionStop, api.StopContainer(ct)) {
+		return
+	}
+
+	if !record(TeardownActionDelete, api.DeleteContainer(ct)) {
+		return
+	}
+
+	if err = RemoveBookingContainer(proxmoxID); err != nil {
+		log.Errorf("failed to forget container %d: %v", proxmoxID, err)
+	}
+}
+
+// teardownBookingVM stops and deletes a booking VM. The record is kept when either step fails.
+func teardownBookingVM(api *vm.ProxmoxAPI, errProxmox error, proxmoxID int, record func(action string, err error) bool) {
+	if errProxmox != nil {
+		record(TeardownActionDelete, errProxmox)
+		return
+	}
+
+	machine, err := api.VirtualMachine(proxmoxID)
+	if err != nil {
+		record(TeardownActionDelete, err)
+		return
+	}
+
+	if machine.IsRunning() && !record(TeardownActionStop, api.StopVirtualMachine(machine)) {
+		return
+	}
+
+	if !record(TeardownActionDelete, api.DeleteVirtualMachine(machine)) {
+		return
+	}
+
+	if err = RemoveBookingVM(proxmoxID); err != nil {
+		log.Errorf("failed to forget VM %d: %v", proxmoxID, err)
+	}
+}
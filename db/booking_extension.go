@@ -0,0 +1,242 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/z46-dev/gomysql"
+)
+
+var (
+	ErrBookingExtensionNotFound = errors.New("booking extension not found")
+	ErrBookingExtensionReviewed = errors.New("booking extension was already reviewed")
+	ErrBookingExtensionPending  = errors.New("booking already has an extension awaiting review")
+	ErrBookingNoEndTime         = errors.New("booking has no end time")
+)
+
+// BookingExtensionByID fetches a booking extension by its ID.
+func BookingExtensionByID(extensionID int) (record *BookingExtension, err error) {
+	if record, err = bookingExtensions.Select(extensionID); err == nil && record == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingExtensionNotFound, extensionID)
+	}
+
+	return
+}
+
+// BookingExtensionsForBooking lists the extensions asked for a booking, oldest first.
+func BookingExtensionsForBooking(bookingID int) (records []*BookingExtension, err error) {
+	if records, err = bookingExtensions.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(bookingExtensions.FieldBySQLName("booking_id"), gomysql.OpEqual, bookingID)); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	}
+
+	return
+}
+
+// PendingBookingExtensions lists the extensions awaiting review across every booking, oldest first.
+func PendingBookingExtensions() (records []*BookingExtension, err error) {
+	if records, err = bookingExtensions.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(bookingExtensions.FieldBySQLName("status"), gomysql.OpEqual, BookingRequestStatusPending)); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	}
+
+	return
+}
+
+// extensionPolicyViolations lists the limits a booking would break by ending at newEnd, including the longest booking
+// the requester's quota allows. The caller must hold the booking's lock.
+func extensionPolicyViolations(booking *Booking, newEnd time.Time, previous []*BookingExtension, requestedBy string, groups []string) (reasons []string) {
+	var maxTotal time.Duration = time.Duration(config.Config.Extensions.MaxTotalDays) * 24 * time.Hour
+	if total := newEnd.Sub(booking.StartTime); total > maxTotal {
+		reasons = append(reasons, fmt.Sprintf("the booking would last %d days, more than the %d allowed", int((total+24*time.Hour-1)/(24*time.Hour)), config.Config.Extensions.MaxTotalDays))
+	}
+
+	var approved int
+	for _, extension := range previous {
+		if extension.Status == BookingRequestStatusApproved {
+			approved++
+		}
+	}
+
+	if approved >= config.Config.Extensions.MaxCount {
+		reasons = append(reasons, fmt.Sprintf("the booking was already extended %d times, the limit is %d", approved, config.Config.Extensions.MaxCount))
+	}
+
+	if limits, err := EffectiveQuotaLimits(requestedBy, groups); err != nil {
+		reasons = append(reasons, fmt.Sprintf("the quota could not be checked: %v", err))
+	} else if err = limits.checkDuration(booking.StartTime, newEnd); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+
+	var managementIPs []string = slices.Clone(booking.OwnedHostManagementIPs)
+	reservations, err := HostReservationsForBooking(booking.ID)
+	if err != nil {
+		return append(reasons, fmt.Sprintf("the reserved hosts could not be checked: %v", err))
+	}
+
+	for _, reservation := range reservations {
+		managementIPs = appendUniqueString(managementIPs, reservation.ManagementIP)
+	}
+
+	if err := HostConflicts(managementIPs, booking.EndTime, newEnd, booking.ID); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+
+	return
+}
+
+// applyBookingExtension moves the booking's end time, and that of its host reservations, and clears its expiry state
+// so that the new end time is warned about again. The caller must hold the booking's lock and store both records.
+func applyBookingExtension(booking *Booking, extension *BookingExtension) (err error) {
+	extension.Status = BookingRequestStatusApproved
+	extension.PreviousEndTime = booking.EndTime
+	extension.NewEndTime = booking.EndTime.Add(time.Duration(extension.Days) * 24 * time.Hour)
+
+	booking.EndTime = extension.NewEndTime
+	booking.ExpiryWarningsSent = nil
+	booking.ExpiredAt = time.Time{}
+
+	err = extendHostReservations(booking.ID, booking.EndTime)
+	return
+}
+
+// RequestBookingExtension asks to extend a booking by a number of days. The extension is approved right away when
+// the booking stays within the configured limits and the requester's quota, and its hosts have no maintenance or other
+// booking scheduled in the added time, otherwise it waits for an admin with the reasons it needs one.
+func RequestBookingExtension(bookingID, days int, justification, requestedBy string, groups []string) (extension *BookingExtension, err error) {
+	extension = &BookingExtension{
+		BookingID:     bookingID,
+		RequestedBy:   requestedBy,
+		RequestedAt:   time.Now(),
+		Days:          days,
+		Justification: justification,
+		Status:        BookingRequestStatusPending,
+	}
+
+	if err = withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case booking == nil:
+			return fmt.Errorf("%w: %d", ErrBookingNotFound, bookingID)
+		case booking.Status == BookingStatusDone:
+			return fmt.Errorf("%w: %d", ErrBookingEnded, bookingID)
+		case booking.EndTime.IsZero():
+			return fmt.Errorf("%w: %d", ErrBookingNoEndTime, bookingID)
+		}
+
+		previous, err := BookingExtensionsForBooking(bookingID)
+		if err != nil {
+			return err
+		}
+
+		for _, other := range previous {
+			if other.Status == BookingRequestStatusPending {
+				return fmt.Errorf("%w: %d", ErrBookingExtensionPending, other.ID)
+			}
+		}
+
+		extension.NewEndTime = booking.EndTime.Add(time.Duration(days) * 24 * time.Hour)
+		if extension.ReviewReasons = extensionPolicyViolations(booking, extension.NewEndTime, previous, requestedBy, groups); len(extension.ReviewReasons) > 0 {
+			return bookingExtensions.Insert(extension)
+		}
+
+		if err := applyBookingExtension(booking, extension); err != nil {
+			return err
+		}
+
+		extension.AutoApproved = true
+		extension.ReviewedAt = extension.RequestedAt
+
+		if err := bookingExtensions.Insert(extension); err != nil {
+			return err
+		}
+
+		return bookings.Update(booking)
+	}); err != nil {
+		return
+	}
+
+	if extension.AutoApproved {
+		notifyBooking(bookingID, BookingNoticeExtended, "", fmt.Sprintf("This booking was extended by %d days, it now ends at %s", days, extension.NewEndTime.Format(time.RFC3339)))
+	}
+
+	return
+}
+
+// reviewBookingExtension records the review of a pending extension, applying it when approved.
+func reviewBookingExtension(extensionID int, status BookingRequestStatus, reviewer, comment string) (extension *BookingExtension, err error) {
+	if extension, err = BookingExtensionByID(extensionID); err != nil {
+		return
+	}
+
+	err = withBookingLock(extension.BookingID, func() error {
+		current, err := bookingExtensions.Select(extensionID)
+		if err != nil {
+			return err
+		} else if current == nil {
+			return fmt.Errorf("%w: %d", ErrBookingExtensionNotFound, extensionID)
+		} else if current.Status != BookingRequestStatusPending {
+			return fmt.Errorf("%w: %d", ErrBookingExtensionReviewed, extensionID)
+		}
+
+		current.Status = status
+		current.Reviewer = reviewer
+		current.ReviewerComment = comment
+		current.ReviewedAt = time.Now()
+
+		if status == BookingRequestStatusApproved {
+			booking, err := bookings.Select(current.BookingID)
+			if err != nil {
+				return err
+			} else if booking == nil {
+				return fmt.Errorf("%w: %d", ErrBookingNotFound, current.BookingID)
+			} else if booking.Status == BookingStatusDone {
+				return fmt.Errorf("%w: %d", ErrBookingEnded, current.BookingID)
+			}
+
+			if err := applyBookingExtension(booking, current); err != nil {
+				return err
+			}
+
+			if err := bookings.Update(booking); err != nil {
+				return err
+			}
+		}
+
+		extension = current
+		return bookingExtensions.Update(current)
+	})
+
+	return
+}
+
+// ApproveBookingExtension approves a pending extension and moves the booking's end time.
+func ApproveBookingExtension(extensionID int, reviewer, comment string) (extension *BookingExtension, err error) {
+	if extension, err = reviewBookingExtension(extensionID, BookingRequestStatusApproved, reviewer, comment); err != nil {
+		return
+	}
+
+	notifyBooking(extension.BookingID, BookingNoticeExtended, "", fmt.Sprintf("This booking was extended by %d days by %s, it now ends at %s", extension.Days, reviewer, extension.NewEndTime.Format(time.RFC3339)))
+	return
+}
+
+// RejectBookingExtension rejects a pending extension with the reviewer's comment.
+func RejectBookingExtension(extensionID int, reviewer, comment string) (extension *BookingExtension, err error) {
+	if extension, err = reviewBookingExtension(extensionID, BookingRequestStatusRejected, reviewer, comment); err != nil {
+		return
+	}
+
+	var message string = fmt.Sprintf("Extension %d of this booking was rejected by %s", extension.ID, reviewer)
+	if comment != "" {
+		message += ": " + comment
+	}
+
+	notifyBooking(extension.BookingID, BookingNoticeExtensionRejected, "", message)
+	return
+}
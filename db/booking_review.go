@@ -0,0 +1,529 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/luthermonson/go-proxmox"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/ssh"
+	"github.com/opnlaas/opnlaas/vm"
+	"github.com/z46-dev/gomysql"
+)
+
+const (
+	FulfillmentResourceHost      = "host"
+	FulfillmentResourceContainer = "container"
+	FulfillmentResourceVM        = "vm"
+)
+
+var (
+	ErrBookingRequestNotFound = errors.New("booking request not found")
+	ErrBookingRequestReviewed = errors.New("booking request was already reviewed")
+	ErrBookingNoNetwork       = errors.New("booking has no free network addresses")
+)
+
+// BookingRequestByID fetches a booking request by its ID.
+func BookingRequestByID(requestID int) (record *BookingRequest, err error) {
+	if record, err = bookingRequests.Select(requestID); err == nil && record == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingRequestNotFound, requestID)
+	}
+
+	return
+}
+
+// PendingBookingRequests lists the requests awaiting review across every booking, oldest first.
+func PendingBookingRequests() (records []*BookingRequest, err error) {
+	if records, err = bookingRequests.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(bookingRequests.FieldBySQLName("status"), gomysql.OpEqual, BookingRequestStatusPending)); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	}
+
+	return
+}
+
+// reviewBookingRequest records the review of a pending request. The booking leaves the pending state once none of
+// its requests await review. The approve hook, when set, runs under the booking's lock before anything is stored and
+// can refuse the review.
+func reviewBookingRequest(requestID int, status BookingRequestStatus, reviewer, comment string, approve func(request *BookingRequest, booking *Booking) error) (request *BookingRequest, err error) {
+	if request, err = BookingRequestByID(requestID); err != nil {
+		return
+	}
+
+	err = withBookingLock(request.BookingID, func() error {
+		current, err := bookingRequests.Select(requestID)
+		if err != nil {
+			return err
+		} else if current == nil {
+			return fmt.Errorf("%w: %d", ErrBookingRequestNotFound, requestID)
+		} else if current.Status != BookingRequestStatusPending {
+			return fmt.Errorf("%w: %d", ErrBookingRequestReviewed, requestID)
+		}
+
+		booking, err := bookings.Select(current.BookingID)
+		if err != nil {
+			return err
+		} else if booking == nil {
+			return fmt.Errorf("%w: %d", ErrBookingNotFound, current.BookingID)
+		}
+
+		if approve != nil {
+			if err := approve(current, booking); err != nil {
+				return err
+			}
+		}
+
+		current.Status = status
+		current.Reviewer = reviewer
+		current.ReviewerComment = comment
+		current.ReviewedAt = time.Now()
+		if err := bookingRequests.Update(current); err != nil {
+			return err
+		}
+
+		request = current
+		if booking.Status != BookingStatusActiveWithRequestPending {
+			return nil
+		}
+
+		requests, err := BookingRequestsForBooking(current.BookingID)
+		if err != nil {
+			return err
+		}
+
+		if slices.ContainsFunc(requests, func(other *BookingRequest) bool { return other.Status == BookingRequestStatusPending }) {
+			return nil
+		}
+
+		booking.Status = BookingStatusActive
+		return bookings.Update(booking)
+	})
+
+	return
+}
+
+// RejectBookingRequest rejects a pending request with the reviewer's comment.
+func RejectBookingRequest(requestID int, reviewer, comment string) (request *BookingRequest, err error) {
+	if request, err = reviewBookingRequest(requestID, BookingRequestStatusRejected, reviewer, comment, nil); err != nil {
+		return
+	}
+
+	var message string = fmt.Sprintf("Booking request %d was rejected by %s", request.ID, reviewer)
+	if comment != "" {
+		message += ": " + comment
+	}
+
+	notifyBooking(request.BookingID, BookingNoticeRequestRejected, "", message)
+	return
+}
+
+// ApproveBookingRequest approves a pending request and queues a job provisioning what it asked for. Resources
+// that could not be provisioned are reported on the request's fulfillment. Requests of scheduled bookings reserve
+// their hosts and Proxmox capacity instead, and are provisioned when the booking starts, so no job is returned.
+// Requests past their requester's quota are refused.
+func ApproveBookingRequest(requestID int, reviewer, comment string) (request *BookingRequest, job *Job, err error) {
+	var window string
+	if request, err = reviewBookingRequest(requestID, BookingRequestStatusApproved, reviewer, comment, func(current *BookingRequest, booking *Booking) error {
+		if err := checkRequestQuota(current, booking); err != nil {
+			return err
+		}
+
+		if booking.Status != BookingStatusScheduled {
+			return nil
+		}
+
+		window = describeSpan(booking.StartTime, booking.EndTime)
+		return reserveRequestHosts(current, booking)
+	}); err != nil {
+		return
+	}
+
+	if window != "" {
+		notifyBooking(request.BookingID, BookingNoticeRequestApproved, "", fmt.Sprintf("Booking request %d was approved by %s, its hosts are reserved from %s and are provisioned when the booking starts", request.ID, reviewer, window))
+		return
+	}
+
+	notifyBooking(request.BookingID, BookingNoticeRequestApproved, "", fmt.Sprintf("Booking request %d was approved by %s", request.ID, reviewer))
+	request, job, err = enqueueBookingFulfillment(requestID, request.BookingID, reviewer)
+	return
+}
+
+// enqueueBookingFulfillment queues the job provisioning an approved request and records it on the request.
+func enqueueBookingFulfillment(requestID, bookingID int, createdBy string) (request *BookingRequest, job *Job, err error) {
+	if job, err = EnqueueJob(JobKindBookingFulfillment, fmt.Sprintf("booking:%d", bookingID), createdBy, func(handle *JobHandle) error {
+		outcomes, err := FulfillBookingRequest(requestID, handle.Progress)
+		if err != nil {
+			return err
+		}
+
+		return handle.SetResult(outcomes)
+	}); err != nil {
+		return
+	}
+
+	err = withBookingLock(bookingID, func() error {
+		current, err := bookingRequests.Select(requestID)
+		if err != nil || current == nil {
+			return err
+		}
+
+		current.JobID = job.ID
+		request = current
+		return bookingRequests.Update(current)
+	})
+
+	return
+}
+
+// FulfillBookingRequest provisions the hosts, containers and VMs of an approved request and records the outcome of
+// each on the request. Individual failures do not stop the others. The progress callback may be nil.
+func FulfillBookingRequest(requestID int, progress func(percent int, message string)) (outcomes []FulfillmentOutcome, err error) {
+	var (
+		request *BookingRequest
+		booking *Booking
+	)
+
+	if request, err = BookingRequestByID(requestID); err != nil {
+		return
+	}
+
+	if booking, err = BookingByID(request.BookingID); err != nil {
+		return
+	} else if booking == nil {
+		err = fmt.Errorf("%w: %d", ErrBookingNotFound, request.BookingID)
+		return
+	}
+
+	var total int = len(request.Hosts) + len(request.Containers) + len(request.VMs)
+	record := func(outcome FulfillmentOutcome, err error) {
+		if err != nil {
+			outcome.Error = err.Error()
+		} else {
+			outcome.Success = true
+		}
+
+		outcomes = append(outcomes, outcome)
+		if progress != nil {
+			progress(len(outcomes)*100/max(total, 1), fmt.Sprintf("%d of %d resources provisioned", len(outcomes), total))
+		}
+	}
+
+	for _, host := range request.Hosts {
+		record(FulfillmentOutcome{ResourceType: FulfillmentResourceHost, Resource: host.ManagementIP}, fulfillBookingHost(booking, host.ManagementIP))
+	}
+
+	if len(request.Containers) > 0 || len(request.VMs) > 0 {
+		var api, errProxmox = vm.SharedProxmox()
+
+		for i, ct := range request.Containers {
+			var outcome FulfillmentOutcome = FulfillmentOutcome{ResourceType: FulfillmentResourceContainer, Resource: resourceName(ct.Name, "ct", booking, i)}
+			if errProxmox != nil {
+				record(outcome, errProxmox)
+			} else {
+				outcome.ProxmoxID, err = createBookingContainer(api, booking, ct, i)
+				record(outcome, err)
+			}
+		}
+
+		for i, machine := range request.VMs {
+			var outcome FulfillmentOutcome = FulfillmentOutcome{ResourceType: FulfillmentResourceVM, Resource: resourceName(machine.Name, "vm", booking, i)}
+			if errProxmox != nil {
+				record(outcome, errProxmox)
+			} else {
+				outcome.ProxmoxID, err = createBookingVM(api, booking, machine, i)
+				record(outcome, err)
+			}
+		}
+	}
+
+	if err = withBookingLock(request.BookingID, func() error {
+		current, err := bookingRequests.Select(requestID)
+		if err != nil || current == nil {
+			return err
+		}
+
+		current.Fulfillment = outcomes
+		current.FulfilledAt = time.Now()
+		return bookingRequests.Update(current)
+	}); err != nil {
+		return
+	}
+
+	var failures []string
+	for _, outcome := range outcomes {
+		if !outcome.Success {
+			failures = append(failures, fmt.Sprintf("%s %s: %s", outcome.ResourceType, outcome.Resource, outcome.Error))
+		}
+	}
+
+	if len(failures) == 0 {
+		notifyBooking(request.BookingID, BookingNoticeRequestFulfilled, "", fmt.Sprintf("Booking request %d was fulfilled", request.ID))
+	} else {
+		notifyBooking(request.BookingID, BookingNoticeRequestFulfilled, "", fmt.Sprintf("Booking request %d was partially fulfilled, %d of %d resources failed: %s", request.ID, len(failures), total, strings.Join(failures, "; ")))
+	}
+
+	return
+}
+
+// fulfillBookingHost assigns a host to the booking unless another booking holds or reserved it in the meantime,
+// dropping the booking's own reservation of it.
+func fulfillBookingHost(booking *Booking, managementIP string) (err error) {
+	hostReservationsLock.Lock()
+	err = hostHeldDuring(managementIP, booking.StartTime, booking.EndTime, booking.ID)
+	hostReservationsLock.Unlock()
+	if err != nil {
+		return
+	}
+
+	if err = AssignHostToBooking(booking.ID, managementIP); err != nil {
+		return
+	}
+
+	err = releaseHostReservations(booking.ID, managementIP)
+	return
+}
+
+// pendingBookingAddresses are the addresses handed to containers still being created, keyed by booking. They only
+// show up on the booking's containers once Proxmox has created them, so they are held here in the meantime.
+var (
+	pendingBookingAddressesLock sync.Mutex
+	pendingBookingAddresses     = map[int][]string{}
+)
+
+// reserveBookingAddress picks the first address of the booking's block not used by its containers or handed to one
+// being created, and holds it until releaseBookingAddress. The first usable address is kept for the gateway.
+func reserveBookingAddress(booking *Booking) (address, gateway net.IP, prefix int, err error) {
+	var (
+		first, last net.IP
+		block       *net.IPNet
+	)
+
+	if booking.CIDRBlock == "" {
+		err = fmt.Errorf("%w: no CIDR block is set", ErrBookingNoNetwork)
+		return
+	}
+
+	if first, last, block, err = ssh.ParseSubnet(booking.CIDRBlock); err != nil {
+		return
+	} else if first == nil {
+		err = fmt.Errorf("%w: %s is not an IPv4 block", ErrBookingNoNetwork, booking.CIDRBlock)
+		return
+	}
+
+	gateway = first
+	prefix, _ = block.Mask.Size()
+
+	err = withBookingLock(booking.ID, func() error {
+		containers, err := BookingContainersForBooking(booking.ID)
+		if err != nil {
+			return err
+		}
+
+		pendingBookingAddressesLock.Lock()
+		defer pendingBookingAddressesLock.Unlock()
+
+		var used []string = slices.Clone(pendingBookingAddresses[booking.ID])
+		for _, ct := range containers {
+			used = append(used, ct.NetworkAddresses...)
+		}
+
+		for _, candidate := range ssh.GetSubnetRange(first, last)[1:] {
+			if !slices.Contains(used, candidate.String()) {
+				address = candidate
+				pendingBookingAddresses[booking.ID] = append(pendingBookingAddresses[booking.ID], candidate.String())
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%w: %s", ErrBookingNoNetwork, booking.CIDRBlock)
+	})
+
+	return
+}
+
+// releaseBookingAddress drops the hold reserveBookingAddress took, once the container is recorded or failed.
+func releaseBookingAddress(bookingID int, address net.IP) {
+	pendingBookingAddressesLock.Lock()
+	defer pendingBookingAddressesLock.Unlock()
+
+	var remaining []string
+	for _, pending := range pendingBookingAddresses[bookingID] {
+		if pending != address.String() {
+			remaining = append(remaining, pending)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(pendingBookingAddresses, bookingID)
+	} else {
+		pendingBookingAddresses[bookingID] = remaining
+	}
+}
+
+// checkBookingOpen re-reads the booking under its lock before something is created for it. Fulfillment runs as a
+// job, the booking may have been released or reaped since it was queued.
+func checkBookingOpen(bookingID int) error {
+	return withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil {
+			return err
+		} else if booking == nil {
+			return fmt.Errorf("%w: %d", ErrBookingNotFound, bookingID)
+		} else if bookingEnded(booking) {
+			return fmt.Errorf("%w: %d", ErrBookingEnded, bookingID)
+		}
+
+		return nil
+	})
+}
+
+// resourceName names a container or VM after the request, falling back to one derived from the booking.
+func resourceName(name, kind string, booking *Booking, index int) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("booking-%d-%s-%d", booking.ID, kind, index+1)
+}
+
+func createBookingContainer(api *vm.ProxmoxAPI, booking *Booking, ct BookingRequestCT, index int) (proxmoxID int, err error) {
+	var (
+		address, gateway net.IP
+		prefix           int
+		node             *proxmox.Node = api.NextNode()
+		result           *vm.ProxmoxAPICreateResult
+		password         []byte = make([]byte, 16)
+	)
+
+	if err = checkBookingOpen(booking.ID); err != nil {
+		return
+	}
+
+	if node == nil {
+		err = errors.New("no online proxmox nodes")
+		return
+	}
+
+	if address, gateway, prefix, err = reserveBookingAddress(booking); err != nil {
+		return
+	}
+
+	defer releaseBookingAddress(booking.ID, address)
+
+	// The root password is never shown to anyone, the owner logs in with the key they gave
+	rand.Read(password)
+
+	if result, err = api.CreateContainer(node, &vm.ContainerCreateOptions{
+		TemplatePath:     ct.Template,
+		StoragePool:      config.Config.Proxmox.Storage,
+		Hostname:         resourceName(ct.Name, "ct", booking, index),
+		RootPassword:     hex.EncodeToString(password),
+		RootSSHPublicKey: strings.TrimSpace(ct.SSHPublicKey),
+		StorageSizeGB:    ct.DiskGB,
+		MemoryMB:         ct.MemoryMB,
+		Cores:            ct.Cores,
+		GatewayIPv4:      gateway.String(),
+		IPv4Address:      address.String(),
+		CIDRBlock:        prefix,
+		NameServer:       config.Config.Proxmox.DNS,
+		SearchDomain:     booking.DNSName,
+	}); err != nil {
+		return
+	}
+
+	proxmoxID = result.CTID
+	if err = AddBookingContainer(&BookingContainer{
+		ProxmoxID:        result.CTID,
+		BookingID:        booking.ID,
+		Template:         ct.Template,
+		Cores:            ct.Cores,
+		MemoryMB:         ct.MemoryMB,
+		DiskGB:           ct.DiskGB,
+		NetworkAddresses: []string{address.String()},
+	}); err != nil {
+		// Teardown only finds containers the booking has a record of, so this one would hold its address forever
+		teardownBookingContainer(api, nil, result.CTID, discardLogger("container", result.CTID))
+	}
+
+	return
+}
+
+func createBookingVM(api *vm.ProxmoxAPI, booking *Booking, machine BookingRequestVM, index int) (proxmoxID int, err error) {
+	var (
+		node   *proxmox.Node = api.NextNode()
+		iso    *StoredISOImage
+		volume string
+		result *vm.ProxmoxAPICreateVMResult
+	)
+
+	if err = checkBookingOpen(booking.ID); err != nil {
+		return
+	}
+
+	if node == nil {
+		err = errors.New("no online proxmox nodes")
+		return
+	}
+
+	if machine.ISOSelection != "" {
+		if iso, err = StoredISOImages.Select(machine.ISOSelection); err != nil {
+			return
+		} else if iso == nil {
+			err = fmt.Errorf("iso %s not found", machine.ISOSelection)
+			return
+		}
+
+		if volume, err = api.EnsureISO(node, config.Config.Proxmox.ISOStorage, iso.FullISOPath); err != nil {
+			return
+		}
+	}
+
+	if result, err = api.CreateVirtualMachine(node, &vm.VirtualMachineCreateOptions{
+		Name:          resourceName(machine.Name, "vm", booking, index),
+		StoragePool:   config.Config.Proxmox.Storage,
+		ISOVolume:     volume,
+		StorageSizeGB: machine.DiskGB,
+		MemoryMB:      machine.MemoryMB,
+		Cores:         machine.Cores,
+	}); err != nil {
+		return
+	}
+
+	var operatingSystem string
+	if iso != nil {
+		operatingSystem = strings.TrimSpace(iso.DistroName + " " + iso.Version)
+	}
+
+	proxmoxID = result.VMID
+	if err = AddBookingVM(&BookingVM{
+		ProxmoxID:       result.VMID,
+		BookingID:       booking.ID,
+		OperatingSystem: operatingSystem,
+		Cores:           machine.Cores,
+		MemoryMB:        machine.MemoryMB,
+		DiskGB:          machine.DiskGB,
+	}); err != nil {
+		teardownBookingVM(api, nil, result.VMID, discardLogger("VM", result.VMID))
+	}
+
+	return
+}
+
+// discardLogger reports the teardown steps of a container or VM deleted because the booking could not record it.
+func discardLogger(kind string, proxmoxID int) func(action string, err error) bool {
+	return func(action string, err error) bool {
+		if err != nil {
+			log.Errorf("failed to %s unrecorded booking %s %d: %v", action, kind, proxmoxID, err)
+		}
+
+		return err == nil
+	}
+}
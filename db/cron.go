@@ -0,0 +1,154 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCronSpec = errors.New("invalid cron spec")
+
+// CronSpec is a parsed five field cron expression: minute, hour, day of month, month and day of week.
+// Each field supports "*", single values, ranges ("1-5"), lists ("1,3,5") and steps ("*/15", "0-30/10").
+type CronSpec struct {
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+
+	// Cron only requires one of the day fields to match when both are restricted
+	daysOfMonthAny bool
+	daysOfWeekAny  bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week, sunday is 0 (7 is accepted as an alias)
+}
+
+// ParseCronSpec parses a five field cron expression.
+func ParseCronSpec(spec string) (parsed *CronSpec, err error) {
+	var (
+		fields []string = strings.Fields(spec)
+		masks  [5]uint64
+	)
+
+	if len(fields) != 5 {
+		err = fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidCronSpec, len(fields))
+		return
+	}
+
+	for i, field := range fields {
+		var bounds cronField = cronFields[i]
+		if i == 4 {
+			bounds.max = 7
+		}
+
+		if masks[i], err = parseCronField(field, bounds); err != nil {
+			err = fmt.Errorf("%w: field %d %q: %v", ErrInvalidCronSpec, i+1, field, err)
+			return
+		}
+	}
+
+	// Fold sunday-as-7 onto 0
+	if masks[4]&(1<<7) != 0 {
+		masks[4] = (masks[4] &^ (1 << 7)) | 1
+	}
+
+	parsed = &CronSpec{
+		minutes:        masks[0],
+		hours:          masks[1],
+		daysOfMonth:    masks[2],
+		months:         masks[3],
+		daysOfWeek:     masks[4],
+		daysOfMonthAny: strings.HasPrefix(fields[2], "*"),
+		daysOfWeekAny:  strings.HasPrefix(fields[4], "*"),
+	}
+
+	return
+}
+
+func parseCronField(field string, bounds cronField) (mask uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		var (
+			rangePart string = part
+			step      int    = 1
+			low       int    = bounds.min
+			high      int    = bounds.max
+		)
+
+		if before, after, found := strings.Cut(part, "/"); found {
+			rangePart = before
+			if step, err = strconv.Atoi(after); err != nil || step <= 0 {
+				err = fmt.Errorf("bad step %q", after)
+				return
+			}
+		}
+
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			lowStr, highStr, _ := strings.Cut(rangePart, "-")
+			if low, err = strconv.Atoi(lowStr); err != nil {
+				return
+			}
+
+			if high, err = strconv.Atoi(highStr); err != nil {
+				return
+			}
+		default:
+			if low, err = strconv.Atoi(rangePart); err != nil {
+				return
+			}
+
+			// "5/10" means starting at 5 every 10
+			if step == 1 {
+				high = low
+			}
+		}
+
+		if low < bounds.min || high > bounds.max || low > high {
+			err = fmt.Errorf("value out of range %d-%d", bounds.min, bounds.max)
+			return
+		}
+
+		for v := low; v <= high; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+
+	return
+}
+
+// Matches reports whether the spec fires during the minute containing t.
+func (c *CronSpec) Matches(t time.Time) bool {
+	if c.minutes&(1<<uint(t.Minute())) == 0 || c.hours&(1<<uint(t.Hour())) == 0 || c.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	var (
+		dayOfMonth bool = c.daysOfMonth&(1<<uint(t.Day())) != 0
+		dayOfWeek  bool = c.daysOfWeek&(1<<uint(t.Weekday())) != 0
+	)
+
+	switch {
+	case c.daysOfMonthAny && c.daysOfWeekAny:
+		return true
+	case c.daysOfMonthAny:
+		return dayOfWeek
+	case c.daysOfWeekAny:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
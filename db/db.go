@@ -20,6 +20,38 @@ var (
 	bookingRequests *gomysql.RegisteredStruct[BookingRequest]
 	// You should not be calling this api directly for lock safety
 	bookings *gomysql.RegisteredStruct[Booking]
+	// You should not be calling this api directly for lock safety
+	jobs *gomysql.RegisteredStruct[Job]
+	// You should not be calling this api directly for lock safety
+	powerSchedules *gomysql.RegisteredStruct[PowerSchedule]
+	// You should not be calling this api directly for lock safety
+	hostEvents *gomysql.RegisteredStruct[HostEvent]
+	// You should not be calling this api directly for lock safety
+	hostFirmware *gomysql.RegisteredStruct[HostFirmware]
+	// You should not be calling this api directly for lock safety
+	firmwarePackages *gomysql.RegisteredStruct[FirmwarePackage]
+	// You should not be calling this api directly for lock safety
+	tagRestrictions *gomysql.RegisteredStruct[TagRestriction]
+	// You should not be calling this api directly for lock safety
+	maintenanceWindows *gomysql.RegisteredStruct[MaintenanceWindow]
+	// You should not be calling this api directly for lock safety
+	bookingNotices *gomysql.RegisteredStruct[BookingNotice]
+	// You should not be calling this api directly for lock safety
+	hostWipes *gomysql.RegisteredStruct[HostWipe]
+	// You should not be calling this api directly for lock safety
+	biosProfiles *gomysql.RegisteredStruct[BIOSProfile]
+	// You should not be calling this api directly for lock safety
+	archivedHosts *gomysql.RegisteredStruct[ArchivedHost]
+	// You should not be calling this api directly for lock safety
+	bookingExtensions *gomysql.RegisteredStruct[BookingExtension]
+	// You should not be calling this api directly for lock safety
+	hostReservations *gomysql.RegisteredStruct[HostReservation]
+	// You should not be calling this api directly for lock safety
+	quotaPolicies *gomysql.RegisteredStruct[QuotaPolicy]
+	// You should not be calling this api directly for lock safety
+	bookingCartRecords *gomysql.RegisteredStruct[BookingCartRecord]
+	// You should not be calling this api directly for lock safety
+	bookingCartHosts *gomysql.RegisteredStruct[BookingCartHost]
 )
 
 func InitDB() (err error) {
@@ -65,6 +97,106 @@ func InitDB() (err error) {
 		return
 	}
 
+	if jobs, err = gomysql.Register(Job{}); err != nil {
+		dbLog.Errorf("Failed to register Job struct: %v\n", err)
+		return
+	}
+
+	if powerSchedules, err = gomysql.Register(PowerSchedule{}); err != nil {
+		dbLog.Errorf("Failed to register PowerSchedule struct: %v\n", err)
+		return
+	}
+
+	if hostEvents, err = gomysql.Register(HostEvent{}); err != nil {
+		dbLog.Errorf("Failed to register HostEvent struct: %v\n", err)
+		return
+	}
+
+	if hostFirmware, err = gomysql.Register(HostFirmware{}); err != nil {
+		dbLog.Errorf("Failed to register HostFirmware struct: %v\n", err)
+		return
+	}
+
+	if firmwarePackages, err = gomysql.Register(FirmwarePackage{}); err != nil {
+		dbLog.Errorf("Failed to register FirmwarePackage struct: %v\n", err)
+		return
+	}
+
+	if tagRestrictions, err = gomysql.Register(TagRestriction{}); err != nil {
+		dbLog.Errorf("Failed to register TagRestriction struct: %v\n", err)
+		return
+	}
+
+	if maintenanceWindows, err = gomysql.Register(MaintenanceWindow{}); err != nil {
+		dbLog.Errorf("Failed to register MaintenanceWindow struct: %v\n", err)
+		return
+	}
+
+	if bookingNotices, err = gomysql.Register(BookingNotice{}); err != nil {
+		dbLog.Errorf("Failed to register BookingNotice struct: %v\n", err)
+		return
+	}
+
+	if hostWipes, err = gomysql.Register(HostWipe{}); err != nil {
+		dbLog.Errorf("Failed to register HostWipe struct: %v\n", err)
+		return
+	}
+
+	if biosProfiles, err = gomysql.Register(BIOSProfile{}); err != nil {
+		dbLog.Errorf("Failed to register BIOSProfile struct: %v\n", err)
+		return
+	}
+
+	if archivedHosts, err = gomysql.Register(ArchivedHost{}); err != nil {
+		dbLog.Errorf("Failed to register ArchivedHost struct: %v\n", err)
+		return
+	}
+
+	if bookingExtensions, err = gomysql.Register(BookingExtension{}); err != nil {
+		dbLog.Errorf("Failed to register BookingExtension struct: %v\n", err)
+		return
+	}
+
+	if hostReservations, err = gomysql.Register(HostReservation{}); err != nil {
+		dbLog.Errorf("Failed to register HostReservation struct: %v\n", err)
+		return
+	}
+
+	if quotaPolicies, err = gomysql.Register(QuotaPolicy{}); err != nil {
+		dbLog.Errorf("Failed to register QuotaPolicy struct: %v\n", err)
+		return
+	}
+
+	if bookingCartRecords, err = gomysql.Register(BookingCartRecord{}); err != nil {
+		dbLog.Errorf("Failed to register BookingCartRecord struct: %v\n", err)
+		return
+	}
+
+	if bookingCartHosts, err = gomysql.Register(BookingCartHost{}); err != nil {
+		dbLog.Errorf("Failed to register BookingCartHost struct: %v\n", err)
+		return
+	}
+
+	if err = failInterruptedJobs(); err != nil {
+		dbLog.Errorf("Failed to clean up interrupted jobs: %v\n", err)
+		return
+	}
+
+	if err = clearInterruptedFirmwareUpdates(); err != nil {
+		dbLog.Errorf("Failed to clean up interrupted firmware updates: %v\n", err)
+		return
+	}
+
+	if err = failInterruptedWipes(); err != nil {
+		dbLog.Errorf("Failed to clean up interrupted wipes: %v\n", err)
+		return
+	}
+
+	if err = loadBookingCarts(); err != nil {
+		dbLog.Errorf("Failed to load booking carts: %v\n", err)
+		return
+	}
+
 	BeginPeriodicRefreshes()
 
 	dbLog.Success("Database initialized!")
@@ -72,6 +204,7 @@ func InitDB() (err error) {
 }
 
 func CloseDB() (err error) {
+	CloseManagementPool()
 	return gomysql.Close()
 }
 
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/ssh"
+)
+
+const maxDiscoveryAddresses = 4096
+
+var (
+	ErrDiscoveryBadSubnet     = fmt.Errorf("discovery subnet must be an IPv4 CIDR with a prefix of /30 or shorter")
+	ErrDiscoveryRangeTooLarge = fmt.Errorf("discovery subnet exceeds %d addresses", maxDiscoveryAddresses)
+)
+
+// Known IANA enterprise numbers reported in RMCP presence pongs.
+var ipmiEnterpriseVendors = map[uint32]VendorID{
+	674:   VendorDELL,
+	11:    VendorHPE,
+	232:   VendorHPE,
+	19046: VendorLenovo,
+	2:     VendorLenovo,
+	9:     VendorCisco,
+	10876: VendorSupermicro,
+	15370: VendorGigabyte,
+	2623:  VendorAsus,
+	343:   VendorIntel,
+}
+
+type DiscoveryCandidate struct {
+	ManagementIP      string         `json:"management_ip"`
+	ManagementType    ManagementType `json:"management_type"`
+	Vendor            VendorID       `json:"vendor"`
+	Model             string         `json:"model"`
+	RedfishVersion    string         `json:"redfish_version,omitempty"`
+	SupportsRedfish   bool           `json:"supports_redfish"`
+	SupportsIPMI      bool           `json:"supports_ipmi"`
+	Authenticated     bool           `json:"authenticated"`
+	AlreadyRegistered bool           `json:"already_registered"`
+}
+
+// VendorFromManufacturer maps a free-form manufacturer string reported by a BMC onto a VendorID.
+func VendorFromManufacturer(manufacturer string) VendorID {
+	var name string = strings.ToLower(manufacturer)
+
+	switch {
+	case strings.Contains(name, "dell"):
+		return VendorDELL
+	case strings.Contains(name, "hpe"), strings.Contains(name, "hewlett"), name == "hp":
+		return VendorHPE
+	case strings.Contains(name, "lenovo"):
+		return VendorLenovo
+	case strings.Contains(name, "cisco"):
+		return VendorCisco
+	case strings.Contains(name, "supermicro"), strings.Contains(name, "super micro"):
+		return VendorSupermicro
+	case strings.Contains(name, "gigabyte"):
+		return VendorGigabyte
+	case strings.Contains(name, "asus"):
+		return VendorAsus
+	case strings.Contains(name, "intel"):
+		return VendorIntel
+	}
+
+	return VendorOther
+}
+
+// discoveryAddresses expands a CIDR into its usable IPv4 host addresses.
+func discoveryAddresses(cidr string) (ips []net.IP, err error) {
+	var (
+		first, last net.IP
+		block       *net.IPNet
+	)
+
+	if first, last, block, err = ssh.ParseSubnet(cidr); err != nil {
+		return
+	}
+
+	if first == nil || last == nil {
+		err = ErrDiscoveryBadSubnet
+		return
+	}
+
+	if ones, bits := block.Mask.Size(); bits != 32 || ones > 30 {
+		err = ErrDiscoveryBadSubnet
+		return
+	} else if 1<<(bits-ones) > maxDiscoveryAddresses+2 {
+		err = ErrDiscoveryRangeTooLarge
+		return
+	}
+
+	ips = ssh.GetSubnetRange(first, last)
+	return
+}
+
+// probeRedfish checks for an unauthenticated Redfish service root at the address.
+func probeRedfish(address string, timeout time.Duration) (candidate *DiscoveryCandidate) {
+	var client *http.Client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	response, err := client.Get("https://" + address + "/redfish/v1")
+	if err != nil {
+		return
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return
+	}
+
+	var root struct {
+		RedfishVersion string
+		Vendor         string
+		Product        string
+		Oem            map[string]any
+	}
+
+	if err = json.NewDecoder(response.Body).Decode(&root); err != nil || root.RedfishVersion == "" {
+		return
+	}
+
+	candidate = &DiscoveryCandidate{
+		ManagementIP:    address,
+		ManagementType:  ManagementTypeRedfish,
+		Vendor:          VendorFromManufacturer(root.Vendor),
+		Model:           root.Product,
+		RedfishVersion:  root.RedfishVersion,
+		SupportsRedfish: true,
+	}
+
+	// Older firmware omits Vendor, but the OEM section is keyed by vendor name
+	if candidate.Vendor == VendorOther {
+		for oemName := range root.Oem {
+			if vendor := VendorFromManufacturer(oemName); vendor != VendorOther {
+				candidate.Vendor = vendor
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// probeIPMI sends an RMCP/ASF presence ping to UDP 623 and reads the pong.
+func probeIPMI(address string, timeout time.Duration) (supported bool, vendor VendorID) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(address, "623"), timeout)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	const tag byte = 0x4c
+	var ping []byte = []byte{
+		0x06, 0x00, 0xff, 0x06, // RMCP header, ASF class
+		0x00, 0x00, 0x11, 0xbe, // ASF IANA (4542)
+		0x80, tag, 0x00, 0x00, // presence ping, tag, reserved, no data
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write(ping); err != nil {
+		return
+	}
+
+	var buffer []byte = make([]byte, 64)
+	n, err := conn.Read(buffer)
+	if err != nil || n < 28 {
+		return
+	}
+
+	// Message type 0x40 is the presence pong, data bit 7 of supported entities is IPMI
+	if buffer[8] != 0x40 || buffer[9] != tag || buffer[20]&0x80 == 0 {
+		return
+	}
+
+	supported = true
+	vendor = ipmiEnterpriseVendors[binary.BigEndian.Uint32(buffer[12:16])]
+	return
+}
+
+// enrichRedfishCandidate logs in with the default credentials to read the primary system model.
+func enrichRedfishCandidate(candidate *DiscoveryCandidate) {
+	var host *Host = &Host{
+		ManagementIP:   candidate.ManagementIP,
+		ManagementType: ManagementTypeRedfish,
+	}
+
+	client, err := NewHostManagementClient(host)
+	if err != nil {
+		return
+	}
+
+	defer client.Close()
+
+	candidate.Authenticated = true
+
+	if client.redfishPrimarySystem.Model != "" {
+		candidate.Model = client.redfishPrimarySystem.Model
+	}
+
+	if vendor := VendorFromManufacturer(client.redfishPrimarySystem.Manufacturer); vendor != VendorOther {
+		candidate.Vendor = vendor
+	}
+}
+
+// probeAddress runs every probe against a single address and merges the results.
+func probeAddress(address string, timeout time.Duration) (candidate *DiscoveryCandidate) {
+	var (
+		wg               sync.WaitGroup
+		redfishCandidate *DiscoveryCandidate
+		ipmiSupported    bool
+		ipmiVendor       VendorID
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		redfishCandidate = probeRedfish(address, timeout)
+	}()
+
+	go func() {
+		defer wg.Done()
+		ipmiSupported, ipmiVendor = probeIPMI(address, timeout)
+	}()
+
+	wg.Wait()
+
+	switch {
+	case redfishCandidate != nil:
+		candidate = redfishCandidate
+		candidate.SupportsIPMI = ipmiSupported
+		enrichRedfishCandidate(candidate)
+
+		if candidate.Vendor == VendorOther {
+			candidate.Vendor = ipmiVendor
+		}
+	case ipmiSupported:
+		candidate = &DiscoveryCandidate{
+			ManagementIP:   address,
+			ManagementType: ManagementTypeIPMI,
+			Vendor:         ipmiVendor,
+			SupportsIPMI:   true,
+		}
+	}
+
+	return
+}
+
+// DiscoverBMCs probes every usable address in the CIDR for Redfish and IPMI management controllers.
+func DiscoverBMCs(cidr string) (candidates []*DiscoveryCandidate, err error) {
+	var ips []net.IP
+	if ips, err = discoveryAddresses(cidr); err != nil {
+		return
+	}
+
+	var (
+		workers   int           = max(config.Config.Management.DiscoveryWorkers, 1)
+		timeout   time.Duration = time.Duration(max(config.Config.Management.DiscoveryTimeoutMS, 100)) * time.Millisecond
+		addresses chan string   = make(chan string)
+		lock      sync.Mutex
+		wg        sync.WaitGroup
+	)
+
+	candidates = make([]*DiscoveryCandidate, 0)
+
+	for range min(workers, len(ips)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for address := range addresses {
+				if candidate := probeAddress(address, timeout); candidate != nil {
+					if existing, _ := Hosts.Select(address); existing != nil {
+						candidate.AlreadyRegistered = true
+					}
+
+					lock.Lock()
+					candidates = append(candidates, candidate)
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, ip := range ips {
+		addresses <- ip.String()
+	}
+
+	close(addresses)
+	wg.Wait()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return binary.BigEndian.Uint32(net.ParseIP(candidates[i].ManagementIP).To4()) < binary.BigEndian.Uint32(net.ParseIP(candidates[j].ManagementIP).To4())
+	})
+
+	return
+}
@@ -0,0 +1,685 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+	"github.com/z46-dev/gomysql"
+)
+
+var (
+	hostFirmwareLock     sync.Mutex
+	firmwarePackagesLock sync.Mutex
+
+	ErrFirmwarePackageNotFound = errors.New("firmware package not found")
+	ErrHostFirmwareUpdating    = errors.New("host firmware is being updated")
+	ErrHostNotIdle             = errors.New("host is booked or reserved")
+	ErrFirmwareBaseURLNotSet   = errors.New("FIRMWARE_BASE_URL must be set to use SimpleUpdate")
+	ErrFirmwareTaskFailed      = errors.New("firmware update task failed")
+)
+
+// FirmwareOutcome is the result of a firmware update on a single host.
+type FirmwareOutcome struct {
+	ManagementIP    string `json:"management_ip"`
+	Success         bool   `json:"success"`
+	PreviousVersion string `json:"previous_version"`
+	Version         string `json:"version"`
+	TaskURI         string `json:"task_uri,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// OutdatedFirmware is an installed firmware component with a newer uploaded package for the host's model.
+type OutdatedFirmware struct {
+	ManagementIP     string           `json:"management_ip"`
+	Model            string           `json:"model"`
+	Category         FirmwareCategory `json:"category"`
+	Name             string           `json:"name"`
+	InstalledVersion string           `json:"installed_version"`
+	AvailableVersion string           `json:"available_version"`
+	PackageID        int              `json:"package_id"`
+}
+
+// splitFirmwareVersion breaks a version string into its numeric and alphabetic parts.
+func splitFirmwareVersion(version string) []string {
+	return strings.FieldsFunc(strings.ToLower(version), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// compareFirmwareVersions compares dotted vendor version strings part by part, numerically where both parts
+// are numbers. It returns -1, 0 or 1 like strings.Compare.
+func compareFirmwareVersions(a, b string) int {
+	var partsA, partsB []string = splitFirmwareVersion(a), splitFirmwareVersion(b)
+
+	for i := range max(len(partsA), len(partsB)) {
+		var partA, partB string = "0", "0"
+		if i < len(partsA) {
+			partA = partsA[i]
+		}
+
+		if i < len(partsB) {
+			partB = partsB[i]
+		}
+
+		numA, errA := strconv.ParseUint(partA, 10, 64)
+		numB, errB := strconv.ParseUint(partB, 10, 64)
+
+		switch {
+		case errA == nil && errB == nil && numA != numB:
+			if numA < numB {
+				return -1
+			}
+
+			return 1
+		case (errA != nil || errB != nil) && partA != partB:
+			return strings.Compare(partA, partB)
+		}
+	}
+
+	return 0
+}
+
+// ---------- INVENTORY ----------
+
+// RefreshHostFirmware reads the firmware inventory from a host's BMC and replaces the stored inventory.
+func RefreshHostFirmware(managementIP string) (records []*HostFirmware, err error) {
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	records, err = host.Management.FirmwareInventory()
+	host.Management.Close()
+
+	if err != nil {
+		return
+	}
+
+	var now time.Time = time.Now()
+	if err = SaveHostFirmware(managementIP, records, now); err != nil {
+		return
+	}
+
+	// Reload so changes made while the BMC was being queried aren't overwritten
+	if _, err = UpdateHost(managementIP, func(host *Host) error {
+		host.FirmwareCollectedAt = now
+		return nil
+	}); errors.Is(err, ErrHostNotFound) {
+		err = nil
+	}
+
+	return
+}
+
+// SaveHostFirmware replaces the stored firmware inventory of a host.
+func SaveHostFirmware(managementIP string, records []*HostFirmware, collectedAt time.Time) (err error) {
+	hostFirmwareLock.Lock()
+	defer hostFirmwareLock.Unlock()
+
+	var existing []*HostFirmware
+	if existing, err = hostFirmware.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(hostFirmware.FieldBySQLName("management_ip"), gomysql.OpEqual, managementIP)); err != nil {
+		return
+	}
+
+	for _, record := range existing {
+		if err = hostFirmware.Delete(record.ID); err != nil {
+			return
+		}
+	}
+
+	for _, record := range records {
+		record.ManagementIP, record.CollectedAt = managementIP, collectedAt
+		if err = hostFirmware.Insert(record); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// periodicFirmwareRefresh re-reads the inventory of hosts whose inventory is older than the refresh interval.
+func periodicFirmwareRefresh(now time.Time) (err error) {
+	var (
+		hosts    []*Host
+		interval time.Duration = time.Duration(config.Config.Firmware.InventoryRefreshHours) * time.Hour
+	)
+
+	if interval <= 0 {
+		return
+	}
+
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	for _, host := range hosts {
+		if host.FirmwareUpdating || now.Sub(host.FirmwareCollectedAt) < interval {
+			continue
+		}
+
+		if _, errRefresh := RefreshHostFirmware(host.ManagementIP); errRefresh != nil && !errors.Is(errRefresh, ErrBMCBackoff) {
+			log.Warnf("failed to refresh firmware inventory for host %s: %v", host.ManagementIP, errRefresh)
+		}
+	}
+
+	return
+}
+
+// HostFirmwareList lists the stored firmware inventory of a host, ordered by category and name.
+func HostFirmwareList(managementIP string) (records []*HostFirmware, err error) {
+	hostFirmwareLock.Lock()
+	records, err = hostFirmware.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(hostFirmware.FieldBySQLName("management_ip"), gomysql.OpEqual, managementIP))
+	hostFirmwareLock.Unlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Category != records[j].Category {
+			return records[i].Category < records[j].Category
+		}
+
+		return records[i].Name < records[j].Name
+	})
+
+	return
+}
+
+// DeleteHostFirmware forgets the stored inventory of a host, used when the host is deleted.
+func DeleteHostFirmware(managementIP string) (err error) {
+	return SaveHostFirmware(managementIP, nil, time.Time{})
+}
+
+// ---------- PACKAGES ----------
+
+// ImportFirmwarePackage moves an uploaded image into the firmware storage directory and stores the package.
+// Name, category, version, models and file name are taken from pkg, the rest is filled in.
+func ImportFirmwarePackage(pkg *FirmwarePackage, sourcePath string) (err error) {
+	var raw []byte = make([]byte, 16)
+	rand.Read(raw)
+
+	pkg.DownloadToken = hex.EncodeToString(raw)
+	pkg.FileName = filepath.Base(pkg.FileName)
+	pkg.FilePath = filepath.Join(config.Config.Firmware.StorageDir, pkg.DownloadToken, pkg.FileName)
+	pkg.UploadedAt = time.Now()
+
+	if err = os.MkdirAll(filepath.Dir(pkg.FilePath), 0o755); err != nil {
+		return
+	}
+
+	var source, destination *os.File
+	if source, err = os.Open(sourcePath); err != nil {
+		return
+	}
+
+	defer source.Close()
+
+	if destination, err = os.Create(pkg.FilePath); err != nil {
+		return
+	}
+
+	var hash = sha256.New()
+	pkg.Size, err = io.Copy(io.MultiWriter(destination, hash), source)
+	if errClose := destination.Close(); err == nil {
+		err = errClose
+	}
+
+	if err != nil {
+		os.RemoveAll(filepath.Dir(pkg.FilePath))
+		return
+	}
+
+	pkg.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	firmwarePackagesLock.Lock()
+	err = firmwarePackages.Insert(pkg)
+	firmwarePackagesLock.Unlock()
+
+	if err != nil {
+		os.RemoveAll(filepath.Dir(pkg.FilePath))
+		return
+	}
+
+	os.Remove(sourcePath)
+	return
+}
+
+// FirmwarePackageList lists every uploaded firmware package, newest first.
+func FirmwarePackageList() (records []*FirmwarePackage, err error) {
+	firmwarePackagesLock.Lock()
+	records, err = firmwarePackages.SelectAll()
+	firmwarePackagesLock.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	return
+}
+
+// FirmwarePackageByID fetches an uploaded firmware package.
+func FirmwarePackageByID(packageID int) (pkg *FirmwarePackage, err error) {
+	firmwarePackagesLock.Lock()
+	defer firmwarePackagesLock.Unlock()
+
+	if pkg, err = firmwarePackages.Select(packageID); err == nil && pkg == nil {
+		err = ErrFirmwarePackageNotFound
+	}
+
+	return
+}
+
+// FirmwarePackageByToken fetches the package a BMC download URL refers to.
+func FirmwarePackageByToken(token string) (pkg *FirmwarePackage, err error) {
+	firmwarePackagesLock.Lock()
+	defer firmwarePackagesLock.Unlock()
+
+	var records []*FirmwarePackage
+	if records, err = firmwarePackages.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(firmwarePackages.FieldBySQLName("download_token"), gomysql.OpEqual, token)); err != nil {
+		return
+	} else if len(records) == 0 {
+		err = ErrFirmwarePackageNotFound
+		return
+	}
+
+	pkg = records[0]
+	return
+}
+
+// DeleteFirmwarePackage removes a package and its image.
+func DeleteFirmwarePackage(packageID int) (err error) {
+	var pkg *FirmwarePackage
+	if pkg, err = FirmwarePackageByID(packageID); err != nil {
+		return
+	}
+
+	firmwarePackagesLock.Lock()
+	err = firmwarePackages.Delete(packageID)
+	firmwarePackagesLock.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	if errRemove := os.RemoveAll(filepath.Dir(pkg.FilePath)); errRemove != nil {
+		log.Warnf("failed to remove image of firmware package %d: %v", packageID, errRemove)
+	}
+
+	return
+}
+
+// FirmwarePackageImageURI returns the URL BMCs download the package image from.
+func FirmwarePackageImageURI(pkg *FirmwarePackage) (imageURI string, err error) {
+	if config.Config.Firmware.BaseURL == "" {
+		err = ErrFirmwareBaseURLNotSet
+		return
+	}
+
+	imageURI = fmt.Sprintf("%s/api/firmware/images/%s/%s", strings.TrimRight(config.Config.Firmware.BaseURL, "/"), pkg.DownloadToken, url.PathEscape(pkg.FileName))
+	return
+}
+
+// packageAppliesTo reports whether a package targets the host's model. Packages without models apply to all.
+func packageAppliesTo(pkg *FirmwarePackage, host *Host) bool {
+	if len(pkg.Models) == 0 {
+		return true
+	}
+
+	for _, model := range pkg.Models {
+		if strings.EqualFold(strings.TrimSpace(model), strings.TrimSpace(host.Model)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// OutdatedFirmwareList compares every host's stored inventory against the uploaded packages for its model
+// and lists the components running an older version than the newest package.
+func OutdatedFirmwareList() (records []OutdatedFirmware, err error) {
+	var (
+		hosts    []*Host
+		packages []*FirmwarePackage
+	)
+
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	if packages, err = FirmwarePackageList(); err != nil {
+		return
+	}
+
+	for _, host := range hosts {
+		var installed []*HostFirmware
+		if installed, err = HostFirmwareList(host.ManagementIP); err != nil {
+			return
+		}
+
+		for _, component := range installed {
+			var newest *FirmwarePackage
+			for _, pkg := range packages {
+				if pkg.Category != component.Category || !packageAppliesTo(pkg, host) {
+					continue
+				}
+
+				if newest == nil || compareFirmwareVersions(pkg.Version, newest.Version) > 0 {
+					newest = pkg
+				}
+			}
+
+			if newest == nil || compareFirmwareVersions(component.Version, newest.Version) >= 0 {
+				continue
+			}
+
+			records = append(records, OutdatedFirmware{
+				ManagementIP:     host.ManagementIP,
+				Model:            host.Model,
+				Category:         component.Category,
+				Name:             component.Name,
+				InstalledVersion: component.Version,
+				AvailableVersion: newest.Version,
+				PackageID:        newest.ID,
+			})
+		}
+	}
+
+	return
+}
+
+// ---------- UPDATES ----------
+
+// reserveHostsForFirmwareUpdate flags hosts as updating so they can't be added to carts while the update
+// runs. Either every host is reserved or none is.
+func reserveHostsForFirmwareUpdate(managementIPs []string) (err error) {
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	var reserved []string
+	for _, managementIP := range managementIPs {
+		if _, err = UpdateHost(managementIP, func(host *Host) (err error) {
+			switch _, inCart := hostCartOwners[managementIP]; {
+			case host.ManagementType != ManagementTypeRedfish:
+				err = fmt.Errorf("%w: %s", ErrNoUpdateService, managementIP)
+			case host.FirmwareUpdating:
+				err = fmt.Errorf("%w: %s", ErrHostFirmwareUpdating, managementIP)
+			case host.IsBooked, host.Wiping, inCart, removingHosts[managementIP]:
+				err = fmt.Errorf("%w: %s", ErrHostNotIdle, managementIP)
+			default:
+				host.FirmwareUpdating = true
+			}
+
+			return
+		}); err != nil {
+			// Hosts reserved before the failure have no job to release them
+			for _, reservedIP := range reserved {
+				releaseHostFromFirmwareUpdate(reservedIP)
+			}
+
+			return
+		}
+
+		reserved = append(reserved, managementIP)
+	}
+
+	return
+}
+
+func releaseHostFromFirmwareUpdate(managementIP string) {
+	if _, err := UpdateHost(managementIP, func(host *Host) error {
+		host.FirmwareUpdating = false
+		return nil
+	}); err != nil {
+		log.Errorf("failed to release host %s after firmware update: %v", managementIP, err)
+	}
+}
+
+// clearInterruptedFirmwareUpdates releases hosts left flagged by a previous process.
+func clearInterruptedFirmwareUpdates() (err error) {
+	var hosts []*Host
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	for _, host := range hosts {
+		if !host.FirmwareUpdating {
+			continue
+		}
+
+		if _, err = UpdateHost(host.ManagementIP, func(host *Host) error {
+			host.FirmwareUpdating = false
+			return nil
+		}); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func installedFirmwareVersion(managementIP string, category FirmwareCategory) (version string) {
+	if records, err := HostFirmwareList(managementIP); err == nil {
+		for _, record := range records {
+			if record.Category == category {
+				return record.Version
+			}
+		}
+	}
+
+	return
+}
+
+// waitForFirmwareTask polls a BMC update task until it finishes or the configured timeout elapses.
+func waitForFirmwareTask(client *HostManagementClient, taskURI string, progress func(percent int, message string)) (err error) {
+	var deadline time.Time = time.Now().Add(time.Duration(config.Config.Firmware.TaskTimeoutMinutes) * time.Minute)
+
+	for {
+		var task *redfish.Task
+		if task, err = client.FirmwareTask(taskURI); err != nil {
+			return
+		}
+
+		switch task.TaskState {
+		case redfish.CompletedTaskState:
+			if task.TaskStatus == common.CriticalHealth {
+				err = fmt.Errorf("%w: %s", ErrFirmwareTaskFailed, firmwareTaskMessage(task))
+			}
+
+			return
+		case redfish.ExceptionTaskState, redfish.KilledTaskState, redfish.CancelledTaskState:
+			err = fmt.Errorf("%w: %s", ErrFirmwareTaskFailed, firmwareTaskMessage(task))
+			return
+		}
+
+		progress(task.PercentComplete, fmt.Sprintf("Task %s", task.TaskState))
+
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("timeout waiting for firmware task %s", taskURI)
+			return
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func firmwareTaskMessage(task *redfish.Task) string {
+	if len(task.Messages) > 0 {
+		return task.Messages[len(task.Messages)-1].Message
+	}
+
+	return string(task.TaskState)
+}
+
+// updateHostFirmware installs a package on one host and re-reads its inventory afterwards.
+func updateHostFirmware(pkg *FirmwarePackage, managementIP string, method FirmwareUpdateMethod, imageURI string, progress func(percent int, message string)) (outcome FirmwareOutcome) {
+	var (
+		host *Host
+		err  error
+	)
+
+	outcome.ManagementIP = managementIP
+	outcome.PreviousVersion = installedFirmwareVersion(managementIP, pkg.Category)
+
+	defer func() {
+		if err != nil {
+			outcome.Error = err.Error()
+		}
+	}()
+
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	progress(5, "Connecting to management interface")
+
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	progress(10, fmt.Sprintf("Starting %s", method.String()))
+
+	if outcome.TaskURI, err = host.Management.StartFirmwareUpdate(method, imageURI, pkg.FilePath); err == nil && outcome.TaskURI != "" {
+		err = waitForFirmwareTask(host.Management, outcome.TaskURI, func(percent int, message string) {
+			progress(10+percent*8/10, message)
+		})
+	}
+
+	host.Management.Close()
+
+	if err != nil {
+		return
+	}
+
+	progress(90, "Reading firmware inventory")
+
+	var records []*HostFirmware
+	if records, err = RefreshHostFirmware(managementIP); err != nil {
+		err = fmt.Errorf("update finished but the inventory could not be read: %w", err)
+		return
+	}
+
+	for _, record := range records {
+		if record.Category == pkg.Category {
+			outcome.Version = record.Version
+			break
+		}
+	}
+
+	outcome.Success = true
+	progress(100, "Firmware updated")
+	return
+}
+
+// ApplyFirmwarePackage installs a package on hosts reserved by reserveHostsForFirmwareUpdate, limited to the
+// configured concurrency, and releases each host once its update finishes. The progress callback may be nil.
+func ApplyFirmwarePackage(pkg *FirmwarePackage, managementIPs []string, method FirmwareUpdateMethod, imageURI string, progress func(percent int, message string)) (outcomes []FirmwareOutcome) {
+	var (
+		slots    chan struct{} = make(chan struct{}, max(config.Config.Firmware.UpdateConcurrency, 1))
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		percents []int = make([]int, len(managementIPs))
+	)
+
+	if progress == nil {
+		progress = func(int, string) {}
+	}
+
+	outcomes = make([]FirmwareOutcome, len(managementIPs))
+	for i, managementIP := range managementIPs {
+		wg.Add(1)
+		go func(index int, ip string) {
+			defer wg.Done()
+			defer releaseHostFromFirmwareUpdate(ip)
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			outcomes[index] = updateHostFirmware(pkg, ip, method, imageURI, func(percent int, message string) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				percents[index] = percent
+
+				var total int
+				for _, p := range percents {
+					total += p
+				}
+
+				progress(total/len(percents), fmt.Sprintf("%s: %s", ip, message))
+			})
+
+			if !outcomes[index].Success {
+				log.Warnf("firmware update of host %s with package %d failed: %s", ip, pkg.ID, outcomes[index].Error)
+			}
+		}(i, managementIP)
+	}
+
+	wg.Wait()
+	return
+}
+
+// QueueFirmwareUpdate reserves idle hosts and queues a job installing the package on them. The job result
+// is a FirmwareOutcome per host.
+func QueueFirmwareUpdate(packageID int, managementIPs []string, method FirmwareUpdateMethod, createdBy string) (job *Job, err error) {
+	var (
+		pkg      *FirmwarePackage
+		imageURI string
+	)
+
+	if pkg, err = FirmwarePackageByID(packageID); err != nil {
+		return
+	}
+
+	var seen map[string]bool = map[string]bool{}
+	managementIPs = slices.DeleteFunc(slices.Clone(managementIPs), func(ip string) (duplicate bool) {
+		duplicate, seen[ip] = seen[ip], true
+		return
+	})
+
+	switch method {
+	case FirmwareUpdateMethodSimpleUpdate:
+		if imageURI, err = FirmwarePackageImageURI(pkg); err != nil {
+			return
+		}
+	case FirmwareUpdateMethodMultipartPush:
+	default:
+		err = ErrInvalidState
+		return
+	}
+
+	if err = reserveHostsForFirmwareUpdate(managementIPs); err != nil {
+		return
+	}
+
+	if job, err = EnqueueJob(JobKindFirmwareUpdate, strings.Join(managementIPs, ","), createdBy, func(handle *JobHandle) error {
+		return handle.SetResult(ApplyFirmwarePackage(pkg, managementIPs, method, imageURI, handle.Progress))
+	}); err != nil {
+		for _, managementIP := range managementIPs {
+			releaseHostFromFirmwareUpdate(managementIP)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/stmcginnis/gofish/common"
+	"github.com/stmcginnis/gofish/redfish"
+	"github.com/z46-dev/gomysql"
+)
+
+var (
+	hostEventLock sync.Mutex
+
+	// Hosts with a power refresh queued by an event. The value is set when another event arrived while the
+	// refresh was running, so the state is read once more afterwards.
+	hostEventRefreshes     map[string]bool = map[string]bool{}
+	hostEventRefreshesLock sync.Mutex
+
+	ErrUnknownEventContext = errors.New("event context does not match any host")
+)
+
+// EventSubscriptionsEnabled reports whether BMC event subscriptions are configured.
+func EventSubscriptionsEnabled() bool {
+	return config.Config.Management.EventListenerURL != ""
+}
+
+func newEventContext() string {
+	var raw []byte = make([]byte, 16)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// EnsureHostEventSubscription subscribes a connected host to its BMC's events, or checks that an existing
+// subscription is still in place. Hosts that cannot be subscribed are left to periodic polling. The caller
+// is responsible for saving the host.
+func EnsureHostEventSubscription(host *Host) (subscribed bool) {
+	if !EventSubscriptionsEnabled() || host.ManagementType != ManagementTypeRedfish {
+		host.EventSubscriptionURI, host.EventContext = "", ""
+		return
+	}
+
+	if host.EventSubscriptionURI != "" {
+		exists, err := host.Management.EventSubscriptionExists(host.EventSubscriptionURI)
+		if err != nil {
+			log.Warnf("failed to verify event subscription for host %s: %v", host.ManagementIP, err)
+			subscribed = true
+			return
+		} else if exists {
+			subscribed = true
+			return
+		}
+
+		log.Infof("event subscription for host %s disappeared, subscribing again", host.ManagementIP)
+	}
+
+	var (
+		context string = newEventContext()
+		uri     string
+		err     error
+	)
+
+	if uri, err = host.Management.SubscribeEvents(config.Config.Management.EventListenerURL, context); err != nil {
+		log.Warnf("host %s rejected event subscription, falling back to polling: %v", host.ManagementIP, err)
+		host.EventSubscriptionURI, host.EventContext = "", ""
+		return
+	}
+
+	host.EventSubscriptionURI, host.EventContext = uri, context
+	subscribed = true
+	return
+}
+
+// UnsubscribeHostEvents removes a host's event subscription from its BMC, used before the host is deleted.
+func UnsubscribeHostEvents(host *Host) (err error) {
+	if host.EventSubscriptionURI == "" {
+		return
+	}
+
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	defer host.Management.Close()
+
+	if err = host.Management.UnsubscribeEvents(host.EventSubscriptionURI); err == nil {
+		host.EventSubscriptionURI, host.EventContext = "", ""
+	}
+
+	return
+}
+
+// HandleRedfishEvent records the events a BMC delivered and refreshes the host's power state.
+func HandleRedfishEvent(event *redfish.Event) (host *Host, err error) {
+	if event.Context == "" {
+		err = ErrUnknownEventContext
+		return
+	}
+
+	var matches []*Host
+	if matches, err = Hosts.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(Hosts.FieldBySQLName("event_context"), gomysql.OpEqual, event.Context)); err != nil {
+		return
+	} else if len(matches) == 0 {
+		err = ErrUnknownEventContext
+		return
+	}
+
+	host = matches[0]
+
+	var now time.Time = time.Now()
+	for _, record := range event.Events {
+		var severity string = string(record.MessageSeverity)
+		if severity == "" {
+			severity = record.Severity
+		}
+
+		switch common.Health(severity) {
+		case common.CriticalHealth:
+			log.Errorf("host %s alert %s: %s", host.ManagementIP, record.MessageID, record.Message)
+		case common.WarningHealth:
+			log.Warnf("host %s alert %s: %s", host.ManagementIP, record.MessageID, record.Message)
+		}
+
+		hostEventLock.Lock()
+		err = hostEvents.Insert(&HostEvent{
+			ManagementIP:      host.ManagementIP,
+			ReceivedAt:        now,
+			EventID:           record.EventID,
+			EventType:         string(record.EventType),
+			MessageID:         record.MessageID,
+			Message:           record.Message,
+			Severity:          severity,
+			OriginOfCondition: record.OriginOfCondition,
+		})
+		hostEventLock.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+
+	if host, err = UpdateHost(host.ManagementIP, func(stored *Host) error {
+		stored.LastEventTime = now
+		return nil
+	}); err != nil {
+		return
+	}
+
+	// Events don't reliably carry the new power state, so any event triggers a read of it
+	queueHostPowerRefresh(host.ManagementIP)
+	return
+}
+
+// queueHostPowerRefresh reads a host's power state in the background, collapsing bursts of events.
+func queueHostPowerRefresh(managementIP string) {
+	hostEventRefreshesLock.Lock()
+	if _, running := hostEventRefreshes[managementIP]; running {
+		hostEventRefreshes[managementIP] = true
+		hostEventRefreshesLock.Unlock()
+		return
+	}
+
+	hostEventRefreshes[managementIP] = false
+	hostEventRefreshesLock.Unlock()
+
+	go func() {
+		for {
+			if err := refreshHostPowerState(managementIP); err != nil {
+				log.Errorf("failed to refresh power state for host %s after event: %v", managementIP, err)
+			}
+
+			hostEventRefreshesLock.Lock()
+			if hostEventRefreshes[managementIP] {
+				hostEventRefreshes[managementIP] = false
+				hostEventRefreshesLock.Unlock()
+				continue
+			}
+
+			delete(hostEventRefreshes, managementIP)
+			hostEventRefreshesLock.Unlock()
+			return
+		}
+	}()
+}
+
+func refreshHostPowerState(managementIP string) (err error) {
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil || host == nil {
+		return
+	}
+
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	defer host.Management.Close()
+
+	var state PowerState
+	if state, err = host.Management.PowerState(host.ManagementType == ManagementTypeRedfish); err != nil {
+		return
+	}
+
+	// Reload so changes made while the BMC was being queried aren't overwritten
+	_, err = UpdateHost(managementIP, func(stored *Host) error {
+		stored.LastKnownPowerState = state
+		stored.LastKnownPowerStateTime = time.Now()
+		return nil
+	})
+	return
+}
+
+// HostEventList lists the events received from a host, newest first. A limit of 0 returns every event.
+func HostEventList(managementIP string, limit int) (records []*HostEvent, err error) {
+	hostEventLock.Lock()
+	records, err = hostEvents.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(hostEvents.FieldBySQLName("management_ip"), gomysql.OpEqual, managementIP))
+	hostEventLock.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	return
+}
+
+// pruneHostEvents deletes events older than the configured retention period.
+func pruneHostEvents(now time.Time) (err error) {
+	if config.Config.Management.EventRetentionDays <= 0 {
+		return
+	}
+
+	var (
+		cutoff time.Time = now.AddDate(0, 0, -config.Config.Management.EventRetentionDays)
+		all    []*HostEvent
+	)
+
+	hostEventLock.Lock()
+	defer hostEventLock.Unlock()
+
+	if all, err = hostEvents.SelectAll(); err != nil {
+		return
+	}
+
+	for _, record := range all {
+		if record.ReceivedAt.Before(cutoff) {
+			if err = hostEvents.Delete(record.ID); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidHostSort = errors.New("invalid host sort key")
+
+// HostFilter narrows host searches down by hardware and state. Zero values match everything.
+type HostFilter struct {
+	MinMemoryGB        int          `query:"min_memory_gb" json:"min_memory_gb"`
+	MinCores           int          `query:"min_cores" json:"min_cores"`
+	MinThreads         int          `query:"min_threads" json:"min_threads"`
+	CPUManufacturer    string       `query:"cpu_manufacturer" json:"cpu_manufacturer"`
+	Vendors            []VendorID   `query:"vendor" json:"vendor"`
+	FormFactors        []FormFactor `query:"form_factor" json:"form_factor"`
+	Model              string       `query:"model" json:"model"`
+	PowerStates        []PowerState `query:"power_state" json:"power_state"`
+	Available          *bool        `query:"available" json:"available"`
+	Tags               []string     `query:"tag" json:"tag"`
+	ExcludeTags        []string     `query:"exclude_tag" json:"exclude_tag"`
+	Site               string       `query:"site" json:"site"`
+	Rack               string       `query:"rack" json:"rack"`
+	DriveMediaType     string       `query:"drive_media_type" json:"drive_media_type"`
+	DriveProtocol      string       `query:"drive_protocol" json:"drive_protocol"`
+	DriveModel         string       `query:"drive_model" json:"drive_model"`
+	MinDriveCapacityGB int          `query:"min_drive_capacity_gb" json:"min_drive_capacity_gb"`
+	MinDrives          int          `query:"min_drives" json:"min_drives"`
+	MinStorageGB       int          `query:"min_storage_gb" json:"min_storage_gb"`
+	HealthyDrivesOnly  bool         `query:"healthy_drives_only" json:"healthy_drives_only"`
+}
+
+// HostListOptions orders and pages a host listing. Sort is one of the hostSortKeys, prefixed with "-" to
+// sort descending. A PerPage of zero returns every host.
+type HostListOptions struct {
+	Sort    string `query:"sort" json:"sort"`
+	Page    int    `query:"page" json:"page"`
+	PerPage int    `query:"per_page" json:"per_page"`
+}
+
+var hostSortKeys map[string]func(a, b *Host) int = map[string]func(a, b *Host) int{
+	"management_ip": func(a, b *Host) int { return strings.Compare(a.ManagementIP, b.ManagementIP) },
+	"model":         func(a, b *Host) int { return strings.Compare(a.Model, b.Model) },
+	"vendor":        func(a, b *Host) int { return int(a.Vendor) - int(b.Vendor) },
+	"form_factor":   func(a, b *Host) int { return int(a.FormFactor) - int(b.FormFactor) },
+	"power_state":   func(a, b *Host) int { return int(a.LastKnownPowerState) - int(b.LastKnownPowerState) },
+	"memory":        func(a, b *Host) int { return a.Specs.Memory.SizeGB - b.Specs.Memory.SizeGB },
+	"cores":         func(a, b *Host) int { return a.Specs.Processor.TotalCores() - b.Specs.Processor.TotalCores() },
+	"threads":       func(a, b *Host) int { return a.Specs.Processor.Threads - b.Specs.Processor.Threads },
+	"storage":       func(a, b *Host) int { return a.Specs.StorageCapacityGB() - b.Specs.StorageCapacityGB() },
+}
+
+// TotalCores is the number of physical cores across every socket.
+func (specs HostCPUSpecs) TotalCores() int {
+	return specs.Cores * max(specs.Count, 1)
+}
+
+// StorageCapacityGB is the raw capacity of the host's drives, or of its volumes when the BMC doesn't list drives.
+func (specs HostSpecs) StorageCapacityGB() (total int) {
+	if len(specs.Drives) > 0 {
+		for _, drive := range specs.Drives {
+			total += drive.CapacityGB
+		}
+
+		return
+	}
+
+	for _, volume := range specs.Storage {
+		total += volume.CapacityGB
+	}
+
+	return
+}
+
+func (f HostFilter) matchesDrive(drive HostDriveSpecs) bool {
+	switch {
+	case f.DriveMediaType != "" && !strings.EqualFold(drive.MediaType, f.DriveMediaType):
+		return false
+	case f.DriveProtocol != "" && !strings.EqualFold(drive.Protocol, f.DriveProtocol):
+		return false
+	case f.DriveModel != "" && !strings.Contains(strings.ToLower(drive.Model), strings.ToLower(f.DriveModel)):
+		return false
+	case drive.CapacityGB < f.MinDriveCapacityGB:
+		return false
+	}
+
+	return true
+}
+
+func (f HostFilter) matchesDrives(specs HostSpecs) bool {
+	var (
+		required int = f.MinDrives
+		matching int
+	)
+
+	if required == 0 && (f.DriveMediaType != "" || f.DriveProtocol != "" || f.DriveModel != "" || f.MinDriveCapacityGB > 0) {
+		required = 1
+	}
+
+	for _, drive := range specs.Drives {
+		if f.HealthyDrivesOnly && drive.FailurePredicted {
+			return false
+		}
+
+		if f.matchesDrive(drive) {
+			matching++
+		}
+	}
+
+	return matching >= required
+}
+
+// matches reports whether a host satisfies every criteria of the filter. Drive criteria must be met by
+// at least MinDrives drives, or a single one when MinDrives isn't set. Whether the host is available is
+// up to the caller since it depends on who is asking.
+func (f HostFilter) matches(host *Host, available bool) bool {
+	switch {
+	case host.Specs.Memory.SizeGB < f.MinMemoryGB,
+		host.Specs.Processor.TotalCores() < f.MinCores,
+		host.Specs.Processor.Threads < f.MinThreads,
+		host.Specs.StorageCapacityGB() < f.MinStorageGB:
+		return false
+	case f.CPUManufacturer != "" && !strings.Contains(strings.ToLower(host.Specs.Processor.Manufacturer), strings.ToLower(f.CPUManufacturer)):
+		return false
+	case f.Model != "" && !strings.Contains(strings.ToLower(host.Model), strings.ToLower(f.Model)):
+		return false
+	case len(f.Vendors) > 0 && !slices.Contains(f.Vendors, host.Vendor),
+		len(f.FormFactors) > 0 && !slices.Contains(f.FormFactors, host.FormFactor),
+		len(f.PowerStates) > 0 && !slices.Contains(f.PowerStates, host.LastKnownPowerState):
+		return false
+	case f.Site != "" && !strings.EqualFold(host.Location.Site, f.Site),
+		f.Rack != "" && !strings.EqualFold(host.Location.Rack, f.Rack):
+		return false
+	case f.Available != nil && *f.Available != available:
+		return false
+	case slices.ContainsFunc(f.Tags, func(tag string) bool { return !host.HasTag(tag) }),
+		slices.ContainsFunc(f.ExcludeTags, host.HasTag):
+		return false
+	}
+
+	return f.matchesDrives(host.Specs)
+}
+
+// Apply sorts the hosts and returns the requested page along with the number of hosts before paging.
+func (o HostListOptions) Apply(hosts []*Host) (page []*Host, total int, err error) {
+	var (
+		key        string = strings.TrimPrefix(o.Sort, "-")
+		descending bool   = strings.HasPrefix(o.Sort, "-")
+	)
+
+	if key == "" {
+		key = "management_ip"
+	}
+
+	compare, ok := hostSortKeys[key]
+	if !ok {
+		err = fmt.Errorf("%w: %q", ErrInvalidHostSort, o.Sort)
+		return
+	}
+
+	// Ties fall back to the management IP so pages stay stable between requests
+	sort.SliceStable(hosts, func(i, j int) bool {
+		var result int = compare(hosts[i], hosts[j])
+		if result == 0 {
+			return hosts[i].ManagementIP < hosts[j].ManagementIP
+		}
+
+		return (result < 0) != descending
+	})
+
+	total = len(hosts)
+	if o.PerPage <= 0 {
+		page = hosts
+		return
+	}
+
+	var start int = max(o.Page-1, 0) * o.PerPage
+	if start >= total {
+		page = make([]*Host, 0)
+		return
+	}
+
+	page = hosts[start:min(start+o.PerPage, total)]
+	return
+}
+
+// SearchHosts lists the hosts matching the filter, with availability judged from the viewpoint of owner and
+// the groups they belong to.
+func SearchHosts(owner string, groups []string, filter HostFilter) (records []*Host, err error) {
+	var (
+		hosts        []*Host
+		restrictions map[string]*TagRestriction
+	)
+
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	if restrictions, err = tagRestrictionMap(); err != nil {
+		return
+	}
+
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	var start, end = cartWindow(owner)
+	for _, h := range hosts {
+		_, restricted := hostRestrictedFor(h, groups, restrictions)
+		if filter.matches(h, !restricted && hostAvailableTo(h, owner, start, end)) {
+			records = append(records, h)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+var (
+	archivedHostsLock sync.Mutex
+
+	ErrHostInUse = errors.New("host is in use")
+)
+
+// ArchivedHosts lists the hosts removed from the lab, most recent first.
+func ArchivedHosts() (records []*ArchivedHost, err error) {
+	archivedHostsLock.Lock()
+	defer archivedHostsLock.Unlock()
+
+	if records, err = archivedHosts.SelectAll(); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	}
+
+	return
+}
+
+// pendingRequestsForHost lists the pending booking requests asking for a host.
+func pendingRequestsForHost(managementIP string) (records []*BookingRequest, err error) {
+	var requests []*BookingRequest
+	if requests, err = bookingRequests.SelectAll(); err != nil {
+		return
+	}
+
+	for _, request := range requests {
+		if request.Status == BookingRequestStatusPending && slices.ContainsFunc(request.Hosts, func(host BookingRequestHost) bool {
+			return host.ManagementIP == managementIP
+		}) {
+			records = append(records, request)
+		}
+	}
+
+	return
+}
+
+// RemoveHost archives a host and deletes it. Hosts that are booked, reserved for a scheduled booking, reserved in a
+// cart or asked for by a pending booking request are refused unless force is set, in which case they are released from all of them and the
+// bookings are notified. Hosts with a firmware update or wipe running are always refused.
+func RemoveHost(managementIP, removedBy string, force bool) (archived *ArchivedHost, err error) {
+	// Flagged before the host is read so no booking, wipe or firmware update can take it while it is torn down
+	if err = markHostRemoving(managementIP); err != nil {
+		return
+	}
+
+	defer unmarkHostRemoving(managementIP)
+
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	} else if host.FirmwareUpdating {
+		err = fmt.Errorf("%w: %s", ErrHostFirmwareUpdating, managementIP)
+		return
+	}
+
+	hostWipesLock.Lock()
+	var wipes []*HostWipe
+	wipes, err = hostWipesFor(managementIP)
+	hostWipesLock.Unlock()
+
+	if err != nil {
+		return
+	} else if len(wipes) > 0 && wipes[0].inProgress() {
+		err = fmt.Errorf("%w: %s", ErrHostWiping, managementIP)
+		return
+	}
+
+	var (
+		record       *ArchivedHost = &ArchivedHost{ManagementIP: host.ManagementIP, ArchivedBy: removedBy, ArchivedAt: time.Now()}
+		requests     []*BookingRequest
+		reservations []*HostReservation
+		blockedBy    []string
+	)
+
+	if record.Record, err = json.Marshal(host); err != nil {
+		return
+	}
+
+	if requests, err = pendingRequestsForHost(managementIP); err != nil {
+		return
+	}
+
+	if reservations, err = HostReservationsForHost(managementIP); err != nil {
+		return
+	}
+
+	bookingCartLock.Lock()
+	record.CartOwner = hostCartOwners[managementIP]
+	bookingCartLock.Unlock()
+
+	if host.IsBooked && host.ActiveBookingID != 0 {
+		record.ReleasedBookingID = host.ActiveBookingID
+		blockedBy = append(blockedBy, fmt.Sprintf("booked by booking %d", host.ActiveBookingID))
+	}
+
+	for _, reservation := range reservations {
+		blockedBy = append(blockedBy, fmt.Sprintf("reserved for booking %d", reservation.BookingID))
+	}
+
+	if record.CartOwner != "" {
+		blockedBy = append(blockedBy, "reserved in the cart of "+record.CartOwner)
+	}
+
+	for _, request := range requests {
+		record.RequestIDs = append(record.RequestIDs, request.ID)
+		blockedBy = append(blockedBy, fmt.Sprintf("asked for by booking request %d", request.ID))
+	}
+
+	if len(blockedBy) > 0 && !force {
+		err = fmt.Errorf("%w: %s", ErrHostInUse, strings.Join(blockedBy, ", "))
+		return
+	}
+
+	if record.ReleasedBookingID != 0 {
+		if err = withBookingLock(record.ReleasedBookingID, func() error {
+			booking, err := bookings.Select(record.ReleasedBookingID)
+			if err != nil || booking == nil {
+				return err
+			}
+
+			booking.OwnedHostManagementIPs = removeString(booking.OwnedHostManagementIPs, managementIP)
+			return bookings.Update(booking)
+		}); err != nil {
+			return
+		}
+
+		notifyBooking(record.ReleasedBookingID, BookingNoticeHostRemoved, managementIP, fmt.Sprintf("Host %s was removed from the lab and released from this booking", managementIP))
+	}
+
+	for _, request := range requests {
+		if err = withBookingLock(request.BookingID, func() error {
+			current, err := bookingRequests.Select(request.ID)
+			if err != nil || current == nil {
+				return err
+			}
+
+			current.Hosts = slices.DeleteFunc(current.Hosts, func(host BookingRequestHost) bool { return host.ManagementIP == managementIP })
+			return bookingRequests.Update(current)
+		}); err != nil {
+			return
+		}
+
+		notifyBooking(request.BookingID, BookingNoticeHostRemoved, managementIP, fmt.Sprintf("Host %s was removed from the lab and dropped from booking request %d", managementIP, request.ID))
+	}
+
+	var reservedBy []int
+	if reservedBy, err = deleteHostReservations(managementIP); err != nil {
+		return
+	}
+
+	for _, bookingID := range reservedBy {
+		notifyBooking(bookingID, BookingNoticeHostRemoved, managementIP, fmt.Sprintf("Host %s was removed from the lab and is no longer reserved for this booking", managementIP))
+	}
+
+	if errUnsubscribe := UnsubscribeHostEvents(host); errUnsubscribe != nil {
+		log.Warnf("failed to remove event subscription for host %s: %v", managementIP, errUnsubscribe)
+	}
+
+	// Holding the cart lock keeps the host from being added to a cart between the cleanup and the delete
+	bookingCartLock.Lock()
+	for _, cart := range bookingCarts {
+		if _, ok := cart.Hosts[managementIP]; ok {
+			delete(cart.Hosts, managementIP)
+			cart.UpdatedAt = time.Now()
+
+			if errCart := persistBookingCart(cart); errCart != nil {
+				log.Errorf("failed to update the cart of %s: %v", cart.Owner, errCart)
+			}
+		}
+	}
+
+	if err = forgetCartHost(managementIP); err == nil {
+		archivedHostsLock.Lock()
+		err = archivedHosts.Insert(record)
+		archivedHostsLock.Unlock()
+	}
+
+	if err == nil {
+		err = deleteRemovedHost(managementIP, record.ReleasedBookingID)
+	}
+	bookingCartLock.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	forgetManagementClients(managementIP)
+
+	if err = DeleteHostFirmware(managementIP); err != nil {
+		return
+	}
+
+	if err = deleteMaintenanceWindows(managementIP); err != nil {
+		return
+	}
+
+	if err = deleteBIOSProfile(managementIP); err != nil {
+		return
+	}
+
+	archived = record
+	return
+}
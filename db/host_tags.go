@@ -0,0 +1,318 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	tagRestrictionsLock sync.Mutex
+
+	validTag *regexp.Regexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,63}$`)
+
+	ErrInvalidTag             = errors.New("tags must be 1-64 lowercase letters, digits or . _ : - characters")
+	ErrTagRestrictionNotFound = errors.New("tag restriction not found")
+	ErrHostRestricted         = errors.New("host is restricted to other groups")
+	ErrInvalidLocation        = errors.New("invalid host location")
+	ErrLocationTaken          = errors.New("location is already taken by another host")
+)
+
+// TagSummary counts the hosts carrying a tag along with any restriction on it.
+type TagSummary struct {
+	Tag         string          `json:"tag"`
+	Hosts       int             `json:"hosts"`
+	Restriction *TagRestriction `json:"restriction"`
+}
+
+// RackHost is a host as placed in a rack.
+type RackHost struct {
+	ManagementIP string     `json:"management_ip"`
+	Model        string     `json:"model"`
+	FormFactor   FormFactor `json:"form_factor"`
+	Unit         int        `json:"unit"`
+	PDU          string     `json:"pdu"`
+	PDUPort      string     `json:"pdu_port"`
+}
+
+// Rack lists the hosts of a rack from the top unit down.
+type Rack struct {
+	Site  string      `json:"site"`
+	Rack  string      `json:"rack"`
+	Hosts []*RackHost `json:"hosts"`
+}
+
+// NormalizeTag lowercases a tag and checks it is made of allowed characters.
+func NormalizeTag(tag string) (normalized string, err error) {
+	if normalized = strings.ToLower(strings.TrimSpace(tag)); !validTag.MatchString(normalized) {
+		err = fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+	}
+
+	return
+}
+
+func normalizeTags(tags []string) (normalized []string, err error) {
+	normalized = make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag, err = NormalizeTag(tag); err != nil {
+			return
+		}
+
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+
+	sort.Strings(normalized)
+	return
+}
+
+// HasTag reports whether the host carries the tag.
+func (host *Host) HasTag(tag string) bool {
+	return slices.Contains(host.Tags, strings.ToLower(tag))
+}
+
+// SetHostTags replaces every tag of a host.
+func SetHostTags(managementIP string, tags []string) (host *Host, err error) {
+	if tags, err = normalizeTags(tags); err != nil {
+		return
+	}
+
+	return UpdateHost(managementIP, func(host *Host) error {
+		host.Tags = tags
+		return nil
+	})
+}
+
+// AddHostTag tags a host, tagging it twice is not an error.
+func AddHostTag(managementIP, tag string) (host *Host, err error) {
+	if tag, err = NormalizeTag(tag); err != nil {
+		return
+	}
+
+	return UpdateHost(managementIP, func(host *Host) (err error) {
+		host.Tags, err = normalizeTags(append(host.Tags, tag))
+		return
+	})
+}
+
+// RemoveHostTag removes a tag from a host.
+func RemoveHostTag(managementIP, tag string) (host *Host, err error) {
+	return UpdateHost(managementIP, func(host *Host) error {
+		host.Tags = slices.DeleteFunc(host.Tags, func(existing string) bool { return existing == strings.ToLower(tag) })
+		return nil
+	})
+}
+
+// SetHostLocation places a host in a rack. A rack unit or PDU port can only hold a single host.
+func SetHostLocation(managementIP string, location HostLocation) (host *Host, err error) {
+	location.Site, location.Rack = strings.TrimSpace(location.Site), strings.TrimSpace(location.Rack)
+	location.PDU, location.PDUPort = strings.TrimSpace(location.PDU), strings.TrimSpace(location.PDUPort)
+
+	if location.Unit < 0 || (location.Unit > 0 && location.Rack == "") || (location.PDUPort != "" && location.PDU == "") {
+		err = ErrInvalidLocation
+		return
+	}
+
+	return UpdateHost(managementIP, func(host *Host) (err error) {
+		var hosts []*Host
+		if hosts, err = Hosts.SelectAll(); err != nil {
+			return
+		}
+
+		for _, other := range hosts {
+			if other.ManagementIP == host.ManagementIP {
+				continue
+			}
+
+			if location.Unit > 0 && other.Location.Site == location.Site && other.Location.Rack == location.Rack && other.Location.Unit == location.Unit {
+				return fmt.Errorf("%w: unit %d of rack %s is used by %s", ErrLocationTaken, location.Unit, location.Rack, other.ManagementIP)
+			}
+
+			if location.PDUPort != "" && other.Location.PDU == location.PDU && other.Location.PDUPort == location.PDUPort {
+				return fmt.Errorf("%w: port %s of PDU %s is used by %s", ErrLocationTaken, location.PDUPort, location.PDU, other.ManagementIP)
+			}
+		}
+
+		host.Location = location
+		return
+	})
+}
+
+// RackLayout groups located hosts by site and rack.
+func RackLayout() (racks []*Rack, err error) {
+	var hosts []*Host
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	var byRack map[[2]string]*Rack = map[[2]string]*Rack{}
+	for _, host := range hosts {
+		if host.Location.Rack == "" {
+			continue
+		}
+
+		var key [2]string = [2]string{host.Location.Site, host.Location.Rack}
+		rack, ok := byRack[key]
+		if !ok {
+			rack = &Rack{Site: key[0], Rack: key[1]}
+			byRack[key] = rack
+			racks = append(racks, rack)
+		}
+
+		rack.Hosts = append(rack.Hosts, &RackHost{
+			ManagementIP: host.ManagementIP,
+			Model:        host.Model,
+			FormFactor:   host.FormFactor,
+			Unit:         host.Location.Unit,
+			PDU:          host.Location.PDU,
+			PDUPort:      host.Location.PDUPort,
+		})
+	}
+
+	for _, rack := range racks {
+		sort.Slice(rack.Hosts, func(i, j int) bool { return rack.Hosts[i].Unit > rack.Hosts[j].Unit })
+	}
+
+	sort.Slice(racks, func(i, j int) bool {
+		if racks[i].Site != racks[j].Site {
+			return racks[i].Site < racks[j].Site
+		}
+
+		return racks[i].Rack < racks[j].Rack
+	})
+
+	return
+}
+
+// ---------- RESTRICTIONS ----------
+
+// TagRestrictionList returns every tag restriction.
+func TagRestrictionList() (records []*TagRestriction, err error) {
+	tagRestrictionsLock.Lock()
+	defer tagRestrictionsLock.Unlock()
+
+	if records, err = tagRestrictions.SelectAll(); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].Tag < records[j].Tag })
+	}
+
+	return
+}
+
+// SetTagRestriction limits hosts carrying the tag to the given groups, replacing any existing restriction.
+func SetTagRestriction(tag string, groups []string, updatedBy string) (restriction *TagRestriction, err error) {
+	if tag, err = NormalizeTag(tag); err != nil {
+		return
+	}
+
+	var allowed []string = make([]string, 0, len(groups))
+	for _, group := range groups {
+		if group = strings.TrimSpace(group); group != "" && !slices.Contains(allowed, group) {
+			allowed = append(allowed, group)
+		}
+	}
+
+	tagRestrictionsLock.Lock()
+	defer tagRestrictionsLock.Unlock()
+
+	var existing *TagRestriction
+	if existing, err = tagRestrictions.Select(tag); err != nil {
+		return
+	}
+
+	restriction = &TagRestriction{Tag: tag, AllowedGroups: allowed, UpdatedBy: updatedBy, UpdatedAt: time.Now()}
+	if existing == nil {
+		err = tagRestrictions.Insert(restriction)
+	} else {
+		err = tagRestrictions.Update(restriction)
+	}
+
+	return
+}
+
+// DeleteTagRestriction lifts the restriction on a tag.
+func DeleteTagRestriction(tag string) (err error) {
+	tagRestrictionsLock.Lock()
+	defer tagRestrictionsLock.Unlock()
+
+	var existing *TagRestriction
+	if existing, err = tagRestrictions.Select(strings.ToLower(tag)); err != nil {
+		return
+	} else if existing == nil {
+		err = fmt.Errorf("%w: %s", ErrTagRestrictionNotFound, tag)
+		return
+	}
+
+	err = tagRestrictions.Delete(existing.Tag)
+	return
+}
+
+// tagRestrictionMap indexes the restrictions by tag.
+func tagRestrictionMap() (restrictions map[string]*TagRestriction, err error) {
+	var records []*TagRestriction
+	if records, err = TagRestrictionList(); err != nil {
+		return
+	}
+
+	restrictions = make(map[string]*TagRestriction, len(records))
+	for _, record := range records {
+		restrictions[record.Tag] = record
+	}
+
+	return
+}
+
+// hostRestrictedFor returns the first tag of the host whose restriction excludes every one of the groups.
+func hostRestrictedFor(host *Host, groups []string, restrictions map[string]*TagRestriction) (tag string, restricted bool) {
+	for _, tag = range host.Tags {
+		if restriction, ok := restrictions[tag]; ok && !slices.ContainsFunc(restriction.AllowedGroups, func(group string) bool { return slices.Contains(groups, group) }) {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
+
+// TagList summarizes every tag in use or restricted.
+func TagList() (summaries []*TagSummary, err error) {
+	var (
+		hosts        []*Host
+		restrictions map[string]*TagRestriction
+		byTag        map[string]*TagSummary = map[string]*TagSummary{}
+	)
+
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	if restrictions, err = tagRestrictionMap(); err != nil {
+		return
+	}
+
+	summary := func(tag string) *TagSummary {
+		if _, ok := byTag[tag]; !ok {
+			byTag[tag] = &TagSummary{Tag: tag, Restriction: restrictions[tag]}
+			summaries = append(summaries, byTag[tag])
+		}
+
+		return byTag[tag]
+	}
+
+	for _, host := range hosts {
+		for _, tag := range host.Tags {
+			summary(tag).Hosts++
+		}
+	}
+
+	for tag := range restrictions {
+		summary(tag)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Tag < summaries[j].Tag })
+	return
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// hostRowLock serializes writes to host rows. Hosts are stored as whole rows, so every writer re-reads the row and
+// changes only its own columns under this lock, otherwise concurrent writers overwrite each other's columns. It is
+// always taken last, never hold it while taking another lock.
+var (
+	hostRowLock sync.Mutex
+
+	// removingHosts are the hosts RemoveHost is tearing down, they can't be assigned to bookings, wiped or updated.
+	// Guarded by hostRowLock.
+	removingHosts = map[string]bool{}
+)
+
+// UpdateHost re-reads a host and saves the changes edit makes to it under hostRowLock. The row is left untouched
+// when edit fails.
+func UpdateHost(managementIP string, edit func(host *Host) error) (host *Host, err error) {
+	hostRowLock.Lock()
+	defer hostRowLock.Unlock()
+
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	if err = edit(host); err != nil {
+		return
+	}
+
+	err = Hosts.Update(host)
+	return
+}
+
+// markHostRemoving flags a host as being removed, failing when another removal of it is already running.
+func markHostRemoving(managementIP string) (err error) {
+	hostRowLock.Lock()
+	defer hostRowLock.Unlock()
+
+	if removingHosts[managementIP] {
+		err = fmt.Errorf("%w: %s is already being removed", ErrHostInUse, managementIP)
+		return
+	}
+
+	removingHosts[managementIP] = true
+	return
+}
+
+func unmarkHostRemoving(managementIP string) {
+	hostRowLock.Lock()
+	delete(removingHosts, managementIP)
+	hostRowLock.Unlock()
+}
+
+// deleteRemovedHost re-reads a host and deletes it under hostRowLock, refusing when it was booked by a booking
+// other than releasedBookingID or started a firmware update since the removal checks ran.
+func deleteRemovedHost(managementIP string, releasedBookingID int) (err error) {
+	hostRowLock.Lock()
+	defer hostRowLock.Unlock()
+
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	}
+
+	switch {
+	case host == nil:
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+	case host.IsBooked && host.ActiveBookingID != releasedBookingID:
+		err = fmt.Errorf("%w: booked by booking %d", ErrHostInUse, host.ActiveBookingID)
+	case host.FirmwareUpdating:
+		err = fmt.Errorf("%w: %s", ErrHostFirmwareUpdating, managementIP)
+	default:
+		err = Hosts.Delete(managementIP)
+	}
+
+	return
+}
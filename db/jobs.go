@@ -0,0 +1,225 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/z46-dev/gomysql"
+)
+
+var (
+	jobsLock      sync.Mutex
+	jobSlots      chan struct{}
+	jobSlotsSetup sync.Once
+
+	ErrJobNotFound = errors.New("job not found")
+)
+
+// JobHandle is passed to a running job so it can report progress and a result.
+type JobHandle struct {
+	job *Job
+}
+
+// JobRunner is the body of a job. Returning an error marks the job as failed.
+type JobRunner func(handle *JobHandle) error
+
+// ID returns the ID of the job being run.
+func (h *JobHandle) ID() int {
+	return h.job.ID
+}
+
+// Progress records a completion percentage and status message for the job.
+func (h *JobHandle) Progress(percent int, message string) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	h.job.Progress = min(max(percent, 0), 100)
+	h.job.Message = message
+
+	if err := jobs.Update(h.job); err != nil {
+		log.Errorf("failed to update progress for job %d: %v", h.job.ID, err)
+	}
+}
+
+// SetResult stores a JSON-encodable result on the job.
+func (h *JobHandle) SetResult(result any) (err error) {
+	var encoded []byte
+	if encoded, err = json.Marshal(result); err != nil {
+		return
+	}
+
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	h.job.Result = encoded
+	err = jobs.Update(h.job)
+	return
+}
+
+// acquireJobSlot blocks until one of the configured concurrent job slots is free.
+func acquireJobSlot() {
+	jobSlotsSetup.Do(func() {
+		jobSlots = make(chan struct{}, max(config.Config.Jobs.MaxConcurrent, 1))
+	})
+
+	jobSlots <- struct{}{}
+}
+
+func releaseJobSlot() {
+	<-jobSlots
+}
+
+// finishJob stores the terminal state of a job.
+func finishJob(job *Job, runErr error) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	job.FinishedAt = time.Now()
+	if runErr != nil {
+		job.Status = JobStatusFailed
+		job.Message = runErr.Error()
+	} else {
+		job.Status = JobStatusSucceeded
+		job.Progress = 100
+	}
+
+	if err := jobs.Update(job); err != nil {
+		log.Errorf("failed to store result of job %d: %v", job.ID, err)
+	}
+}
+
+// EnqueueJob stores a new job and runs it in the background, returning immediately.
+func EnqueueJob(kind JobKind, target string, createdBy string, run JobRunner) (job *Job, err error) {
+	job = &Job{
+		Kind:      kind,
+		Target:    target,
+		Status:    JobStatusQueued,
+		Message:   "Queued",
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	jobsLock.Lock()
+	err = jobs.Insert(job)
+	jobsLock.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	var running *Job = new(Job)
+	*running = *job
+
+	go func() {
+		acquireJobSlot()
+		defer releaseJobSlot()
+
+		jobsLock.Lock()
+		running.Status = JobStatusRunning
+		running.StartedAt = time.Now()
+		running.Message = "Running"
+		if err := jobs.Update(running); err != nil {
+			log.Errorf("failed to mark job %d as running: %v", running.ID, err)
+		}
+		jobsLock.Unlock()
+
+		var runErr error
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					runErr = fmt.Errorf("job panicked: %v", recovered)
+				}
+			}()
+
+			runErr = run(&JobHandle{job: running})
+		}()
+
+		finishJob(running, runErr)
+	}()
+
+	return
+}
+
+// JobByID fetches a job by its ID.
+func JobByID(jobID int) (job *Job, err error) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+
+	if job, err = jobs.Select(jobID); err == nil && job == nil {
+		err = ErrJobNotFound
+	}
+
+	return
+}
+
+// JobsCreatedBy lists the jobs a user triggered, newest first.
+func JobsCreatedBy(username string) (records []*Job, err error) {
+	jobsLock.Lock()
+	records, err = jobs.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(jobs.FieldBySQLName("created_by"), gomysql.OpEqual, username))
+	jobsLock.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	return
+}
+
+// JobList lists every job, newest first.
+func JobList() (records []*Job, err error) {
+	jobsLock.Lock()
+	records, err = jobs.SelectAll()
+	jobsLock.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	return
+}
+
+// WaitForJob polls a job until it finishes or the timeout elapses.
+func WaitForJob(jobID int, timeout time.Duration) (job *Job, err error) {
+	var deadline time.Time = time.Now().Add(timeout)
+
+	for {
+		if job, err = JobByID(jobID); err != nil {
+			return
+		}
+
+		if job.Status == JobStatusSucceeded || job.Status == JobStatusFailed {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("timeout waiting for job %d", jobID)
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// failInterruptedJobs marks jobs left queued or running by a previous process as failed.
+func failInterruptedJobs() (err error) {
+	var records []*Job
+	if records, err = jobs.SelectAll(); err != nil {
+		return
+	}
+
+	for _, job := range records {
+		if job.Status != JobStatusQueued && job.Status != JobStatusRunning {
+			continue
+		}
+
+		job.Status = JobStatusFailed
+		job.Message = "interrupted by server restart"
+		job.FinishedAt = time.Now()
+
+		if err = jobs.Update(job); err != nil {
+			return
+		}
+	}
+
+	return
+}
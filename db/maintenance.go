@@ -0,0 +1,370 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/z46-dev/gomysql"
+)
+
+var (
+	maintenanceLock    sync.Mutex
+	bookingNoticesLock sync.Mutex
+
+	ErrMaintenanceWindowNotFound = errors.New("maintenance window not found")
+	ErrInvalidMaintenanceWindow  = errors.New("invalid maintenance window")
+	ErrHostInMaintenance         = errors.New("host is in maintenance")
+	ErrMaintenanceOverlap        = errors.New("booking overlaps a scheduled maintenance window")
+	ErrMaintenanceWindowOverlap  = errors.New("overlaps another maintenance window of the host")
+)
+
+// activeAt reports whether the window holds its host out of service at the given time.
+func (window *MaintenanceWindow) activeAt(now time.Time) bool {
+	return !window.StartTime.After(now) && (window.EndTime.IsZero() || now.Before(window.EndTime))
+}
+
+// overlaps reports whether the window intersects [start, end). A zero end is open-ended on either side.
+func (window *MaintenanceWindow) overlaps(start, end time.Time) bool {
+	return (end.IsZero() || window.StartTime.Before(end)) && (window.EndTime.IsZero() || start.Before(window.EndTime))
+}
+
+// equal compares maintenance states, times are compared as instants since they round trip through the database.
+func (state HostMaintenance) equal(other HostMaintenance) bool {
+	return state.Active == other.Active && state.WindowID == other.WindowID && state.Reason == other.Reason && state.SetBy == other.SetBy &&
+		state.StartTime.Equal(other.StartTime) && state.EndTime.Equal(other.EndTime)
+}
+
+// InMaintenance reports whether the host is currently out of service for maintenance.
+func (host *Host) InMaintenance() bool {
+	return host.Maintenance.Active
+}
+
+// maintenanceWindowsFor lists the windows of one host, or of every host when managementIP is empty. The caller must
+// hold maintenanceLock.
+func maintenanceWindowsFor(managementIP string) (records []*MaintenanceWindow, err error) {
+	if managementIP == "" {
+		records, err = maintenanceWindows.SelectAll()
+	} else {
+		records, err = maintenanceWindows.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(maintenanceWindows.FieldBySQLName("management_ip"), gomysql.OpEqual, managementIP))
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].StartTime.Equal(records[j].StartTime) {
+			return records[i].StartTime.Before(records[j].StartTime)
+		}
+
+		return records[i].ID < records[j].ID
+	})
+
+	return
+}
+
+// MaintenanceWindowsForHost lists every maintenance window of a host, oldest first.
+func MaintenanceWindowsForHost(managementIP string) (records []*MaintenanceWindow, err error) {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	records, err = maintenanceWindowsFor(managementIP)
+	return
+}
+
+// UpcomingMaintenanceWindows lists the windows that are in effect or have yet to start.
+func UpcomingMaintenanceWindows(now time.Time) (records []*MaintenanceWindow, err error) {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	var windows []*MaintenanceWindow
+	if windows, err = maintenanceWindowsFor(""); err != nil {
+		return
+	}
+
+	for _, window := range windows {
+		if window.EndTime.IsZero() || now.Before(window.EndTime) {
+			records = append(records, window)
+		}
+	}
+
+	return
+}
+
+// ScheduleMaintenance takes a host out of service from start, or now when start is zero, until end. A zero end
+// keeps the host in maintenance until the window is ended. Bookings holding the host are notified.
+func ScheduleMaintenance(managementIP, reason string, start, end time.Time, createdBy string) (window *MaintenanceWindow, err error) {
+	var now time.Time = time.Now()
+
+	if start.IsZero() {
+		start = now
+	}
+
+	if reason = strings.TrimSpace(reason); reason == "" {
+		err = fmt.Errorf("%w: a reason is required", ErrInvalidMaintenanceWindow)
+		return
+	} else if !end.IsZero() && (!end.After(start) || !end.After(now)) {
+		err = fmt.Errorf("%w: the end time must be after the start time and in the future", ErrInvalidMaintenanceWindow)
+		return
+	}
+
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	// Overlapping windows would announce the same maintenance twice and leave ending it ambiguous
+	var existing []*MaintenanceWindow
+	if existing, err = maintenanceWindowsFor(host.ManagementIP); err != nil {
+		return
+	}
+
+	for _, other := range existing {
+		if other.overlaps(start, end) {
+			err = fmt.Errorf("%w: window %d (%s)", ErrMaintenanceWindowOverlap, other.ID, describeWindow(other))
+			return
+		}
+	}
+
+	window = &MaintenanceWindow{
+		ManagementIP: host.ManagementIP,
+		Reason:       reason,
+		StartTime:    start,
+		EndTime:      end,
+		CreatedBy:    createdBy,
+		CreatedAt:    now,
+	}
+
+	if err = maintenanceWindows.Insert(window); err != nil {
+		return
+	}
+
+	// Windows starting right away are announced as started by the sync below
+	if start.After(now) {
+		notifyBookingOfWindow(host, window, BookingNoticeMaintenanceScheduled, fmt.Sprintf("Host %s is scheduled for maintenance from %s: %s", host.ManagementIP, describeWindow(window), reason))
+	}
+
+	err = syncHostMaintenance(host.ManagementIP, now)
+	return
+}
+
+// EndMaintenance ends a window in effect, or cancels one that has yet to start. Windows already over are left alone.
+func EndMaintenance(windowID int) (window *MaintenanceWindow, err error) {
+	var now time.Time = time.Now()
+
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	if window, err = maintenanceWindows.Select(windowID); err != nil {
+		return
+	} else if window == nil {
+		err = fmt.Errorf("%w: %d", ErrMaintenanceWindowNotFound, windowID)
+		return
+	}
+
+	switch {
+	case window.StartTime.After(now):
+		if err = maintenanceWindows.Delete(window.ID); err != nil {
+			return
+		}
+
+		if host, errHost := Hosts.Select(window.ManagementIP); errHost == nil && host != nil {
+			notifyBookingOfWindow(host, window, BookingNoticeMaintenanceCancelled, fmt.Sprintf("Maintenance of host %s from %s was cancelled", host.ManagementIP, describeWindow(window)))
+		}
+	case window.activeAt(now):
+		window.EndTime = now
+		if err = maintenanceWindows.Update(window); err != nil {
+			return
+		}
+	default:
+		return
+	}
+
+	err = syncHostMaintenance(window.ManagementIP, now)
+	return
+}
+
+// RefreshMaintenance starts and ends maintenance on hosts as their windows come and go.
+func RefreshMaintenance(now time.Time) (err error) {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	var hosts []*Host
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	var windows []*MaintenanceWindow
+	if windows, err = maintenanceWindowsFor(""); err != nil {
+		return
+	}
+
+	for _, host := range hosts {
+		var state HostMaintenance = maintenanceStateAt(host.ManagementIP, windows, now)
+		if state.equal(host.Maintenance) {
+			continue
+		}
+
+		if errSync := syncHostMaintenance(host.ManagementIP, now); errSync != nil {
+			log.Errorf("failed to update maintenance state of host %s: %v", host.ManagementIP, errSync)
+		}
+	}
+
+	return
+}
+
+// maintenanceStateAt derives the maintenance state of a host from the earliest window in effect.
+func maintenanceStateAt(managementIP string, windows []*MaintenanceWindow, now time.Time) (state HostMaintenance) {
+	for _, window := range windows {
+		if window.ManagementIP == managementIP && window.activeAt(now) {
+			return HostMaintenance{
+				Active:    true,
+				WindowID:  window.ID,
+				Reason:    window.Reason,
+				StartTime: window.StartTime,
+				EndTime:   window.EndTime,
+				SetBy:     window.CreatedBy,
+			}
+		}
+	}
+
+	return
+}
+
+// syncHostMaintenance writes the maintenance state of a host and tells its booking when maintenance starts or ends.
+// The caller must hold maintenanceLock.
+func syncHostMaintenance(managementIP string, now time.Time) (err error) {
+	var windows []*MaintenanceWindow
+	if windows, err = maintenanceWindowsFor(managementIP); err != nil {
+		return
+	}
+
+	var state HostMaintenance = maintenanceStateAt(managementIP, windows, now)
+
+	_, err = UpdateHost(managementIP, func(host *Host) error {
+		var previous HostMaintenance = host.Maintenance
+		if host.Maintenance = state; previous.equal(state) || !host.IsBooked || host.ActiveBookingID == 0 {
+			return nil
+		}
+
+		if state.Active && previous.WindowID != state.WindowID {
+			notifyBooking(host.ActiveBookingID, BookingNoticeMaintenanceStarted, host.ManagementIP, fmt.Sprintf("Host %s entered maintenance: %s", host.ManagementIP, state.Reason))
+		} else if !state.Active {
+			notifyBooking(host.ActiveBookingID, BookingNoticeMaintenanceEnded, host.ManagementIP, fmt.Sprintf("Host %s is back in service", host.ManagementIP))
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// MaintenanceConflicts checks that none of the hosts have maintenance overlapping [start, end). A zero end is
+// open-ended.
+func MaintenanceConflicts(managementIPs []string, start, end time.Time) (err error) {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	for _, managementIP := range managementIPs {
+		var windows []*MaintenanceWindow
+		if windows, err = maintenanceWindowsFor(managementIP); err != nil {
+			return
+		}
+
+		for _, window := range windows {
+			if window.overlaps(start, end) {
+				err = fmt.Errorf("%w: host %s is in maintenance from %s", ErrMaintenanceOverlap, managementIP, describeWindow(window))
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// deleteMaintenanceWindows forgets the windows of a host, used when the host is removed.
+func deleteMaintenanceWindows(managementIP string) (err error) {
+	maintenanceLock.Lock()
+	defer maintenanceLock.Unlock()
+
+	var windows []*MaintenanceWindow
+	if windows, err = maintenanceWindowsFor(managementIP); err != nil {
+		return
+	}
+
+	for _, window := range windows {
+		if err = maintenanceWindows.Delete(window.ID); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func describeWindow(window *MaintenanceWindow) string {
+	if window.EndTime.IsZero() {
+		return window.StartTime.Format(time.RFC3339) + " until further notice"
+	}
+
+	return window.StartTime.Format(time.RFC3339) + " to " + window.EndTime.Format(time.RFC3339)
+}
+
+// notifyBookingOfWindow notifies the booking holding the host when its booking period overlaps the window, and the
+// bookings the host is reserved for over the window. The caller must hold maintenanceLock.
+func notifyBookingOfWindow(host *Host, window *MaintenanceWindow, kind BookingNoticeKind, message string) {
+	if host.IsBooked && host.ActiveBookingID != 0 {
+		if booking, err := BookingByID(host.ActiveBookingID); err == nil && booking != nil && window.overlaps(booking.StartTime, booking.EndTime) {
+			notifyBooking(host.ActiveBookingID, kind, host.ManagementIP, message)
+		}
+	}
+
+	hostReservationsLock.Lock()
+	reservations, err := hostReservationsWhere("management_ip", host.ManagementIP)
+	hostReservationsLock.Unlock()
+	if err != nil {
+		log.Errorf("failed to list reservations of host %s: %v", host.ManagementIP, err)
+		return
+	}
+
+	for _, reservation := range reservations {
+		if reservation.BookingID != host.ActiveBookingID && window.overlaps(reservation.StartTime, reservation.EndTime) {
+			notifyBooking(reservation.BookingID, kind, host.ManagementIP, message)
+		}
+	}
+}
+
+// notifyBooking records a notice for the members of a booking. Failures are logged rather than returned so that
+// the change being announced is not undone.
+func notifyBooking(bookingID int, kind BookingNoticeKind, managementIP, message string) {
+	bookingNoticesLock.Lock()
+	defer bookingNoticesLock.Unlock()
+
+	if err := bookingNotices.Insert(&BookingNotice{
+		BookingID:    bookingID,
+		Kind:         kind,
+		ManagementIP: managementIP,
+		Message:      message,
+		CreatedAt:    time.Now(),
+	}); err != nil {
+		log.Errorf("failed to notify booking %d: %v", bookingID, err)
+	}
+}
+
+// BookingNoticesForBooking lists the notices of a booking, oldest first.
+func BookingNoticesForBooking(bookingID int) (records []*BookingNotice, err error) {
+	bookingNoticesLock.Lock()
+	defer bookingNoticesLock.Unlock()
+
+	if records, err = bookingNotices.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(bookingNotices.FieldBySQLName("booking_id"), gomysql.OpEqual, bookingID)); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	}
+
+	return
+}
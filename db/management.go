@@ -2,24 +2,41 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bougou/go-ipmi"
 	"github.com/opnlaas/opnlaas/config"
 	"github.com/stmcginnis/gofish"
+	"github.com/stmcginnis/gofish/common"
 	"github.com/stmcginnis/gofish/redfish"
 )
 
 var (
-	bg                   context.Context = context.Background()
-	ErrBadManagementType                 = fmt.Errorf("bad management type for host/function")
-	ErrNotConnected                      = fmt.Errorf("not connected to host management interface")
-	ErrNoChassisFound                    = fmt.Errorf("no chassis found for host")
-	ErrInvalidState                      = fmt.Errorf("invalid state input for host/function")
-	ErrNoSystemFound                     = fmt.Errorf("no system found for host")
+	bg                    context.Context = context.Background()
+	ErrBadManagementType                  = fmt.Errorf("bad management type for host/function")
+	ErrNotConnected                       = fmt.Errorf("not connected to host management interface")
+	ErrNoChassisFound                     = fmt.Errorf("no chassis found for host")
+	ErrInvalidState                       = fmt.Errorf("invalid state input for host/function")
+	ErrNoSystemFound                      = fmt.Errorf("no system found for host")
+	ErrEventsNotSupported                 = fmt.Errorf("host management interface does not support event subscriptions")
+	ErrNoUpdateService                    = fmt.Errorf("host management interface does not support firmware updates")
+	ErrBIOSNotSupported                   = fmt.Errorf("host management interface does not support BIOS configuration")
 )
 
+// LAN channels probed for the BMC's MAC address, vendors don't put them any higher in practice
+const ipmiMaxLANChannel uint8 = 3
+
 func NewHostManagementClient(host *Host) (client *HostManagementClient, err error) {
 	client = &HostManagementClient{
 		Host: host,
@@ -83,8 +100,22 @@ func (c *HostManagementClient) redfishInit() (err error) {
 	return
 }
 
+// splitManagementAddress splits an optional port off a management address, so BMCs behind port forwards
+// (or local simulators) can be reached as "ip:port".
+func splitManagementAddress(address string, defaultPort int) (host string, port int) {
+	host, port = address, defaultPort
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		if parsed, errConv := strconv.Atoi(p); errConv == nil {
+			host, port = h, parsed
+		}
+	}
+
+	return
+}
+
 func (c *HostManagementClient) ipmiInit() (err error) {
-	if c.ipmiClient, err = ipmi.NewClient(c.Host.ManagementIP, 623, config.Config.Management.DefaultIPMIUser, config.Config.Management.DefaultIPMIPass); err != nil {
+	host, port := splitManagementAddress(c.Host.ManagementIP, 623)
+	if c.ipmiClient, err = ipmi.NewClient(host, port, config.Config.Management.DefaultIPMIUser, config.Config.Management.DefaultIPMIPass); err != nil {
 		return
 	}
 
@@ -92,7 +123,17 @@ func (c *HostManagementClient) ipmiInit() (err error) {
 	return
 }
 
+// Close returns a pooled client to its pool, or logs out of the BMC.
 func (c *HostManagementClient) Close() {
+	if c.pool != nil {
+		c.release()
+		return
+	}
+
+	c.disconnect()
+}
+
+func (c *HostManagementClient) disconnect() {
 	if c.redfishClient != nil {
 		c.redfishClient.Logout()
 	}
@@ -106,17 +147,24 @@ func (c *HostManagementClient) Close() {
 
 // ---------- POWER MANAGEMENT ----------
 
+// refreshRedfishSystem reloads the primary system, whose properties are cached from when it was fetched.
+func (c *HostManagementClient) refreshRedfishSystem() (err error) {
+	if c.redfishService == nil {
+		err = ErrNotConnected
+		return
+	}
+
+	var systems []*redfish.ComputerSystem
+	if systems, err = c.redfishService.Systems(); err == nil && len(systems) > 0 {
+		c.redfishPrimarySystem = systems[0]
+	}
+
+	return
+}
+
 func (c *HostManagementClient) redfishPowerState(forcePoll bool) (state PowerState, err error) {
 	if forcePoll {
-		if c.redfishService == nil {
-			err = ErrNotConnected
-			return
-		}
-
-		var systems []*redfish.ComputerSystem
-		if systems, err = c.redfishService.Systems(); err == nil && len(systems) > 0 {
-			c.redfishPrimarySystem = systems[0]
-		} else if err != nil {
+		if err = c.refreshRedfishSystem(); err != nil {
 			return
 		}
 	}
@@ -149,6 +197,8 @@ func (c *HostManagementClient) ipmiPowerState() (state PowerState, err error) {
 }
 
 func (c *HostManagementClient) PowerState(forcePoll bool) (state PowerState, err error) {
+	defer c.noteResult(&err)
+
 	if !c.connected {
 		err = ErrNotConnected
 		return
@@ -213,6 +263,8 @@ func (c *HostManagementClient) ipmiSetPowerState(desiredState PowerState, force
 }
 
 func (c *HostManagementClient) SetPowerState(desiredState PowerState, force bool) (err error) {
+	defer c.noteResult(&err)
+
 	if !c.connected {
 		err = ErrNotConnected
 		return
@@ -257,6 +309,8 @@ func (c *HostManagementClient) ipmiResetPowerState(force bool) (err error) {
 }
 
 func (c *HostManagementClient) ResetPowerState(force bool) (err error) {
+	defer c.noteResult(&err)
+
 	if !c.connected {
 		err = ErrNotConnected
 		return
@@ -315,6 +369,8 @@ func (c *HostManagementClient) ipmiSetPXEBoot(bootMode BootMode) (err error) {
 }
 
 func (c *HostManagementClient) SetPXEBoot(bootMode BootMode) (err error) {
+	defer c.noteResult(&err)
+
 	if !c.connected {
 		err = ErrNotConnected
 		return
@@ -332,6 +388,66 @@ func (c *HostManagementClient) SetPXEBoot(bootMode BootMode) (err error) {
 	return
 }
 
+// ---------- BIOS CONFIGURATION ----------
+
+// BIOSAttributes reads the current BIOS attributes of the system.
+func (c *HostManagementClient) BIOSAttributes() (attributes map[string]any, err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	if c.Host.ManagementType != ManagementTypeRedfish {
+		err = ErrBIOSNotSupported
+		return
+	}
+
+	var bios *redfish.Bios
+	if bios, err = c.redfishPrimarySystem.Bios(); err != nil {
+		return
+	} else if bios == nil {
+		err = ErrBIOSNotSupported
+		return
+	}
+
+	attributes = map[string]any(bios.Attributes)
+	return
+}
+
+// RevertBIOS stages the given attributes, or a reset to factory defaults when there are none. Either takes
+// effect on the next boot.
+func (c *HostManagementClient) RevertBIOS(attributes map[string]any) (err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	if c.Host.ManagementType != ManagementTypeRedfish {
+		err = ErrBIOSNotSupported
+		return
+	}
+
+	var bios *redfish.Bios
+	if bios, err = c.redfishPrimarySystem.Bios(); err != nil {
+		return
+	} else if bios == nil {
+		err = ErrBIOSNotSupported
+		return
+	}
+
+	if len(attributes) == 0 {
+		err = bios.ResetBios()
+	} else {
+		err = bios.UpdateBiosAttributes(redfish.SettingsAttributes(attributes))
+	}
+
+	return
+}
+
 // ---------- DATA COLLECTION ----------
 
 func (c *HostManagementClient) redfishUpdateSystemInfo() (err error) {
@@ -367,8 +483,14 @@ func (c *HostManagementClient) redfishUpdateSystemInfo() (err error) {
 
 	c.Host.Model = c.redfishPrimarySystem.Model
 
+	// An unrecognized or missing manufacturer keeps the vendor detected earlier or set by an admin
+	if vendor := VendorFromManufacturer(c.redfishPrimarySystem.Manufacturer); vendor != VendorOther {
+		c.Host.Vendor = vendor
+	}
+
 	services, _ := c.redfishPrimarySystem.Storage()
 
+	c.Host.Specs.Storage, c.Host.Specs.Drives = nil, nil
 	for _, service := range services {
 		volumes, _ := service.Volumes()
 		for _, volume := range volumes {
@@ -377,12 +499,78 @@ func (c *HostManagementClient) redfishUpdateSystemInfo() (err error) {
 				MediaType:  string(volume.VolumeType),
 			})
 		}
+
+		// Drives are listed separately so hosts in HBA/JBOD mode, which have no volumes, still report storage
+		drives, _ := service.Drives()
+		for _, drive := range drives {
+			c.Host.Specs.Drives = append(c.Host.Specs.Drives, HostDriveSpecs{
+				Name:             drive.ID,
+				Model:            strings.TrimSpace(drive.Model),
+				SerialNumber:     strings.TrimSpace(drive.SerialNumber),
+				MediaType:        string(drive.MediaType),
+				Protocol:         string(drive.Protocol),
+				CapacityGB:       int(drive.CapacityBytes / (1024 * 1024 * 1024)),
+				FailurePredicted: drive.FailurePredicted,
+			})
+		}
+	}
+
+	sort.Slice(c.Host.Specs.Drives, func(i, j int) bool { return c.Host.Specs.Drives[i].Name < c.Host.Specs.Drives[j].Name })
+
+	interfaces, _ := c.redfishPrimarySystem.EthernetInterfaces()
+
+	c.Host.Specs.NICs = nil
+	for _, iface := range interfaces {
+		var mac string
+		if mac, err = NormalizeMACAddress(iface.MACAddress); err != nil {
+			if mac, err = NormalizeMACAddress(iface.PermanentMACAddress); err != nil {
+				// Disabled ports on some BMCs report no MAC at all
+				err = nil
+				continue
+			}
+		}
+
+		c.Host.Specs.NICs = append(c.Host.Specs.NICs, HostNICSpecs{
+			Name:       iface.ID,
+			MACAddress: mac,
+			SpeedMbps:  iface.SpeedMbps,
+			LinkStatus: string(iface.LinkStatus),
+		})
+	}
+
+	// Interfaces are fetched concurrently, keep them in a stable order
+	sort.Slice(c.Host.Specs.NICs, func(i, j int) bool { return c.Host.Specs.NICs[i].Name < c.Host.Specs.NICs[j].Name })
+	return
+}
+
+func (c *HostManagementClient) ipmiUpdateSystemInfo() (err error) {
+	// IPMI has no view of the host's own interfaces, only the BMC's LAN channels are reported
+	c.Host.Specs.NICs = nil
+	for channel := uint8(1); channel <= ipmiMaxLANChannel; channel++ {
+		var param *ipmi.LanConfigParam_MAC = &ipmi.LanConfigParam_MAC{}
+		if c.ipmiClient.GetLanConfigParamFor(bg, channel, param) != nil || len(param.MAC) == 0 {
+			continue
+		}
+
+		var mac string
+		if mac, err = NormalizeMACAddress(param.MAC.String()); err != nil {
+			err = nil
+			continue
+		}
+
+		c.Host.Specs.NICs = append(c.Host.Specs.NICs, HostNICSpecs{
+			Name:       fmt.Sprintf("BMC LAN %d", channel),
+			MACAddress: mac,
+			Management: true,
+		})
 	}
 
 	return
 }
 
 func (c *HostManagementClient) UpdateSystemInfo() (err error) {
+	defer c.noteResult(&err)
+
 	if !c.connected {
 		err = ErrNotConnected
 		return
@@ -391,6 +579,8 @@ func (c *HostManagementClient) UpdateSystemInfo() (err error) {
 	switch c.Host.ManagementType {
 	case ManagementTypeRedfish:
 		err = c.redfishUpdateSystemInfo()
+	case ManagementTypeIPMI:
+		err = c.ipmiUpdateSystemInfo()
 	default:
 		err = ErrBadManagementType
 	}
@@ -435,6 +625,8 @@ func (c *HostManagementClient) ipmiWaitSystemPowerState(desiredState PowerState,
 }
 
 func (c *HostManagementClient) WaitSystemPowerState(desiredState PowerState, timeoutSeconds int) (err error) {
+	defer c.noteResult(&err)
+
 	if !c.connected {
 		err = ErrNotConnected
 		return
@@ -451,3 +643,313 @@ func (c *HostManagementClient) WaitSystemPowerState(desiredState PowerState, tim
 
 	return
 }
+
+// ---------- EVENTS ----------
+
+func (c *HostManagementClient) redfishSubscribeEvents(destination, context string) (subscriptionURI string, err error) {
+	var service *redfish.EventService
+	if service, err = c.redfishService.EventService(); err != nil {
+		return
+	}
+
+	if !service.ServiceEnabled {
+		err = ErrEventsNotSupported
+		return
+	}
+
+	subscriptionURI, err = service.CreateEventSubscriptionInstance(destination, nil, nil, nil, redfish.RedfishEventDestinationProtocol, context, redfish.DeliveryRetryPolicy(""), nil)
+	return
+}
+
+// SubscribeEvents registers destination with the BMC's event service and returns the subscription URI.
+func (c *HostManagementClient) SubscribeEvents(destination, context string) (subscriptionURI string, err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	switch c.Host.ManagementType {
+	case ManagementTypeRedfish:
+		subscriptionURI, err = c.redfishSubscribeEvents(destination, context)
+	default:
+		err = ErrEventsNotSupported
+	}
+
+	return
+}
+
+// UnsubscribeEvents removes an event subscription from the BMC.
+func (c *HostManagementClient) UnsubscribeEvents(subscriptionURI string) (err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	switch c.Host.ManagementType {
+	case ManagementTypeRedfish:
+		err = redfish.DeleteEventDestination(c.redfishClient, subscriptionURI)
+	default:
+		err = ErrEventsNotSupported
+	}
+
+	return
+}
+
+// EventSubscriptionExists checks that the BMC still holds a subscription, they are lost on some BMC resets.
+func (c *HostManagementClient) EventSubscriptionExists(subscriptionURI string) (exists bool, err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	if c.Host.ManagementType != ManagementTypeRedfish {
+		err = ErrEventsNotSupported
+		return
+	}
+
+	if _, err = redfish.GetEventDestination(c.redfishClient, subscriptionURI); err == nil {
+		exists = true
+		return
+	}
+
+	var redfishErr *common.Error
+	if errors.As(err, &redfishErr) && redfishErr.HTTPReturnedStatusCode == http.StatusNotFound {
+		err = nil
+	}
+
+	return
+}
+
+// ---------- FIRMWARE ----------
+
+// firmwareCategoryFor guesses the component a firmware inventory entry belongs to from its ID and name, the
+// Redfish schema has no property for it and vendors name entries very differently.
+func firmwareCategoryFor(id, name string) FirmwareCategory {
+	var text string = strings.ToLower(id + " " + name)
+
+	switch {
+	case strings.Contains(text, "bios") || strings.Contains(text, "uefi") || strings.Contains(text, "system rom"):
+		return FirmwareCategoryBIOS
+	case strings.Contains(text, "bmc") || strings.Contains(text, "idrac") || strings.Contains(text, "ilo") || strings.Contains(text, "xcc") || strings.Contains(text, "remote access") || strings.Contains(text, "lights-out"):
+		return FirmwareCategoryBMC
+	case strings.Contains(text, "nic") || strings.Contains(text, "ethernet") || strings.Contains(text, "network") || strings.Contains(text, "adapter"):
+		return FirmwareCategoryNIC
+	case strings.Contains(text, "raid") || strings.Contains(text, "perc") || strings.Contains(text, "storage") || strings.Contains(text, "disk") || strings.Contains(text, "nvme") || strings.Contains(text, "hba"):
+		return FirmwareCategoryStorage
+	case strings.Contains(text, "psu") || strings.Contains(text, "power supply"):
+		return FirmwareCategoryPSU
+	}
+
+	return FirmwareCategoryOther
+}
+
+func (c *HostManagementClient) redfishFirmwareInventory() (records []*HostFirmware, err error) {
+	var (
+		service   *redfish.UpdateService
+		inventory []*redfish.SoftwareInventory
+	)
+
+	if service, err = c.redfishService.UpdateService(); err != nil {
+		return
+	}
+
+	if inventory, err = service.FirmwareInventories(); err != nil {
+		return
+	}
+
+	for _, entry := range inventory {
+		// Some BMCs list the previous and staged images too, only installed firmware is of interest
+		if entry.Status.State != "" && entry.Status.State != common.EnabledState {
+			continue
+		}
+
+		records = append(records, &HostFirmware{
+			ManagementIP: c.Host.ManagementIP,
+			InventoryID:  entry.ID,
+			Name:         entry.Name,
+			Category:     firmwareCategoryFor(entry.ID, entry.Name),
+			Version:      entry.Version,
+			Manufacturer: entry.Manufacturer,
+			ReleaseDate:  entry.ReleaseDate,
+			Updateable:   entry.Updateable,
+		})
+	}
+
+	return
+}
+
+func (c *HostManagementClient) ipmiFirmwareInventory() (records []*HostFirmware, err error) {
+	var device *ipmi.GetDeviceIDResponse
+	if device, err = c.ipmiClient.GetDeviceID(bg); err != nil {
+		return
+	}
+
+	// IPMI only reports the BMC's own firmware
+	records = append(records, &HostFirmware{
+		ManagementIP: c.Host.ManagementIP,
+		InventoryID:  "BMC",
+		Name:         "BMC",
+		Category:     FirmwareCategoryBMC,
+		Version:      device.FirmwareVersionStr(),
+	})
+
+	return
+}
+
+// FirmwareInventory lists the firmware installed on the host.
+func (c *HostManagementClient) FirmwareInventory() (records []*HostFirmware, err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	switch c.Host.ManagementType {
+	case ManagementTypeRedfish:
+		records, err = c.redfishFirmwareInventory()
+	case ManagementTypeIPMI:
+		records, err = c.ipmiFirmwareInventory()
+	default:
+		err = ErrBadManagementType
+	}
+
+	return
+}
+
+// redfishUpdateTask returns the task a BMC created for an update request, from the Location header or the
+// returned task resource. An empty URI means the BMC applied the update synchronously.
+func redfishUpdateTask(resp *http.Response) (taskURI string) {
+	defer resp.Body.Close()
+
+	if taskURI = resp.Header.Get("Location"); taskURI != "" {
+		if parsed, err := url.Parse(taskURI); err == nil {
+			taskURI = parsed.Path
+		}
+
+		return
+	}
+
+	var body struct {
+		ID   string `json:"@odata.id"`
+		Type string `json:"@odata.type"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && strings.Contains(body.Type, "Task") {
+		taskURI = body.ID
+	}
+
+	return
+}
+
+func (c *HostManagementClient) redfishSimpleFirmwareUpdate(imageURI string) (taskURI string, err error) {
+	var service *redfish.UpdateService
+	if service, err = c.redfishService.UpdateService(); err != nil {
+		return
+	}
+
+	// gofish does not expose the action target or the created task, so the action is posted directly
+	var actions struct {
+		Actions struct {
+			SimpleUpdate struct {
+				Target string
+			} `json:"#UpdateService.SimpleUpdate"`
+		}
+	}
+
+	if err = json.Unmarshal(service.RawData, &actions); err != nil {
+		return
+	} else if actions.Actions.SimpleUpdate.Target == "" {
+		err = ErrNoUpdateService
+		return
+	}
+
+	var resp *http.Response
+	if resp, err = c.redfishClient.Post(actions.Actions.SimpleUpdate.Target, &redfish.SimpleUpdateParameters{ImageURI: imageURI}); err != nil {
+		return
+	}
+
+	taskURI = redfishUpdateTask(resp)
+	return
+}
+
+func (c *HostManagementClient) redfishPushFirmwareUpdate(image *os.File) (taskURI string, err error) {
+	var service *redfish.UpdateService
+	if service, err = c.redfishService.UpdateService(); err != nil {
+		return
+	}
+
+	if service.MultipartHTTPPushURI == "" {
+		err = ErrNoUpdateService
+		return
+	}
+
+	var resp *http.Response
+	if resp, err = c.redfishClient.PostMultipart(service.MultipartHTTPPushURI, map[string]io.Reader{
+		"UpdateParameters": strings.NewReader(`{"Targets":[]}`),
+		"UpdateFile":       image,
+	}); err != nil {
+		return
+	}
+
+	taskURI = redfishUpdateTask(resp)
+	return
+}
+
+// StartFirmwareUpdate asks the BMC to install a firmware image, either by having it download imageURI
+// (SimpleUpdate) or by uploading imagePath (multipart push). It returns the URI of the task tracking the
+// update, or an empty URI if the BMC finished immediately.
+func (c *HostManagementClient) StartFirmwareUpdate(method FirmwareUpdateMethod, imageURI, imagePath string) (taskURI string, err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	if c.Host.ManagementType != ManagementTypeRedfish {
+		err = ErrNoUpdateService
+		return
+	}
+
+	switch method {
+	case FirmwareUpdateMethodSimpleUpdate:
+		taskURI, err = c.redfishSimpleFirmwareUpdate(imageURI)
+	case FirmwareUpdateMethodMultipartPush:
+		var image *os.File
+		if image, err = os.Open(imagePath); err != nil {
+			return
+		}
+
+		defer image.Close()
+		taskURI, err = c.redfishPushFirmwareUpdate(image)
+	default:
+		err = ErrInvalidState
+	}
+
+	return
+}
+
+// FirmwareTask reads the state of a firmware update task.
+func (c *HostManagementClient) FirmwareTask(taskURI string) (task *redfish.Task, err error) {
+	defer c.noteResult(&err)
+
+	if !c.connected {
+		err = ErrNotConnected
+		return
+	}
+
+	if c.Host.ManagementType != ManagementTypeRedfish {
+		err = ErrNoUpdateService
+		return
+	}
+
+	task, err = redfish.GetTask(c.redfishClient, taskURI)
+	return
+}
@@ -0,0 +1,302 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+)
+
+type idleManagementClient struct {
+	client *HostManagementClient
+	since  time.Time
+}
+
+// managementPoolEntry holds the sessions and health of a single BMC.
+type managementPoolEntry struct {
+	managementIP string
+	slots        chan struct{} // one per session the BMC may have open at once
+	idle         []idleManagementClient
+
+	failures     int
+	backoffUntil time.Time
+	lastError    error
+}
+
+// ManagementPoolStats describes the pool state for a single BMC.
+type ManagementPoolStats struct {
+	ManagementIP string    `json:"management_ip"`
+	InUse        int       `json:"in_use"`
+	Idle         int       `json:"idle"`
+	Failures     int       `json:"failures"`
+	BackoffUntil time.Time `json:"backoff_until"`
+	LastError    string    `json:"last_error"`
+}
+
+var (
+	managementPool     map[string]*managementPoolEntry = map[string]*managementPoolEntry{}
+	managementPoolLock sync.Mutex
+
+	ErrBMCBackoff = errors.New("bmc unreachable, backing off")
+	ErrBMCBusy    = errors.New("timed out waiting for a free bmc session")
+)
+
+func managementPoolEntryFor(managementIP string) (entry *managementPoolEntry) {
+	var ok bool
+	if entry, ok = managementPool[managementIP]; !ok {
+		entry = &managementPoolEntry{
+			managementIP: managementIP,
+			slots:        make(chan struct{}, max(config.Config.Management.PoolMaxSessionsPerBMC, 1)),
+		}
+
+		managementPool[managementIP] = entry
+	}
+
+	return
+}
+
+// backoffDelay doubles from the base delay with every consecutive failure, up to the configured maximum.
+func backoffDelay(failures int) (delay time.Duration) {
+	var (
+		base    time.Duration = time.Duration(config.Config.Management.BackoffBaseSeconds) * time.Second
+		ceiling time.Duration = time.Duration(config.Config.Management.BackoffMaxSeconds) * time.Second
+	)
+
+	delay = base
+	for i := 1; i < failures && delay < ceiling; i++ {
+		delay *= 2
+	}
+
+	return min(delay, ceiling)
+}
+
+// AcquireHostManagementClient returns a connected management client for the host, reusing an idle session
+// to the same BMC when there is one. At most MGMT_POOL_MAX_SESSIONS_PER_BMC clients are handed out per BMC
+// at once, and BMCs that failed to connect are not retried until their backoff expires. Closing the client
+// returns it to the pool.
+func AcquireHostManagementClient(host *Host) (client *HostManagementClient, err error) {
+	managementPoolLock.Lock()
+	var entry *managementPoolEntry = managementPoolEntryFor(host.ManagementIP)
+	if time.Now().Before(entry.backoffUntil) {
+		err = fmt.Errorf("%w until %s: %v", ErrBMCBackoff, entry.backoffUntil.Format(time.RFC3339), entry.lastError)
+		managementPoolLock.Unlock()
+		return
+	}
+	managementPoolLock.Unlock()
+
+	select {
+	case entry.slots <- struct{}{}:
+	case <-time.After(time.Duration(config.Config.Management.PoolAcquireSeconds) * time.Second):
+		err = ErrBMCBusy
+		return
+	}
+
+	managementPoolLock.Lock()
+	for len(entry.idle) > 0 && client == nil {
+		var last idleManagementClient = entry.idle[len(entry.idle)-1]
+		entry.idle = entry.idle[:len(entry.idle)-1]
+
+		if last.client.Host.ManagementType != host.ManagementType {
+			go last.client.disconnect()
+			continue
+		}
+
+		client = last.client
+	}
+	managementPoolLock.Unlock()
+
+	// The system cached at login may be minutes old, an idle session that can't reload it is dropped
+	if client != nil && client.redfishService != nil {
+		if errRefresh := client.refreshRedfishSystem(); errRefresh != nil {
+			log.Warnf("dropping idle session to bmc %s: %v", host.ManagementIP, errRefresh)
+			go client.disconnect()
+			client = nil
+		}
+	}
+
+	if client != nil {
+		client.Host = host
+		client.failed = false
+		client.pool = entry
+		return
+	}
+
+	if client, err = NewHostManagementClient(host); err != nil {
+		<-entry.slots
+		recordBMCHealth(host, entry, err)
+		client = nil
+		return
+	}
+
+	client.pool = entry
+	recordBMCHealth(host, entry, nil)
+	return
+}
+
+// recordBMCHealth updates the backoff state of a BMC and the reachable flag of its host.
+func recordBMCHealth(host *Host, entry *managementPoolEntry, connectErr error) {
+	var now time.Time = time.Now()
+
+	managementPoolLock.Lock()
+	if connectErr == nil {
+		entry.failures, entry.backoffUntil, entry.lastError = 0, time.Time{}, nil
+	} else {
+		entry.failures++
+		entry.lastError = connectErr
+		entry.backoffUntil = now.Add(backoffDelay(entry.failures))
+		log.Warnf("bmc %s unreachable (%d consecutive failures), backing off until %s: %v", host.ManagementIP, entry.failures, entry.backoffUntil.Format(time.RFC3339), connectErr)
+	}
+	managementPoolLock.Unlock()
+
+	var wasReachable bool = host.BMCReachable
+	host.BMCReachable, host.BMCCheckedAt, host.BMCLastError = connectErr == nil, now, ""
+	if connectErr != nil {
+		host.BMCLastError = connectErr.Error()
+	}
+
+	// Only transitions are written back, the caller saves the host on the happy path anyway
+	if wasReachable == host.BMCReachable {
+		return
+	}
+
+	if _, err := UpdateHost(host.ManagementIP, func(stored *Host) error {
+		stored.BMCReachable, stored.BMCCheckedAt, stored.BMCLastError = host.BMCReachable, host.BMCCheckedAt, host.BMCLastError
+		return nil
+	}); err != nil && !errors.Is(err, ErrHostNotFound) {
+		log.Errorf("failed to save bmc health for host %s: %v", host.ManagementIP, err)
+	}
+}
+
+// noteResult marks a pooled client as failed after an error talking to the BMC, so its session is logged
+// out rather than reused.
+func (c *HostManagementClient) noteResult(err *error) {
+	if *err != nil && !errors.Is(*err, ErrInvalidState) && !errors.Is(*err, ErrBadManagementType) && !errors.Is(*err, ErrEventsNotSupported) && !errors.Is(*err, ErrNoUpdateService) && !errors.Is(*err, ErrBIOSNotSupported) {
+		c.failed = true
+	}
+}
+
+// release hands a pooled client back, or disconnects it if it failed or its entry was dropped from the pool.
+func (c *HostManagementClient) release() {
+	var (
+		entry  *managementPoolEntry = c.pool
+		pooled bool
+	)
+
+	c.pool = nil
+
+	if !c.failed && c.connected {
+		managementPoolLock.Lock()
+		if pooled = managementPool[entry.managementIP] == entry; pooled {
+			entry.idle = append(entry.idle, idleManagementClient{client: c, since: time.Now()})
+		}
+		managementPoolLock.Unlock()
+	}
+
+	if !pooled {
+		c.disconnect()
+	}
+
+	<-entry.slots
+}
+
+// ExpireIdleManagementClients logs out pooled sessions that have not been used within the idle period.
+func ExpireIdleManagementClients(now time.Time) {
+	var (
+		cutoff  time.Time = now.Add(-time.Duration(config.Config.Management.PoolIdleSeconds) * time.Second)
+		expired []*HostManagementClient
+	)
+
+	managementPoolLock.Lock()
+	for _, entry := range managementPool {
+		var kept []idleManagementClient
+		for _, idle := range entry.idle {
+			if idle.since.Before(cutoff) {
+				expired = append(expired, idle.client)
+			} else {
+				kept = append(kept, idle)
+			}
+		}
+
+		entry.idle = kept
+	}
+	managementPoolLock.Unlock()
+
+	for _, client := range expired {
+		client.disconnect()
+	}
+}
+
+// CloseManagementPool logs out every idle session and forgets all backoff state.
+func CloseManagementPool() {
+	var idle []*HostManagementClient
+
+	managementPoolLock.Lock()
+	for _, entry := range managementPool {
+		for _, client := range entry.idle {
+			idle = append(idle, client.client)
+		}
+	}
+
+	managementPool = map[string]*managementPoolEntry{}
+	managementPoolLock.Unlock()
+
+	for _, client := range idle {
+		client.disconnect()
+	}
+}
+
+// forgetManagementClients logs out the idle sessions of a BMC and drops its pool entry, used when the host is
+// removed. Clients still in use are logged out when they are released.
+func forgetManagementClients(managementIP string) {
+	var idle []idleManagementClient
+
+	managementPoolLock.Lock()
+	if entry, ok := managementPool[managementIP]; ok {
+		idle, entry.idle = entry.idle, nil
+		delete(managementPool, managementIP)
+	}
+	managementPoolLock.Unlock()
+
+	for _, client := range idle {
+		client.client.disconnect()
+	}
+}
+
+// ManagementPoolSnapshot reports the sessions and health of every BMC the pool has seen.
+func ManagementPoolSnapshot() (stats []ManagementPoolStats) {
+	managementPoolLock.Lock()
+	defer managementPoolLock.Unlock()
+
+	for _, entry := range managementPool {
+		var stat ManagementPoolStats = ManagementPoolStats{
+			ManagementIP: entry.managementIP,
+			InUse:        len(entry.slots),
+			Idle:         len(entry.idle),
+			Failures:     entry.failures,
+			BackoffUntil: entry.backoffUntil,
+		}
+
+		if entry.lastError != nil {
+			stat.LastError = entry.lastError.Error()
+		}
+
+		stats = append(stats, stat)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ManagementIP < stats[j].ManagementIP })
+	return
+}
+
+// ResetBMCBackoff clears the backoff of a BMC so the next request connects immediately.
+func ResetBMCBackoff(managementIP string) {
+	managementPoolLock.Lock()
+	defer managementPoolLock.Unlock()
+
+	if entry, ok := managementPool[managementIP]; ok {
+		entry.failures, entry.backoffUntil = 0, time.Time{}
+	}
+}
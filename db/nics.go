@@ -0,0 +1,130 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+var (
+	ErrInvalidMACAddress  = errors.New("invalid MAC address")
+	ErrNICNotFound        = errors.New("host has no such NIC")
+	ErrNICNotProvisioning = errors.New("the BMC's own NIC can't be used for provisioning")
+)
+
+// NormalizeMACAddress converts a MAC address to the lowercase, colon separated form stored with hosts.
+func NormalizeMACAddress(mac string) (normalized string, err error) {
+	var address net.HardwareAddr
+	if address, err = net.ParseMAC(strings.TrimSpace(mac)); err != nil || len(address) != 6 {
+		err = fmt.Errorf("%w: %q", ErrInvalidMACAddress, mac)
+		return
+	}
+
+	normalized = address.String()
+	return
+}
+
+// NIC returns the host NIC with the given MAC address, or nil.
+func (host *Host) NIC(mac string) *HostNICSpecs {
+	for i, nic := range host.Specs.NICs {
+		if strings.EqualFold(nic.MACAddress, mac) {
+			return &host.Specs.NICs[i]
+		}
+	}
+
+	return nil
+}
+
+// RefreshHostSpecs reads the hardware inventory from a host's BMC and replaces the stored specs.
+func RefreshHostSpecs(managementIP string) (host *Host, err error) {
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	var collected *Host = &Host{ManagementIP: host.ManagementIP, ManagementType: host.ManagementType}
+	if collected.Management, err = AcquireHostManagementClient(collected); err != nil {
+		return
+	}
+
+	err = collected.Management.UpdateSystemInfo()
+	collected.Management.Close()
+
+	if err != nil {
+		return
+	}
+
+	// Reload so changes made while the BMC was being queried aren't overwritten
+	host, err = UpdateHost(managementIP, func(host *Host) error {
+		host.Specs = collected.Specs
+		if collected.Model != "" {
+			host.Model, host.Vendor = collected.Model, collected.Vendor
+		}
+
+		// A provisioning NIC that was removed would keep matching DHCP and PXE lookups
+		if nic := host.NIC(host.ProvisioningMAC); host.ProvisioningMAC != "" && (nic == nil || nic.Management) {
+			log.Warnf("provisioning NIC %s of host %s is no longer in its inventory, clearing it", host.ProvisioningMAC, managementIP)
+			host.ProvisioningMAC = ""
+		}
+
+		return nil
+	})
+	return
+}
+
+// SetHostProvisioningNIC marks the NIC a host PXE boots from. An empty MAC address clears it.
+func SetHostProvisioningNIC(managementIP, mac string) (host *Host, err error) {
+	if mac != "" {
+		if mac, err = NormalizeMACAddress(mac); err != nil {
+			return
+		}
+	}
+
+	host, err = UpdateHost(managementIP, func(host *Host) error {
+		if mac != "" {
+			var nic *HostNICSpecs = host.NIC(mac)
+			if nic == nil {
+				return fmt.Errorf("%w: %s", ErrNICNotFound, mac)
+			} else if nic.Management {
+				return ErrNICNotProvisioning
+			}
+		}
+
+		host.ProvisioningMAC = mac
+		return nil
+	})
+	return
+}
+
+// HostByMACAddress finds the host owning a MAC address, as seen by DHCP and PXE requests. Provisioning
+// NICs take precedence over any other NIC reporting the same address.
+func HostByMACAddress(mac string) (host *Host, provisioning bool, err error) {
+	if mac, err = NormalizeMACAddress(mac); err != nil {
+		return
+	}
+
+	var hosts []*Host
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	for _, candidate := range hosts {
+		if candidate.ProvisioningMAC == mac {
+			host, provisioning = candidate, true
+			return
+		} else if host == nil && candidate.NIC(mac) != nil {
+			host = candidate
+		}
+	}
+
+	if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, mac)
+	}
+
+	return
+}
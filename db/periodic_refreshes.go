@@ -1,10 +1,12 @@
 package db
 
 import (
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
 )
 
 func periodicHostPowerRefresh() (err error) {
@@ -14,28 +16,45 @@ func periodicHostPowerRefresh() (err error) {
 		return
 	}
 
-	var wg sync.WaitGroup
+	var (
+		wg     sync.WaitGroup
+		resync time.Duration = time.Duration(config.Config.Management.EventResyncMinutes) * time.Minute
+	)
+
 	for _, host := range hosts {
+		// Subscribed hosts report changes as events, they are only polled occasionally to catch missed ones
+		if host.EventSubscriptionURI != "" && EventSubscriptionsEnabled() && time.Since(host.LastKnownPowerStateTime) < resync {
+			continue
+		}
+
 		wg.Add(1)
 		go func(h *Host) {
 			defer wg.Done()
 			var err error
 
-			if h.Management, err = NewHostManagementClient(h); err != nil {
+			if h.Management, err = AcquireHostManagementClient(h); errors.Is(err, ErrBMCBackoff) {
+				return
+			} else if err != nil {
 				log.Errorf("failed to create management client for host %s: %v", h.ManagementIP, err)
 				return
 			}
 
 			defer h.Management.Close()
 
-			if h.LastKnownPowerState, err = h.Management.PowerState(true); err != nil {
+			var state PowerState
+			if state, err = h.Management.PowerState(h.ManagementType == ManagementTypeRedfish); err != nil {
 				log.Errorf("failed to get power state for host %s: %v", h.ManagementIP, err)
 				return
 			}
 
-			h.LastKnownPowerStateTime = time.Now()
+			EnsureHostEventSubscription(h)
 
-			if err = Hosts.Update(h); err != nil {
+			if _, err = UpdateHost(h.ManagementIP, func(stored *Host) error {
+				stored.LastKnownPowerState, stored.LastKnownPowerStateTime = state, time.Now()
+				stored.EventSubscriptionURI, stored.EventContext = h.EventSubscriptionURI, h.EventContext
+				stored.BMCReachable, stored.BMCCheckedAt, stored.BMCLastError = h.BMCReachable, h.BMCCheckedAt, h.BMCLastError
+				return nil
+			}); err != nil {
 				log.Errorf("failed to update host %s in database: %v", h.ManagementIP, err)
 				return
 			}
@@ -44,6 +63,11 @@ func periodicHostPowerRefresh() (err error) {
 
 	wg.Wait()
 
+	if err = pruneHostEvents(time.Now()); err != nil {
+		log.Errorf("failed to prune host events: %v", err)
+		err = nil
+	}
+
 	return
 }
 
@@ -58,5 +82,49 @@ func BeginPeriodicRefreshes() (err error) {
 		}
 	}()
 
+	go func() {
+		for {
+			time.Sleep(1 * time.Hour)
+
+			if err := periodicFirmwareRefresh(time.Now()); err != nil {
+				log.Errorf("error during periodic firmware inventory refresh: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			time.Sleep(30 * time.Second)
+			ExpireIdleManagementClients(time.Now())
+		}
+	}()
+
+	go func() {
+		for {
+			// Evaluate once per wall clock minute so cron schedules fire on time
+			time.Sleep(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+
+			if err := RefreshMaintenance(time.Now()); err != nil {
+				log.Errorf("error during maintenance refresh: %v", err)
+			}
+
+			if _, err := EvaluatePowerPolicies(time.Now()); err != nil {
+				log.Errorf("error during power policy evaluation: %v", err)
+			}
+
+			if _, err := ActivateScheduledBookings(time.Now()); err != nil {
+				log.Errorf("error during booking activation: %v", err)
+			}
+
+			if _, err := ReapExpiredBookings(time.Now()); err != nil {
+				log.Errorf("error during booking expiry: %v", err)
+			}
+
+			if _, err := ExpireBookingCarts(time.Now()); err != nil {
+				log.Errorf("error during booking cart expiry: %v", err)
+			}
+		}
+	}()
+
 	return
 }
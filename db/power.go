@@ -0,0 +1,325 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/luthermonson/go-proxmox"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/vm"
+)
+
+const powerActionWaitSeconds = 120
+
+const (
+	PowerResourceHost      = "host"
+	PowerResourceContainer = "container"
+)
+
+var (
+	ErrHostNotFound           = errors.New("host not found")
+	ErrUnsupportedPowerAction = errors.New("unsupported power action")
+)
+
+// PowerOutcome is the result of a power action on a single host or container during a bulk operation.
+type PowerOutcome struct {
+	ResourceType string     `json:"resource_type"`
+	ResourceID   string     `json:"resource_id"`
+	Success      bool       `json:"success"`
+	PowerState   PowerState `json:"power_state"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// PowerActionTargetState returns the power state a host should settle in after the action.
+func PowerActionTargetState(action PowerAction) (state PowerState, err error) {
+	switch action {
+	case PowerActionPowerOn, PowerActionGracefulRestart, PowerActionForceRestart:
+		state = PowerStateOn
+	case PowerActionPowerOff, PowerActionGracefulShutdown:
+		state = PowerStateOff
+	default:
+		err = ErrUnsupportedPowerAction
+	}
+
+	return
+}
+
+// RunHostPowerAction applies a power action to a host, waits for it to settle and stores the new power state.
+// The progress callback may be nil.
+func RunHostPowerAction(managementIP string, action PowerAction, progress func(percent int, message string)) (state PowerState, err error) {
+	var (
+		host         *Host
+		currentState PowerState
+		waitState    PowerState
+	)
+
+	if progress == nil {
+		progress = func(int, string) {}
+	}
+
+	if waitState, err = PowerActionTargetState(action); err != nil {
+		return
+	}
+
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	progress(10, "Connecting to management interface")
+
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		err = fmt.Errorf("failed to create management client: %w", err)
+		return
+	}
+
+	defer host.Management.Close()
+
+	if currentState, err = host.Management.PowerState(false); err != nil {
+		err = fmt.Errorf("failed to read current power state: %w", err)
+		return
+	}
+
+	progress(25, fmt.Sprintf("Sending %s", action.String()))
+
+	switch action {
+	case PowerActionPowerOn:
+		if currentState == PowerStateOn {
+			state = currentState
+			progress(100, "Host already powered on")
+			return
+		}
+
+		if err = host.Management.SetPowerState(PowerStateOn, false); err != nil {
+			err = fmt.Errorf("failed to power on host: %w", err)
+			return
+		}
+	case PowerActionGracefulShutdown:
+		if currentState == PowerStateOff {
+			state = currentState
+			progress(100, "Host already powered off")
+			return
+		}
+
+		if err = host.Management.SetPowerState(PowerStateOff, false); err != nil {
+			err = fmt.Errorf("failed to gracefully shut down host: %w", err)
+			return
+		}
+	case PowerActionPowerOff:
+		if currentState == PowerStateOff {
+			state = currentState
+			progress(100, "Host already powered off")
+			return
+		}
+
+		if err = host.Management.SetPowerState(PowerStateOff, true); err != nil {
+			err = fmt.Errorf("failed to force power off host: %w", err)
+			return
+		}
+	case PowerActionGracefulRestart:
+		if err = host.Management.ResetPowerState(false); err != nil {
+			err = fmt.Errorf("failed to gracefully restart host: %w", err)
+			return
+		}
+	case PowerActionForceRestart:
+		if err = host.Management.ResetPowerState(true); err != nil {
+			err = fmt.Errorf("failed to force restart host: %w", err)
+			return
+		}
+	}
+
+	progress(50, fmt.Sprintf("Waiting for host to reach %s power state", waitState.String()))
+
+	if err = host.Management.WaitSystemPowerState(waitState, powerActionWaitSeconds); err != nil {
+		err = fmt.Errorf("timed out waiting for host to reach %s power state: %w", waitState.String(), err)
+		return
+	}
+
+	state = waitState
+	if polled, errPoll := host.Management.PowerState(host.ManagementType == ManagementTypeRedfish); errPoll != nil {
+		log.Warnf("failed to update last known power state for host %s: %v", host.ManagementIP, errPoll)
+	} else {
+		state = polled
+	}
+
+	if _, errUpdate := UpdateHost(managementIP, func(stored *Host) error {
+		stored.LastKnownPowerState = state
+		stored.LastKnownPowerStateTime = time.Now()
+		return nil
+	}); errUpdate != nil {
+		log.Warnf("failed to save updated power state for host %s: %v", host.ManagementIP, errUpdate)
+	}
+
+	progress(100, "Power action completed successfully")
+	return
+}
+
+// BulkHostPowerAction runs a power action against many hosts, limited to the configured concurrency.
+// The progress callback may be nil.
+func BulkHostPowerAction(managementIPs []string, action PowerAction, progress func(percent int, message string)) (outcomes []PowerOutcome) {
+	var (
+		slots     chan struct{} = make(chan struct{}, max(config.Config.Management.BulkPowerConcurrency, 1))
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		completed int
+	)
+
+	if progress == nil {
+		progress = func(int, string) {}
+	}
+
+	outcomes = make([]PowerOutcome, len(managementIPs))
+	for i, managementIP := range managementIPs {
+		wg.Add(1)
+		go func(index int, ip string) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			var outcome PowerOutcome = PowerOutcome{ResourceType: PowerResourceHost, ResourceID: ip}
+			if state, err := RunHostPowerAction(ip, action, nil); err != nil {
+				outcome.Error = err.Error()
+			} else {
+				outcome.Success = true
+				outcome.PowerState = state
+			}
+
+			outcomes[index] = outcome
+
+			lock.Lock()
+			completed++
+			progress(completed*100/len(managementIPs), fmt.Sprintf("%d of %d hosts done", completed, len(managementIPs)))
+			lock.Unlock()
+		}(i, managementIP)
+	}
+
+	wg.Wait()
+	return
+}
+
+// ContainerPowerAction applies a power action to Proxmox containers using the bulk start/stop helpers.
+func ContainerPowerAction(ctIDs []int, action PowerAction) (outcomes []PowerOutcome) {
+	var (
+		api        *vm.ProxmoxAPI
+		containers []*proxmox.Container
+		err        error
+		targetIDs  []int
+		found      map[int]*proxmox.Container = map[int]*proxmox.Container{}
+		state      PowerState
+	)
+
+	fail := func(reason error) []PowerOutcome {
+		var failed []PowerOutcome
+		for _, id := range ctIDs {
+			failed = append(failed, PowerOutcome{ResourceType: PowerResourceContainer, ResourceID: strconv.Itoa(id), Error: reason.Error()})
+		}
+
+		return failed
+	}
+
+	if len(ctIDs) == 0 {
+		return
+	}
+
+	if state, err = PowerActionTargetState(action); err != nil {
+		return fail(err)
+	}
+
+	if api, err = vm.SharedProxmox(); err != nil {
+		return fail(err)
+	}
+
+	if containers, err = api.GetContainers(ctIDs); err != nil {
+		return fail(err)
+	}
+
+	for _, ct := range containers {
+		found[int(ct.VMID)] = ct
+	}
+
+	for _, id := range ctIDs {
+		if ct, ok := found[id]; ok {
+			// Proxmox rejects starting a running container or stopping a stopped one
+			if (action == PowerActionPowerOn && ct.Status == "running") || (state == PowerStateOff && ct.Status == "stopped") {
+				continue
+			}
+
+			targetIDs = append(targetIDs, id)
+		}
+	}
+
+	if len(targetIDs) > 0 {
+		switch action {
+		case PowerActionPowerOn:
+			err = api.BulkStart(targetIDs)
+		case PowerActionPowerOff, PowerActionGracefulShutdown:
+			err = api.BulkStop(targetIDs)
+		case PowerActionGracefulRestart, PowerActionForceRestart:
+			if err = api.BulkStop(targetIDs); err == nil {
+				err = api.BulkStart(targetIDs)
+			}
+		}
+	}
+
+	for _, id := range ctIDs {
+		var outcome PowerOutcome = PowerOutcome{ResourceType: PowerResourceContainer, ResourceID: strconv.Itoa(id)}
+
+		switch {
+		case found[id] == nil:
+			outcome.Error = "container not found"
+		case err != nil:
+			outcome.Error = err.Error()
+		default:
+			outcome.Success = true
+			outcome.PowerState = state
+
+			if record, errSelect := bookingContainers.Select(id); errSelect == nil && record != nil {
+				record.LastKnownPowerState = state
+				record.LastKnownPowerTime = time.Now()
+				if errUpdate := UpdateBookingContainer(record); errUpdate != nil {
+					log.Warnf("failed to save power state for container %d: %v", id, errUpdate)
+				}
+			}
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	return
+}
+
+// BookingPowerAction applies a power action to every host and container owned by a booking.
+// The progress callback may be nil.
+func BookingPowerAction(bookingID int, action PowerAction, progress func(percent int, message string)) (outcomes []PowerOutcome, err error) {
+	var booking *Booking
+
+	if progress == nil {
+		progress = func(int, string) {}
+	}
+
+	if booking, err = BookingByID(bookingID); err != nil {
+		return
+	} else if booking == nil {
+		err = ErrBookingNotFound
+		return
+	}
+
+	outcomes = BulkHostPowerAction(booking.OwnedHostManagementIPs, action, func(percent int, message string) {
+		// Hosts are the slow part, containers get the remaining share once they finish
+		progress(percent*9/10, message)
+	})
+
+	if len(booking.OwnedBookingCTIDs) > 0 {
+		progress(90, fmt.Sprintf("Applying %s to %d containers", action.String(), len(booking.OwnedBookingCTIDs)))
+		outcomes = append(outcomes, ContainerPowerAction(booking.OwnedBookingCTIDs, action)...)
+	}
+
+	return
+}
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+)
+
+// Power policy jobs are created by these pseudo-users so they can be told apart in the job history
+const (
+	PowerPolicyCreatorPrefix   = "power-policy:"
+	PowerPolicyCreatorIdle     = PowerPolicyCreatorPrefix + "idle"
+	PowerPolicyCreatorPreStart = PowerPolicyCreatorPrefix + "pre-start"
+)
+
+var (
+	powerScheduleLock sync.Mutex
+
+	// Hosts with a policy power action in flight, so a slow BMC isn't sent the same action every tick
+	powerPolicyInFlight     map[string]bool = map[string]bool{}
+	powerPolicyInFlightLock sync.Mutex
+
+	ErrPowerScheduleNotFound = errors.New("power schedule not found")
+)
+
+// PowerScheduleCreator is the job creator recorded for actions fired by a schedule.
+func PowerScheduleCreator(scheduleID int) string {
+	return fmt.Sprintf("%sschedule:%d", PowerPolicyCreatorPrefix, scheduleID)
+}
+
+// validatePowerSchedule checks the cron spec, action and host of a schedule.
+func validatePowerSchedule(record *PowerSchedule) (err error) {
+	if _, err = ParseCronSpec(record.Cron); err != nil {
+		return
+	}
+
+	if _, err = PowerActionTargetState(record.Action); err != nil {
+		return
+	}
+
+	var host *Host
+	if host, err = Hosts.Select(record.ManagementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, record.ManagementIP)
+	}
+
+	return
+}
+
+// CreatePowerSchedule validates and stores a new power schedule.
+func CreatePowerSchedule(record *PowerSchedule) (err error) {
+	if err = validatePowerSchedule(record); err != nil {
+		return
+	}
+
+	powerScheduleLock.Lock()
+	defer powerScheduleLock.Unlock()
+
+	err = powerSchedules.Insert(record)
+	return
+}
+
+// UpdatePowerSchedule validates and saves changes to an existing power schedule.
+func UpdatePowerSchedule(record *PowerSchedule) (err error) {
+	if err = validatePowerSchedule(record); err != nil {
+		return
+	}
+
+	powerScheduleLock.Lock()
+	defer powerScheduleLock.Unlock()
+
+	var existing *PowerSchedule
+	if existing, err = powerSchedules.Select(record.ID); err != nil {
+		return
+	} else if existing == nil {
+		err = ErrPowerScheduleNotFound
+		return
+	}
+
+	err = powerSchedules.Update(record)
+	return
+}
+
+// DeletePowerSchedule removes a power schedule.
+func DeletePowerSchedule(scheduleID int) (err error) {
+	powerScheduleLock.Lock()
+	defer powerScheduleLock.Unlock()
+
+	var existing *PowerSchedule
+	if existing, err = powerSchedules.Select(scheduleID); err != nil {
+		return
+	} else if existing == nil {
+		err = ErrPowerScheduleNotFound
+		return
+	}
+
+	err = powerSchedules.Delete(scheduleID)
+	return
+}
+
+// PowerScheduleByID fetches a power schedule by its ID.
+func PowerScheduleByID(scheduleID int) (record *PowerSchedule, err error) {
+	powerScheduleLock.Lock()
+	defer powerScheduleLock.Unlock()
+
+	if record, err = powerSchedules.Select(scheduleID); err == nil && record == nil {
+		err = ErrPowerScheduleNotFound
+	}
+
+	return
+}
+
+// PowerScheduleList lists every power schedule ordered by ID.
+func PowerScheduleList() (records []*PowerSchedule, err error) {
+	powerScheduleLock.Lock()
+	records, err = powerSchedules.SelectAll()
+	powerScheduleLock.Unlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return
+}
+
+// PowerPolicyJobs lists the jobs fired by the power policy engine, newest first.
+func PowerPolicyJobs() (records []*Job, err error) {
+	var all []*Job
+	if all, err = JobList(); err != nil {
+		return
+	}
+
+	for _, job := range all {
+		if strings.HasPrefix(job.CreatedBy, PowerPolicyCreatorPrefix) {
+			records = append(records, job)
+		}
+	}
+
+	return
+}
+
+// enqueuePolicyPowerAction queues a power action for a host unless one from the policy engine is already running.
+func enqueuePolicyPowerAction(managementIP string, action PowerAction, creator string, reason string) (job *Job, err error) {
+	powerPolicyInFlightLock.Lock()
+	if powerPolicyInFlight[managementIP] {
+		powerPolicyInFlightLock.Unlock()
+		return
+	}
+
+	powerPolicyInFlight[managementIP] = true
+	powerPolicyInFlightLock.Unlock()
+
+	log.Infof("power policy: %s on host %s (%s)", action.String(), managementIP, reason)
+
+	if job, err = EnqueueJob(JobKindHostPower, managementIP, creator, func(handle *JobHandle) error {
+		defer func() {
+			powerPolicyInFlightLock.Lock()
+			delete(powerPolicyInFlight, managementIP)
+			powerPolicyInFlightLock.Unlock()
+		}()
+
+		handle.Progress(0, reason)
+		state, err := RunHostPowerAction(managementIP, action, handle.Progress)
+		if err != nil {
+			return err
+		}
+
+		return handle.SetResult(map[string]any{"power_state": state, "reason": reason})
+	}); err != nil {
+		powerPolicyInFlightLock.Lock()
+		delete(powerPolicyInFlight, managementIP)
+		powerPolicyInFlightLock.Unlock()
+	}
+
+	return
+}
+
+// evaluateIdlePowerOff powers off unbooked hosts that have been idle longer than the configured period. Hosts
+// reserved for a booking starting within the pre-start lead time are left on for it.
+func evaluateIdlePowerOff(now time.Time, hosts []*Host) (queued []*Job) {
+	var (
+		idleFor      time.Duration   = time.Duration(config.Config.PowerPolicy.IdleOffMinutes) * time.Minute
+		lead         time.Duration   = time.Duration(config.Config.PowerPolicy.PreStartOnMinutes) * time.Minute
+		reservedSoon map[string]bool = map[string]bool{}
+	)
+
+	hostReservationsLock.Lock()
+	reservations, err := hostReservations.SelectAll()
+	hostReservationsLock.Unlock()
+	if err != nil {
+		log.Errorf("failed to list host reservations for idle power off: %v", err)
+		return
+	}
+
+	for _, reservation := range reservations {
+		if overlapping(reservation.StartTime, heldUntil(reservation.EndTime), now, now.Add(lead)) {
+			reservedSoon[reservation.ManagementIP] = true
+		}
+	}
+
+	for _, host := range hosts {
+		// Powering off mid-flash can brick a host, a wipe powers its host off once done, hosts in maintenance are
+		// left to the admins working on them, and pre-start powers reserved hosts on for their booking
+		if host.IsBooked || host.FirmwareUpdating || host.Wiping || host.InMaintenance() || reservedSoon[host.ManagementIP] {
+			continue
+		}
+
+		if host.IdleSince.IsZero() {
+			// Start the idle clock for hosts that predate idle tracking, the host is re-read as it may have been
+			// booked since the snapshot was taken
+			if _, err := UpdateHost(host.ManagementIP, func(host *Host) error {
+				if host.IdleSince.IsZero() && !host.IsBooked && !host.FirmwareUpdating && !host.Wiping {
+					host.IdleSince = now
+				}
+
+				return nil
+			}); err != nil {
+				log.Errorf("failed to start idle clock for host %s: %v", host.ManagementIP, err)
+			}
+
+			continue
+		}
+
+		if host.LastKnownPowerState != PowerStateOn || now.Sub(host.IdleSince) < idleFor {
+			continue
+		}
+
+		if job, err := enqueuePolicyPowerAction(host.ManagementIP, PowerActionPowerOff, PowerPolicyCreatorIdle, fmt.Sprintf("Idle since %s", host.IdleSince.Format(time.RFC3339))); err != nil {
+			log.Errorf("failed to queue idle power off for host %s: %v", host.ManagementIP, err)
+		} else if job != nil {
+			queued = append(queued, job)
+		}
+	}
+
+	return
+}
+
+// evaluatePreStartPowerOn powers on the hosts owned by or reserved for bookings that start within the configured
+// lead time.
+func evaluatePreStartPowerOn(now time.Time, hosts []*Host) (queued []*Job) {
+	var (
+		lead    time.Duration    = time.Duration(config.Config.PowerPolicy.PreStartOnMinutes) * time.Minute
+		byIP    map[string]*Host = map[string]*Host{}
+		records []*Booking
+		err     error
+	)
+
+	for _, host := range hosts {
+		byIP[host.ManagementIP] = host
+	}
+
+	if records, err = BookingList(); err != nil {
+		log.Errorf("failed to list bookings for pre-start power on: %v", err)
+		return
+	}
+
+	for _, booking := range records {
+		if booking.Status == BookingStatusDone || !booking.StartTime.After(now) || booking.StartTime.Sub(now) > lead {
+			continue
+		}
+
+		var managementIPs []string = slices.Clone(booking.OwnedHostManagementIPs)
+		if reservations, err := HostReservationsForBooking(booking.ID); err != nil {
+			log.Errorf("failed to list the reserved hosts of booking %d: %v", booking.ID, err)
+		} else {
+			for _, reservation := range reservations {
+				managementIPs = appendUniqueString(managementIPs, reservation.ManagementIP)
+			}
+		}
+
+		for _, managementIP := range managementIPs {
+			if host, ok := byIP[managementIP]; !ok || host.LastKnownPowerState == PowerStateOn {
+				continue
+			}
+
+			if job, err := enqueuePolicyPowerAction(managementIP, PowerActionPowerOn, PowerPolicyCreatorPreStart, fmt.Sprintf("Booking %d starts at %s", booking.ID, booking.StartTime.Format(time.RFC3339))); err != nil {
+				log.Errorf("failed to queue pre-start power on for host %s: %v", managementIP, err)
+			} else if job != nil {
+				queued = append(queued, job)
+
+				// Restart the idle clock of reserved hosts, they were idle while off
+				if _, err := UpdateHost(managementIP, func(host *Host) error {
+					if !host.IdleSince.IsZero() {
+						host.IdleSince = now
+					}
+
+					return nil
+				}); err != nil {
+					log.Errorf("failed to restart idle clock for host %s: %v", managementIP, err)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// evaluatePowerSchedules fires the admin defined schedules that match the current minute.
+func evaluatePowerSchedules(now time.Time, hosts []*Host) (queued []*Job) {
+	var (
+		minute    time.Time        = now.Truncate(time.Minute)
+		byIP      map[string]*Host = map[string]*Host{}
+		schedules []*PowerSchedule
+		err       error
+	)
+
+	for _, host := range hosts {
+		byIP[host.ManagementIP] = host
+	}
+
+	if schedules, err = PowerScheduleList(); err != nil {
+		log.Errorf("failed to list power schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		if !schedule.Enabled || !schedule.LastRunAt.Before(minute) {
+			continue
+		}
+
+		spec, err := ParseCronSpec(schedule.Cron)
+		if err != nil {
+			log.Errorf("power schedule %d has an invalid cron spec: %v", schedule.ID, err)
+			continue
+		}
+
+		if !spec.Matches(minute) {
+			continue
+		}
+
+		host, ok := byIP[schedule.ManagementIP]
+		if !ok || host.FirmwareUpdating || host.Wiping || host.InMaintenance() || (host.IsBooked && !schedule.AllowWhileBooked) {
+			continue
+		}
+
+		schedule.LastRunAt = minute
+		powerScheduleLock.Lock()
+		err = powerSchedules.Update(schedule)
+		powerScheduleLock.Unlock()
+
+		if err != nil {
+			log.Errorf("failed to record run of power schedule %d: %v", schedule.ID, err)
+			continue
+		}
+
+		if job, err := enqueuePolicyPowerAction(schedule.ManagementIP, schedule.Action, PowerScheduleCreator(schedule.ID), fmt.Sprintf("Schedule %d (%s)", schedule.ID, schedule.Cron)); err != nil {
+			log.Errorf("failed to queue scheduled power action for host %s: %v", schedule.ManagementIP, err)
+		} else if job != nil {
+			queued = append(queued, job)
+		}
+	}
+
+	return
+}
+
+// EvaluatePowerPolicies runs one pass of the power policy engine and returns the jobs it queued.
+func EvaluatePowerPolicies(now time.Time) (queued []*Job, err error) {
+	var hosts []*Host
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	if config.Config.PowerPolicy.Enabled {
+		queued = append(queued, evaluateIdlePowerOff(now, hosts)...)
+		queued = append(queued, evaluatePreStartPowerOn(now, hosts)...)
+	}
+
+	queued = append(queued, evaluatePowerSchedules(now, hosts)...)
+	return
+}
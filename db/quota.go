@@ -0,0 +1,434 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/z46-dev/gomysql"
+)
+
+var quotaPoliciesLock sync.Mutex
+
+var (
+	ErrQuotaExceeded       = errors.New("quota exceeded")
+	ErrQuotaPolicyNotFound = errors.New("quota policy not found")
+	ErrInvalidQuotaPolicy  = errors.New("invalid quota policy")
+)
+
+// QuotaLimits are the limits in effect for a user, zero is unlimited. A policy set for the user replaces those of
+// their groups, otherwise each limit is the most generous among their groups.
+type QuotaLimits struct {
+	Hosts          int   `json:"hosts"`
+	Cores          int   `json:"cores"`
+	MemoryMB       int   `json:"memory_mb"`
+	DiskGB         int   `json:"disk_gb"`
+	DurationDays   int   `json:"duration_days"`
+	ActiveBookings int   `json:"active_bookings"`
+	PolicyIDs      []int `json:"policy_ids"`
+}
+
+// QuotaUsage is what a user holds across the bookings they own and the requests they made that are yet to be
+// fulfilled. Hosts in their cart are counted apart.
+type QuotaUsage struct {
+	Hosts          int `json:"hosts"`
+	CartHosts      int `json:"cart_hosts"`
+	Cores          int `json:"cores"`
+	MemoryMB       int `json:"memory_mb"`
+	DiskGB         int `json:"disk_gb"`
+	ActiveBookings int `json:"active_bookings"`
+}
+
+// QuotaRemaining is what a user may still take, -1 when unlimited.
+type QuotaRemaining struct {
+	Hosts          int `json:"hosts"`
+	Cores          int `json:"cores"`
+	MemoryMB       int `json:"memory_mb"`
+	DiskGB         int `json:"disk_gb"`
+	ActiveBookings int `json:"active_bookings"`
+}
+
+// Quota is a user's limits, usage and remaining allowance.
+type Quota struct {
+	Username  string         `json:"username"`
+	Limits    QuotaLimits    `json:"limits"`
+	Usage     QuotaUsage     `json:"usage"`
+	Remaining QuotaRemaining `json:"remaining"`
+}
+
+// QuotaPolicyList returns every quota policy, users before groups.
+func QuotaPolicyList() (records []*QuotaPolicy, err error) {
+	quotaPoliciesLock.Lock()
+	defer quotaPoliciesLock.Unlock()
+
+	if records, err = quotaPolicies.SelectAll(); err == nil {
+		sort.Slice(records, func(i, j int) bool {
+			if records[i].Scope != records[j].Scope {
+				return records[i].Scope == QuotaScopeUser
+			}
+
+			return records[i].Subject < records[j].Subject
+		})
+	}
+
+	return
+}
+
+// quotaPolicyFor finds the policy of a user or group. The caller must hold quotaPoliciesLock.
+func quotaPolicyFor(scope QuotaScope, subject string) (record *QuotaPolicy, err error) {
+	var records []*QuotaPolicy
+	if records, err = quotaPolicies.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(quotaPolicies.FieldBySQLName("subject"), gomysql.OpEqual, subject)); err != nil {
+		return
+	}
+
+	for _, candidate := range records {
+		if candidate.Scope == scope {
+			record = candidate
+			return
+		}
+	}
+
+	return
+}
+
+// SetQuotaPolicy sets the limits of a user or group, replacing any existing policy for them.
+func SetQuotaPolicy(policy *QuotaPolicy, updatedBy string) (record *QuotaPolicy, err error) {
+	policy.Subject = strings.TrimSpace(policy.Subject)
+	if _, ok := QuotaScopeNames[policy.Scope]; !ok {
+		err = fmt.Errorf("%w: unknown scope %q", ErrInvalidQuotaPolicy, policy.Scope)
+		return
+	} else if policy.Subject == "" {
+		err = fmt.Errorf("%w: a user or group is required", ErrInvalidQuotaPolicy)
+		return
+	} else if min(policy.MaxHosts, policy.MaxCores, policy.MaxMemoryMB, policy.MaxDiskGB, policy.MaxDurationDays, policy.MaxActiveBookings) < 0 {
+		err = fmt.Errorf("%w: limits cannot be negative", ErrInvalidQuotaPolicy)
+		return
+	}
+
+	quotaPoliciesLock.Lock()
+	defer quotaPoliciesLock.Unlock()
+
+	var existing *QuotaPolicy
+	if existing, err = quotaPolicyFor(policy.Scope, policy.Subject); err != nil {
+		return
+	}
+
+	record = policy
+	record.UpdatedBy = updatedBy
+	record.UpdatedAt = time.Now()
+
+	if existing == nil {
+		record.ID = 0
+		err = quotaPolicies.Insert(record)
+	} else {
+		record.ID = existing.ID
+		err = quotaPolicies.Update(record)
+	}
+
+	return
+}
+
+// DeleteQuotaPolicy lifts the limits of a user or group.
+func DeleteQuotaPolicy(scope QuotaScope, subject string) (err error) {
+	quotaPoliciesLock.Lock()
+	defer quotaPoliciesLock.Unlock()
+
+	var existing *QuotaPolicy
+	if existing, err = quotaPolicyFor(scope, subject); err != nil {
+		return
+	} else if existing == nil {
+		err = fmt.Errorf("%w: %s %s", ErrQuotaPolicyNotFound, scope, subject)
+		return
+	}
+
+	err = quotaPolicies.Delete(existing.ID)
+	return
+}
+
+// EffectiveQuotaLimits works out the limits of a user from their own policy, or from those of their groups.
+func EffectiveQuotaLimits(username string, groups []string) (limits QuotaLimits, err error) {
+	var records []*QuotaPolicy
+	if records, err = QuotaPolicyList(); err != nil {
+		return
+	}
+
+	var matched []*QuotaPolicy
+	for _, record := range records {
+		if record.Scope == QuotaScopeUser && record.Subject == username {
+			matched = []*QuotaPolicy{record}
+			break
+		}
+
+		if record.Scope == QuotaScopeGroup && slices.Contains(groups, record.Subject) {
+			matched = append(matched, record)
+		}
+	}
+
+	// Zero is unlimited, so it is the most generous value of all
+	generous := func(current, candidate int, first bool) int {
+		switch {
+		case first:
+			return candidate
+		case current == 0 || candidate == 0:
+			return 0
+		default:
+			return max(current, candidate)
+		}
+	}
+
+	for i, record := range matched {
+		limits.Hosts = generous(limits.Hosts, record.MaxHosts, i == 0)
+		limits.Cores = generous(limits.Cores, record.MaxCores, i == 0)
+		limits.MemoryMB = generous(limits.MemoryMB, record.MaxMemoryMB, i == 0)
+		limits.DiskGB = generous(limits.DiskGB, record.MaxDiskGB, i == 0)
+		limits.DurationDays = generous(limits.DurationDays, record.MaxDurationDays, i == 0)
+		limits.ActiveBookings = generous(limits.ActiveBookings, record.MaxActiveBookings, i == 0)
+		limits.PolicyIDs = append(limits.PolicyIDs, record.ID)
+	}
+
+	return
+}
+
+// quotaUsage adds up what a user holds: the hosts, containers and VMs of the bookings they own that have not ended
+// and the resources of their requests that are pending or approved but not yet provisioned.
+func quotaUsage(username string) (usage QuotaUsage, err error) {
+	var (
+		persons  []*BookingPerson
+		requests []*BookingRequest
+		hosts    []string
+	)
+
+	if persons, err = BookingPersonsFor(username); err != nil {
+		return
+	}
+
+	for _, person := range persons {
+		if person.PermissionLevel != BookingPermissionLevelOwner {
+			continue
+		}
+
+		var (
+			booking      *Booking
+			reservations []*HostReservation
+			containers   []*BookingContainer
+			machines     []*BookingVM
+		)
+
+		if booking, err = bookings.Select(person.BookingID); err != nil {
+			return
+		} else if booking == nil || booking.Status == BookingStatusDone {
+			continue
+		}
+
+		if reservations, err = HostReservationsForBooking(booking.ID); err != nil {
+			return
+		}
+
+		if containers, err = BookingContainersForBooking(booking.ID); err != nil {
+			return
+		}
+
+		if machines, err = BookingVMsForBooking(booking.ID); err != nil {
+			return
+		}
+
+		usage.ActiveBookings++
+		for _, managementIP := range booking.OwnedHostManagementIPs {
+			hosts = appendUniqueString(hosts, managementIP)
+		}
+
+		for _, reservation := range reservations {
+			hosts = appendUniqueString(hosts, reservation.ManagementIP)
+		}
+
+		for _, ct := range containers {
+			usage.Cores += ct.Cores
+			usage.MemoryMB += ct.MemoryMB
+			usage.DiskGB += ct.DiskGB
+		}
+
+		for _, machine := range machines {
+			usage.Cores += machine.Cores
+			usage.MemoryMB += machine.MemoryMB
+			usage.DiskGB += machine.DiskGB
+		}
+	}
+
+	if requests, err = bookingRequests.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(bookingRequests.FieldBySQLName("requested_by"), gomysql.OpEqual, username)); err != nil {
+		return
+	}
+
+	for _, request := range requests {
+		if request.Status == BookingRequestStatusRejected || !request.FulfilledAt.IsZero() {
+			continue
+		}
+
+		for _, host := range request.Hosts {
+			hosts = appendUniqueString(hosts, host.ManagementIP)
+		}
+
+		usage.add(request.Containers, request.VMs)
+	}
+
+	usage.Hosts = len(hosts)
+	return
+}
+
+// add counts the containers and VMs of a request.
+func (usage *QuotaUsage) add(containers []BookingRequestCT, vms []BookingRequestVM) {
+	for _, ct := range containers {
+		usage.Cores += ct.Cores
+		usage.MemoryMB += ct.MemoryMB
+		usage.DiskGB += ct.DiskGB
+	}
+
+	for _, machine := range vms {
+		usage.Cores += machine.Cores
+		usage.MemoryMB += machine.MemoryMB
+		usage.DiskGB += machine.DiskGB
+	}
+}
+
+// check returns the first limit the usage is over, hosts in the cart included.
+func (limits QuotaLimits) check(usage QuotaUsage) (err error) {
+	switch {
+	case limits.Hosts > 0 && usage.Hosts+usage.CartHosts > limits.Hosts:
+		err = fmt.Errorf("%w: %d hosts would be held, the limit is %d", ErrQuotaExceeded, usage.Hosts+usage.CartHosts, limits.Hosts)
+	case limits.Cores > 0 && usage.Cores > limits.Cores:
+		err = fmt.Errorf("%w: %d cores would be held, the limit is %d", ErrQuotaExceeded, usage.Cores, limits.Cores)
+	case limits.MemoryMB > 0 && usage.MemoryMB > limits.MemoryMB:
+		err = fmt.Errorf("%w: %d MB of memory would be held, the limit is %d", ErrQuotaExceeded, usage.MemoryMB, limits.MemoryMB)
+	case limits.DiskGB > 0 && usage.DiskGB > limits.DiskGB:
+		err = fmt.Errorf("%w: %d GB of disk would be held, the limit is %d", ErrQuotaExceeded, usage.DiskGB, limits.DiskGB)
+	case limits.ActiveBookings > 0 && usage.ActiveBookings > limits.ActiveBookings:
+		err = fmt.Errorf("%w: %d bookings would be active, the limit is %d", ErrQuotaExceeded, usage.ActiveBookings, limits.ActiveBookings)
+	}
+
+	return
+}
+
+// checkDuration refuses bookings running from start to end for longer than allowed. Open-ended bookings are refused
+// whenever a limit is set.
+func (limits QuotaLimits) checkDuration(start, end time.Time) (err error) {
+	if limits.DurationDays <= 0 {
+		return
+	}
+
+	if end.IsZero() {
+		err = fmt.Errorf("%w: bookings must end within %d days", ErrQuotaExceeded, limits.DurationDays)
+	} else if end.Sub(start) > time.Duration(limits.DurationDays)*24*time.Hour {
+		err = fmt.Errorf("%w: bookings may last %d days at most", ErrQuotaExceeded, limits.DurationDays)
+	}
+
+	return
+}
+
+// UserQuota reports the limits, usage and remaining allowance of a user.
+func UserQuota(username string, groups []string) (quota *Quota, err error) {
+	quota = &Quota{Username: username}
+	if quota.Limits, err = EffectiveQuotaLimits(username, groups); err != nil {
+		return
+	}
+
+	if quota.Usage, err = quotaUsage(username); err != nil {
+		return
+	}
+
+	bookingCartLock.Lock()
+	if cart, ok := bookingCarts[username]; ok && cart != nil {
+		quota.Usage.CartHosts = len(cart.Hosts)
+	}
+	bookingCartLock.Unlock()
+
+	remaining := func(limit, used int) int {
+		if limit <= 0 {
+			return -1
+		}
+
+		return max(limit-used, 0)
+	}
+
+	quota.Remaining = QuotaRemaining{
+		Hosts:          remaining(quota.Limits.Hosts, quota.Usage.Hosts+quota.Usage.CartHosts),
+		Cores:          remaining(quota.Limits.Cores, quota.Usage.Cores),
+		MemoryMB:       remaining(quota.Limits.MemoryMB, quota.Usage.MemoryMB),
+		DiskGB:         remaining(quota.Limits.DiskGB, quota.Usage.DiskGB),
+		ActiveBookings: remaining(quota.Limits.ActiveBookings, quota.Usage.ActiveBookings),
+	}
+
+	return
+}
+
+// CheckBookingQuota checks that a user may create another booking running from start to end.
+func CheckBookingQuota(username string, groups []string, start, end time.Time) (err error) {
+	var (
+		limits QuotaLimits
+		usage  QuotaUsage
+	)
+
+	if limits, err = EffectiveQuotaLimits(username, groups); err != nil {
+		return
+	}
+
+	if err = limits.checkDuration(start, end); err != nil || limits.ActiveBookings == 0 {
+		return
+	}
+
+	if usage, err = quotaUsage(username); err != nil {
+		return
+	}
+
+	if usage.ActiveBookings >= limits.ActiveBookings {
+		err = fmt.Errorf("%w: %d bookings are active, the limit is %d", ErrQuotaExceeded, usage.ActiveBookings, limits.ActiveBookings)
+	}
+
+	return
+}
+
+// checkCartQuota checks that the owner may have cartHosts hosts in their cart on top of those they hold. The caller
+// must hold bookingCartLock.
+func checkCartQuota(owner string, groups []string, cartHosts int) (err error) {
+	var (
+		limits QuotaLimits
+		usage  QuotaUsage
+	)
+
+	if limits, err = EffectiveQuotaLimits(owner, groups); err != nil || limits.Hosts == 0 {
+		return
+	}
+
+	if usage, err = quotaUsage(owner); err != nil {
+		return
+	}
+
+	err = limits.check(QuotaUsage{Hosts: usage.Hosts, CartHosts: cartHosts})
+	return
+}
+
+// checkRequestQuota checks a pending request against the quota of whoever made it, the request itself already
+// being part of their usage.
+func checkRequestQuota(request *BookingRequest, booking *Booking) (err error) {
+	var (
+		limits QuotaLimits
+		usage  QuotaUsage
+	)
+
+	if limits, err = EffectiveQuotaLimits(request.RequestedBy, request.RequesterGroups); err != nil {
+		return
+	}
+
+	if err = limits.checkDuration(booking.StartTime, booking.EndTime); err != nil {
+		return
+	}
+
+	if usage, err = quotaUsage(request.RequestedBy); err != nil {
+		return
+	}
+
+	err = limits.check(usage)
+	return
+}
@@ -0,0 +1,587 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/z46-dev/gomysql"
+)
+
+const (
+	BookingActivator = "booking-activator"
+
+	CalendarEntryBooking     = "booking"
+	CalendarEntryReservation = "reservation"
+	CalendarEntryMaintenance = "maintenance"
+)
+
+var (
+	// hostReservationsLock may be taken while holding maintenanceLock, bookingCartLock or a booking's lock, never
+	// the other way around.
+	hostReservationsLock  sync.Mutex
+	bookingActivationLock sync.Mutex
+)
+
+var (
+	ErrHostReserved         = errors.New("host is reserved by another booking")
+	ErrProxmoxCapacity      = errors.New("not enough proxmox capacity")
+	ErrInvalidBookingWindow = errors.New("invalid booking window")
+)
+
+// CalendarEntry is a stretch of time a host is taken by a booking, a reservation or maintenance. A zero end is
+// open-ended.
+type CalendarEntry struct {
+	Kind      string    `json:"kind"`
+	BookingID int       `json:"booking_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// CalendarHost is the occupancy of a single host, soonest first.
+type CalendarHost struct {
+	ManagementIP string          `json:"management_ip"`
+	Entries      []CalendarEntry `json:"entries"`
+}
+
+// ProxmoxUsage is the container and VM capacity claimed by bookings over a window. Zero capacities are unlimited.
+type ProxmoxUsage struct {
+	Cores            int `json:"cores"`
+	MemoryMB         int `json:"memory_mb"`
+	CapacityCores    int `json:"capacity_cores"`
+	CapacityMemoryMB int `json:"capacity_memory_mb"`
+}
+
+// Calendar is the occupancy of the lab between From and To.
+type Calendar struct {
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	Hosts   []*CalendarHost `json:"hosts"`
+	Proxmox ProxmoxUsage    `json:"proxmox"`
+}
+
+// overlapping reports whether [aStart, aEnd) and [bStart, bEnd) intersect. A zero end is open-ended.
+func overlapping(aStart, aEnd, bStart, bEnd time.Time) bool {
+	return (bEnd.IsZero() || aStart.Before(bEnd)) && (aEnd.IsZero() || bStart.Before(aEnd))
+}
+
+// heldUntil is when resources booked until end are given back, after the expiry grace period. Zero is open-ended.
+func heldUntil(end time.Time) time.Time {
+	if end.IsZero() {
+		return end
+	}
+
+	return end.Add(expiryGrace())
+}
+
+func describeSpan(start, end time.Time) string {
+	if end.IsZero() {
+		return start.Format(time.RFC3339) + " until further notice"
+	}
+
+	return start.Format(time.RFC3339) + " to " + end.Format(time.RFC3339)
+}
+
+// ValidateBookingWindow checks a requested booking window. A zero start is now and a zero end is open-ended, a
+// given end must come after both.
+func ValidateBookingWindow(start, end, now time.Time) (err error) {
+	if !start.IsZero() && start.Before(now.Add(-time.Minute)) {
+		err = fmt.Errorf("%w: the start time is in the past", ErrInvalidBookingWindow)
+	} else if !end.IsZero() && (!end.After(now) || !end.After(start)) {
+		err = fmt.Errorf("%w: the end time must come after the start time", ErrInvalidBookingWindow)
+	}
+
+	return
+}
+
+// hostReservationsWhere lists the reservations matching a column, soonest first. The caller must hold
+// hostReservationsLock.
+func hostReservationsWhere(column string, value any) (records []*HostReservation, err error) {
+	if records, err = hostReservations.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(hostReservations.FieldBySQLName(column), gomysql.OpEqual, value)); err != nil {
+		return
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].StartTime.Equal(records[j].StartTime) {
+			return records[i].StartTime.Before(records[j].StartTime)
+		}
+
+		return records[i].ID < records[j].ID
+	})
+
+	return
+}
+
+// HostReservationsForBooking lists the hosts reserved for a booking that has yet to start.
+func HostReservationsForBooking(bookingID int) (records []*HostReservation, err error) {
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	records, err = hostReservationsWhere("booking_id", bookingID)
+	return
+}
+
+// HostReservationsForHost lists the upcoming reservations of a host, soonest first.
+func HostReservationsForHost(managementIP string) (records []*HostReservation, err error) {
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	records, err = hostReservationsWhere("management_ip", managementIP)
+	return
+}
+
+// hostHeldDuring checks that no other booking holds or reserves the host while a booking running from start to end
+// would, grace periods included. Unknown hosts are left for the caller to refuse. The caller must hold
+// hostReservationsLock.
+func hostHeldDuring(managementIP string, start, end time.Time, bookingID int) (err error) {
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	}
+
+	if host != nil && host.IsBooked && host.ActiveBookingID != 0 && host.ActiveBookingID != bookingID {
+		var holder *Booking
+		if holder, err = bookings.Select(host.ActiveBookingID); err != nil {
+			return
+		}
+
+		if holder == nil || overlapping(holder.StartTime, heldUntil(holder.EndTime), start, heldUntil(end)) {
+			err = fmt.Errorf("%w: %s is held by booking %d", ErrHostAlreadyBooked, managementIP, host.ActiveBookingID)
+			return
+		}
+	}
+
+	var reservations []*HostReservation
+	if reservations, err = hostReservationsWhere("management_ip", managementIP); err != nil {
+		return
+	}
+
+	for _, reservation := range reservations {
+		if reservation.BookingID != bookingID && overlapping(reservation.StartTime, heldUntil(reservation.EndTime), start, heldUntil(end)) {
+			err = fmt.Errorf("%w: %s is reserved by booking %d from %s", ErrHostReserved, managementIP, reservation.BookingID, describeSpan(reservation.StartTime, reservation.EndTime))
+			return
+		}
+	}
+
+	return
+}
+
+// HostConflicts checks that the hosts are free for a booking running from start to end: no maintenance scheduled in
+// the window and not held or reserved by another booking. A zero end is open-ended.
+func HostConflicts(managementIPs []string, start, end time.Time, bookingID int) (err error) {
+	if err = MaintenanceConflicts(managementIPs, start, end); err != nil {
+		return
+	}
+
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	for _, managementIP := range managementIPs {
+		if err = hostHeldDuring(managementIP, start, end, bookingID); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ProxmoxUsageDuring is the peak cores and memory held at once during [start, end) by the containers and VMs of
+// bookings, including those of approved requests still waiting for their booking to start. Bookings that don't run
+// at the same time don't add up.
+func ProxmoxUsageDuring(start, end time.Time) (usage ProxmoxUsage, err error) {
+	usage.CapacityCores = config.Config.Proxmox.CapacityCores
+	usage.CapacityMemoryMB = config.Config.Proxmox.CapacityMemoryMB
+
+	type usageChange struct {
+		at              time.Time
+		cores, memoryMB int
+	}
+
+	var (
+		records []*Booking
+		changes []usageChange
+	)
+
+	if records, err = bookings.SelectAll(); err != nil {
+		return
+	}
+
+	for _, booking := range records {
+		if booking.Status == BookingStatusDone || !overlapping(booking.StartTime, heldUntil(booking.EndTime), start, end) {
+			continue
+		}
+
+		var (
+			containers []*BookingContainer
+			machines   []*BookingVM
+			requests   []*BookingRequest
+		)
+
+		if containers, err = BookingContainersForBooking(booking.ID); err != nil {
+			return
+		}
+
+		if machines, err = BookingVMsForBooking(booking.ID); err != nil {
+			return
+		}
+
+		if requests, err = BookingRequestsForBooking(booking.ID); err != nil {
+			return
+		}
+
+		var held usageChange = usageChange{at: booking.StartTime}
+		for _, ct := range containers {
+			held.cores += ct.Cores
+			held.memoryMB += ct.MemoryMB
+		}
+
+		for _, machine := range machines {
+			held.cores += machine.Cores
+			held.memoryMB += machine.MemoryMB
+		}
+
+		for _, request := range requests {
+			if request.Status != BookingRequestStatusApproved || !request.FulfilledAt.IsZero() {
+				continue
+			}
+
+			cores, memoryMB := requestedProxmoxResources(request.Containers, request.VMs)
+			held.cores += cores
+			held.memoryMB += memoryMB
+		}
+
+		if held.cores == 0 && held.memoryMB == 0 {
+			continue
+		}
+
+		changes = append(changes, held)
+		if until := heldUntil(booking.EndTime); !until.IsZero() {
+			changes = append(changes, usageChange{at: until, cores: -held.cores, memoryMB: -held.memoryMB})
+		}
+	}
+
+	// Every booking overlaps the window, so the peak of the sweep is reached inside it. Releases go first when they
+	// line up with a start, the spans are half-open.
+	sort.SliceStable(changes, func(i, j int) bool {
+		if !changes[i].at.Equal(changes[j].at) {
+			return changes[i].at.Before(changes[j].at)
+		}
+
+		return changes[i].cores+changes[i].memoryMB < changes[j].cores+changes[j].memoryMB
+	})
+
+	var cores, memoryMB int
+	for _, change := range changes {
+		cores += change.cores
+		memoryMB += change.memoryMB
+		usage.Cores = max(usage.Cores, cores)
+		usage.MemoryMB = max(usage.MemoryMB, memoryMB)
+	}
+
+	return
+}
+
+func requestedProxmoxResources(containers []BookingRequestCT, vms []BookingRequestVM) (cores, memoryMB int) {
+	for _, ct := range containers {
+		cores += ct.Cores
+		memoryMB += ct.MemoryMB
+	}
+
+	for _, machine := range vms {
+		cores += machine.Cores
+		memoryMB += machine.MemoryMB
+	}
+
+	return
+}
+
+// ProxmoxCapacityConflicts checks that the containers and VMs fit in the capacity left for a booking running from
+// start to end.
+func ProxmoxCapacityConflicts(start, end time.Time, containers []BookingRequestCT, vms []BookingRequestVM) (err error) {
+	var cores, memoryMB = requestedProxmoxResources(containers, vms)
+	if cores == 0 && memoryMB == 0 || config.Config.Proxmox.CapacityCores <= 0 && config.Config.Proxmox.CapacityMemoryMB <= 0 {
+		return
+	}
+
+	var usage ProxmoxUsage
+	if usage, err = ProxmoxUsageDuring(start, heldUntil(end)); err != nil {
+		return
+	}
+
+	if usage.CapacityCores > 0 && usage.Cores+cores > usage.CapacityCores {
+		err = fmt.Errorf("%w: %d of %d cores are taken from %s, %d more were asked for", ErrProxmoxCapacity, usage.Cores, usage.CapacityCores, describeSpan(start, end), cores)
+	} else if usage.CapacityMemoryMB > 0 && usage.MemoryMB+memoryMB > usage.CapacityMemoryMB {
+		err = fmt.Errorf("%w: %d of %d MB of memory are taken from %s, %d MB more were asked for", ErrProxmoxCapacity, usage.MemoryMB, usage.CapacityMemoryMB, describeSpan(start, end), memoryMB)
+	}
+
+	return
+}
+
+// reserveRequestHosts reserves the hosts of an approved request until its scheduled booking starts. Either every
+// host is reserved or none is. The caller must hold the booking's lock.
+func reserveRequestHosts(request *BookingRequest, booking *Booking) (err error) {
+	var managementIPs []string
+	for _, host := range request.Hosts {
+		managementIPs = append(managementIPs, host.ManagementIP)
+	}
+
+	if err = MaintenanceConflicts(managementIPs, booking.StartTime, booking.EndTime); err != nil {
+		return
+	}
+
+	if err = ProxmoxCapacityConflicts(booking.StartTime, booking.EndTime, request.Containers, request.VMs); err != nil {
+		return
+	}
+
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	for _, managementIP := range managementIPs {
+		if err = hostHeldDuring(managementIP, booking.StartTime, booking.EndTime, booking.ID); err != nil {
+			return
+		}
+	}
+
+	var now time.Time = time.Now()
+	for _, managementIP := range managementIPs {
+		if err = hostReservations.Insert(&HostReservation{
+			ManagementIP: managementIP,
+			BookingID:    booking.ID,
+			RequestID:    request.ID,
+			StartTime:    booking.StartTime,
+			EndTime:      booking.EndTime,
+			CreatedAt:    now,
+		}); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// releaseHostReservations drops the reservations of a booking, only the one of managementIP when it is set.
+func releaseHostReservations(bookingID int, managementIP string) (err error) {
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	var reservations []*HostReservation
+	if reservations, err = hostReservationsWhere("booking_id", bookingID); err != nil {
+		return
+	}
+
+	for _, reservation := range reservations {
+		if managementIP != "" && reservation.ManagementIP != managementIP {
+			continue
+		}
+
+		if err = hostReservations.Delete(reservation.ID); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// deleteHostReservations forgets the reservations of a host, used when the host is removed. The bookings that
+// held them are returned.
+func deleteHostReservations(managementIP string) (bookingIDs []int, err error) {
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	var reservations []*HostReservation
+	if reservations, err = hostReservationsWhere("management_ip", managementIP); err != nil {
+		return
+	}
+
+	for _, reservation := range reservations {
+		if err = hostReservations.Delete(reservation.ID); err != nil {
+			return
+		}
+
+		bookingIDs = appendUniqueInt(bookingIDs, reservation.BookingID)
+	}
+
+	return
+}
+
+// extendHostReservations moves the end of a booking's reservations along with its end time.
+func extendHostReservations(bookingID int, end time.Time) (err error) {
+	hostReservationsLock.Lock()
+	defer hostReservationsLock.Unlock()
+
+	var reservations []*HostReservation
+	if reservations, err = hostReservationsWhere("booking_id", bookingID); err != nil {
+		return
+	}
+
+	for _, reservation := range reservations {
+		reservation.EndTime = end
+		if err = hostReservations.Update(reservation); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ActivateScheduledBookings starts the scheduled bookings whose start time has come and queues the provisioning of
+// their approved requests. The queued jobs are returned.
+func ActivateScheduledBookings(now time.Time) (queued []*Job, err error) {
+	bookingActivationLock.Lock()
+	defer bookingActivationLock.Unlock()
+
+	var records []*Booking
+	if records, err = bookings.SelectAll(); err != nil {
+		return
+	}
+
+	for _, booking := range records {
+		if booking.Status != BookingStatusScheduled || booking.StartTime.After(now) {
+			continue
+		}
+
+		jobs, err := activateBooking(booking.ID)
+		if err != nil {
+			log.Errorf("failed to start booking %d: %v", booking.ID, err)
+		}
+
+		queued = append(queued, jobs...)
+	}
+
+	return
+}
+
+// activateBooking moves a scheduled booking to active and queues a fulfillment job for each approved request.
+func activateBooking(bookingID int) (queued []*Job, err error) {
+	var (
+		requests []*BookingRequest
+		started  bool
+	)
+
+	if requests, err = BookingRequestsForBooking(bookingID); err != nil {
+		return
+	}
+
+	if err = withBookingLock(bookingID, func() error {
+		booking, err := bookings.Select(bookingID)
+		if err != nil || booking == nil || booking.Status != BookingStatusScheduled {
+			return err
+		}
+
+		booking.Status = BookingStatusActive
+		if slices.ContainsFunc(requests, func(request *BookingRequest) bool { return request.Status == BookingRequestStatusPending }) {
+			booking.Status = BookingStatusActiveWithRequestPending
+		}
+
+		started = true
+		return bookings.Update(booking)
+	}); err != nil || !started {
+		return
+	}
+
+	notifyBooking(bookingID, BookingNoticeStarted, "", "This booking has started, its reserved hosts, containers and VMs are being provisioned")
+
+	for _, request := range requests {
+		if request.Status != BookingRequestStatusApproved || request.JobID != 0 || !request.FulfilledAt.IsZero() {
+			continue
+		}
+
+		var job *Job
+		if _, job, err = enqueueBookingFulfillment(request.ID, request.BookingID, BookingActivator); err != nil {
+			return
+		}
+
+		queued = append(queued, job)
+	}
+
+	return
+}
+
+// BookingCalendar lists what takes each host between from and to, and the Proxmox capacity claimed over the range.
+func BookingCalendar(from, to time.Time) (calendar *Calendar, err error) {
+	calendar = &Calendar{From: from, To: to}
+
+	var (
+		hosts        []*Host
+		records      []*Booking
+		reservations []*HostReservation
+		windows      []*MaintenanceWindow
+		byIP         = map[string]*CalendarHost{}
+		byID         = map[int]*Booking{}
+	)
+
+	if hosts, err = Hosts.SelectAll(); err != nil {
+		return
+	}
+
+	if records, err = bookings.SelectAll(); err != nil {
+		return
+	}
+
+	for _, booking := range records {
+		byID[booking.ID] = booking
+	}
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].ManagementIP < hosts[j].ManagementIP })
+	for _, host := range hosts {
+		var entry *CalendarHost = &CalendarHost{ManagementIP: host.ManagementIP, Entries: []CalendarEntry{}}
+		calendar.Hosts = append(calendar.Hosts, entry)
+		byIP[host.ManagementIP] = entry
+
+		if !host.IsBooked || host.ActiveBookingID == 0 {
+			continue
+		}
+
+		if booking := byID[host.ActiveBookingID]; booking != nil && overlapping(booking.StartTime, heldUntil(booking.EndTime), from, to) {
+			entry.Entries = append(entry.Entries, CalendarEntry{Kind: CalendarEntryBooking, BookingID: booking.ID, Reason: booking.Name, StartTime: booking.StartTime, EndTime: booking.EndTime})
+		}
+	}
+
+	hostReservationsLock.Lock()
+	reservations, err = hostReservations.SelectAll()
+	hostReservationsLock.Unlock()
+	if err != nil {
+		return
+	}
+
+	for _, reservation := range reservations {
+		if entry := byIP[reservation.ManagementIP]; entry != nil && overlapping(reservation.StartTime, heldUntil(reservation.EndTime), from, to) {
+			var name string
+			if booking := byID[reservation.BookingID]; booking != nil {
+				name = booking.Name
+			}
+
+			entry.Entries = append(entry.Entries, CalendarEntry{Kind: CalendarEntryReservation, BookingID: reservation.BookingID, Reason: name, StartTime: reservation.StartTime, EndTime: reservation.EndTime})
+		}
+	}
+
+	maintenanceLock.Lock()
+	windows, err = maintenanceWindowsFor("")
+	maintenanceLock.Unlock()
+	if err != nil {
+		return
+	}
+
+	for _, window := range windows {
+		if entry := byIP[window.ManagementIP]; entry != nil && window.overlaps(from, to) {
+			entry.Entries = append(entry.Entries, CalendarEntry{Kind: CalendarEntryMaintenance, Reason: window.Reason, StartTime: window.StartTime, EndTime: window.EndTime})
+		}
+	}
+
+	for _, entry := range calendar.Hosts {
+		sort.SliceStable(entry.Entries, func(i, j int) bool { return entry.Entries[i].StartTime.Before(entry.Entries[j].StartTime) })
+	}
+
+	if calendar.Hosts == nil {
+		calendar.Hosts = make([]*CalendarHost, 0)
+	}
+
+	calendar.Proxmox, err = ProxmoxUsageDuring(from, to)
+	return
+}
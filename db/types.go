@@ -23,6 +23,14 @@ type (
 	BookingPermissionLevel int
 	BookingStatus          int
 	BookingRequestStatus   int
+	JobKind                int
+	JobStatus              int
+	FirmwareCategory       int
+	FirmwareUpdateMethod   int
+	BookingNoticeKind      int
+	WipeMethod             string
+	WipeStatus             int
+	QuotaScope             string
 
 	HostCPUSpecs struct {
 		Manufacturer string `json:"manufacturer"`
@@ -45,10 +53,48 @@ type (
 		MediaType  string `json:"media_type"`
 	}
 
+	HostDriveSpecs struct {
+		Name             string `json:"name"`
+		Model            string `json:"model"`
+		SerialNumber     string `json:"serial_number"`
+		MediaType        string `json:"media_type"` // SSD, HDD or SMR
+		Protocol         string `json:"protocol"`   // SATA, SAS, NVMe...
+		CapacityGB       int    `json:"capacity_gb"`
+		FailurePredicted bool   `json:"failure_predicted"`
+	}
+
+	HostNICSpecs struct {
+		Name       string `json:"name"`
+		MACAddress string `json:"mac_address"`
+		SpeedMbps  int    `json:"speed_mbps"`
+		LinkStatus string `json:"link_status"`
+		Management bool   `json:"management"` // The BMC's own port, it can't be used for provisioning
+	}
+
 	HostSpecs struct {
 		Processor HostCPUSpecs       `json:"processor"`
 		Memory    HostMemorySpecs    `json:"memory"`
 		Storage   []HostStorageSpecs `json:"storage"`
+		Drives    []HostDriveSpecs   `json:"drives"`
+		NICs      []HostNICSpecs     `json:"nics"`
+	}
+
+	HostLocation struct {
+		Site    string `json:"site"`
+		Rack    string `json:"rack"`
+		Unit    int    `json:"unit"` // Lowest rack unit the host occupies, 0 when unknown
+		PDU     string `json:"pdu"`
+		PDUPort string `json:"pdu_port"`
+	}
+
+	// HostMaintenance mirrors the maintenance window currently in effect on a host.
+	HostMaintenance struct {
+		Active    bool      `json:"active"`
+		WindowID  int       `json:"window_id"`
+		Reason    string    `json:"reason"`
+		StartTime time.Time `json:"start_time"`
+		EndTime   time.Time `json:"end_time"` // Zero until an admin ends the maintenance
+		SetBy     string    `json:"set_by"`
 	}
 
 	HostManagementClient struct {
@@ -63,6 +109,10 @@ type (
 
 		// IPMI stuff
 		ipmiClient *ipmi.Client
+
+		// Set for clients handed out by the management pool
+		pool   *managementPoolEntry
+		failed bool
 	}
 
 	Host struct {
@@ -76,6 +126,20 @@ type (
 		Specs                   HostSpecs             `gomysql:"specs" json:"specs"`
 		IsBooked                bool                  `gomysql:"is_booked" json:"is_booked"`
 		ActiveBookingID         int                   `gomysql:"active_booking_id" json:"active_booking_id"`
+		IdleSince               time.Time             `gomysql:"idle_since" json:"idle_since"`
+		EventSubscriptionURI    string                `gomysql:"event_subscription_uri" json:"event_subscription_uri"`
+		EventContext            string                `gomysql:"event_context" json:"-"`
+		LastEventTime           time.Time             `gomysql:"last_event_time" json:"last_event_time"`
+		BMCReachable            bool                  `gomysql:"bmc_reachable" json:"bmc_reachable"`
+		BMCLastError            string                `gomysql:"bmc_last_error" json:"bmc_last_error"`
+		BMCCheckedAt            time.Time             `gomysql:"bmc_checked_at" json:"bmc_checked_at"`
+		FirmwareUpdating        bool                  `gomysql:"firmware_updating" json:"firmware_updating"`
+		FirmwareCollectedAt     time.Time             `gomysql:"firmware_collected_at" json:"firmware_collected_at"`
+		ProvisioningMAC         string                `gomysql:"provisioning_mac" json:"provisioning_mac"`
+		Tags                    []string              `gomysql:"tags" json:"tags"`
+		Location                HostLocation          `gomysql:"location" json:"location"`
+		Maintenance             HostMaintenance       `gomysql:"maintenance" json:"maintenance"`
+		Wiping                  bool                  `gomysql:"wiping" json:"wiping"`
 		Management              *HostManagementClient `json:"-"`
 	}
 
@@ -125,12 +189,15 @@ type (
 		ISOSelection string `json:"iso_selection"`
 	}
 
+	// BookingRequestCT is a container asked for by a booking. SSHPublicKey is installed for root, the only way to
+	// log into it.
 	BookingRequestCT struct {
-		Name     string `json:"name"`
-		Template string `json:"template"`
-		Cores    int    `json:"cores"`
-		MemoryMB int    `json:"memory_mb"`
-		DiskGB   int    `json:"disk_gb"`
+		Name         string `json:"name"`
+		Template     string `json:"template"`
+		Cores        int    `json:"cores"`
+		MemoryMB     int    `json:"memory_mb"`
+		DiskGB       int    `json:"disk_gb"`
+		SSHPublicKey string `json:"ssh_public_key"`
 	}
 
 	BookingRequestVM struct {
@@ -146,6 +213,7 @@ type (
 		BookingID       int                  `gomysql:"booking_id" json:"booking_id"`
 		RequestedAt     time.Time            `gomysql:"requested_at" json:"requested_at"`
 		RequestedBy     string               `gomysql:"requested_by" json:"requested_by"`
+		RequesterGroups []string             `gomysql:"requester_groups" json:"requester_groups"` // Kept to apply the requester's quota on approval
 		Justification   string               `gomysql:"justification" json:"justification"`
 		Reviewer        string               `gomysql:"reviewer" json:"reviewer"`
 		ReviewerComment string               `gomysql:"reviewer_comment" json:"reviewer_comment"`
@@ -153,6 +221,99 @@ type (
 		Hosts           []BookingRequestHost `gomysql:"hosts" json:"hosts"`
 		Containers      []BookingRequestCT   `gomysql:"containers" json:"containers"`
 		VMs             []BookingRequestVM   `gomysql:"vms" json:"vms"`
+		ReviewedAt      time.Time            `gomysql:"reviewed_at" json:"reviewed_at"`
+		JobID           int                  `gomysql:"job_id" json:"job_id"`
+		Fulfillment     []FulfillmentOutcome `gomysql:"fulfillment" json:"fulfillment"`
+		FulfilledAt     time.Time            `gomysql:"fulfilled_at" json:"fulfilled_at"`
+	}
+
+	// FulfillmentOutcome is the result of provisioning one resource of an approved booking request. ProxmoxID is
+	// set for the containers and VMs that were created.
+	FulfillmentOutcome struct {
+		ResourceType string `json:"resource_type"`
+		Resource     string `json:"resource"`
+		ProxmoxID    int    `json:"proxmox_id,omitempty"`
+		Success      bool   `json:"success"`
+		Error        string `json:"error,omitempty"`
+	}
+
+	// BookingTeardownStep is one step of releasing the resources of an expired booking.
+	BookingTeardownStep struct {
+		ResourceType string    `json:"resource_type"`
+		Resource     string    `json:"resource"`
+		Action       string    `json:"action"`
+		Success      bool      `json:"success"`
+		Error        string    `json:"error,omitempty"`
+		At           time.Time `json:"at"`
+	}
+
+	// BookingExtension asks to move the end time of a booking. Extensions within the configured limits are approved
+	// as they are requested, the others wait for review with the limits they break. Approved extensions make up the
+	// history of the booking's end time.
+	BookingExtension struct {
+		ID              int                  `gomysql:"id,primary,increment" json:"id"`
+		BookingID       int                  `gomysql:"booking_id" json:"booking_id"`
+		RequestedBy     string               `gomysql:"requested_by" json:"requested_by"`
+		RequestedAt     time.Time            `gomysql:"requested_at" json:"requested_at"`
+		Days            int                  `gomysql:"days" json:"days"`
+		Justification   string               `gomysql:"justification" json:"justification"`
+		Status          BookingRequestStatus `gomysql:"status" json:"status"`
+		AutoApproved    bool                 `gomysql:"auto_approved" json:"auto_approved"`
+		ReviewReasons   []string             `gomysql:"review_reasons" json:"review_reasons"`
+		Reviewer        string               `gomysql:"reviewer" json:"reviewer"`
+		ReviewerComment string               `gomysql:"reviewer_comment" json:"reviewer_comment"`
+		ReviewedAt      time.Time            `gomysql:"reviewed_at" json:"reviewed_at"`
+		PreviousEndTime time.Time            `gomysql:"previous_end_time" json:"previous_end_time"`
+		NewEndTime      time.Time            `gomysql:"new_end_time" json:"new_end_time"`
+	}
+
+	// HostReservation holds a host for a booking that has yet to start. The host is assigned to the booking, and the
+	// reservation dropped, when the booking starts.
+	HostReservation struct {
+		ID           int       `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP string    `gomysql:"management_ip" json:"management_ip"`
+		BookingID    int       `gomysql:"booking_id" json:"booking_id"`
+		RequestID    int       `gomysql:"request_id" json:"request_id"`
+		StartTime    time.Time `gomysql:"start_time" json:"start_time"`
+		EndTime      time.Time `gomysql:"end_time" json:"end_time"`
+		CreatedAt    time.Time `gomysql:"created_at" json:"created_at"`
+	}
+
+	// BookingCartRecord persists a user's cart, its hosts are BookingCartHost records. A cart left untouched past
+	// ExpiresAt is released by the sweeper, a zero ExpiresAt never expires.
+	BookingCartRecord struct {
+		Owner     string    `gomysql:"owner,primary,unique" json:"owner"`
+		StartTime time.Time `gomysql:"start_time" json:"start_time"`
+		EndTime   time.Time `gomysql:"end_time" json:"end_time"`
+		UpdatedAt time.Time `gomysql:"updated_at" json:"updated_at"`
+		ExpiresAt time.Time `gomysql:"expires_at" json:"expires_at"`
+
+		Containers []BookingRequestCT `gomysql:"containers" json:"containers"`
+		VMs        []BookingRequestVM `gomysql:"vms" json:"vms"`
+	}
+
+	// BookingCartHost holds a host in a user's cart, a host is only ever in one cart.
+	BookingCartHost struct {
+		ManagementIP string    `gomysql:"management_ip,primary,unique" json:"management_ip"`
+		Owner        string    `gomysql:"owner" json:"owner"`
+		ISOSelection string    `gomysql:"iso_selection" json:"iso_selection"`
+		AddedAt      time.Time `gomysql:"added_at" json:"added_at"`
+	}
+
+	// QuotaPolicy caps what a user, or each member of a group, may hold across the bookings they own and the
+	// requests they made. Zero limits are unlimited.
+	QuotaPolicy struct {
+		ID                int        `gomysql:"id,primary,increment" json:"id"`
+		Scope             QuotaScope `gomysql:"scope" json:"scope"`
+		Subject           string     `gomysql:"subject" json:"subject"`
+		MaxHosts          int        `gomysql:"max_hosts" json:"max_hosts"`
+		MaxCores          int        `gomysql:"max_cores" json:"max_cores"`
+		MaxMemoryMB       int        `gomysql:"max_memory_mb" json:"max_memory_mb"`
+		MaxDiskGB         int        `gomysql:"max_disk_gb" json:"max_disk_gb"`
+		MaxDurationDays   int        `gomysql:"max_duration_days" json:"max_duration_days"`
+		MaxActiveBookings int        `gomysql:"max_active_bookings" json:"max_active_bookings"`
+		UpdatedBy         string     `gomysql:"updated_by" json:"updated_by"`
+		UpdatedAt         time.Time  `gomysql:"updated_at" json:"updated_at"`
 	}
 
 	Booking struct {
@@ -169,6 +330,158 @@ type (
 		OwnedBookingCTIDs      []int         `gomysql:"owned_booking_ctids" json:"owned_booking_ctids"`
 		OwnedBookingVMIDs      []int         `gomysql:"owned_booking_vmids" json:"owned_booking_vmids"`
 		Requests               []int         `gomysql:"requests" json:"requests"`
+
+		// Expiry tracks the warnings sent before EndTime and the teardown once the grace period is over
+		ExpiryWarningsSent []int                 `gomysql:"expiry_warnings_sent" json:"expiry_warnings_sent"`
+		ExpiredAt          time.Time             `gomysql:"expired_at" json:"expired_at"`
+		TeardownJobID      int                   `gomysql:"teardown_job_id" json:"teardown_job_id"`
+		Teardown           []BookingTeardownStep `gomysql:"teardown" json:"teardown"`
+		TornDownAt         time.Time             `gomysql:"torn_down_at" json:"torn_down_at"`
+	}
+
+	Job struct {
+		ID         int             `gomysql:"id,primary,increment" json:"id"`
+		Kind       JobKind         `gomysql:"kind" json:"kind"`
+		Target     string          `gomysql:"target" json:"target"`
+		Status     JobStatus       `gomysql:"status" json:"status"`
+		Progress   int             `gomysql:"progress" json:"progress"`
+		Message    string          `gomysql:"message" json:"message"`
+		Result     json.RawMessage `gomysql:"result" json:"result,omitempty"`
+		CreatedBy  string          `gomysql:"created_by" json:"created_by"`
+		CreatedAt  time.Time       `gomysql:"created_at" json:"created_at"`
+		StartedAt  time.Time       `gomysql:"started_at" json:"started_at"`
+		FinishedAt time.Time       `gomysql:"finished_at" json:"finished_at"`
+	}
+
+	PowerSchedule struct {
+		ID               int         `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP     string      `gomysql:"management_ip" json:"management_ip"`
+		Cron             string      `gomysql:"cron" json:"cron"`
+		Action           PowerAction `gomysql:"action" json:"action"`
+		Enabled          bool        `gomysql:"enabled" json:"enabled"`
+		AllowWhileBooked bool        `gomysql:"allow_while_booked" json:"allow_while_booked"`
+		CreatedBy        string      `gomysql:"created_by" json:"created_by"`
+		LastRunAt        time.Time   `gomysql:"last_run_at" json:"last_run_at"`
+	}
+
+	HostEvent struct {
+		ID                int       `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP      string    `gomysql:"management_ip" json:"management_ip"`
+		ReceivedAt        time.Time `gomysql:"received_at" json:"received_at"`
+		EventID           string    `gomysql:"event_id" json:"event_id"`
+		EventType         string    `gomysql:"event_type" json:"event_type"`
+		MessageID         string    `gomysql:"message_id" json:"message_id"`
+		Message           string    `gomysql:"message" json:"message"`
+		Severity          string    `gomysql:"severity" json:"severity"`
+		OriginOfCondition string    `gomysql:"origin_of_condition" json:"origin_of_condition"`
+	}
+
+	HostFirmware struct {
+		ID           int              `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP string           `gomysql:"management_ip" json:"management_ip"`
+		InventoryID  string           `gomysql:"inventory_id" json:"inventory_id"`
+		Name         string           `gomysql:"name" json:"name"`
+		Category     FirmwareCategory `gomysql:"category" json:"category"`
+		Version      string           `gomysql:"version" json:"version"`
+		Manufacturer string           `gomysql:"manufacturer" json:"manufacturer"`
+		ReleaseDate  string           `gomysql:"release_date" json:"release_date"`
+		Updateable   bool             `gomysql:"updateable" json:"updateable"`
+		CollectedAt  time.Time        `gomysql:"collected_at" json:"collected_at"`
+	}
+
+	// TagRestriction limits booking hosts carrying Tag to members of AllowedGroups. No groups means nobody.
+	TagRestriction struct {
+		Tag           string    `gomysql:"tag,primary,unique" json:"tag"`
+		AllowedGroups []string  `gomysql:"allowed_groups" json:"allowed_groups"`
+		UpdatedBy     string    `gomysql:"updated_by" json:"updated_by"`
+		UpdatedAt     time.Time `gomysql:"updated_at" json:"updated_at"`
+	}
+
+	// HostWipeDrive is a drive to be wiped and, once the wipe image reports back, how it went.
+	HostWipeDrive struct {
+		Name         string     `json:"name"`
+		Model        string     `json:"model"`
+		SerialNumber string     `json:"serial_number"`
+		CapacityGB   int        `json:"capacity_gb"`
+		Method       WipeMethod `json:"method"`
+		Wiped        bool       `json:"wiped"`
+		Message      string     `json:"message"`
+	}
+
+	// HostWipe is one run of the release pipeline on a host. Completed wipes carry a certificate, the SHA-256 of
+	// the verified record. BootSource is the address that fetched the boot script, only it may fetch the plan and
+	// report.
+	HostWipe struct {
+		ID           int             `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP string          `gomysql:"management_ip" json:"management_ip"`
+		BookingID    int             `gomysql:"booking_id" json:"booking_id"`
+		Status       WipeStatus      `gomysql:"status" json:"status"`
+		Token        string          `gomysql:"token,unique" json:"-"`
+		BootSource   string          `gomysql:"boot_source" json:"boot_source"`
+		Drives       []HostWipeDrive `gomysql:"drives" json:"drives"`
+		BIOSReverted bool            `gomysql:"bios_reverted" json:"bios_reverted"`
+		Message      string          `gomysql:"message" json:"message"`
+		Certificate  string          `gomysql:"certificate" json:"certificate"`
+		RequestedBy  string          `gomysql:"requested_by" json:"requested_by"`
+		JobID        int             `gomysql:"job_id" json:"job_id"`
+		StartedAt    time.Time       `gomysql:"started_at" json:"started_at"`
+		FinishedAt   time.Time       `gomysql:"finished_at" json:"finished_at"`
+	}
+
+	// BIOSProfile is the BIOS configuration a host is reverted to after a wipe.
+	BIOSProfile struct {
+		ManagementIP string          `gomysql:"management_ip,primary,unique" json:"management_ip"`
+		Attributes   json.RawMessage `gomysql:"attributes" json:"attributes"`
+		CapturedBy   string          `gomysql:"captured_by" json:"captured_by"`
+		CapturedAt   time.Time       `gomysql:"captured_at" json:"captured_at"`
+	}
+
+	// ArchivedHost keeps the record of a removed host and what its removal released. Record is the host as it was
+	// when it was removed.
+	ArchivedHost struct {
+		ID                int             `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP      string          `gomysql:"management_ip" json:"management_ip"`
+		Record            json.RawMessage `gomysql:"record" json:"record"`
+		ReleasedBookingID int             `gomysql:"released_booking_id" json:"released_booking_id"`
+		CartOwner         string          `gomysql:"cart_owner" json:"cart_owner"`
+		RequestIDs        []int           `gomysql:"request_ids" json:"request_ids"`
+		ArchivedBy        string          `gomysql:"archived_by" json:"archived_by"`
+		ArchivedAt        time.Time       `gomysql:"archived_at" json:"archived_at"`
+	}
+
+	// MaintenanceWindow takes a host out of service from StartTime until EndTime, or until ended when EndTime is zero.
+	MaintenanceWindow struct {
+		ID           int       `gomysql:"id,primary,increment" json:"id"`
+		ManagementIP string    `gomysql:"management_ip" json:"management_ip"`
+		Reason       string    `gomysql:"reason" json:"reason"`
+		StartTime    time.Time `gomysql:"start_time" json:"start_time"`
+		EndTime      time.Time `gomysql:"end_time" json:"end_time"`
+		CreatedBy    string    `gomysql:"created_by" json:"created_by"`
+		CreatedAt    time.Time `gomysql:"created_at" json:"created_at"`
+	}
+
+	BookingNotice struct {
+		ID           int               `gomysql:"id,primary,increment" json:"id"`
+		BookingID    int               `gomysql:"booking_id" json:"booking_id"`
+		Kind         BookingNoticeKind `gomysql:"kind" json:"kind"`
+		ManagementIP string            `gomysql:"management_ip" json:"management_ip"`
+		Message      string            `gomysql:"message" json:"message"`
+		CreatedAt    time.Time         `gomysql:"created_at" json:"created_at"`
+	}
+
+	FirmwarePackage struct {
+		ID            int              `gomysql:"id,primary,increment" json:"id"`
+		Name          string           `gomysql:"name" json:"name"`
+		Category      FirmwareCategory `gomysql:"category" json:"category"`
+		Version       string           `gomysql:"version" json:"version"`
+		Models        []string         `gomysql:"models" json:"models"`
+		FileName      string           `gomysql:"file_name" json:"file_name"`
+		FilePath      string           `gomysql:"file_path" json:"-"`
+		Size          int64            `gomysql:"size" json:"size"`
+		SHA256        string           `gomysql:"sha256" json:"sha256"`
+		DownloadToken string           `gomysql:"download_token,unique" json:"-"`
+		UploadedBy    string           `gomysql:"uploaded_by" json:"uploaded_by"`
+		UploadedAt    time.Time        `gomysql:"uploaded_at" json:"uploaded_at"`
 	}
 )
 
@@ -252,6 +565,7 @@ const (
 	BookingStatusActiveWithRequestPending BookingStatus = iota
 	BookingStatusActive
 	BookingStatusDone
+	BookingStatusScheduled
 )
 
 const (
@@ -260,6 +574,72 @@ const (
 	BookingRequestStatusRejected
 )
 
+const (
+	JobKindHostPower JobKind = iota
+	JobKindBulkPower
+	JobKindFirmwareUpdate
+	JobKindHostWipe
+	JobKindBookingFulfillment
+	JobKindBookingTeardown
+)
+
+const (
+	JobStatusQueued JobStatus = iota
+	JobStatusRunning
+	JobStatusSucceeded
+	JobStatusFailed
+)
+
+const (
+	FirmwareCategoryOther FirmwareCategory = iota
+	FirmwareCategoryBIOS
+	FirmwareCategoryBMC
+	FirmwareCategoryNIC
+	FirmwareCategoryStorage
+	FirmwareCategoryPSU
+)
+
+const (
+	FirmwareUpdateMethodSimpleUpdate FirmwareUpdateMethod = iota
+	FirmwareUpdateMethodMultipartPush
+)
+
+const (
+	WipeMethodNVMeFormat WipeMethod = "nvme-format"
+	WipeMethodDiscard    WipeMethod = "blkdiscard"
+	WipeMethodOverwrite  WipeMethod = "dd"
+)
+
+const (
+	QuotaScopeUser  QuotaScope = "user"
+	QuotaScopeGroup QuotaScope = "group"
+)
+
+const (
+	WipeStatusBooting WipeStatus = iota
+	WipeStatusWiping
+	WipeStatusWiped
+	WipeStatusCompleted
+	WipeStatusFailed
+)
+
+const (
+	BookingNoticeMaintenanceScheduled BookingNoticeKind = iota
+	BookingNoticeMaintenanceStarted
+	BookingNoticeMaintenanceEnded
+	BookingNoticeMaintenanceCancelled
+	BookingNoticeHostRemoved
+	BookingNoticeRequestApproved
+	BookingNoticeRequestRejected
+	BookingNoticeRequestFulfilled
+	BookingNoticeExpiryWarning
+	BookingNoticeExpired
+	BookingNoticeTornDown
+	BookingNoticeExtended
+	BookingNoticeExtensionRejected
+	BookingNoticeStarted
+)
+
 var (
 	VendorNames = map[VendorID]string{
 		VendorOther:      "Other",
@@ -361,6 +741,7 @@ var (
 		BookingStatusActiveWithRequestPending: "Active (Request Pending)",
 		BookingStatusActive:                   "Active",
 		BookingStatusDone:                     "Done",
+		BookingStatusScheduled:                "Scheduled",
 	}
 
 	BookingStatusNameReverses = map[string]BookingStatus{}
@@ -372,6 +753,88 @@ var (
 	}
 
 	BookingRequestStatusNameReverses = map[string]BookingRequestStatus{}
+
+	JobKindNames = map[JobKind]string{
+		JobKindHostPower:          "Host Power",
+		JobKindBulkPower:          "Bulk Power",
+		JobKindFirmwareUpdate:     "Firmware Update",
+		JobKindHostWipe:           "Host Wipe",
+		JobKindBookingFulfillment: "Booking Fulfillment",
+		JobKindBookingTeardown:    "Booking Teardown",
+	}
+
+	JobKindNameReverses = map[string]JobKind{}
+
+	JobStatusNames = map[JobStatus]string{
+		JobStatusQueued:    "Queued",
+		JobStatusRunning:   "Running",
+		JobStatusSucceeded: "Succeeded",
+		JobStatusFailed:    "Failed",
+	}
+
+	JobStatusNameReverses = map[string]JobStatus{}
+
+	FirmwareCategoryNames = map[FirmwareCategory]string{
+		FirmwareCategoryOther:   "Other",
+		FirmwareCategoryBIOS:    "BIOS",
+		FirmwareCategoryBMC:     "BMC",
+		FirmwareCategoryNIC:     "NIC",
+		FirmwareCategoryStorage: "Storage",
+		FirmwareCategoryPSU:     "PSU",
+	}
+
+	FirmwareCategoryNameReverses = map[string]FirmwareCategory{}
+
+	FirmwareUpdateMethodNames = map[FirmwareUpdateMethod]string{
+		FirmwareUpdateMethodSimpleUpdate:  "Simple Update",
+		FirmwareUpdateMethodMultipartPush: "Multipart Push",
+	}
+
+	FirmwareUpdateMethodNameReverses = map[string]FirmwareUpdateMethod{}
+
+	BookingNoticeKindNames = map[BookingNoticeKind]string{
+		BookingNoticeMaintenanceScheduled: "Maintenance Scheduled",
+		BookingNoticeMaintenanceStarted:   "Maintenance Started",
+		BookingNoticeMaintenanceEnded:     "Maintenance Ended",
+		BookingNoticeMaintenanceCancelled: "Maintenance Cancelled",
+		BookingNoticeHostRemoved:          "Host Removed",
+		BookingNoticeRequestApproved:      "Request Approved",
+		BookingNoticeRequestRejected:      "Request Rejected",
+		BookingNoticeRequestFulfilled:     "Request Fulfilled",
+		BookingNoticeExpiryWarning:        "Expiry Warning",
+		BookingNoticeExpired:              "Expired",
+		BookingNoticeTornDown:             "Torn Down",
+		BookingNoticeExtended:             "Extended",
+		BookingNoticeExtensionRejected:    "Extension Rejected",
+		BookingNoticeStarted:              "Started",
+	}
+
+	BookingNoticeKindNameReverses = map[string]BookingNoticeKind{}
+
+	WipeMethodNames = map[WipeMethod]string{
+		WipeMethodNVMeFormat: "NVMe Format",
+		WipeMethodDiscard:    "Discard",
+		WipeMethodOverwrite:  "Overwrite",
+	}
+
+	WipeMethodNameReverses = map[string]WipeMethod{}
+
+	QuotaScopeNames = map[QuotaScope]string{
+		QuotaScopeUser:  "User",
+		QuotaScopeGroup: "Group",
+	}
+
+	QuotaScopeNameReverses = map[string]QuotaScope{}
+
+	WipeStatusNames = map[WipeStatus]string{
+		WipeStatusBooting:   "Booting",
+		WipeStatusWiping:    "Wiping",
+		WipeStatusWiped:     "Wiped",
+		WipeStatusCompleted: "Completed",
+		WipeStatusFailed:    "Failed",
+	}
+
+	WipeStatusNameReverses = map[string]WipeStatus{}
 )
 
 func (v VendorID) String() string {
@@ -462,6 +925,70 @@ func (b BookingStatus) String() string {
 	return "Unknown Status"
 }
 
+func (k JobKind) String() string {
+	if name, exists := JobKindNames[k]; exists {
+		return name
+	}
+
+	return "Unknown Job"
+}
+
+func (s JobStatus) String() string {
+	if name, exists := JobStatusNames[s]; exists {
+		return name
+	}
+
+	return "Unknown Status"
+}
+
+func (f FirmwareCategory) String() string {
+	if name, exists := FirmwareCategoryNames[f]; exists {
+		return name
+	}
+
+	return "Other"
+}
+
+func (m FirmwareUpdateMethod) String() string {
+	if name, exists := FirmwareUpdateMethodNames[m]; exists {
+		return name
+	}
+
+	return "Unknown Method"
+}
+
+func (k BookingNoticeKind) String() string {
+	if name, exists := BookingNoticeKindNames[k]; exists {
+		return name
+	}
+
+	return "Unknown Notice"
+}
+
+func (m WipeMethod) String() string {
+	if name, exists := WipeMethodNames[m]; exists {
+		return name
+	}
+
+	return "Unknown Method"
+}
+
+func (s WipeStatus) String() string {
+	if name, exists := WipeStatusNames[s]; exists {
+		return name
+	}
+
+	return "Unknown Status"
+}
+
+func (s QuotaScope) String() string {
+	if name, exists := QuotaScopeNames[s]; exists {
+		return name
+	}
+
+	return "Unknown Scope"
+}
+
 func (specs HostSpecs) String() string {
 	var (
 		specsBytes []byte
@@ -519,4 +1046,36 @@ func init() {
 	for k, v := range BookingStatusNames {
 		BookingStatusNameReverses[v] = k
 	}
+
+	for k, v := range JobKindNames {
+		JobKindNameReverses[v] = k
+	}
+
+	for k, v := range JobStatusNames {
+		JobStatusNameReverses[v] = k
+	}
+
+	for k, v := range FirmwareCategoryNames {
+		FirmwareCategoryNameReverses[v] = k
+	}
+
+	for k, v := range FirmwareUpdateMethodNames {
+		FirmwareUpdateMethodNameReverses[v] = k
+	}
+
+	for k, v := range BookingNoticeKindNames {
+		BookingNoticeKindNameReverses[v] = k
+	}
+
+	for k, v := range WipeMethodNames {
+		WipeMethodNameReverses[v] = k
+	}
+
+	for k, v := range WipeStatusNames {
+		WipeStatusNameReverses[v] = k
+	}
+
+	for k, v := range QuotaScopeNames {
+		QuotaScopeNameReverses[v] = k
+	}
 }
@@ -0,0 +1,683 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/z46-dev/gomysql"
+)
+
+// Wipes started by releasing a host from a booking are created by this user
+const WipeCreatorRelease = "booking-release"
+
+var (
+	hostWipesLock    sync.Mutex
+	biosProfilesLock sync.Mutex
+
+	ErrWipeNotFound        = errors.New("wipe not found")
+	ErrWipeNotInProgress   = errors.New("wipe is not in progress")
+	ErrHostWiping          = errors.New("host is being wiped")
+	ErrWipeNotConfigured   = errors.New("WIPE_BASE_URL, WIPE_KERNEL_URL, WIPE_INITRD_URL and WIPE_IMAGE_NETWORKS must be set to wipe hosts")
+	ErrWipeSourceRejected  = errors.New("request did not come from the host being wiped")
+	ErrWipeVerification    = errors.New("wipe could not be verified")
+	ErrBIOSProfileNotFound = errors.New("BIOS profile not found")
+)
+
+// WipePlan tells the wipe image which drives to wipe and how, and where to report back.
+type WipePlan struct {
+	WipeID       int             `json:"wipe_id"`
+	ManagementIP string          `json:"management_ip"`
+	Drives       []HostWipeDrive `json:"drives"`
+	ReportURL    string          `json:"report_url"`
+}
+
+// WipeReportDrive is the outcome of wiping one drive as reported by the wipe image.
+type WipeReportDrive struct {
+	Name         string     `json:"name"`
+	SerialNumber string     `json:"serial_number"`
+	Method       WipeMethod `json:"method"`
+	Success      bool       `json:"success"`
+	Message      string     `json:"message"`
+}
+
+// WipeReport is posted by the wipe image once it has been through every drive.
+type WipeReport struct {
+	Drives []WipeReportDrive `json:"drives"`
+}
+
+// inProgress reports whether the wipe has yet to complete or fail.
+func (wipe *HostWipe) inProgress() bool {
+	return wipe.Status != WipeStatusCompleted && wipe.Status != WipeStatusFailed
+}
+
+// wipeMethodFor picks how a drive is wiped: NVMe drives are formatted with a crypto erase, other SSDs are
+// discarded and spinning disks are overwritten.
+func wipeMethodFor(drive HostDriveSpecs) WipeMethod {
+	switch {
+	case strings.EqualFold(drive.Protocol, "NVMe"):
+		return WipeMethodNVMeFormat
+	case strings.EqualFold(drive.MediaType, "SSD"):
+		return WipeMethodDiscard
+	default:
+		return WipeMethodOverwrite
+	}
+}
+
+func wipeConfigured() bool {
+	return config.Config.Wipe.BaseURL != "" && config.Config.Wipe.KernelURL != "" && config.Config.Wipe.InitrdURL != "" && len(wipeImageNetworks()) > 0
+}
+
+// wipeImageNetworks parses WIPE_IMAGE_NETWORKS, skipping malformed entries.
+func wipeImageNetworks() (networks []*net.IPNet) {
+	for _, cidr := range config.Config.Wipe.ImageNetworks {
+		if _, network, err := net.ParseCIDR(strings.TrimSpace(cidr)); err == nil {
+			networks = append(networks, network)
+		} else if strings.TrimSpace(cidr) != "" {
+			log.Warnf("ignoring malformed wipe image network %q: %v", cidr, err)
+		}
+	}
+
+	return
+}
+
+// inWipeImageNetwork reports whether source is an address the wipe image may boot from.
+func inWipeImageNetwork(source string) bool {
+	var address net.IP = net.ParseIP(source)
+	return address != nil && slices.ContainsFunc(wipeImageNetworks(), func(network *net.IPNet) bool { return network.Contains(address) })
+}
+
+// checkWipeSource makes sure a plan or report request comes from the address that booted the wipe image. The
+// token alone isn't proof, it is in the boot script. The caller must hold hostWipesLock.
+func checkWipeSource(wipe *HostWipe, source string) error {
+	if wipe.BootSource == "" || wipe.BootSource != source {
+		return fmt.Errorf("%w: %s", ErrWipeSourceRejected, source)
+	}
+
+	return nil
+}
+
+func wipeURL(token, endpoint string) string {
+	return fmt.Sprintf("%s/api/wipe/%s/%s", strings.TrimRight(config.Config.Wipe.BaseURL, "/"), token, endpoint)
+}
+
+// wipeCertificate hashes the verified parts of a finished wipe.
+func wipeCertificate(wipe *HostWipe) string {
+	encoded, _ := json.Marshal(struct {
+		ID           int             `json:"id"`
+		ManagementIP string          `json:"management_ip"`
+		BookingID    int             `json:"booking_id"`
+		Drives       []HostWipeDrive `json:"drives"`
+		BIOSReverted bool            `json:"bios_reverted"`
+		FinishedAt   time.Time       `json:"finished_at"`
+	}{wipe.ID, wipe.ManagementIP, wipe.BookingID, wipe.Drives, wipe.BIOSReverted, wipe.FinishedAt.UTC()})
+
+	var sum [32]byte = sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// ---------- HISTORY ----------
+
+// HostWipeByID fetches a wipe by its ID.
+func HostWipeByID(wipeID int) (wipe *HostWipe, err error) {
+	hostWipesLock.Lock()
+	defer hostWipesLock.Unlock()
+
+	if wipe, err = hostWipes.Select(wipeID); err == nil && wipe == nil {
+		err = fmt.Errorf("%w: %d", ErrWipeNotFound, wipeID)
+	}
+
+	return
+}
+
+// HostWipeHistory lists every wipe of a host, newest first.
+func HostWipeHistory(managementIP string) (records []*HostWipe, err error) {
+	hostWipesLock.Lock()
+	defer hostWipesLock.Unlock()
+
+	records, err = hostWipesFor(managementIP)
+	return
+}
+
+// hostWipesFor lists the wipes of a host, newest first. The caller must hold hostWipesLock.
+func hostWipesFor(managementIP string) (records []*HostWipe, err error) {
+	if records, err = hostWipes.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(hostWipes.FieldBySQLName("management_ip"), gomysql.OpEqual, managementIP)); err == nil {
+		sort.Slice(records, func(i, j int) bool { return records[i].ID > records[j].ID })
+	}
+
+	return
+}
+
+// hostWipeByToken finds a wipe by the token handed to the wipe image. The caller must hold hostWipesLock.
+func hostWipeByToken(token string) (wipe *HostWipe, err error) {
+	var records []*HostWipe
+	if records, err = hostWipes.SelectAllWithFilter(gomysql.NewFilter().KeyCmp(hostWipes.FieldBySQLName("token"), gomysql.OpEqual, token)); err != nil {
+		return
+	} else if len(records) == 0 || token == "" {
+		err = ErrWipeNotFound
+		return
+	}
+
+	wipe = records[0]
+	return
+}
+
+// ---------- BIOS PROFILES ----------
+
+// BIOSProfileFor returns the BIOS profile of a host.
+func BIOSProfileFor(managementIP string) (profile *BIOSProfile, err error) {
+	biosProfilesLock.Lock()
+	defer biosProfilesLock.Unlock()
+
+	if profile, err = biosProfiles.Select(managementIP); err == nil && profile == nil {
+		err = fmt.Errorf("%w: %s", ErrBIOSProfileNotFound, managementIP)
+	}
+
+	return
+}
+
+// CaptureBIOSProfile stores the current BIOS attributes of a host as the profile it is reverted to after a wipe.
+func CaptureBIOSProfile(managementIP, capturedBy string) (profile *BIOSProfile, err error) {
+	var host *Host
+	if host, err = Hosts.Select(managementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, managementIP)
+		return
+	}
+
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	var attributes map[string]any
+	attributes, err = host.Management.BIOSAttributes()
+	host.Management.Close()
+
+	if err != nil {
+		return
+	}
+
+	profile = &BIOSProfile{ManagementIP: host.ManagementIP, CapturedBy: capturedBy, CapturedAt: time.Now()}
+	if profile.Attributes, err = json.Marshal(attributes); err != nil {
+		return
+	}
+
+	biosProfilesLock.Lock()
+	defer biosProfilesLock.Unlock()
+
+	var existing *BIOSProfile
+	if existing, err = biosProfiles.Select(host.ManagementIP); err != nil {
+		return
+	} else if existing == nil {
+		err = biosProfiles.Insert(profile)
+	} else {
+		err = biosProfiles.Update(profile)
+	}
+
+	return
+}
+
+// deleteBIOSProfile forgets the BIOS profile of a host, used when the host is removed.
+func deleteBIOSProfile(managementIP string) (err error) {
+	biosProfilesLock.Lock()
+	defer biosProfilesLock.Unlock()
+
+	var profile *BIOSProfile
+	if profile, err = biosProfiles.Select(managementIP); err == nil && profile != nil {
+		err = biosProfiles.Delete(managementIP)
+	}
+
+	return
+}
+
+// revertHostBIOS restores the host's BIOS profile, or factory defaults when none was captured. Hosts whose BMC
+// can't configure the BIOS are left as they are and reverted comes back false.
+func revertHostBIOS(client *HostManagementClient) (reverted bool, err error) {
+	var attributes map[string]any
+	if profile, errProfile := BIOSProfileFor(client.Host.ManagementIP); errProfile == nil {
+		if err = json.Unmarshal(profile.Attributes, &attributes); err != nil {
+			return
+		}
+	} else if !errors.Is(errProfile, ErrBIOSProfileNotFound) {
+		err = errProfile
+		return
+	}
+
+	if err = client.RevertBIOS(attributes); errors.Is(err, ErrBIOSNotSupported) {
+		err = nil
+		return
+	}
+
+	reverted = err == nil
+	return
+}
+
+// ---------- PIPELINE ----------
+
+// StartHostWipe PXE boots an idle host into the wipe image and queues a job that waits for the image to
+// report back, reverts the BIOS profile and returns the host to the pool. The host stays out of the pool if
+// any step fails, retrying is a matter of starting another wipe. The wipe is only returned once it is recorded.
+func StartHostWipe(managementIP string, bookingID int, requestedBy string) (wipe *HostWipe, job *Job, err error) {
+	if !wipeConfigured() {
+		err = ErrWipeNotConfigured
+		return
+	}
+
+	var host *Host
+	if host, err = reserveHostForWipe(managementIP); err != nil {
+		return
+	}
+
+	var raw []byte = make([]byte, 16)
+	rand.Read(raw)
+
+	wipe = &HostWipe{
+		ManagementIP: host.ManagementIP,
+		BookingID:    bookingID,
+		Status:       WipeStatusBooting,
+		Token:        hex.EncodeToString(raw),
+		RequestedBy:  requestedBy,
+		StartedAt:    time.Now(),
+	}
+
+	for _, drive := range host.Specs.Drives {
+		wipe.Drives = append(wipe.Drives, HostWipeDrive{
+			Name:         drive.Name,
+			Model:        drive.Model,
+			SerialNumber: drive.SerialNumber,
+			CapacityGB:   drive.CapacityGB,
+			Method:       wipeMethodFor(drive),
+		})
+	}
+
+	hostWipesLock.Lock()
+	err = hostWipes.Insert(wipe)
+	hostWipesLock.Unlock()
+
+	if err != nil {
+		wipe = nil
+		return
+	}
+
+	var wipeID int = wipe.ID
+	if job, err = EnqueueJob(JobKindHostWipe, host.ManagementIP, requestedBy, func(handle *JobHandle) error {
+		return runHostWipe(wipeID, handle)
+	}); err != nil {
+		failHostWipe(wipeID, err)
+		return
+	}
+
+	hostWipesLock.Lock()
+	wipe.JobID = job.ID
+	err = hostWipes.Update(wipe)
+	hostWipesLock.Unlock()
+	return
+}
+
+// reserveHostForWipe takes an idle host out of the pool. Hosts already flagged as wiping, after a release or a
+// failed wipe, may be wiped again as long as no other wipe is running.
+func reserveHostForWipe(managementIP string) (host *Host, err error) {
+	bookingCartLock.Lock()
+	defer bookingCartLock.Unlock()
+
+	hostWipesLock.Lock()
+	var wipes []*HostWipe
+	wipes, err = hostWipesFor(managementIP)
+	hostWipesLock.Unlock()
+
+	if err != nil {
+		return
+	} else if len(wipes) > 0 && wipes[0].inProgress() {
+		err = fmt.Errorf("%w: %s", ErrHostWiping, managementIP)
+		return
+	}
+
+	host, err = UpdateHost(managementIP, func(host *Host) error {
+		if _, reserved := hostCartOwners[managementIP]; host.IsBooked || reserved || removingHosts[managementIP] {
+			return fmt.Errorf("%w: %s", ErrHostNotIdle, managementIP)
+		} else if host.FirmwareUpdating {
+			return fmt.Errorf("%w: %s", ErrHostFirmwareUpdating, managementIP)
+		}
+
+		host.Wiping = true
+		return nil
+	})
+	return
+}
+
+// runHostWipe is the body of a wipe job.
+func runHostWipe(wipeID int, handle *JobHandle) (err error) {
+	var (
+		wipe *HostWipe
+		host *Host
+	)
+
+	defer func() {
+		if err != nil {
+			failHostWipe(wipeID, err)
+		}
+	}()
+
+	if wipe, err = HostWipeByID(wipeID); err != nil {
+		return
+	}
+
+	if host, err = Hosts.Select(wipe.ManagementIP); err != nil {
+		return
+	} else if host == nil {
+		err = fmt.Errorf("%w: %s", ErrHostNotFound, wipe.ManagementIP)
+		return
+	}
+
+	handle.Progress(5, "Connecting to management interface")
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	handle.Progress(10, "Booting the wipe image")
+	if err = host.Management.SetPXEBoot(BootModeUEFI); err == nil {
+		err = powerCycleHost(host.Management)
+	}
+
+	host.Management.Close()
+	if err != nil {
+		return
+	}
+
+	if err = waitForWipeReport(wipeID, handle); err != nil {
+		return
+	}
+
+	handle.Progress(80, "Reverting the BIOS profile")
+	if host.Management, err = AcquireHostManagementClient(host); err != nil {
+		return
+	}
+
+	var reverted bool
+	if reverted, err = revertHostBIOS(host.Management); err == nil {
+		handle.Progress(90, "Powering off")
+		err = host.Management.SetPowerState(PowerStateOff, true)
+	}
+
+	host.Management.Close()
+	if err != nil {
+		return
+	}
+
+	if wipe, err = completeHostWipe(wipeID, reverted); err != nil {
+		return
+	}
+
+	handle.Progress(100, "Host wiped and returned to the pool")
+	return handle.SetResult(wipe)
+}
+
+// powerCycleHost restarts a running host or powers on a stopped one so it picks up its boot override.
+func powerCycleHost(client *HostManagementClient) (err error) {
+	var state PowerState
+	if state, err = client.PowerState(true); err != nil {
+		return
+	}
+
+	if state == PowerStateOn {
+		return client.ResetPowerState(true)
+	}
+
+	return client.SetPowerState(PowerStateOn, false)
+}
+
+// waitForWipeReport polls the wipe until the image's report has been verified or the configured timeout elapses.
+func waitForWipeReport(wipeID int, handle *JobHandle) (err error) {
+	var deadline time.Time = time.Now().Add(time.Duration(config.Config.Wipe.TimeoutMinutes) * time.Minute)
+
+	for {
+		var wipe *HostWipe
+		if wipe, err = HostWipeByID(wipeID); err != nil {
+			return
+		}
+
+		switch wipe.Status {
+		case WipeStatusWiped:
+			return
+		case WipeStatusBooting:
+			handle.Progress(20, "Waiting for the wipe image")
+		case WipeStatusWiping:
+			handle.Progress(40, "Wiping drives")
+		default:
+			return fmt.Errorf("%w: %s", ErrWipeVerification, wipe.Message)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for the wipe image of host %s to report", wipe.ManagementIP)
+		}
+
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// completeHostWipe certifies a verified wipe and returns its host to the pool.
+func completeHostWipe(wipeID int, biosReverted bool) (wipe *HostWipe, err error) {
+	hostWipesLock.Lock()
+	if wipe, err = hostWipes.Select(wipeID); err == nil && wipe != nil {
+		wipe.Status = WipeStatusCompleted
+		wipe.BIOSReverted = biosReverted
+		wipe.FinishedAt = time.Now()
+		wipe.Certificate = wipeCertificate(wipe)
+		if wipe.Message = "Drives wiped and BIOS profile reverted"; !biosReverted {
+			wipe.Message = "Drives wiped, the BMC does not support reverting the BIOS profile"
+		}
+
+		err = hostWipes.Update(wipe)
+	}
+	hostWipesLock.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	_, err = UpdateHost(wipe.ManagementIP, func(host *Host) error {
+		host.Wiping = false
+		host.IdleSince = time.Now()
+		return nil
+	})
+
+	return
+}
+
+// failHostWipe records why a wipe failed. The host is kept out of the pool.
+func failHostWipe(wipeID int, cause error) {
+	hostWipesLock.Lock()
+	defer hostWipesLock.Unlock()
+
+	wipe, err := hostWipes.Select(wipeID)
+	if err != nil || wipe == nil || !wipe.inProgress() {
+		return
+	}
+
+	wipe.Status = WipeStatusFailed
+	wipe.Message = cause.Error()
+	wipe.FinishedAt = time.Now()
+
+	if err = hostWipes.Update(wipe); err != nil {
+		log.Errorf("failed to record wipe %d failure: %v", wipeID, err)
+	}
+
+	log.Warnf("wipe of host %s failed, it is kept out of the pool: %v", wipe.ManagementIP, cause)
+}
+
+// failInterruptedWipes fails wipes left running by a previous process. Their hosts stay out of the pool until
+// wiped again.
+func failInterruptedWipes() (err error) {
+	var records []*HostWipe
+	if records, err = hostWipes.SelectAll(); err != nil {
+		return
+	}
+
+	for _, wipe := range records {
+		if !wipe.inProgress() {
+			continue
+		}
+
+		wipe.Status = WipeStatusFailed
+		wipe.Message = "interrupted by a restart"
+		wipe.FinishedAt = time.Now()
+		if err = hostWipes.Update(wipe); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// ---------- WIPE IMAGE ----------
+
+// WipeBootScript returns the iPXE script booting the wipe image for a host being wiped, found by any of its MACs.
+// The script is only served to the wipe image networks, and once fetched only to the same address, which is then
+// the only one allowed to fetch the plan and report.
+func WipeBootScript(mac, source string) (script string, err error) {
+	if !inWipeImageNetwork(source) {
+		err = fmt.Errorf("%w: %s is not in a wipe image network", ErrWipeSourceRejected, source)
+		return
+	}
+
+	var host *Host
+	if host, _, err = HostByMACAddress(mac); err != nil {
+		return
+	}
+
+	hostWipesLock.Lock()
+	defer hostWipesLock.Unlock()
+
+	var wipes []*HostWipe
+	if wipes, err = hostWipesFor(host.ManagementIP); err != nil {
+		return
+	} else if !host.Wiping || len(wipes) == 0 || !wipes[0].inProgress() {
+		err = fmt.Errorf("%w: %s", ErrWipeNotInProgress, host.ManagementIP)
+		return
+	}
+
+	var wipe *HostWipe = wipes[0]
+	if wipe.BootSource == "" {
+		wipe.BootSource = source
+		if err = hostWipes.Update(wipe); err != nil {
+			return
+		}
+	} else if err = checkWipeSource(wipe, source); err != nil {
+		return
+	}
+
+	script = fmt.Sprintf("#!ipxe\nkernel %s initrd=initrd laas.wipe_plan=%s laas.wipe_report=%s\ninitrd --name initrd %s\nboot\n",
+		config.Config.Wipe.KernelURL, wipeURL(wipe.Token, "plan"), wipeURL(wipe.Token, "report"), config.Config.Wipe.InitrdURL)
+	return
+}
+
+// WipePlanFor hands the wipe image its plan. Fetching the plan marks the image as booted.
+func WipePlanFor(token, source string) (plan *WipePlan, err error) {
+	hostWipesLock.Lock()
+	defer hostWipesLock.Unlock()
+
+	var wipe *HostWipe
+	if wipe, err = hostWipeByToken(token); err != nil {
+		return
+	} else if wipe.Status != WipeStatusBooting && wipe.Status != WipeStatusWiping {
+		err = fmt.Errorf("%w: %d", ErrWipeNotInProgress, wipe.ID)
+		return
+	} else if err = checkWipeSource(wipe, source); err != nil {
+		return
+	}
+
+	if wipe.Status == WipeStatusBooting {
+		wipe.Status = WipeStatusWiping
+		if err = hostWipes.Update(wipe); err != nil {
+			return
+		}
+	}
+
+	plan = &WipePlan{WipeID: wipe.ID, ManagementIP: wipe.ManagementIP, Drives: wipe.Drives, ReportURL: wipeURL(token, "report")}
+	return
+}
+
+// SubmitWipeReport records the wipe image's report. Every planned drive must be reported wiped with its planned
+// method, otherwise the wipe fails. Without an inventory to plan from, the drives the image found are taken as is.
+// Reports from any address other than the one that booted the image are rejected and leave the wipe running.
+func SubmitWipeReport(token, source string, report WipeReport) (wipe *HostWipe, err error) {
+	hostWipesLock.Lock()
+	defer hostWipesLock.Unlock()
+
+	if wipe, err = hostWipeByToken(token); err != nil {
+		return
+	} else if wipe.Status != WipeStatusBooting && wipe.Status != WipeStatusWiping {
+		err = fmt.Errorf("%w: %d", ErrWipeNotInProgress, wipe.ID)
+		return
+	} else if err = checkWipeSource(wipe, source); err != nil {
+		wipe = nil
+		return
+	}
+
+	if len(wipe.Drives) == 0 {
+		for _, reported := range report.Drives {
+			wipe.Drives = append(wipe.Drives, HostWipeDrive{Name: reported.Name, SerialNumber: reported.SerialNumber, Method: reported.Method})
+		}
+	}
+
+	var problems []string
+	if len(wipe.Drives) == 0 {
+		problems = append(problems, "no drives were reported")
+	}
+
+	for i := range wipe.Drives {
+		var (
+			drive    *HostWipeDrive = &wipe.Drives[i]
+			reported *WipeReportDrive
+		)
+
+		for j := range report.Drives {
+			if (drive.SerialNumber != "" && report.Drives[j].SerialNumber == drive.SerialNumber) || (drive.SerialNumber == "" && report.Drives[j].Name == drive.Name) {
+				reported = &report.Drives[j]
+				break
+			}
+		}
+
+		switch {
+		case reported == nil:
+			drive.Message = "not reported"
+		case reported.Method != drive.Method:
+			drive.Message = fmt.Sprintf("wiped with %s instead of %s", reported.Method, drive.Method)
+		case !reported.Success:
+			drive.Message = reported.Message
+		default:
+			drive.Wiped, drive.Message = true, reported.Message
+		}
+
+		if !drive.Wiped {
+			problems = append(problems, fmt.Sprintf("%s: %s", drive.Name, drive.Message))
+		}
+	}
+
+	if len(problems) == 0 {
+		wipe.Status = WipeStatusWiped
+	} else {
+		wipe.Status = WipeStatusFailed
+		wipe.Message = strings.Join(problems, "; ")
+		wipe.FinishedAt = time.Now()
+		err = fmt.Errorf("%w: %s", ErrWipeVerification, wipe.Message)
+	}
+
+	if errUpdate := hostWipes.Update(wipe); errUpdate != nil {
+		err = errUpdate
+	}
+
+	return
+}
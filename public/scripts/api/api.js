@@ -11,3 +11,4 @@ export * from "./api_auth.js";
 export * from "./api_enums.js";
 export * from "./api_hosts.js";
 export * from "./api_isos.js";
+export * from "./api_jobs.js";
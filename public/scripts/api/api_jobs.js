@@ -0,0 +1,27 @@
+import { apiGet, known_uri } from "./util.js";
+
+// Job statuses that will not change anymore (see /api/enums/job-statuses)
+const FINISHED_JOB_STATUSES = [2, 3];
+
+export async function getJobs() {
+    return await apiGet(known_uri.jobs());
+}
+
+export async function getJobById(job_id) {
+    return await apiGet(known_uri.jobById(job_id));
+}
+
+/**
+ * Polls a job until it succeeds or fails.
+ * @returns the last response from the job endpoint
+ */
+export async function waitForJob(job_id, interval_ms = 1000) {
+    while (true) {
+        const response = await getJobById(job_id);
+        if (response.status_code !== 200 || FINISHED_JOB_STATUSES.includes(response.body.status)) {
+            return response;
+        }
+
+        await new Promise((resolve) => setTimeout(resolve, interval_ms));
+    }
+}
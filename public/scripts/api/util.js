@@ -32,6 +32,8 @@ export const known_uri = {
     hosts_hostByManagementIP: (management_ip) => `${known_uri.hosts_hosts()}/${management_ip}`,
     hosts_hostPowerAction: (management_ip, power_action) => `${known_uri.hosts_hostByManagementIP(management_ip)}/power/${power_action}`,
     iso_images: () => "/api/iso-images",
+    jobs: () => "/api/jobs",
+    jobById: (job_id) => `${known_uri.jobs()}/${job_id}`,
 };
 
 export async function apiGet(URI, params) {
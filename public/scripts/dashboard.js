@@ -383,10 +383,20 @@ async function powerControl(button) {
 
         const powerActions = (await API.getPowerActions()).body;
         const powerAction = powerActions[btnText];
-        const response = await API.postHostPowerControl(deviceAddress, powerAction);
+        let response = await API.postHostPowerControl(deviceAddress, powerAction);
+        let message = response?.body?.message;
+        let isOK = response.status_code === 202;
+
+        if (isOK) {
+            // Power actions run as background jobs, wait for the result
+            response = await API.waitForJob(response.body.job_id);
+            message = response?.body?.message;
+            isOK = response.status_code === 200 && response.body.status === 2;
+            if (isOK) {
+                response.body.power_state = response.body.result?.power_state;
+            }
+        }
 
-        const message = response?.body?.message;
-        const isOK = response.status_code === 200;
         if (!isOK) {
             const fallback = message || "Failed to change power state.";
             if (errorBox) {
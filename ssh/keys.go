@@ -7,6 +7,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -76,3 +77,16 @@ func CreateSSHKeyPair() (pub, priv string, err error) {
 
 	return
 }
+
+// NormalizeAuthorizedKey checks that key is a single public key in authorized_keys format and returns it without
+// surrounding whitespace.
+func NormalizeAuthorizedKey(key string) (normalized string, err error) {
+	normalized = strings.TrimSpace(key)
+	if _, _, _, rest, errParse := ssh.ParseAuthorizedKey([]byte(normalized)); errParse != nil {
+		err = fmt.Errorf("invalid SSH public key: %w", errParse)
+	} else if len(strings.TrimSpace(string(rest))) > 0 {
+		err = fmt.Errorf("invalid SSH public key: expected a single key")
+	}
+
+	return
+}
@@ -0,0 +1,298 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func newSimulatedRedfish(t *testing.T) *bmcsim.RedfishServer {
+	return bmcsim.NewRedfishServer(config.Config.Management.DefaultIPMIUser, config.Config.Management.DefaultIPMIPass, bmcsim.DefaultHardware())
+}
+
+func newSimulatedIPMI(t *testing.T) *bmcsim.IPMIServer {
+	sim, err := bmcsim.NewIPMIServer(config.Config.Management.DefaultIPMIUser, config.Config.Management.DefaultIPMIPass)
+	if err != nil {
+		t.Fatalf("Failed to start IPMI simulator: %v", err)
+	}
+
+	return sim
+}
+
+func TestSimulatedRedfishManagement(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var sim *bmcsim.RedfishServer = newSimulatedRedfish(t)
+	defer sim.Close()
+
+	var (
+		hardware bmcsim.Hardware = bmcsim.DefaultHardware()
+		host     *db.Host        = &db.Host{ManagementIP: sim.Address(), ManagementType: db.ManagementTypeRedfish}
+		err      error
+	)
+
+	if host.Management, err = db.NewHostManagementClient(host); err != nil {
+		t.Fatalf("Failed to connect to simulated Redfish BMC: %v", err)
+	}
+
+	t.Run("Reads power state", func(t *testing.T) {
+		if state, err := host.Management.PowerState(true); err != nil {
+			t.Fatalf("Failed to read power state: %v", err)
+		} else if state != db.PowerStateOff {
+			t.Fatalf("Expected power state Off, got %s", state.String())
+		}
+	})
+
+	t.Run("Collects system info", func(t *testing.T) {
+		if err := host.Management.UpdateSystemInfo(); err != nil {
+			t.Fatalf("Failed to update system info: %v", err)
+		}
+
+		if host.Model != hardware.Model || host.Vendor != db.VendorFromManufacturer(hardware.Manufacturer) {
+			t.Fatalf("Unexpected model/vendor %q/%v", host.Model, host.Vendor)
+		}
+
+		if host.Specs.Processor.Count != hardware.CPUCount || host.Specs.Processor.Threads != hardware.CPUCount*hardware.ThreadsPerCPU {
+			t.Fatalf("Unexpected processor specs: %+v", host.Specs.Processor)
+		}
+
+		if host.Specs.Memory.NumDIMMs != hardware.DIMMCount || host.Specs.Memory.SizeGB != hardware.DIMMCount*hardware.DIMMSizeGiB {
+			t.Fatalf("Unexpected memory specs: %+v", host.Specs.Memory)
+		}
+
+		// Volumes are fetched concurrently, so compare totals rather than order
+		var collectedGB, expectedGB int
+		for _, storage := range host.Specs.Storage {
+			collectedGB += storage.CapacityGB
+		}
+
+		for _, size := range hardware.VolumeSizesGiB {
+			expectedGB += size
+		}
+
+		if len(host.Specs.Storage) != len(hardware.VolumeSizesGiB) || collectedGB != expectedGB {
+			t.Fatalf("Unexpected storage specs: %+v", host.Specs.Storage)
+		}
+	})
+
+	t.Run("Unknown manufacturers keep the known vendor", func(t *testing.T) {
+		var unbranded bmcsim.Hardware = bmcsim.DefaultHardware()
+		unbranded.Manufacturer = ""
+
+		var other *bmcsim.RedfishServer = bmcsim.NewRedfishServer(config.Config.Management.DefaultIPMIUser, config.Config.Management.DefaultIPMIPass, unbranded)
+		defer other.Close()
+
+		var known *db.Host = &db.Host{ManagementIP: other.Address(), ManagementType: db.ManagementTypeRedfish, Vendor: db.VendorHPE}
+		if known.Management, err = db.NewHostManagementClient(known); err != nil {
+			t.Fatalf("Failed to connect to simulated Redfish BMC: %v", err)
+		}
+
+		defer known.Management.Close()
+
+		if err := known.Management.UpdateSystemInfo(); err != nil {
+			t.Fatalf("Failed to update system info: %v", err)
+		} else if known.Vendor != db.VendorHPE {
+			t.Fatalf("Expected the vendor to stay %v, got %v", db.VendorHPE, known.Vendor)
+		}
+	})
+
+	t.Run("Sets power state", func(t *testing.T) {
+		if err := host.Management.SetPowerState(db.PowerStateOn, false); err != nil {
+			t.Fatalf("Failed to power on: %v", err)
+		}
+
+		if err := host.Management.WaitSystemPowerState(db.PowerStateOn, 5); err != nil {
+			t.Fatalf("Failed waiting for power on: %v", err)
+		}
+
+		if err := host.Management.SetPowerState(db.PowerStateOff, true); err != nil {
+			t.Fatalf("Failed to power off: %v", err)
+		} else if sim.PowerState() != bmcsim.PowerOff {
+			t.Fatalf("Expected simulator to be off, got %s", sim.PowerState())
+		}
+
+		if err := host.Management.ResetPowerState(true); err != nil {
+			t.Fatalf("Failed to reset: %v", err)
+		} else if sim.PowerState() != bmcsim.PowerOn {
+			t.Fatalf("Expected simulator to be on after reset, got %s", sim.PowerState())
+		}
+
+		if resets := sim.Resets(); len(resets) != 3 || resets[1] != "ForceOff" {
+			t.Fatalf("Unexpected reset history: %v", resets)
+		}
+	})
+
+	t.Run("Sets PXE boot", func(t *testing.T) {
+		if err := host.Management.SetPXEBoot(db.BootModeUEFI); err != nil {
+			t.Fatalf("Failed to set PXE boot: %v", err)
+		}
+
+		if boot := sim.BootOverride(); boot.Target != "Pxe" || boot.Enabled != "Once" || boot.Mode != "UEFI" {
+			t.Fatalf("Unexpected boot override: %+v", boot)
+		}
+	})
+
+	t.Run("Close logs out", func(t *testing.T) {
+		host.Management.Close()
+
+		if sessions := sim.ActiveSessions(); sessions != 0 {
+			t.Fatalf("Expected no active sessions, got %d", sessions)
+		}
+	})
+}
+
+func TestSimulatedIPMIManagement(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var sim *bmcsim.IPMIServer = newSimulatedIPMI(t)
+	defer sim.Close()
+
+	var (
+		host *db.Host = &db.Host{ManagementIP: sim.Address(), ManagementType: db.ManagementTypeIPMI}
+		err  error
+	)
+
+	if host.Management, err = db.NewHostManagementClient(host); err != nil {
+		t.Fatalf("Failed to connect to simulated IPMI BMC: %v", err)
+	}
+
+	t.Run("Reads power state", func(t *testing.T) {
+		if state, err := host.Management.PowerState(false); err != nil {
+			t.Fatalf("Failed to read power state: %v", err)
+		} else if state != db.PowerStateOff {
+			t.Fatalf("Expected power state Off, got %s", state.String())
+		}
+	})
+
+	t.Run("Sets power state", func(t *testing.T) {
+		if err := host.Management.SetPowerState(db.PowerStateOn, false); err != nil {
+			t.Fatalf("Failed to power on: %v", err)
+		}
+
+		if err := host.Management.WaitSystemPowerState(db.PowerStateOn, 5); err != nil {
+			t.Fatalf("Failed waiting for power on: %v", err)
+		}
+
+		if err := host.Management.SetPowerState(db.PowerStateOff, false); err != nil {
+			t.Fatalf("Failed to shut down: %v", err)
+		} else if sim.PowerOn() {
+			t.Fatalf("Expected simulator to be off")
+		}
+
+		if err := host.Management.ResetPowerState(false); err != nil {
+			t.Fatalf("Failed to power cycle: %v", err)
+		}
+
+		var expected []byte = []byte{bmcsim.ChassisPowerUp, bmcsim.ChassisSoftShutdown, bmcsim.ChassisPowerCycle}
+		if controls := sim.ChassisControls(); string(controls) != string(expected) {
+			t.Fatalf("Expected chassis controls %v, got %v", expected, controls)
+		}
+	})
+
+	t.Run("Sets PXE boot", func(t *testing.T) {
+		if err := host.Management.SetPXEBoot(db.BootModeUEFI); err != nil {
+			t.Fatalf("Failed to set PXE boot: %v", err)
+		}
+
+		if flags := sim.BootFlags(); !flags.Valid || !flags.EFI || flags.Persistent || flags.DeviceSelector != 0x01 {
+			t.Fatalf("Unexpected boot flags: %+v", flags)
+		}
+	})
+
+	t.Run("Close ends the session", func(t *testing.T) {
+		host.Management.Close()
+
+		if sessions := sim.ActiveSessions(); sessions != 0 {
+			t.Fatalf("Expected no active sessions, got %d", sessions)
+		}
+	})
+}
+
+func TestSimulatedHostPowerAPI(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	var (
+		redfishSim *bmcsim.RedfishServer = newSimulatedRedfish(t)
+		ipmiSim    *bmcsim.IPMIServer    = newSimulatedIPMI(t)
+	)
+
+	defer redfishSim.Close()
+	defer ipmiSim.Close()
+
+	powerAction := func(t *testing.T, managementIP string, action db.PowerAction) {
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("http://%s/api/hosts/%s/power/%d", config.Config.WebServer.Address, managementIP, action), "", aliceCookies)
+		if err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusAccepted, status, body)
+		}
+
+		var queued struct {
+			JobID int `json:"job_id"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &queued); err != nil {
+			t.Fatalf("Failed to unmarshal queued job: %v", err)
+		}
+
+		if finished, err := db.WaitForJob(queued.JobID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for power job: %v", err)
+		} else if finished.Status != db.JobStatusSucceeded {
+			t.Fatalf("Expected power job to succeed, got %+v", finished)
+		}
+	}
+
+	t.Run("Redfish host can be registered and powered", func(t *testing.T) {
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("http://%s/api/hosts", config.Config.WebServer.Address), fmt.Sprintf(`{"management_ip":%q,"management_type":%d}`, redfishSim.Address(), db.ManagementTypeRedfish), aliceCookies)
+		if err != nil {
+			t.Fatalf("Host create request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+
+		powerAction(t, redfishSim.Address(), db.PowerActionPowerOn)
+
+		if redfishSim.PowerState() != bmcsim.PowerOn {
+			t.Fatalf("Expected simulator to be on, got %s", redfishSim.PowerState())
+		}
+
+		if host, err := db.Hosts.Select(redfishSim.Address()); err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		} else if host.LastKnownPowerState != db.PowerStateOn {
+			t.Fatalf("Expected stored power state On, got %s", host.LastKnownPowerState.String())
+		}
+	})
+
+	t.Run("IPMI host can be powered", func(t *testing.T) {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ipmiSim.Address(), ManagementType: db.ManagementTypeIPMI}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+
+		ipmiSim.SetPowerOn(true)
+		powerAction(t, ipmiSim.Address(), db.PowerActionPowerOff)
+
+		if ipmiSim.PowerOn() {
+			t.Fatalf("Expected simulator to be off")
+		}
+	})
+}
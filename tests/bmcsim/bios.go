@@ -0,0 +1,112 @@
+package bmcsim
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+)
+
+func defaultBIOSAttributes() map[string]any {
+	return map[string]any{
+		"BootMode":           "Uefi",
+		"ProcVirtualization": "Enabled",
+		"SriovGlobalEnable":  "Disabled",
+		"SysProfile":         "PerfOptimized",
+	}
+}
+
+// BIOSAttributes returns the BIOS attributes in effect.
+func (s *RedfishServer) BIOSAttributes() map[string]any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return maps.Clone(s.bios)
+}
+
+// SetBIOSAttribute changes a BIOS attribute in effect, as if it was changed from the setup menu.
+func (s *RedfishServer) SetBIOSAttribute(name string, value any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bios[name] = value
+}
+
+// PendingBIOSAttributes returns the BIOS attributes staged for the next boot.
+func (s *RedfishServer) PendingBIOSAttributes() map[string]any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return maps.Clone(s.biosPending)
+}
+
+// BIOSResets returns how many times the BIOS was reset to defaults.
+func (s *RedfishServer) BIOSResets() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.biosResets
+}
+
+// applyPendingBIOS applies staged BIOS changes, as the host does when it boots. The caller must hold s.lock.
+func (s *RedfishServer) applyPendingBIOS() {
+	if s.biosResetPending {
+		s.bios, s.biosResetPending = defaultBIOSAttributes(), false
+	}
+
+	maps.Copy(s.bios, s.biosPending)
+	s.biosPending = map[string]any{}
+}
+
+func (s *RedfishServer) handleBIOS(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":  "/redfish/v1/Systems/1/Bios",
+		"Id":         "Bios",
+		"Name":       "BIOS Configuration Current Settings",
+		"Attributes": s.bios,
+		"@Redfish.Settings": map[string]any{
+			"SettingsObject": link("/redfish/v1/Systems/1/Bios/Settings"),
+		},
+		"Actions": map[string]any{
+			"#Bios.ResetBios": map[string]any{
+				"target": "/redfish/v1/Systems/1/Bios/Actions/Bios.ResetBios",
+			},
+		},
+	})
+}
+
+func (s *RedfishServer) handleBIOSSettings(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":  "/redfish/v1/Systems/1/Bios/Settings",
+		"Id":         "Settings",
+		"Name":       "BIOS Configuration Pending Settings",
+		"Attributes": s.biosPending,
+	})
+}
+
+func (s *RedfishServer) handleBIOSSettingsPatch(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Attributes map[string]any
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.lock.Lock()
+	maps.Copy(s.biosPending, body.Attributes)
+	s.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RedfishServer) handleBIOSReset(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	s.biosResetPending = true
+	s.biosResets++
+	s.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,185 @@
+package bmcsim
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Redfish message IDs emitted by the simulator
+const (
+	MessagePowerStateChanged = "Simulator.1.0.PowerStateChanged"
+)
+
+type eventSubscription struct {
+	ID          string
+	Destination string
+	Context     string
+	Protocol    string
+}
+
+var eventClient *http.Client = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+// SetRejectSubscriptions makes the event service refuse new subscriptions, like BMCs without eventing
+// licenses do.
+func (s *RedfishServer) SetRejectSubscriptions(reject bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rejectSubscriptions = reject
+}
+
+// Subscriptions returns the destinations of every active event subscription.
+func (s *RedfishServer) Subscriptions() (destinations []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, subscription := range s.subscriptions {
+		destinations = append(destinations, subscription.Destination)
+	}
+
+	return
+}
+
+// DropSubscriptions forgets every subscription, as a BMC reset to defaults would.
+func (s *RedfishServer) DropSubscriptions() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.subscriptions = map[string]eventSubscription{}
+}
+
+// SendEvent delivers an event record to every subscriber and returns once all deliveries were attempted.
+func (s *RedfishServer) SendEvent(messageID, message, severity string) {
+	s.lock.Lock()
+	s.eventSeq++
+	var (
+		record map[string]any = map[string]any{
+			"EventId":           fmt.Sprintf("%d", s.eventSeq),
+			"EventTimestamp":    time.Now().Format(time.RFC3339),
+			"EventType":         "Alert",
+			"MessageId":         messageID,
+			"Message":           message,
+			"MessageSeverity":   severity,
+			"OriginOfCondition": link("/redfish/v1/Systems/1"),
+		}
+		targets []eventSubscription = make([]eventSubscription, 0, len(s.subscriptions))
+	)
+
+	for _, subscription := range s.subscriptions {
+		targets = append(targets, subscription)
+	}
+	s.lock.Unlock()
+
+	for _, target := range targets {
+		body, _ := json.Marshal(map[string]any{
+			"@odata.type": "#Event.v1_7_0.Event",
+			"Id":          record["EventId"],
+			"Name":        "Event Array",
+			"Context":     target.Context,
+			"Events":      []map[string]any{record},
+		})
+
+		if resp, err := eventClient.Post(target.Destination, "application/json", bytes.NewReader(body)); err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+func (s *RedfishServer) emitPowerEvent(state string) {
+	go s.SendEvent(MessagePowerStateChanged, fmt.Sprintf("The system power state changed to %s.", state), "OK")
+}
+
+func (s *RedfishServer) handleEventService(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":                    "/redfish/v1/EventService",
+		"Id":                           "EventService",
+		"Name":                         "Event Service",
+		"ServiceEnabled":               true,
+		"DeliveryRetryAttempts":        3,
+		"DeliveryRetryIntervalSeconds": 5,
+		"Subscriptions":                link("/redfish/v1/EventService/Subscriptions"),
+	})
+}
+
+func (s *RedfishServer) handleSubscriptionCollection(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	var members []string
+	for id := range s.subscriptions {
+		members = append(members, "/redfish/v1/EventService/Subscriptions/"+id)
+	}
+	s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Event Subscriptions Collection", members))
+}
+
+func (s *RedfishServer) handleSubscriptionCreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Destination string
+		Context     string
+		Protocol    string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Destination == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid subscription"})
+		return
+	}
+
+	s.lock.Lock()
+	if s.rejectSubscriptions {
+		s.lock.Unlock()
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "event subscriptions are not supported"})
+		return
+	}
+
+	s.subscriptionSeq++
+	var subscription eventSubscription = eventSubscription{
+		ID:          fmt.Sprintf("%d", s.subscriptionSeq),
+		Destination: body.Destination,
+		Context:     body.Context,
+		Protocol:    body.Protocol,
+	}
+	s.subscriptions[subscription.ID] = subscription
+	s.lock.Unlock()
+
+	var path string = "/redfish/v1/EventService/Subscriptions/" + subscription.ID
+	w.Header().Set("Location", path)
+	writeJSON(w, http.StatusCreated, map[string]any{"@odata.id": path, "Id": subscription.ID, "Destination": subscription.Destination})
+}
+
+func (s *RedfishServer) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	subscription, ok := s.subscriptions[r.PathValue("id")]
+	s.lock.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "subscription not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":   r.URL.Path,
+		"Id":          subscription.ID,
+		"Destination": subscription.Destination,
+		"Context":     subscription.Context,
+		"Protocol":    subscription.Protocol,
+	})
+}
+
+func (s *RedfishServer) handleSubscriptionDelete(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	_, ok := s.subscriptions[r.PathValue("id")]
+	delete(s.subscriptions, r.PathValue("id"))
+	s.lock.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "subscription not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,273 @@
+package bmcsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Firmware components reported by the simulator
+const (
+	FirmwareBIOS = "BIOS"
+	FirmwareBMC  = "iDRAC"
+	FirmwareNIC  = "NIC.Integrated.1"
+)
+
+// How long a simulated update task stays running before it completes
+const firmwareTaskDuration = 300 * time.Millisecond
+
+type firmwareComponent struct {
+	ID      string
+	Name    string
+	Version string
+}
+
+type updateTask struct {
+	ID       string
+	State    string
+	Status   string
+	Percent  int
+	Messages []string
+}
+
+// FirmwareImage builds an image the simulator understands, it installs version on the component.
+func FirmwareImage(componentID, version string) []byte {
+	return []byte(componentID + "=" + version)
+}
+
+func defaultFirmware() []*firmwareComponent {
+	return []*firmwareComponent{
+		{ID: FirmwareBIOS, Name: "BIOS", Version: "1.10.2"},
+		{ID: FirmwareBMC, Name: "Integrated Dell Remote Access Controller", Version: "6.10.00.00"},
+		{ID: FirmwareNIC, Name: "Broadcom NetXtreme Gigabit Ethernet", Version: "22.31.6"},
+	}
+}
+
+// FirmwareVersion returns the installed version of a firmware component.
+func (s *RedfishServer) FirmwareVersion(componentID string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, component := range s.firmware {
+		if component.ID == componentID {
+			return component.Version
+		}
+	}
+
+	return ""
+}
+
+// SetFirmwareVersion changes the installed version of a firmware component.
+func (s *RedfishServer) SetFirmwareVersion(componentID, version string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, component := range s.firmware {
+		if component.ID == componentID {
+			component.Version = version
+		}
+	}
+}
+
+// FirmwareUpdates returns how many update requests the simulator accepted, by "SimpleUpdate" and "Multipart".
+func (s *RedfishServer) FirmwareUpdates() map[string]int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var counts map[string]int = map[string]int{}
+	for method, count := range s.firmwareUpdates {
+		counts[method] = count
+	}
+
+	return counts
+}
+
+// startUpdateTask installs an image in the background, as BMCs do, and returns the task tracking it.
+func (s *RedfishServer) startUpdateTask(method string, image func() ([]byte, error)) (task *updateTask) {
+	s.lock.Lock()
+	s.taskSeq++
+	task = &updateTask{ID: fmt.Sprintf("%d", s.taskSeq), State: "Running", Status: "OK", Percent: 0}
+	s.tasks[task.ID] = task
+	s.firmwareUpdates[method]++
+	s.lock.Unlock()
+
+	go func() {
+		var (
+			data    []byte
+			err     error
+			applied bool
+		)
+
+		if data, err = image(); err == nil {
+			componentID, version, ok := strings.Cut(strings.TrimSpace(string(data)), "=")
+
+			s.lock.Lock()
+			task.Percent = 50
+			s.lock.Unlock()
+
+			time.Sleep(firmwareTaskDuration)
+
+			s.lock.Lock()
+			for _, component := range s.firmware {
+				if ok && component.ID == componentID {
+					component.Version, applied = version, true
+				}
+			}
+			s.lock.Unlock()
+
+			if !applied {
+				err = fmt.Errorf("image does not match any component of this system")
+			}
+		}
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		if err != nil {
+			task.State, task.Status = "Exception", "Critical"
+			task.Messages = append(task.Messages, err.Error())
+			return
+		}
+
+		task.State, task.Percent = "Completed", 100
+		task.Messages = append(task.Messages, "The update completed successfully.")
+	}()
+
+	return
+}
+
+func (s *RedfishServer) writeTaskAccepted(w http.ResponseWriter, task *updateTask) {
+	var path string = "/redfish/v1/TaskService/Tasks/" + task.ID
+	w.Header().Set("Location", path)
+	writeJSON(w, http.StatusAccepted, map[string]any{"@odata.id": path, "@odata.type": "#Task.v1_6_0.Task", "Id": task.ID, "TaskState": "New"})
+}
+
+func (s *RedfishServer) handleUpdateService(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":            "/redfish/v1/UpdateService",
+		"Id":                   "UpdateService",
+		"Name":                 "Update Service",
+		"ServiceEnabled":       true,
+		"FirmwareInventory":    link("/redfish/v1/UpdateService/FirmwareInventory"),
+		"MultiPartHttpPushUri": "/redfish/v1/UpdateService/MultipartUpload",
+		"Actions": map[string]any{
+			"#UpdateService.SimpleUpdate": map[string]any{
+				"target": "/redfish/v1/UpdateService/Actions/UpdateService.SimpleUpdate",
+				"TransferProtocol@Redfish.AllowableValues": []string{"HTTP", "HTTPS"},
+			},
+		},
+	})
+}
+
+func (s *RedfishServer) handleFirmwareInventoryCollection(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	var members []string
+	for _, component := range s.firmware {
+		members = append(members, "/redfish/v1/UpdateService/FirmwareInventory/"+component.ID)
+	}
+	s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Firmware Inventory Collection", members))
+}
+
+func (s *RedfishServer) handleFirmwareInventory(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, component := range s.firmware {
+		if component.ID == r.PathValue("id") {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"@odata.id":    r.URL.Path,
+				"Id":           component.ID,
+				"Name":         component.Name,
+				"Version":      component.Version,
+				"Manufacturer": s.hardware.Manufacturer,
+				"Updateable":   true,
+				"Status":       map[string]string{"State": "Enabled", "Health": "OK"},
+			})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such firmware component"})
+}
+
+func (s *RedfishServer) handleSimpleUpdate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ImageURI string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ImageURI == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ImageURI is required"})
+		return
+	}
+
+	s.writeTaskAccepted(w, s.startUpdateTask("SimpleUpdate", func() (data []byte, err error) {
+		var resp *http.Response
+		if resp, err = eventClient.Get(body.ImageURI); err != nil {
+			return
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("image download failed with status %d", resp.StatusCode)
+			return
+		}
+
+		return io.ReadAll(resp.Body)
+	}))
+}
+
+func (s *RedfishServer) handleMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	file, _, err := r.FormFile("UpdateFile")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "UpdateFile is required"})
+		return
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.writeTaskAccepted(w, s.startUpdateTask("Multipart", func() ([]byte, error) { return data, nil }))
+}
+
+func (s *RedfishServer) handleTask(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	task, ok := s.tasks[r.PathValue("id")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "task not found"})
+		return
+	}
+
+	var messages []map[string]string = make([]map[string]string, 0, len(task.Messages))
+	for _, message := range task.Messages {
+		messages = append(messages, map[string]string{"Message": message})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":       r.URL.Path,
+		"@odata.type":     "#Task.v1_6_0.Task",
+		"Id":              task.ID,
+		"Name":            "Firmware Update Task",
+		"TaskState":       task.State,
+		"TaskStatus":      task.Status,
+		"PercentComplete": task.Percent,
+		"Messages":        messages,
+	})
+}
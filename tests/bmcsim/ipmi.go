@@ -0,0 +1,629 @@
+package bmcsim
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+)
+
+// RMCP+ constants, see the IPMI v2.0 specification sections 13.27 through 13.32
+const (
+	rmcpClassASF  byte = 0x06
+	rmcpClassIPMI byte = 0x07
+
+	authTypeRMCPPlus byte = 0x06
+
+	payloadIPMI        byte = 0x00
+	payloadOpenSession byte = 0x10
+	payloadOpenReply   byte = 0x11
+	payloadRAKP1       byte = 0x12
+	payloadRAKP2       byte = 0x13
+	payloadRAKP3       byte = 0x14
+	payloadRAKP4       byte = 0x15
+
+	// Cipher suite 3 is the only one the simulator implements
+	authAlgHMACSHA1      byte = 0x01
+	integrityHMACSHA196  byte = 0x01
+	cryptAlgAESCBC128    byte = 0x01
+	statusNoCipherMatch  byte = 0x11
+	statusUnauthorized   byte = 0x0d
+	statusInvalidSession byte = 0x02
+	statusBadIntegrity   byte = 0x0f
+
+	netFnChassis   byte = 0x00
+	netFnApp       byte = 0x06
+	netFnTransport byte = 0x0c
+
+	ccOK                byte = 0x00
+	ccParamNotSupported byte = 0x80
+	ccInvalidCommand    byte = 0xc1
+	ccInvalidField      byte = 0xcc
+
+	// The simulated BMC has a single LAN channel
+	lanChannel       byte = 0x01
+	lanParamMAC      byte = 0x05
+	lanParamRevision byte = 0x11
+)
+
+// Chassis control values, IPMI v2.0 section 28.3
+const (
+	ChassisPowerDown    byte = 0x00
+	ChassisPowerUp      byte = 0x01
+	ChassisPowerCycle   byte = 0x02
+	ChassisHardReset    byte = 0x03
+	ChassisSoftShutdown byte = 0x05
+)
+
+var errBadPayload = errors.New("malformed encrypted payload")
+
+// BootFlags is the boot flags parameter last written with Set System Boot Options.
+type BootFlags struct {
+	Valid          bool
+	Persistent     bool
+	EFI            bool
+	DeviceSelector byte
+}
+
+type ipmiSession struct {
+	consoleID   uint32
+	bmcID       uint32
+	consoleRand []byte
+	bmcRand     []byte
+	role        byte
+	username    []byte
+	sik         []byte
+	k1          []byte
+	k2          []byte
+	active      bool
+	sequence    uint32
+}
+
+// IPMIServer is a minimal RMCP+ responder supporting cipher suite 3 and the chassis commands used by
+// the management client.
+type IPMIServer struct {
+	conn     *net.UDPConn
+	username string
+	password string
+	guid     []byte
+
+	lock      sync.Mutex
+	firmware  [2]byte // major, minor
+	mac       net.HardwareAddr
+	powerOn   bool
+	boot      BootFlags
+	controls  []byte
+	sessions  map[uint32]*ipmiSession
+	sessionID uint32
+}
+
+// NewIPMIServer starts a simulated IPMI BMC on a random loopback UDP port.
+func NewIPMIServer(username, password string) (s *IPMIServer, err error) {
+	s = &IPMIServer{
+		username:  username,
+		password:  password,
+		guid:      make([]byte, 16),
+		firmware:  [2]byte{2, 10},
+		mac:       net.HardwareAddr{0xb4, 0x96, 0x91, 0x0a, 0x20, 0x00},
+		sessions:  map[uint32]*ipmiSession{},
+		sessionID: 0x1000,
+	}
+
+	rand.Read(s.guid)
+
+	if s.conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		return
+	}
+
+	go s.serve()
+	return
+}
+
+// Address returns the "host:port" the simulator listens on, usable as a host management IP.
+func (s *IPMIServer) Address() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close shuts the simulator down.
+func (s *IPMIServer) Close() {
+	s.conn.Close()
+}
+
+// PowerOn reports whether the simulated chassis is powered on.
+func (s *IPMIServer) PowerOn() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.powerOn
+}
+
+// SetPowerOn forces the simulated chassis power state.
+func (s *IPMIServer) SetPowerOn(on bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.powerOn = on
+}
+
+// SetFirmwareRevision sets the BMC firmware revision reported by Get Device ID.
+func (s *IPMIServer) SetFirmwareRevision(major, minor byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.firmware = [2]byte{major, minor}
+}
+
+// SetLANMAC sets the MAC address reported for the BMC's LAN channel.
+func (s *IPMIServer) SetLANMAC(mac net.HardwareAddr) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.mac = mac
+}
+
+// BootFlags returns the boot flags last written to the BMC.
+func (s *IPMIServer) BootFlags() BootFlags {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.boot
+}
+
+// ChassisControls returns every chassis control value received, oldest first.
+func (s *IPMIServer) ChassisControls() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]byte(nil), s.controls...)
+}
+
+// ActiveSessions returns the number of established sessions that have not been closed.
+func (s *IPMIServer) ActiveSessions() (count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, session := range s.sessions {
+		if session.active {
+			count++
+		}
+	}
+
+	return
+}
+
+func (s *IPMIServer) serve() {
+	var buffer []byte = make([]byte, 1024)
+
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		if reply := s.handlePacket(append([]byte(nil), buffer[:n]...)); reply != nil {
+			s.conn.WriteToUDP(reply, addr)
+		}
+	}
+}
+
+func hmacSHA1(key []byte, parts ...[]byte) []byte {
+	var mac = hmac.New(sha1.New, key)
+	for _, part := range parts {
+		mac.Write(part)
+	}
+
+	return mac.Sum(nil)
+}
+
+func uint32LE(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// passwordKey pads the password to the 20 byte key used by RAKP-HMAC-SHA1.
+func (s *IPMIServer) passwordKey() []byte {
+	var key []byte = make([]byte, 20)
+	copy(key, s.password)
+	return key
+}
+
+func (s *IPMIServer) handlePacket(packet []byte) []byte {
+	if len(packet) < 5 || packet[0] != 0x06 {
+		return nil
+	}
+
+	switch packet[3] {
+	case rmcpClassASF:
+		return s.handlePresencePing(packet)
+	case rmcpClassIPMI:
+		if packet[4] != authTypeRMCPPlus || len(packet) < 16 {
+			// IPMI v1.5 sessions are not simulated
+			return nil
+		}
+
+		return s.handleSession(packet)
+	}
+
+	return nil
+}
+
+func (s *IPMIServer) handlePresencePing(packet []byte) []byte {
+	// ASF header: IANA (4), message type, tag, reserved, data length
+	if len(packet) < 12 || packet[8] != 0x80 {
+		return nil
+	}
+
+	var pong []byte = []byte{0x06, 0x00, 0xff, rmcpClassASF, 0x00, 0x00, 0x11, 0xbe, 0x40, packet[9], 0x00, 0x10}
+	pong = append(pong, 0x00, 0x00, 0x11, 0xbe) // IANA
+	pong = append(pong, 0x00, 0x00, 0x00, 0x00) // OEM defined
+	pong = append(pong, 0x81, 0x00)             // supported entities (IPMI), interactions
+	pong = append(pong, make([]byte, 6)...)
+	return pong
+}
+
+func (s *IPMIServer) handleSession(packet []byte) []byte {
+	var (
+		payloadType   byte   = packet[5] & 0x3f
+		authenticated bool   = packet[5]&0x40 != 0
+		encrypted     bool   = packet[5]&0x80 != 0
+		sessionID     uint32 = binary.LittleEndian.Uint32(packet[6:10])
+		payloadLength int    = int(binary.LittleEndian.Uint16(packet[14:16]))
+	)
+
+	if len(packet) < 16+payloadLength {
+		return nil
+	}
+
+	var payload []byte = packet[16 : 16+payloadLength]
+
+	switch payloadType {
+	case payloadOpenSession:
+		return s.handleOpenSession(payload)
+	case payloadRAKP1:
+		return s.handleRAKP1(payload)
+	case payloadRAKP3:
+		return s.handleRAKP3(payload)
+	case payloadIPMI:
+		if sessionID == 0 {
+			return s.sessionPacket(nil, payloadIPMI, s.handleIPMI(nil, payload))
+		}
+
+		s.lock.Lock()
+		session, ok := s.sessions[sessionID]
+		s.lock.Unlock()
+
+		if !ok || !session.active {
+			return nil
+		}
+
+		if authenticated {
+			// Trailer: integrity pad, pad length, next header, 12 byte HMAC-SHA1-96
+			var trailerStart int = 16 + payloadLength
+			if len(packet) < trailerStart+14 {
+				return nil
+			}
+
+			var (
+				authCode []byte = packet[len(packet)-12:]
+				expected []byte = hmacSHA1(session.k1, packet[4:len(packet)-12])[:12]
+			)
+
+			if !hmac.Equal(authCode, expected) {
+				return nil
+			}
+		}
+
+		if encrypted {
+			var err error
+			if payload, err = decryptAES(session.k2[:16], payload); err != nil {
+				return nil
+			}
+		}
+
+		return s.sessionPacket(session, payloadIPMI, s.handleIPMI(session, payload))
+	}
+
+	return nil
+}
+
+// sessionPacket wraps a payload in the RMCP and RMCP+ session headers, encrypting and signing it when
+// the session is active.
+func (s *IPMIServer) sessionPacket(session *ipmiSession, payloadType byte, payload []byte) []byte {
+	if payload == nil {
+		return nil
+	}
+
+	var (
+		header   []byte = []byte{authTypeRMCPPlus, payloadType}
+		sequence uint32
+		id       uint32
+	)
+
+	if session != nil && session.active {
+		var err error
+		if payload, err = encryptAES(session.k2[:16], payload); err != nil {
+			return nil
+		}
+
+		header[1] |= 0xc0
+		s.lock.Lock()
+		session.sequence++
+		sequence = session.sequence
+		s.lock.Unlock()
+		id = session.consoleID
+	}
+
+	header = append(header, uint32LE(id)...)
+	header = append(header, uint32LE(sequence)...)
+	header = binary.LittleEndian.AppendUint16(header, uint16(len(payload)))
+
+	var body []byte = append(header, payload...)
+	if session != nil && session.active {
+		var padLength int = (4 - (len(body)+2)%4) % 4
+		body = append(body, bytes.Repeat([]byte{0xff}, padLength)...)
+		body = append(body, byte(padLength), 0x07)
+		body = append(body, hmacSHA1(session.k1, body)[:12]...)
+	}
+
+	return append([]byte{0x06, 0x00, 0xff, rmcpClassIPMI}, body...)
+}
+
+func (s *IPMIServer) handleOpenSession(payload []byte) []byte {
+	if len(payload) < 32 {
+		return nil
+	}
+
+	var (
+		tag       byte   = payload[0]
+		consoleID uint32 = binary.LittleEndian.Uint32(payload[4:8])
+	)
+
+	if payload[12] != authAlgHMACSHA1 || payload[20] != integrityHMACSHA196 || payload[28] != cryptAlgAESCBC128 {
+		reply := append([]byte{tag, statusNoCipherMatch, 0x00, 0x00}, uint32LE(consoleID)...)
+		return s.sessionPacket(nil, payloadOpenReply, reply)
+	}
+
+	s.lock.Lock()
+	s.sessionID++
+	var session *ipmiSession = &ipmiSession{consoleID: consoleID, bmcID: s.sessionID}
+	s.sessions[session.bmcID] = session
+	s.lock.Unlock()
+
+	var reply []byte = []byte{tag, 0x00, 0x04, 0x00}
+	reply = append(reply, uint32LE(consoleID)...)
+	reply = append(reply, uint32LE(session.bmcID)...)
+	reply = append(reply, 0x00, 0x00, 0x00, 0x08, authAlgHMACSHA1, 0x00, 0x00, 0x00)
+	reply = append(reply, 0x01, 0x00, 0x00, 0x08, integrityHMACSHA196, 0x00, 0x00, 0x00)
+	reply = append(reply, 0x02, 0x00, 0x00, 0x08, cryptAlgAESCBC128, 0x00, 0x00, 0x00)
+	return s.sessionPacket(nil, payloadOpenReply, reply)
+}
+
+func (s *IPMIServer) handleRAKP1(payload []byte) []byte {
+	if len(payload) < 28 || len(payload) < 28+int(payload[27]) {
+		return nil
+	}
+
+	var (
+		tag   byte   = payload[0]
+		bmcID uint32 = binary.LittleEndian.Uint32(payload[4:8])
+	)
+
+	s.lock.Lock()
+	session, ok := s.sessions[bmcID]
+	s.lock.Unlock()
+
+	if !ok {
+		return s.sessionPacket(nil, payloadRAKP2, append([]byte{tag, statusInvalidSession, 0x00, 0x00}, uint32LE(0)...))
+	}
+
+	session.consoleRand = append([]byte(nil), payload[8:24]...)
+	session.role = payload[24]
+	session.username = append([]byte(nil), payload[28:28+int(payload[27])]...)
+
+	if string(session.username) != s.username {
+		return s.sessionPacket(nil, payloadRAKP2, append([]byte{tag, statusUnauthorized, 0x00, 0x00}, uint32LE(session.consoleID)...))
+	}
+
+	session.bmcRand = make([]byte, 16)
+	rand.Read(session.bmcRand)
+
+	var nameInfo []byte = append([]byte{session.role, byte(len(session.username))}, session.username...)
+
+	session.sik = hmacSHA1(s.passwordKey(), session.consoleRand, session.bmcRand, nameInfo)
+	session.k1 = hmacSHA1(session.sik, bytes.Repeat([]byte{0x01}, 20))
+	session.k2 = hmacSHA1(session.sik, bytes.Repeat([]byte{0x02}, 20))
+
+	var authCode []byte = hmacSHA1(s.passwordKey(), uint32LE(session.consoleID), uint32LE(session.bmcID), session.consoleRand, session.bmcRand, s.guid, nameInfo)
+
+	var reply []byte = []byte{tag, 0x00, 0x00, 0x00}
+	reply = append(reply, uint32LE(session.consoleID)...)
+	reply = append(reply, session.bmcRand...)
+	reply = append(reply, s.guid...)
+	reply = append(reply, authCode...)
+	return s.sessionPacket(nil, payloadRAKP2, reply)
+}
+
+func (s *IPMIServer) handleRAKP3(payload []byte) []byte {
+	if len(payload) < 8 {
+		return nil
+	}
+
+	var (
+		tag   byte   = payload[0]
+		bmcID uint32 = binary.LittleEndian.Uint32(payload[4:8])
+	)
+
+	s.lock.Lock()
+	session, ok := s.sessions[bmcID]
+	s.lock.Unlock()
+
+	if !ok || session.sik == nil {
+		return s.sessionPacket(nil, payloadRAKP4, append([]byte{tag, statusInvalidSession, 0x00, 0x00}, uint32LE(0)...))
+	}
+
+	var expected []byte = hmacSHA1(s.passwordKey(), session.bmcRand, uint32LE(session.consoleID), []byte{session.role, byte(len(session.username))}, session.username)
+	if !hmac.Equal(payload[8:], expected) {
+		return s.sessionPacket(nil, payloadRAKP4, append([]byte{tag, statusBadIntegrity, 0x00, 0x00}, uint32LE(session.consoleID)...))
+	}
+
+	var reply []byte = []byte{tag, 0x00, 0x00, 0x00}
+	reply = append(reply, uint32LE(session.consoleID)...)
+	reply = append(reply, hmacSHA1(session.sik, session.consoleRand, uint32LE(session.bmcID), s.guid)[:12]...)
+
+	var packet []byte = s.sessionPacket(nil, payloadRAKP4, reply)
+
+	s.lock.Lock()
+	session.active = true
+	s.lock.Unlock()
+
+	return packet
+}
+
+// handleIPMI answers a single IPMI request message, see IPMI v2.0 section 13.8.
+func (s *IPMIServer) handleIPMI(session *ipmiSession, message []byte) []byte {
+	if len(message) < 7 {
+		return nil
+	}
+
+	var (
+		netFn   byte   = message[1] >> 2
+		command byte   = message[5]
+		data    []byte = message[6 : len(message)-1]
+	)
+
+	completion, responseData := s.handleCommand(session, netFn, command, data)
+
+	var response []byte = []byte{message[3], (netFn+1)<<2 | message[4]&0x03, 0x00, message[0], message[4]&0xfc | message[1]&0x03, command, completion}
+	response[2] = checksum(response[0:2])
+	response = append(response, responseData...)
+	return append(response, checksum(response[3:]))
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+
+	return -sum
+}
+
+func (s *IPMIServer) handleCommand(session *ipmiSession, netFn, command byte, data []byte) (completion byte, response []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case netFn == netFnApp && command == 0x38: // Get Channel Authentication Capabilities
+		return ccOK, []byte{0x01, 0x80, 0x04, 0x02, 0x00, 0x00, 0x00, 0x00}
+	case session == nil:
+		// Everything else requires an established session
+		return ccInvalidCommand, nil
+	case netFn == netFnApp && command == 0x01: // Get Device ID
+		// The minor revision is BCD encoded, the auxiliary revision is left empty
+		var minorBCD byte = (s.firmware[1]/10)<<4 | s.firmware[1]%10
+		return ccOK, []byte{0x20, 0x81, s.firmware[0] & 0x7f, minorBCD, 0x02, 0xbf, 0xa2, 0x02, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	case netFn == netFnApp && command == 0x3b: // Set Session Privilege Level
+		var level byte = 0x04
+		if len(data) > 0 && data[0] != 0 {
+			level = data[0]
+		}
+
+		return ccOK, []byte{level}
+	case netFn == netFnApp && command == 0x3c: // Close Session
+		delete(s.sessions, session.bmcID)
+		return ccOK, nil
+	case netFn == netFnChassis && command == 0x01: // Get Chassis Status
+		var current byte
+		if s.powerOn {
+			current = 0x01
+		}
+
+		return ccOK, []byte{current, 0x00, 0x40}
+	case netFn == netFnChassis && command == 0x02: // Chassis Control
+		if len(data) < 1 {
+			return 0xcc, nil
+		}
+
+		switch data[0] {
+		case ChassisPowerDown, ChassisSoftShutdown:
+			s.powerOn = false
+		case ChassisPowerUp, ChassisPowerCycle, ChassisHardReset:
+			s.powerOn = true
+		default:
+			return 0xcc, nil
+		}
+
+		s.controls = append(s.controls, data[0])
+		return ccOK, nil
+	case netFn == netFnChassis && command == 0x08: // Set System Boot Options
+		if len(data) >= 3 && data[0]&0x7f == 0x05 {
+			s.boot = BootFlags{
+				Valid:          data[1]&0x80 != 0,
+				Persistent:     data[1]&0x40 != 0,
+				EFI:            data[1]&0x20 != 0,
+				DeviceSelector: (data[2] >> 2) & 0x0f,
+			}
+		}
+
+		return ccOK, nil
+	case netFn == netFnTransport && command == 0x02: // Get LAN Configuration Parameters
+		if len(data) < 2 || data[0]&0x0f != lanChannel {
+			return ccInvalidField, nil
+		} else if data[1] != lanParamMAC {
+			return ccParamNotSupported, nil
+		}
+
+		return ccOK, append([]byte{lanParamRevision}, s.mac...)
+	}
+
+	return ccInvalidCommand, nil
+}
+
+// encryptAES pads and encrypts a payload with AES-CBC-128, prefixing the random IV.
+func encryptAES(key, plain []byte) (out []byte, err error) {
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+
+	var padLength int = (aes.BlockSize - (len(plain)+1)%aes.BlockSize) % aes.BlockSize
+	var padded []byte = append([]byte(nil), plain...)
+	for i := 1; i <= padLength; i++ {
+		padded = append(padded, byte(i))
+	}
+
+	padded = append(padded, byte(padLength))
+
+	var iv []byte = make([]byte, aes.BlockSize)
+	rand.Read(iv)
+
+	out = append(out, iv...)
+	var encrypted []byte = make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+	out = append(out, encrypted...)
+	return
+}
+
+// decryptAES reverses encryptAES.
+func decryptAES(key, data []byte) (plain []byte, err error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		err = errBadPayload
+		return
+	}
+
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+
+	var decrypted []byte = make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(decrypted, data[aes.BlockSize:])
+
+	var padLength int = int(decrypted[len(decrypted)-1])
+	if padLength+1 > len(decrypted) {
+		err = errBadPayload
+		return
+	}
+
+	plain = decrypted[:len(decrypted)-padLength-1]
+	return
+}
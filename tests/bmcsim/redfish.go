@@ -0,0 +1,638 @@
+// Package bmcsim provides in-process Redfish and IPMI BMC simulators so management code can be tested
+// without real hardware.
+package bmcsim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Redfish power states reported by the simulator
+const (
+	PowerOn  = "On"
+	PowerOff = "Off"
+)
+
+// Hardware describes the inventory a simulated BMC reports.
+type Hardware struct {
+	Manufacturer    string
+	Model           string
+	SerialNumber    string
+	CPUManufacturer string
+	CPUModel        string
+	CPUCount        int
+	ThreadsPerCPU   int
+	CPUSpeedMHz     int
+	CPUMaxSpeedMHz  int
+	DIMMCount       int
+	DIMMSizeGiB     int
+	DIMMSpeedMHz    int
+	VolumeSizesGiB  []int
+	Drives          []Drive
+	NICs            []NIC
+}
+
+// Drive is a physical disk reported under the simulated storage controller.
+type Drive struct {
+	ID               string
+	Model            string
+	SerialNumber     string
+	MediaType        string
+	Protocol         string
+	CapacityGiB      int
+	FailurePredicted bool
+}
+
+// NIC is a network interface reported under the simulated system's EthernetInterfaces.
+type NIC struct {
+	ID         string
+	MACAddress string
+	SpeedMbps  int
+	LinkUp     bool
+}
+
+// DefaultHardware returns a modest two socket server.
+func DefaultHardware() Hardware {
+	return Hardware{
+		Manufacturer:    "Dell Inc.",
+		Model:           "PowerEdge R650",
+		SerialNumber:    "SIM0001",
+		CPUManufacturer: "Intel(R) Corporation",
+		CPUModel:        "Intel(R) Xeon(R) Gold 6338 CPU @ 2.00GHz",
+		CPUCount:        2,
+		ThreadsPerCPU:   64,
+		CPUSpeedMHz:     2000,
+		CPUMaxSpeedMHz:  3200,
+		DIMMCount:       16,
+		DIMMSizeGiB:     32,
+		DIMMSpeedMHz:    3200,
+		VolumeSizesGiB:  []int{480, 1920},
+		Drives: []Drive{
+			{ID: "Disk.Bay.0", Model: "MZ7L3480HCHQ", SerialNumber: "S6KMNE0R100001", MediaType: "SSD", Protocol: "SATA", CapacityGiB: 480},
+			{ID: "Disk.Bay.1", Model: "MZ7L3480HCHQ", SerialNumber: "S6KMNE0R100002", MediaType: "SSD", Protocol: "SATA", CapacityGiB: 480},
+			{ID: "Disk.Bay.2", Model: "ST2000NX0463", SerialNumber: "W46200A1", MediaType: "HDD", Protocol: "SAS", CapacityGiB: 1920},
+		},
+		NICs: []NIC{
+			{ID: "NIC.Integrated.1-1-1", MACAddress: "B4:96:91:0A:10:01", SpeedMbps: 25000, LinkUp: true},
+			{ID: "NIC.Integrated.1-2-1", MACAddress: "B4:96:91:0A:10:02", SpeedMbps: 25000, LinkUp: false},
+		},
+	}
+}
+
+// BootOverride is the one-time boot configuration last written to the simulated system.
+type BootOverride struct {
+	Target  string
+	Enabled string
+	Mode    string
+}
+
+// RedfishServer is an in-memory Redfish service exposing a single system and chassis over TLS.
+type RedfishServer struct {
+	server   *httptest.Server
+	username string
+	password string
+	hardware Hardware
+
+	lock        sync.Mutex
+	powerState  string
+	boot        BootOverride
+	resets      []string
+	sessions    map[string]string // token -> session ID
+	sessionSeq  int
+	maxSessions int
+
+	subscriptions       map[string]eventSubscription
+	subscriptionSeq     int
+	rejectSubscriptions bool
+	eventSeq            int
+
+	firmware        []*firmwareComponent
+	firmwareUpdates map[string]int
+	tasks           map[string]*updateTask
+	taskSeq         int
+
+	bios             map[string]any
+	biosPending      map[string]any
+	biosResetPending bool
+	biosResets       int
+}
+
+// NewRedfishServer starts a simulated Redfish BMC accepting the given credentials.
+func NewRedfishServer(username, password string, hardware Hardware) (s *RedfishServer) {
+	s = &RedfishServer{
+		username:   username,
+		password:   password,
+		hardware:   hardware,
+		powerState: PowerOff,
+		boot:       BootOverride{Target: "None", Enabled: "Disabled", Mode: "UEFI"},
+		sessions:   map[string]string{},
+
+		subscriptions: map[string]eventSubscription{},
+
+		firmware:        defaultFirmware(),
+		firmwareUpdates: map[string]int{},
+		tasks:           map[string]*updateTask{},
+
+		bios:        defaultBIOSAttributes(),
+		biosPending: map[string]any{},
+	}
+
+	var mux *http.ServeMux = http.NewServeMux()
+	mux.HandleFunc("GET /redfish/v1", s.handleServiceRoot)
+	mux.HandleFunc("GET /redfish/v1/{$}", s.handleServiceRoot)
+	mux.HandleFunc("POST /redfish/v1/SessionService/Sessions", s.handleSessionCreate)
+	mux.HandleFunc("DELETE /redfish/v1/SessionService/Sessions/{id}", s.authenticated(s.handleSessionDelete))
+	mux.HandleFunc("GET /redfish/v1/EventService", s.authenticated(s.handleEventService))
+	mux.HandleFunc("GET /redfish/v1/EventService/Subscriptions", s.authenticated(s.handleSubscriptionCollection))
+	mux.HandleFunc("POST /redfish/v1/EventService/Subscriptions", s.authenticated(s.handleSubscriptionCreate))
+	mux.HandleFunc("GET /redfish/v1/EventService/Subscriptions/{id}", s.authenticated(s.handleSubscription))
+	mux.HandleFunc("DELETE /redfish/v1/EventService/Subscriptions/{id}", s.authenticated(s.handleSubscriptionDelete))
+	mux.HandleFunc("GET /redfish/v1/UpdateService", s.authenticated(s.handleUpdateService))
+	mux.HandleFunc("GET /redfish/v1/UpdateService/FirmwareInventory", s.authenticated(s.handleFirmwareInventoryCollection))
+	mux.HandleFunc("GET /redfish/v1/UpdateService/FirmwareInventory/{id}", s.authenticated(s.handleFirmwareInventory))
+	mux.HandleFunc("POST /redfish/v1/UpdateService/Actions/UpdateService.SimpleUpdate", s.authenticated(s.handleSimpleUpdate))
+	mux.HandleFunc("POST /redfish/v1/UpdateService/MultipartUpload", s.authenticated(s.handleMultipartUpload))
+	mux.HandleFunc("GET /redfish/v1/TaskService/Tasks/{id}", s.authenticated(s.handleTask))
+	mux.HandleFunc("GET /redfish/v1/Chassis", s.authenticated(s.handleChassisCollection))
+	mux.HandleFunc("GET /redfish/v1/Chassis/1", s.authenticated(s.handleChassis))
+	mux.HandleFunc("GET /redfish/v1/Systems", s.authenticated(s.handleSystemCollection))
+	mux.HandleFunc("GET /redfish/v1/Systems/1", s.authenticated(s.handleSystem))
+	mux.HandleFunc("PATCH /redfish/v1/Systems/1", s.authenticated(s.handleSystemPatch))
+	mux.HandleFunc("POST /redfish/v1/Systems/1/Actions/ComputerSystem.Reset", s.authenticated(s.handleReset))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Bios", s.authenticated(s.handleBIOS))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Bios/Settings", s.authenticated(s.handleBIOSSettings))
+	mux.HandleFunc("PATCH /redfish/v1/Systems/1/Bios/Settings", s.authenticated(s.handleBIOSSettingsPatch))
+	mux.HandleFunc("POST /redfish/v1/Systems/1/Bios/Actions/Bios.ResetBios", s.authenticated(s.handleBIOSReset))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Processors", s.authenticated(s.handleProcessorCollection))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Processors/{id}", s.authenticated(s.handleProcessor))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Memory", s.authenticated(s.handleMemoryCollection))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Memory/{id}", s.authenticated(s.handleMemory))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Storage", s.authenticated(s.handleStorageCollection))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Storage/1", s.authenticated(s.handleStorage))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Storage/1/Volumes", s.authenticated(s.handleVolumeCollection))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Storage/1/Volumes/{id}", s.authenticated(s.handleVolume))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/Storage/1/Drives/{id}", s.authenticated(s.handleDrive))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/EthernetInterfaces", s.authenticated(s.handleEthernetInterfaceCollection))
+	mux.HandleFunc("GET /redfish/v1/Systems/1/EthernetInterfaces/{id}", s.authenticated(s.handleEthernetInterface))
+
+	s.server = httptest.NewTLSServer(mux)
+	return
+}
+
+// Address returns the "host:port" the simulator listens on, usable as a host management IP.
+func (s *RedfishServer) Address() string {
+	return s.server.Listener.Addr().String()
+}
+
+// Close shuts the simulator down.
+func (s *RedfishServer) Close() {
+	s.server.Close()
+}
+
+// PowerState returns the current simulated power state.
+func (s *RedfishServer) PowerState() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.powerState
+}
+
+// SetPowerState forces the simulated power state, as if the power button had been pressed, and notifies
+// event subscribers.
+func (s *RedfishServer) SetPowerState(state string) {
+	s.lock.Lock()
+	s.powerState = state
+	s.lock.Unlock()
+
+	s.emitPowerEvent(state)
+}
+
+// BootOverride returns the boot override last written to the system.
+func (s *RedfishServer) BootOverride() BootOverride {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.boot
+}
+
+// Resets returns every reset type received, oldest first.
+func (s *RedfishServer) Resets() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.resets...)
+}
+
+// SetMaxSessions limits how many sessions may be open at once, like older BMCs with few session slots.
+// Zero removes the limit.
+func (s *RedfishServer) SetMaxSessions(limit int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.maxSessions = limit
+}
+
+// SetNICs replaces the system's network interfaces, as if cards had been swapped.
+func (s *RedfishServer) SetNICs(nics []NIC) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hardware.NICs = append([]NIC(nil), nics...)
+}
+
+func (s *RedfishServer) nics() []NIC {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.hardware.NICs
+}
+
+// SessionLogins returns how many sessions have been created since the simulator started.
+func (s *RedfishServer) SessionLogins() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.sessionSeq
+}
+
+// ActiveSessions returns the number of sessions that have not been logged out.
+func (s *RedfishServer) ActiveSessions() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.sessions)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func link(path string) map[string]string {
+	return map[string]string{"@odata.id": path}
+}
+
+func collection(path, name string, members []string) map[string]any {
+	var links []map[string]string = make([]map[string]string, 0, len(members))
+	for _, member := range members {
+		links = append(links, link(member))
+	}
+
+	return map[string]any{
+		"@odata.id":           path,
+		"Name":                name,
+		"Members":             links,
+		"Members@odata.count": len(links),
+	}
+}
+
+func (s *RedfishServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		_, ok := s.sessions[r.Header.Get("X-Auth-Token")]
+		s.lock.Unlock()
+
+		if !ok {
+			if user, pass, basic := r.BasicAuth(); !basic || user != s.username || pass != s.password {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *RedfishServer) handleServiceRoot(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":      "/redfish/v1",
+		"Id":             "RootService",
+		"Name":           "Root Service",
+		"RedfishVersion": "1.15.0",
+		"Vendor":         s.hardware.Manufacturer,
+		"Product":        s.hardware.Model,
+		"Chassis":        link("/redfish/v1/Chassis"),
+		"Systems":        link("/redfish/v1/Systems"),
+		"SessionService": link("/redfish/v1/SessionService"),
+		"EventService":   link("/redfish/v1/EventService"),
+		"UpdateService":  link("/redfish/v1/UpdateService"),
+		"TaskService":    link("/redfish/v1/TaskService"),
+		"Links": map[string]any{
+			"Sessions": link("/redfish/v1/SessionService/Sessions"),
+		},
+	})
+}
+
+func (s *RedfishServer) handleSessionCreate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserName string
+		Password string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if body.UserName != s.username || body.Password != s.password {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+		return
+	}
+
+	var raw []byte = make([]byte, 16)
+	rand.Read(raw)
+
+	s.lock.Lock()
+	if s.maxSessions > 0 && len(s.sessions) >= s.maxSessions {
+		s.lock.Unlock()
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "no session slots available"})
+		return
+	}
+
+	s.sessionSeq++
+	var (
+		token string = hex.EncodeToString(raw)
+		id    string = fmt.Sprintf("%d", s.sessionSeq)
+		path  string = "/redfish/v1/SessionService/Sessions/" + id
+	)
+	s.sessions[token] = id
+	s.lock.Unlock()
+
+	w.Header().Set("X-Auth-Token", token)
+	w.Header().Set("Location", path)
+	writeJSON(w, http.StatusCreated, map[string]any{"@odata.id": path, "Id": id, "UserName": body.UserName})
+}
+
+func (s *RedfishServer) handleSessionDelete(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	for token, id := range s.sessions {
+		if id == r.PathValue("id") {
+			delete(s.sessions, token)
+		}
+	}
+	s.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RedfishServer) handleChassisCollection(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collection("/redfish/v1/Chassis", "Chassis Collection", []string{"/redfish/v1/Chassis/1"}))
+}
+
+func (s *RedfishServer) handleChassis(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":    "/redfish/v1/Chassis/1",
+		"Id":           "1",
+		"Name":         "Chassis",
+		"ChassisType":  "RackMount",
+		"Manufacturer": s.hardware.Manufacturer,
+		"Model":        s.hardware.Model,
+		"SerialNumber": s.hardware.SerialNumber,
+		"PowerState":   s.powerState,
+		"Links": map[string]any{
+			"ComputerSystems": []map[string]string{link("/redfish/v1/Systems/1")},
+		},
+	})
+}
+
+func (s *RedfishServer) handleSystemCollection(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collection("/redfish/v1/Systems", "Computer System Collection", []string{"/redfish/v1/Systems/1"}))
+}
+
+func (s *RedfishServer) handleSystem(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":    "/redfish/v1/Systems/1",
+		"Id":           "1",
+		"Name":         "System",
+		"SystemType":   "Physical",
+		"Manufacturer": s.hardware.Manufacturer,
+		"Model":        s.hardware.Model,
+		"SerialNumber": s.hardware.SerialNumber,
+		"PowerState":   s.powerState,
+		"Boot": map[string]any{
+			"BootSourceOverrideTarget":  s.boot.Target,
+			"BootSourceOverrideEnabled": s.boot.Enabled,
+			"BootSourceOverrideMode":    s.boot.Mode,
+		},
+		"ProcessorSummary": map[string]any{
+			"Count":                 s.hardware.CPUCount,
+			"LogicalProcessorCount": s.hardware.CPUCount * s.hardware.ThreadsPerCPU,
+			"Model":                 s.hardware.CPUModel,
+		},
+		"MemorySummary": map[string]any{
+			"TotalSystemMemoryGiB": s.hardware.DIMMCount * s.hardware.DIMMSizeGiB,
+		},
+		"Processors":         link("/redfish/v1/Systems/1/Processors"),
+		"Memory":             link("/redfish/v1/Systems/1/Memory"),
+		"Storage":            link("/redfish/v1/Systems/1/Storage"),
+		"EthernetInterfaces": link("/redfish/v1/Systems/1/EthernetInterfaces"),
+		"Bios":               link("/redfish/v1/Systems/1/Bios"),
+		"Actions": map[string]any{
+			"#ComputerSystem.Reset": map[string]any{
+				"target":                            "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset",
+				"ResetType@Redfish.AllowableValues": []string{"On", "ForceOff", "GracefulShutdown", "GracefulRestart", "ForceRestart", "PowerCycle"},
+			},
+		},
+	})
+}
+
+func (s *RedfishServer) handleSystemPatch(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Boot *struct {
+			BootSourceOverrideTarget  string
+			BootSourceOverrideEnabled string
+			BootSourceOverrideMode    string
+		}
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if body.Boot != nil {
+		s.lock.Lock()
+		s.boot = BootOverride{
+			Target:  body.Boot.BootSourceOverrideTarget,
+			Enabled: body.Boot.BootSourceOverrideEnabled,
+			Mode:    body.Boot.BootSourceOverrideMode,
+		}
+		s.lock.Unlock()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *RedfishServer) handleReset(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ResetType string
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var state string
+	switch body.ResetType {
+	case "On", "GracefulRestart", "ForceRestart", "PowerCycle":
+		state = PowerOn
+	case "ForceOff", "GracefulShutdown":
+		state = PowerOff
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported reset type " + body.ResetType})
+		return
+	}
+
+	s.lock.Lock()
+	s.powerState = state
+	s.resets = append(s.resets, body.ResetType)
+	if state == PowerOn {
+		s.applyPendingBIOS()
+	}
+	s.lock.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+	s.emitPowerEvent(state)
+}
+
+func indexedMembers(base string, count int) (members []string) {
+	for i := 1; i <= count; i++ {
+		members = append(members, fmt.Sprintf("%s/%d", base, i))
+	}
+
+	return
+}
+
+func (s *RedfishServer) handleProcessorCollection(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Processors Collection", indexedMembers("/redfish/v1/Systems/1/Processors", s.hardware.CPUCount)))
+}
+
+func (s *RedfishServer) handleProcessor(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":         r.URL.Path,
+		"Id":                r.PathValue("id"),
+		"ProcessorType":     "CPU",
+		"Manufacturer":      s.hardware.CPUManufacturer,
+		"Model":             s.hardware.CPUModel,
+		"OperatingSpeedMHz": s.hardware.CPUSpeedMHz,
+		"MaxSpeedMHz":       s.hardware.CPUMaxSpeedMHz,
+		"TotalThreads":      s.hardware.ThreadsPerCPU,
+	})
+}
+
+func (s *RedfishServer) handleMemoryCollection(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Memory Collection", indexedMembers("/redfish/v1/Systems/1/Memory", s.hardware.DIMMCount)))
+}
+
+func (s *RedfishServer) handleMemory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":         r.URL.Path,
+		"Id":                r.PathValue("id"),
+		"MemoryDeviceType":  "DDR4",
+		"CapacityMiB":       s.hardware.DIMMSizeGiB * 1024,
+		"OperatingSpeedMhz": s.hardware.DIMMSpeedMHz,
+	})
+}
+
+func (s *RedfishServer) handleStorageCollection(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Storage Collection", []string{"/redfish/v1/Systems/1/Storage/1"}))
+}
+
+func (s *RedfishServer) handleStorage(w http.ResponseWriter, r *http.Request) {
+	var drives []map[string]string = make([]map[string]string, 0, len(s.hardware.Drives))
+	for _, drive := range s.hardware.Drives {
+		drives = append(drives, link("/redfish/v1/Systems/1/Storage/1/Drives/"+drive.ID))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id": r.URL.Path,
+		"Id":        "1",
+		"Name":      "Storage Controller",
+		"Volumes":   link("/redfish/v1/Systems/1/Storage/1/Volumes"),
+		"Drives":    drives,
+	})
+}
+
+func (s *RedfishServer) handleVolumeCollection(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Volume Collection", indexedMembers("/redfish/v1/Systems/1/Storage/1/Volumes", len(s.hardware.VolumeSizesGiB))))
+}
+
+func (s *RedfishServer) handleVolume(w http.ResponseWriter, r *http.Request) {
+	var index int
+	if _, err := fmt.Sscanf(r.PathValue("id"), "%d", &index); err != nil || index < 1 || index > len(s.hardware.VolumeSizesGiB) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such volume"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"@odata.id":     r.URL.Path,
+		"Id":            r.PathValue("id"),
+		"Name":          "Volume " + r.PathValue("id"),
+		"VolumeType":    "RawDevice",
+		"CapacityBytes": int64(s.hardware.VolumeSizesGiB[index-1]) * 1024 * 1024 * 1024,
+	})
+}
+
+func (s *RedfishServer) handleEthernetInterfaceCollection(w http.ResponseWriter, r *http.Request) {
+	var members []string
+	for _, nic := range s.nics() {
+		members = append(members, "/redfish/v1/Systems/1/EthernetInterfaces/"+nic.ID)
+	}
+
+	writeJSON(w, http.StatusOK, collection(r.URL.Path, "Ethernet Interface Collection", members))
+}
+
+func (s *RedfishServer) handleEthernetInterface(w http.ResponseWriter, r *http.Request) {
+	for _, nic := range s.nics() {
+		if nic.ID != r.PathValue("id") {
+			continue
+		}
+
+		var linkStatus string = "LinkDown"
+		if nic.LinkUp {
+			linkStatus = "LinkUp"
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.id":           r.URL.Path,
+			"Id":                  nic.ID,
+			"Name":                "Ethernet Interface " + nic.ID,
+			"MACAddress":          nic.MACAddress,
+			"PermanentMACAddress": nic.MACAddress,
+			"SpeedMbps":           nic.SpeedMbps,
+			"LinkStatus":          linkStatus,
+			"InterfaceEnabled":    true,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such ethernet interface"})
+}
+
+func (s *RedfishServer) handleDrive(w http.ResponseWriter, r *http.Request) {
+	for _, drive := range s.hardware.Drives {
+		if drive.ID != r.PathValue("id") {
+			continue
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"@odata.id":        r.URL.Path,
+			"Id":               drive.ID,
+			"Name":             "Drive " + drive.ID,
+			"Model":            drive.Model,
+			"SerialNumber":     drive.SerialNumber,
+			"MediaType":        drive.MediaType,
+			"Protocol":         drive.Protocol,
+			"CapacityBytes":    int64(drive.CapacityGiB) * 1024 * 1024 * 1024,
+			"FailurePredicted": drive.FailurePredicted,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such drive"})
+}
@@ -0,0 +1,284 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestPersistentBookingCarts(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	config.Config.Carts.TTLMinutes = 30
+
+	auth.AddUserInjection("cora", "cora", auth.AuthPermsBookingCreator)
+	auth.AddUserInjection("cory", "cory", auth.AuthPermsBookingCreator)
+
+	var (
+		baseURL string = "http://" + config.Config.WebServer.Address
+		cookies        = map[string][]*http.Cookie{}
+	)
+
+	for _, username := range []string{"cora", "cory"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+		defer db.ResetBookingCart(username)
+	}
+
+	for _, ip := range []string{"10.0.16.1", "10.0.16.2"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	addHost := func(t *testing.T, username, payload string, expected int) {
+		status, body, err := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", payload, cookies[username])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d adding %s for %s, got %d: %v %s", expected, payload, username, status, err, body)
+		}
+	}
+
+	snapshot := func(t *testing.T) (cart db.BookingCart) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/bookings/cart", cookies["cora"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Cart snapshot failed (%d): %v %s", status, err, body)
+		}
+
+		if err = json.Unmarshal([]byte(body), &cart); err != nil {
+			t.Fatalf("Failed to unmarshal cart: %v", err)
+		}
+
+		return
+	}
+
+	var expiresAt time.Time
+
+	t.Run("Carts expire after the TTL and activity pushes it back", func(t *testing.T) {
+		var before time.Time = time.Now()
+		addHost(t, "cora", `{"management_ip":"10.0.16.1"}`, fiber.StatusOK)
+
+		cart := snapshot(t)
+		if cart.ExpiresAt.Before(before.Add(30*time.Minute)) || cart.ExpiresAt.After(time.Now().Add(30*time.Minute)) {
+			t.Fatalf("Expected the cart to expire in 30 minutes, got %s", cart.ExpiresAt)
+		}
+
+		config.Config.Carts.TTLMinutes = 60
+		addHost(t, "cora", `{"management_ip":"10.0.16.2","iso_selection":""}`, fiber.StatusOK)
+
+		if expiresAt = snapshot(t).ExpiresAt; !expiresAt.After(cart.ExpiresAt.Add(29 * time.Minute)) {
+			t.Fatalf("Expected adding a host to push the expiry back, got %s after %s", expiresAt, cart.ExpiresAt)
+		}
+	})
+
+	t.Run("Carts survive a restart", func(t *testing.T) {
+		if err := db.CloseDB(); err != nil {
+			t.Fatalf("Failed to close DB: %v", err)
+		}
+
+		if err := db.InitDB(); err != nil {
+			t.Fatalf("Failed to reopen DB: %v", err)
+		}
+
+		cart, err := db.BookingCartSnapshot("cora")
+		if err != nil || len(cart.Hosts) != 2 || !cart.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("Expected the cart to be restored, got %+v (%v)", cart, err)
+		}
+
+		addHost(t, "cory", `{"management_ip":"10.0.16.1"}`, fiber.StatusConflict)
+
+		if err = db.RemoveHostFromCart("cora", "10.0.16.2"); err != nil {
+			t.Fatalf("Failed to remove host from cart: %v", err)
+		}
+
+		addHost(t, "cory", `{"management_ip":"10.0.16.2"}`, fiber.StatusOK)
+	})
+
+	t.Run("The sweeper releases expired carts", func(t *testing.T) {
+		cart, err := db.BookingCartSnapshot("cora")
+		if err != nil {
+			t.Fatalf("Failed to snapshot cart: %v", err)
+		}
+
+		if expired, err := db.ExpireBookingCarts(cart.ExpiresAt.Add(-time.Second)); err != nil || len(expired) != 0 {
+			t.Fatalf("Expected no cart to expire early, got %v (%v)", expired, err)
+		}
+
+		expired, err := db.ExpireBookingCarts(cart.ExpiresAt)
+		if err != nil || !slices.Contains(expired, "cora") || slices.Contains(expired, "cory") {
+			t.Fatalf("Expected only cora's cart to expire, got %v (%v)", expired, err)
+		}
+
+		if _, err = db.BookingCartSnapshot("cora"); !errors.Is(err, db.ErrCartNotFound) {
+			t.Fatalf("Expected the cart to be gone, got %v", err)
+		}
+
+		addHost(t, "cory", `{"management_ip":"10.0.16.1"}`, fiber.StatusOK)
+
+		if err = db.CloseDB(); err != nil {
+			t.Fatalf("Failed to close DB: %v", err)
+		}
+
+		if err = db.InitDB(); err != nil {
+			t.Fatalf("Failed to reopen DB: %v", err)
+		}
+
+		if _, err = db.BookingCartSnapshot("cora"); !errors.Is(err, db.ErrCartNotFound) {
+			t.Fatalf("Expected the expired cart to stay gone after a restart, got %v", err)
+		}
+
+		if cart, err = db.BookingCartSnapshot("cory"); err != nil || len(cart.Hosts) != 2 {
+			t.Fatalf("Expected cory's cart to be restored, got %+v (%v)", cart, err)
+		}
+	})
+}
+
+func TestBookingCartResources(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	config.Config.Proxmox.Templates = []string{"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst"}
+	config.Config.Proxmox.CapacityCores = 4
+
+	auth.AddUserInjection("cade", "cade", auth.AuthPermsBookingCreator)
+	defer db.ResetBookingCart("cade")
+
+	if err := db.StoredISOImages.Insert(&db.StoredISOImage{Name: "debian.iso"}); err != nil {
+		t.Fatalf("Failed to insert ISO: %v", err)
+	}
+
+	var baseURL string = "http://" + config.Config.WebServer.Address
+
+	cookies, err := loginAndGetCookies(t, "cade", "cade")
+	if err != nil {
+		t.Fatalf("Failed to login as cade: %v", err)
+	}
+
+	send := func(t *testing.T, method, path, payload string, expected int) (cart db.BookingCart) {
+		var (
+			status int
+			body   string
+			err    error
+		)
+
+		switch method {
+		case http.MethodPost:
+			status, body, err = makeHTTPPostRequest(t, baseURL+path, payload, cookies)
+		case http.MethodPut:
+			status, body, err = makeHTTPPutRequest(t, baseURL+path, payload, cookies)
+		case http.MethodDelete:
+			status, body, err = makeHTTPDeleteRequest(t, baseURL+path, cookies)
+		}
+
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s %s, got %d: %v %s", expected, method, path, status, err, body)
+		}
+
+		if status == fiber.StatusOK {
+			json.Unmarshal([]byte(body), &cart)
+		}
+
+		return
+	}
+
+	t.Run("Templates and ISOs are listed", func(t *testing.T) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/bookings/cart/templates", cookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Templates failed (%d): %v %s", status, err, body)
+		}
+
+		var options struct {
+			Templates []string `json:"templates"`
+			ISOs      []string `json:"isos"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &options); err != nil || !slices.Equal(options.Templates, config.Config.Proxmox.Templates) || !slices.Equal(options.ISOs, []string{"debian.iso"}) {
+			t.Fatalf("Unexpected options %s: %v", body, err)
+		}
+	})
+
+	t.Run("Containers and VMs are validated", func(t *testing.T) {
+		send(t, http.MethodPost, "/api/bookings/cart/containers", `{"template":"local:vztmpl/unknown.tar.zst","cores":1,"memory_mb":512,"disk_gb":8}`, fiber.StatusBadRequest)
+		send(t, http.MethodPost, "/api/bookings/cart/containers", `{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":0,"memory_mb":512,"disk_gb":8}`, fiber.StatusBadRequest)
+		send(t, http.MethodPost, "/api/bookings/cart/containers", `{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":1,"memory_mb":512,"disk_gb":8}`, fiber.StatusBadRequest)
+		send(t, http.MethodPost, "/api/bookings/cart/containers", `{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":1,"memory_mb":512,"disk_gb":8,"ssh_public_key":"not a key"}`, fiber.StatusBadRequest)
+		send(t, http.MethodPost, "/api/bookings/cart/vms", `{"iso_selection":"missing.iso","cores":1,"memory_mb":1024,"disk_gb":16}`, fiber.StatusBadRequest)
+
+		if cart := send(t, http.MethodPost, "/api/bookings/cart/containers", `{"name":"web","template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":2,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}`, fiber.StatusOK); len(cart.Containers) != 1 || cart.Containers[0].Name != "web" {
+			t.Fatalf("Expected the container in the cart, got %+v", cart)
+		}
+
+		if cart := send(t, http.MethodPost, "/api/bookings/cart/vms", `{"name":"db","iso_selection":"debian.iso","cores":2,"memory_mb":1024,"disk_gb":16}`, fiber.StatusOK); len(cart.VMs) != 1 || len(cart.Containers) != 1 {
+			t.Fatalf("Expected the VM in the cart, got %+v", cart)
+		}
+	})
+
+	t.Run("Cart resources are held to the Proxmox capacity", func(t *testing.T) {
+		send(t, http.MethodPost, "/api/bookings/cart/containers", `{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":1,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}`, fiber.StatusConflict)
+
+		send(t, http.MethodPut, "/api/bookings/cart/containers/0", `{"name":"web","template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":1,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}`, fiber.StatusOK)
+		send(t, http.MethodPut, "/api/bookings/cart/containers/3", `{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":1,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}`, fiber.StatusNotFound)
+
+		if cart := send(t, http.MethodPut, "/api/bookings/cart/vms/0", `{"name":"db","iso_selection":"debian.iso","cores":3,"memory_mb":1024,"disk_gb":16}`, fiber.StatusOK); cart.VMs[0].Cores != 3 || cart.Containers[0].Cores != 1 {
+			t.Fatalf("Expected the edits in the cart, got %+v", cart)
+		}
+
+		send(t, http.MethodPost, "/api/bookings/cart/vms", `{"cores":1,"memory_mb":1024,"disk_gb":16}`, fiber.StatusConflict)
+		send(t, http.MethodPost, "/api/bookings/cart/vms", `{"cores":1,"memory_mb":1024,"disk_gb":16}`, fiber.StatusConflict)
+
+		if cart := send(t, http.MethodDelete, "/api/bookings/cart/vms/0", "", fiber.StatusOK); len(cart.VMs) != 0 {
+			t.Fatalf("Expected the VM to be removed, got %+v", cart)
+		}
+
+		send(t, http.MethodDelete, "/api/bookings/cart/vms/0", "", fiber.StatusNotFound)
+
+		if hosts, virtual, err := db.CartCounts("cade"); err != nil || hosts != 0 || virtual != 1 {
+			t.Fatalf("Expected one virtual resource in the cart, got %d hosts and %d virtual (%v)", hosts, virtual, err)
+		}
+	})
+
+	t.Run("Requests include the cart's resources", func(t *testing.T) {
+		status, body, err := makeHTTPPostRequest(t, baseURL+"/api/bookings", `{"name":"cade's lab","duration_days":1}`, cookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Booking create failed (%d): %v %s", status, err, body)
+		}
+
+		var booking db.Booking
+		if err = json.Unmarshal([]byte(body), &booking); err != nil {
+			t.Fatalf("Failed to unmarshal booking: %v", err)
+		}
+
+		status, body, err = makeHTTPPostRequest(t, fmt.Sprintf("%s/api/bookings/%d/requests", baseURL, booking.ID), `{"justification":"class"}`, cookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Request failed (%d): %v %s", status, err, body)
+		}
+
+		var request db.BookingRequest
+		if err = json.Unmarshal([]byte(body), &request); err != nil || len(request.Containers) != 1 || request.Containers[0].Name != "web" || len(request.VMs) != 0 {
+			t.Fatalf("Expected the cart's container on the request, got %s (%v)", body, err)
+		}
+
+		if _, err = db.BookingCartSnapshot("cade"); !errors.Is(err, db.ErrCartNotFound) {
+			t.Fatalf("Expected the cart to be emptied, got %v", err)
+		}
+	})
+}
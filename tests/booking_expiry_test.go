@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestBookingExpiry(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	config.Config.Expiry.WarningHours = []int{24, 1}
+	config.Config.Expiry.GraceHours = 2
+
+	var end time.Time = time.Now().Add(48 * time.Hour)
+
+	for _, ip := range []string{"10.0.11.1", "10.0.11.2"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	var booking *db.Booking = &db.Booking{Name: "expiry", DNSName: "expiry.lab", CIDRBlock: "10.70.0.0/24", StartTime: time.Now(), EndTime: end}
+	if err := db.CreateBooking(booking); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	if err := db.AssignHostToBooking(booking.ID, "10.0.11.1"); err != nil {
+		t.Fatalf("Failed to assign host: %v", err)
+	}
+
+	if err := db.AddBookingContainer(&db.BookingContainer{ProxmoxID: 9001, BookingID: booking.ID, Template: "debian"}); err != nil {
+		t.Fatalf("Failed to add container: %v", err)
+	}
+
+	var pending *db.BookingRequest = &db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob", Hosts: []db.BookingRequestHost{{ManagementIP: "10.0.11.2"}}}
+	if err := db.AddBookingRequest(pending); err != nil {
+		t.Fatalf("Failed to add booking request: %v", err)
+	}
+
+	reap := func(t *testing.T, at time.Time) []*db.Job {
+		queued, err := db.ReapExpiredBookings(at)
+		if err != nil {
+			t.Fatalf("Failed to reap bookings: %v", err)
+		}
+
+		return queued
+	}
+
+	kinds := func(t *testing.T) (found []db.BookingNoticeKind) {
+		notices, err := db.BookingNoticesForBooking(booking.ID)
+		if err != nil {
+			t.Fatalf("Failed to list notices: %v", err)
+		}
+
+		for _, notice := range notices {
+			found = append(found, notice.Kind)
+		}
+
+		return
+	}
+
+	t.Run("Bookings are warned before they end", func(t *testing.T) {
+		reap(t, time.Now())
+		if found := kinds(t); len(found) != 0 {
+			t.Fatalf("Expected no notices yet, got %v", found)
+		}
+
+		reap(t, end.Add(-23*time.Hour))
+		reap(t, end.Add(-22*time.Hour))
+		if found := kinds(t); !slices.Equal(found, []db.BookingNoticeKind{db.BookingNoticeExpiryWarning}) {
+			t.Fatalf("Expected a single warning, got %v", found)
+		}
+
+		reap(t, end.Add(-30*time.Minute))
+		if current, err := db.BookingByID(booking.ID); err != nil || !slices.Equal(current.ExpiryWarningsSent, []int{24, 1}) {
+			t.Fatalf("Expected both warnings to be recorded, got %+v (%v)", current, err)
+		}
+	})
+
+	t.Run("Ended bookings keep their resources during the grace period", func(t *testing.T) {
+		if queued := reap(t, end.Add(time.Hour)); len(queued) != 0 {
+			t.Fatalf("Expected no teardown during the grace period, got %+v", queued)
+		}
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current.ExpiredAt.IsZero() || current.Status == db.BookingStatusDone || !slices.Contains(current.OwnedHostManagementIPs, "10.0.11.1") {
+			t.Fatalf("Expected the booking to be expired but intact, got %+v (%v)", current, err)
+		}
+	})
+
+	t.Run("Expired bookings are torn down", func(t *testing.T) {
+		queued := reap(t, end.Add(3*time.Hour))
+		if len(queued) != 1 || queued[0].Kind != db.JobKindBookingTeardown {
+			t.Fatalf("Expected a teardown job, got %+v", queued)
+		}
+
+		if job, err := db.WaitForJob(queued[0].ID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		} else if job.Status != db.JobStatusSucceeded {
+			t.Fatalf("Expected job to succeed, got %s: %s", job.Status.String(), job.Message)
+		}
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current.Status != db.BookingStatusDone || current.TornDownAt.IsZero() || current.TeardownJobID != queued[0].ID || len(current.OwnedHostManagementIPs) != 0 {
+			t.Fatalf("Expected the booking to be done, got %+v (%v)", current, err)
+		}
+
+		if len(current.Teardown) != 2 {
+			t.Fatalf("Expected a step per resource, got %+v", current.Teardown)
+		}
+
+		if step := current.Teardown[0]; step.ResourceType != db.FulfillmentResourceHost || step.Action != db.TeardownActionRelease || !step.Success {
+			t.Fatalf("Expected the host to be released, got %+v", step)
+		}
+
+		if step := current.Teardown[1]; step.ResourceType != db.FulfillmentResourceContainer || step.Resource != "9001" || step.Success || !strings.Contains(step.Error, "disabled") {
+			t.Fatalf("Expected the container to fail without proxmox, got %+v", step)
+		}
+
+		if host, err := db.Hosts.Select("10.0.11.1"); err != nil || host == nil || host.IsBooked || host.IdleSince.IsZero() {
+			t.Fatalf("Expected the host back in the pool, got %+v (%v)", host, err)
+		}
+
+		if containers, err := db.BookingContainersForBooking(booking.ID); err != nil || len(containers) != 1 {
+			t.Fatalf("Expected the container to be kept for cleanup, got %+v (%v)", containers, err)
+		}
+
+		if request, err := db.BookingRequestByID(pending.ID); err != nil || request.Status != db.BookingRequestStatusRejected || request.Reviewer != db.BookingReaper {
+			t.Fatalf("Expected the pending request to be rejected, got %+v (%v)", request, err)
+		}
+
+		if found := kinds(t); !slices.Equal(found, []db.BookingNoticeKind{db.BookingNoticeExpiryWarning, db.BookingNoticeExpiryWarning, db.BookingNoticeExpired, db.BookingNoticeRequestRejected, db.BookingNoticeTornDown}) {
+			t.Fatalf("Unexpected notices %v", found)
+		}
+	})
+
+	t.Run("Ended bookings are left alone", func(t *testing.T) {
+		if queued := reap(t, end.Add(4*time.Hour)); len(queued) != 0 {
+			t.Fatalf("Expected no further teardown, got %+v", queued)
+		}
+
+		if err := db.AddBookingRequest(&db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob"}); !errors.Is(err, db.ErrBookingEnded) {
+			t.Fatalf("Expected requests to be refused, got %v", err)
+		}
+	})
+}
+
+func TestTeardownRetriesHostRelease(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var previous = config.Config.Wipe
+	defer func() { config.Config.Wipe = previous }()
+
+	// Wiping is on but has no image to boot, so hosts can't be released
+	config.Config.Wipe.Enabled = true
+	config.Config.Wipe.KernelURL = ""
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: "10.0.11.5", ManagementType: db.ManagementTypeRedfish}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	var booking *db.Booking = &db.Booking{Name: "retry", DNSName: "retry.lab", Status: db.BookingStatusActive, EndTime: time.Now().Add(24 * time.Hour)}
+	if err := db.CreateBooking(booking); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	if err := db.AssignHostToBooking(booking.ID, "10.0.11.5"); err != nil {
+		t.Fatalf("Failed to assign host: %v", err)
+	}
+
+	reap := func(t *testing.T, at time.Time) []*db.Job {
+		queued, err := db.ReapExpiredBookings(at)
+		if err != nil {
+			t.Fatalf("Failed to reap bookings: %v", err)
+		}
+
+		return queued
+	}
+
+	wait := func(t *testing.T, jobs ...*db.Job) {
+		if len(jobs) != 1 || jobs[0].Kind != db.JobKindBookingTeardown {
+			t.Fatalf("Expected a teardown job, got %+v", jobs)
+		}
+
+		if _, err := db.WaitForJob(jobs[0].ID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		}
+	}
+
+	tornDownNotices := func(t *testing.T) (count int) {
+		notices, err := db.BookingNoticesForBooking(booking.ID)
+		if err != nil {
+			t.Fatalf("Failed to list notices: %v", err)
+		}
+
+		for _, notice := range notices {
+			if notice.Kind == db.BookingNoticeTornDown {
+				count++
+			}
+		}
+
+		return
+	}
+
+	t.Run("Bookings holding hosts are not marked torn down", func(t *testing.T) {
+		job, err := db.ReleaseBooking(booking.ID, "bob")
+		if err != nil {
+			t.Fatalf("Failed to release booking: %v", err)
+		}
+
+		wait(t, job)
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current.Status != db.BookingStatusDone || !current.TornDownAt.IsZero() || len(current.Teardown) != 1 || current.Teardown[0].Success {
+			t.Fatalf("Expected the failed release to leave the teardown open, got %+v (%v)", current, err)
+		}
+
+		wait(t, reap(t, time.Now())...)
+
+		if current, err = db.BookingByID(booking.ID); err != nil || !current.TornDownAt.IsZero() || len(current.Teardown) != 2 {
+			t.Fatalf("Expected the reaper to retry the teardown, got %+v (%v)", current, err)
+		}
+
+		if count := tornDownNotices(t); count != 1 {
+			t.Fatalf("Expected retries not to notify again, got %d notices", count)
+		}
+	})
+
+	t.Run("Retries finish once the hosts are released", func(t *testing.T) {
+		config.Config.Wipe.Enabled = false
+		wait(t, reap(t, time.Now())...)
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current.TornDownAt.IsZero() || len(current.OwnedHostManagementIPs) != 0 {
+			t.Fatalf("Expected the booking to be torn down, got %+v (%v)", current, err)
+		}
+
+		if host, err := db.Hosts.Select("10.0.11.5"); err != nil || host == nil || host.IsBooked {
+			t.Fatalf("Expected the host back in the pool, got %+v (%v)", host, err)
+		}
+
+		if count := tornDownNotices(t); count != 2 {
+			t.Fatalf("Expected the completed teardown to be notified, got %d notices", count)
+		}
+
+		if queued := reap(t, time.Now()); len(queued) != 0 {
+			t.Fatalf("Expected no further teardown, got %+v", queued)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestBookingExtensions(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	config.Config.Extensions.MaxTotalDays = 10
+	config.Config.Extensions.MaxCount = 2
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator)
+	auth.AddUserInjection("carol", "carol", auth.AuthPermsUser)
+
+	var (
+		baseURL string = "http://" + config.Config.WebServer.Address
+		cookies        = map[string][]*http.Cookie{}
+	)
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+	}
+
+	status, body, err := makeHTTPPostRequest(t, baseURL+"/api/bookings", `{"name":"bob's lab","duration_days":3}`, cookies["bob"])
+	if err != nil || status != fiber.StatusOK {
+		t.Fatalf("Booking create failed (%d): %v %s", status, err, body)
+	}
+
+	var booking db.Booking
+	if err = json.Unmarshal([]byte(body), &booking); err != nil {
+		t.Fatalf("Failed to unmarshal booking: %v", err)
+	}
+
+	if err = db.Hosts.Insert(&db.Host{ManagementIP: "10.0.12.1", ManagementType: db.ManagementTypeRedfish}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	if err = db.AssignHostToBooking(booking.ID, "10.0.12.1"); err != nil {
+		t.Fatalf("Failed to assign host: %v", err)
+	}
+
+	var extendURL string = fmt.Sprintf("%s/api/bookings/%d/extend", baseURL, booking.ID)
+
+	extend := func(t *testing.T, payload string, expected int) (extension db.BookingExtension) {
+		status, body, err := makeHTTPPostRequest(t, extendURL, payload, cookies["bob"])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s, got %d: %v %s", expected, payload, status, err, body)
+		}
+
+		json.Unmarshal([]byte(body), &extension)
+		return
+	}
+
+	review := func(t *testing.T, extensionID int, action, payload string, expected int) {
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("%s/api/review/extensions/%d/%s", baseURL, extensionID, action), payload, cookies["alice"])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s, got %d: %v %s", expected, action, status, err, body)
+		}
+	}
+
+	endTime := func(t *testing.T) time.Time {
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current == nil {
+			t.Fatalf("Failed to get booking: %v", err)
+		}
+
+		return current.EndTime
+	}
+
+	t.Run("Extensions are validated", func(t *testing.T) {
+		extend(t, `{"days":0}`, fiber.StatusBadRequest)
+
+		if status, _, _ := makeHTTPPostRequest(t, extendURL, `{"days":1}`, cookies["carol"]); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a non-member, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Extensions within the limits are approved", func(t *testing.T) {
+		var previous time.Time = endTime(t)
+		if _, err := db.ReapExpiredBookings(previous.Add(-time.Hour)); err != nil {
+			t.Fatalf("Failed to reap bookings: %v", err)
+		}
+
+		extension := extend(t, `{"days":2,"justification":"project deadline"}`, fiber.StatusOK)
+		if !extension.AutoApproved || extension.Status != db.BookingRequestStatusApproved || !extension.PreviousEndTime.Equal(previous) || !extension.NewEndTime.Equal(previous.Add(48*time.Hour)) {
+			t.Fatalf("Unexpected extension %+v", extension)
+		}
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || !current.EndTime.Equal(extension.NewEndTime) || len(current.ExpiryWarningsSent) != 0 {
+			t.Fatalf("Expected the booking to end later with its warnings reset, got %+v (%v)", current, err)
+		}
+	})
+
+	t.Run("Extensions overlapping maintenance are reviewed", func(t *testing.T) {
+		var previous time.Time = endTime(t)
+		window, err := db.ScheduleMaintenance("10.0.12.1", "rack move", previous.Add(time.Hour), previous.Add(2*time.Hour), "alice")
+		if err != nil {
+			t.Fatalf("Failed to schedule maintenance: %v", err)
+		}
+
+		extension := extend(t, `{"days":1}`, fiber.StatusAccepted)
+		if extension.AutoApproved || extension.Status != db.BookingRequestStatusPending || len(extension.ReviewReasons) != 1 {
+			t.Fatalf("Expected the extension to wait for review, got %+v", extension)
+		}
+
+		extend(t, `{"days":1}`, fiber.StatusConflict)
+
+		if status, _, _ := makeHTTPGetRequestWithCookies(t, baseURL+"/api/review/extensions", cookies["bob"]); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a regular user, got %d", fiber.StatusForbidden, status)
+		}
+
+		review(t, extension.ID, "reject", `{}`, fiber.StatusBadRequest)
+		review(t, extension.ID, "reject", `{"comment":"the rack is moving that day"}`, fiber.StatusOK)
+		review(t, extension.ID, "approve", `{}`, fiber.StatusConflict)
+
+		if current := endTime(t); !current.Equal(previous) {
+			t.Fatalf("Expected the end time to stay at %s, got %s", previous, current)
+		}
+
+		if _, err := db.EndMaintenance(window.ID); err != nil {
+			t.Fatalf("Failed to cancel maintenance: %v", err)
+		}
+	})
+
+	t.Run("Extensions past the requester's quota are reviewed", func(t *testing.T) {
+		var previous time.Time = endTime(t)
+		if _, err := db.SetQuotaPolicy(&db.QuotaPolicy{Scope: db.QuotaScopeUser, Subject: "bob", MaxDurationDays: 6}, "alice"); err != nil {
+			t.Fatalf("Failed to set quota policy: %v", err)
+		}
+
+		extension := extend(t, `{"days":2}`, fiber.StatusAccepted)
+		if len(extension.ReviewReasons) != 1 || !strings.Contains(extension.ReviewReasons[0], "quota exceeded") {
+			t.Fatalf("Expected the quota to need review, got %+v", extension)
+		}
+
+		review(t, extension.ID, "reject", `{"comment":"over your quota"}`, fiber.StatusOK)
+		if current := endTime(t); !current.Equal(previous) {
+			t.Fatalf("Expected the end time to stay at %s, got %s", previous, current)
+		}
+
+		if err := db.DeleteQuotaPolicy(db.QuotaScopeUser, "bob"); err != nil {
+			t.Fatalf("Failed to delete quota policy: %v", err)
+		}
+	})
+
+	t.Run("Extensions past the limits are reviewed", func(t *testing.T) {
+		var previous time.Time = endTime(t)
+
+		extension := extend(t, `{"days":7}`, fiber.StatusAccepted)
+		if len(extension.ReviewReasons) != 1 || !strings.Contains(extension.ReviewReasons[0], "days") {
+			t.Fatalf("Expected the total duration to need review, got %+v", extension)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/review/extensions", cookies["alice"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Review queue failed (%d): %v", status, err)
+		}
+
+		var queue []*db.BookingExtension
+		if err = json.Unmarshal([]byte(body), &queue); err != nil || len(queue) != 1 || queue[0].ID != extension.ID {
+			t.Fatalf("Unexpected queue %s: %v", body, err)
+		}
+
+		review(t, extension.ID, "approve", `{"comment":"enjoy"}`, fiber.StatusOK)
+		if current := endTime(t); !current.Equal(previous.Add(7 * 24 * time.Hour)) {
+			t.Fatalf("Expected the approved extension to apply, got %s", current)
+		}
+
+		if extension = extend(t, `{"days":1}`, fiber.StatusAccepted); len(extension.ReviewReasons) != 2 {
+			t.Fatalf("Expected the duration and count limits to need review, got %+v", extension.ReviewReasons)
+		}
+	})
+
+	t.Run("Extension history is kept", func(t *testing.T) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, fmt.Sprintf("%s/api/bookings/%d/extensions", baseURL, booking.ID), cookies["bob"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Extensions list failed (%d): %v", status, err)
+		}
+
+		var extensions []*db.BookingExtension
+		if err = json.Unmarshal([]byte(body), &extensions); err != nil || len(extensions) != 5 {
+			t.Fatalf("Unexpected extensions %s: %v", body, err)
+		}
+
+		var statuses []db.BookingRequestStatus
+		for _, extension := range extensions {
+			statuses = append(statuses, extension.Status)
+		}
+
+		if !slices.Equal(statuses, []db.BookingRequestStatus{db.BookingRequestStatusApproved, db.BookingRequestStatusRejected, db.BookingRequestStatusRejected, db.BookingRequestStatusApproved, db.BookingRequestStatusPending}) {
+			t.Fatalf("Unexpected history %s", body)
+		}
+
+		notices, err := db.BookingNoticesForBooking(booking.ID)
+		if err != nil {
+			t.Fatalf("Failed to list notices: %v", err)
+		}
+
+		var extended, rejected int
+		for _, notice := range notices {
+			switch notice.Kind {
+			case db.BookingNoticeExtended:
+				extended++
+			case db.BookingNoticeExtensionRejected:
+				rejected++
+			}
+		}
+
+		if extended != 2 || rejected != 2 {
+			t.Fatalf("Unexpected notices %+v", notices)
+		}
+	})
+}
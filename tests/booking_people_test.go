@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestBookingMembership(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("mona", "mona", auth.AuthPermsBookingCreator)
+	auth.AddUserInjection("mike", "mike", auth.AuthPermsUser)
+	auth.AddUserInjection("mia", "mia", auth.AuthPermsUser)
+	auth.AddUserInjection("moira", "moira", auth.AuthPermsAdministrator)
+
+	var (
+		baseURL string = "http://" + config.Config.WebServer.Address
+		cookies        = map[string][]*http.Cookie{}
+	)
+
+	for _, username := range []string{"mona", "mike", "mia", "moira"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+	}
+
+	status, body, err := makeHTTPPostRequest(t, baseURL+"/api/bookings", `{"name":"mona's lab","duration_days":2}`, cookies["mona"])
+	if err != nil || status != fiber.StatusOK {
+		t.Fatalf("Booking create failed (%d): %v %s", status, err, body)
+	}
+
+	var booking db.Booking
+	if err = json.Unmarshal([]byte(body), &booking); err != nil {
+		t.Fatalf("Failed to unmarshal booking: %v", err)
+	}
+
+	var (
+		bookingURL string = fmt.Sprintf("%s/api/bookings/%d", baseURL, booking.ID)
+		peopleURL  string = bookingURL + "/people"
+	)
+
+	expect := func(t *testing.T, method, username, url, payload string, expected int) string {
+		var (
+			status int
+			body   string
+			err    error
+		)
+
+		switch method {
+		case http.MethodGet:
+			status, body, err = makeHTTPGetRequestWithCookies(t, url, cookies[username])
+		case http.MethodPost:
+			status, body, err = makeHTTPPostRequest(t, url, payload, cookies[username])
+		case http.MethodPut:
+			status, body, err = makeHTTPPutRequest(t, url, payload, cookies[username])
+		case http.MethodDelete:
+			status, body, err = makeHTTPDeleteRequest(t, url, cookies[username])
+		}
+
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s %s as %s, got %d: %v %s", expected, method, url, username, status, err, body)
+		}
+
+		return body
+	}
+
+	level := func(level db.BookingPermissionLevel) string {
+		return fmt.Sprintf(`{"permission_level":%d}`, level)
+	}
+
+	t.Run("Owners invite members", func(t *testing.T) {
+		expect(t, http.MethodGet, "mike", peopleURL, "", fiber.StatusForbidden)
+		expect(t, http.MethodPost, "mike", peopleURL, `{"username":"mike","permission_level":1}`, fiber.StatusForbidden)
+
+		expect(t, http.MethodPost, "mona", peopleURL, `{"username":"mike","permission_level":9}`, fiber.StatusBadRequest)
+		expect(t, http.MethodPost, "mona", peopleURL, `{"username":"","permission_level":1}`, fiber.StatusBadRequest)
+		expect(t, http.MethodPost, "mona", peopleURL, fmt.Sprintf(`{"username":"mike","permission_level":%d}`, db.BookingPermissionLevelViewer), fiber.StatusCreated)
+		expect(t, http.MethodPost, "mona", peopleURL, fmt.Sprintf(`{"username":"mike","permission_level":%d}`, db.BookingPermissionLevelOwner), fiber.StatusConflict)
+
+		var people []*db.BookingPerson
+		if err := json.Unmarshal([]byte(expect(t, http.MethodGet, "mike", peopleURL, "", fiber.StatusOK)), &people); err != nil || len(people) != 2 {
+			t.Fatalf("Expected two members, got %+v (%v)", people, err)
+		}
+
+		if current, err := db.BookingByID(booking.ID); err != nil || len(current.People) != 2 {
+			t.Fatalf("Expected the booking to list both members, got %+v (%v)", current, err)
+		}
+	})
+
+	t.Run("Listing and details are scoped to members", func(t *testing.T) {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: "10.0.15.1", ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+
+		if err := db.AssignHostToBooking(booking.ID, "10.0.15.1"); err != nil {
+			t.Fatalf("Failed to assign host: %v", err)
+		}
+
+		list := func(t *testing.T, username, query string) (ids []int) {
+			var found []*db.Booking
+			if err := json.Unmarshal([]byte(expect(t, http.MethodGet, username, baseURL+"/api/bookings"+query, "", fiber.StatusOK)), &found); err != nil {
+				t.Fatalf("Failed to unmarshal bookings: %v", err)
+			}
+
+			for _, booking := range found {
+				ids = append(ids, booking.ID)
+			}
+
+			return
+		}
+
+		if ids := list(t, "mia", ""); len(ids) != 0 {
+			t.Fatalf("Expected mia to see no bookings, got %v", ids)
+		}
+
+		if ids := list(t, "mike", "?all=1"); len(ids) != 1 || ids[0] != booking.ID {
+			t.Fatalf("Expected mike to only see his booking, got %v", ids)
+		}
+
+		if ids := list(t, "moira", ""); len(ids) != 0 {
+			t.Fatalf("Expected admins to only see their own bookings without the flag, got %v", ids)
+		}
+
+		if ids := list(t, "moira", "?all=1"); len(ids) != 1 {
+			t.Fatalf("Expected admins to see every booking with the flag, got %v", ids)
+		}
+
+		expect(t, http.MethodGet, "mia", bookingURL, "", fiber.StatusForbidden)
+		expect(t, http.MethodGet, "moira", fmt.Sprintf("%s/api/bookings/%d", baseURL, booking.ID+1000), "", fiber.StatusNotFound)
+
+		var details db.BookingDetails
+		if err := json.Unmarshal([]byte(expect(t, http.MethodGet, "mike", bookingURL, "", fiber.StatusOK)), &details); err != nil {
+			t.Fatalf("Failed to unmarshal booking details: %v", err)
+		}
+
+		if details.Booking.ID != booking.ID || len(details.People) != 2 || len(details.Hosts) != 1 || details.Hosts[0].ManagementIP != "10.0.15.1" || details.Containers == nil || details.Requests == nil {
+			t.Fatalf("Unexpected booking details %+v", details)
+		}
+	})
+
+	t.Run("Levels gate booking actions", func(t *testing.T) {
+		var powerURL string = fmt.Sprintf("%s/power/%d", bookingURL, db.PowerActionPowerOn)
+
+		expect(t, http.MethodGet, "mike", bookingURL+"/notices", "", fiber.StatusOK)
+		expect(t, http.MethodPost, "mike", powerURL, "", fiber.StatusForbidden)
+
+		expect(t, http.MethodPut, "mike", peopleURL+"/mike", level(db.BookingPermissionLevelOwner), fiber.StatusForbidden)
+		expect(t, http.MethodPut, "mona", peopleURL+"/mike", level(db.BookingPermissionLevelOperator), fiber.StatusOK)
+
+		expect(t, http.MethodPost, "mike", powerURL, "", fiber.StatusAccepted)
+		expect(t, http.MethodPost, "mike", bookingURL+"/extend", `{"days":1}`, fiber.StatusForbidden)
+		expect(t, http.MethodPost, "mike", bookingURL+"/release", "", fiber.StatusForbidden)
+		expect(t, http.MethodPost, "mike", peopleURL, `{"username":"mia","permission_level":1}`, fiber.StatusForbidden)
+	})
+
+	t.Run("Bookings keep an owner", func(t *testing.T) {
+		expect(t, http.MethodPut, "mona", peopleURL+"/mona", level(db.BookingPermissionLevelViewer), fiber.StatusConflict)
+		expect(t, http.MethodDelete, "mona", peopleURL+"/mona", "", fiber.StatusConflict)
+		expect(t, http.MethodDelete, "mona", peopleURL+"/mia", "", fiber.StatusNotFound)
+
+		expect(t, http.MethodPut, "mona", peopleURL+"/mike", level(db.BookingPermissionLevelOwner), fiber.StatusOK)
+		expect(t, http.MethodDelete, "mona", peopleURL+"/mona", "", fiber.StatusOK)
+		expect(t, http.MethodGet, "mona", peopleURL, "", fiber.StatusForbidden)
+	})
+
+	t.Run("Owners release bookings", func(t *testing.T) {
+		var response struct {
+			JobID int `json:"job_id"`
+		}
+
+		if err := json.Unmarshal([]byte(expect(t, http.MethodPost, "mike", bookingURL+"/release", "", fiber.StatusAccepted)), &response); err != nil {
+			t.Fatalf("Failed to unmarshal release: %v", err)
+		}
+
+		if _, err := db.WaitForJob(response.JobID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		}
+
+		if current, err := db.BookingByID(booking.ID); err != nil || current.Status != db.BookingStatusDone || current.TornDownAt.IsZero() {
+			t.Fatalf("Expected the booking to be torn down, got %+v (%v)", current, err)
+		}
+
+		expect(t, http.MethodPost, "mike", bookingURL+"/release", "", fiber.StatusConflict)
+	})
+}
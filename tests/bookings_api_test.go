@@ -11,6 +11,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/opnlaas/opnlaas/app"
 	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
 	"github.com/opnlaas/opnlaas/db"
 )
 
@@ -21,7 +22,8 @@ func TestBookingAPIFlow(t *testing.T) {
 	var appServer *fiber.App = app.CreateApp()
 
 	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
-	auth.AddUserInjection("bob", "bob", auth.AuthPermsUser)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator)
+	auth.AddUserInjection("erin", "erin", auth.AuthPermsUser)
 
 	testHostIP := "10.0.0.1"
 	if err := db.Hosts.Insert(&db.Host{
@@ -164,7 +166,13 @@ func TestBookingAPIFlow(t *testing.T) {
 			t.Fatalf("alice failed to add host to cart status %d err %v", status, err)
 		}
 
-		requestPayload := `{"justification":"need resources","containers":[{"name":"ct1","template":"ubuntu","cores":2,"memory_mb":512,"disk_gb":10}],"vms":[{"name":"vm1","iso_selection":"", "cores":2,"memory_mb":1024,"disk_gb":20}]}`
+		config.Config.Proxmox.Templates = []string{"ubuntu"}
+		invalidPayload := `{"justification":"need resources","containers":[{"name":"ct1","template":"missing","cores":2,"memory_mb":512,"disk_gb":10}]}`
+		if status, resp, _, err := doRequest("POST", fmt.Sprintf("/api/bookings/%d/requests", booking.ID), invalidPayload, "application/json", aliceCookies); err != nil || status != fiber.StatusBadRequest {
+			t.Fatalf("expected invalid containers to be refused with %d, got %d: %v %s", fiber.StatusBadRequest, status, err, resp)
+		}
+
+		requestPayload := `{"justification":"need resources","containers":[{"name":"ct1","template":"ubuntu","cores":2,"memory_mb":512,"disk_gb":10,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}],"vms":[{"name":"vm1","iso_selection":"", "cores":2,"memory_mb":1024,"disk_gb":20}]}`
 		if status, resp, _, err := doRequest("POST", fmt.Sprintf("/api/bookings/%d/requests", booking.ID), requestPayload, "application/json", aliceCookies); err != nil {
 			t.Fatalf("create booking request failed: %v", err)
 		} else if status != fiber.StatusOK {
@@ -185,4 +193,40 @@ func TestBookingAPIFlow(t *testing.T) {
 			t.Fatalf("expected host to be free for bob after request, got status %d", status)
 		}
 	})
+
+	t.Run("Only booking creators can book", func(t *testing.T) {
+		defer db.ResetBookingCart("erin")
+
+		erinCookies := login("erin")
+		bobCookies := login("bob")
+
+		var profile struct {
+			Permissions       string `json:"permissions"`
+			CanCreateBookings bool   `json:"can_create_bookings"`
+		}
+
+		if status, resp, _, err := doRequest("GET", "/api/auth/me", "", "", erinCookies); err != nil || status != fiber.StatusOK {
+			t.Fatalf("expected erin auth check 200 got %d: %v", status, err)
+		} else if err := json.Unmarshal([]byte(resp), &profile); err != nil || profile.Permissions != "user" || profile.CanCreateBookings {
+			t.Fatalf("expected erin to be a plain user, got %s", resp)
+		}
+
+		if status, resp, _, err := doRequest("GET", "/api/auth/me", "", "", bobCookies); err != nil || status != fiber.StatusOK {
+			t.Fatalf("expected bob auth check 200 got %d: %v", status, err)
+		} else if err := json.Unmarshal([]byte(resp), &profile); err != nil || profile.Permissions != "booking creator" || !profile.CanCreateBookings {
+			t.Fatalf("expected bob to be a booking creator, got %s", resp)
+		}
+
+		if status, _, _, _ := doRequest("POST", "/api/bookings", `{"name":"Erin Booking","duration_days":1}`, "application/json", erinCookies); status != fiber.StatusForbidden {
+			t.Fatalf("expected erin create booking status %d got %d", fiber.StatusForbidden, status)
+		}
+
+		if status, _, _, _ := doRequest("POST", "/api/bookings/cart/hosts", fmt.Sprintf(`{"management_ip":"%s"}`, testHostIP), "application/json", erinCookies); status != fiber.StatusForbidden {
+			t.Fatalf("expected erin add host status %d got %d", fiber.StatusForbidden, status)
+		}
+
+		if status, _, _, _ := doRequest("GET", "/api/bookings/cart", "", "", erinCookies); status != fiber.StatusForbidden {
+			t.Fatalf("expected erin cart status %d got %d", fiber.StatusForbidden, status)
+		}
+	})
 }
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestVendorFromManufacturer(t *testing.T) {
+	var cases map[string]db.VendorID = map[string]db.VendorID{
+		"Dell Inc.":                   db.VendorDELL,
+		"HPE":                         db.VendorHPE,
+		"Hewlett Packard Enterprise":  db.VendorHPE,
+		"Lenovo":                      db.VendorLenovo,
+		"Supermicro":                  db.VendorSupermicro,
+		"Cisco Systems Inc":           db.VendorCisco,
+		"GIGABYTE":                    db.VendorGigabyte,
+		"Some Whitebox Manufacturing": db.VendorOther,
+	}
+
+	for manufacturer, expected := range cases {
+		if vendor := db.VendorFromManufacturer(manufacturer); vendor != expected {
+			t.Fatalf("Expected %q to map to %s, got %s", manufacturer, expected, vendor)
+		}
+	}
+}
+
+func TestDiscoverBMCs(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	t.Run("Rejects invalid subnets", func(t *testing.T) {
+		for _, cidr := range []string{"not-a-cidr", "10.0.0.1/32", "10.0.0.0/31", "fd00::/64"} {
+			if _, err := db.DiscoverBMCs(cidr); err == nil {
+				t.Fatalf("Expected error discovering %q, got nil", cidr)
+			}
+		}
+	})
+
+	t.Run("Rejects oversized subnets", func(t *testing.T) {
+		if _, err := db.DiscoverBMCs("10.0.0.0/16"); err != db.ErrDiscoveryRangeTooLarge {
+			t.Fatalf("Expected %v, got %v", db.ErrDiscoveryRangeTooLarge, err)
+		}
+	})
+
+	t.Run("Loopback scan finds nothing", func(t *testing.T) {
+		if candidates, err := db.DiscoverBMCs("127.0.0.0/30"); err != nil {
+			t.Fatalf("Failed to scan loopback subnet: %v", err)
+		} else if len(candidates) != 0 {
+			t.Fatalf("Expected no candidates on loopback, got %+v", candidates)
+		}
+	})
+}
+
+func TestDiscoverAPI(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsUser)
+
+	var url string = fmt.Sprintf("http://%s/api/hosts/discover", config.Config.WebServer.Address)
+
+	t.Run("Non-admin is forbidden", func(t *testing.T) {
+		if cookies, err := loginAndGetCookies(t, "bob", "bob"); err != nil {
+			t.Fatalf("Failed to login as bob: %v", err)
+		} else if status, _, err := makeHTTPPostRequest(t, url, `{"cidr":"127.0.0.0/30"}`, cookies); err != nil {
+			t.Fatalf("Discover request failed: %v", err)
+		} else if status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Admin gets bad request for invalid CIDR", func(t *testing.T) {
+		if cookies, err := loginAndGetCookies(t, "alice", "alice"); err != nil {
+			t.Fatalf("Failed to login as alice: %v", err)
+		} else if status, _, err := makeHTTPPostRequest(t, url, `{"cidr":"nope"}`, cookies); err != nil {
+			t.Fatalf("Discover request failed: %v", err)
+		} else if status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Admin scan of loopback returns empty list", func(t *testing.T) {
+		if cookies, err := loginAndGetCookies(t, "alice", "alice"); err != nil {
+			t.Fatalf("Failed to login as alice: %v", err)
+		} else if status, body, err := makeHTTPPostRequest(t, url, `{"cidr":"127.0.0.0/30"}`, cookies); err != nil {
+			t.Fatalf("Discover request failed: %v", err)
+		} else if status != fiber.StatusOK || body != "[]" {
+			t.Fatalf("Expected status %d with empty list, got %d: %s", fiber.StatusOK, status, body)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func TestDriveInventory(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	collect := func(t *testing.T, hardware bmcsim.Hardware) *db.Host {
+		var sim *bmcsim.RedfishServer = bmcsim.NewRedfishServer(config.Config.Management.DefaultIPMIUser, config.Config.Management.DefaultIPMIPass, hardware)
+		t.Cleanup(sim.Close)
+
+		var (
+			host *db.Host = &db.Host{ManagementIP: sim.Address(), ManagementType: db.ManagementTypeRedfish}
+			err  error
+		)
+
+		if host.Management, err = db.NewHostManagementClient(host); err != nil {
+			t.Fatalf("Failed to connect to simulated Redfish BMC: %v", err)
+		}
+
+		defer host.Management.Close()
+
+		if err = host.Management.UpdateSystemInfo(); err != nil {
+			t.Fatalf("Failed to update system info: %v", err)
+		}
+
+		return host
+	}
+
+	t.Run("Drives are collected alongside volumes", func(t *testing.T) {
+		var (
+			hardware bmcsim.Hardware = bmcsim.DefaultHardware()
+			host     *db.Host        = collect(t, hardware)
+		)
+
+		if len(host.Specs.Drives) != len(hardware.Drives) || len(host.Specs.Storage) != len(hardware.VolumeSizesGiB) {
+			t.Fatalf("Unexpected storage specs: %+v", host.Specs)
+		}
+
+		for i, drive := range host.Specs.Drives {
+			var expected bmcsim.Drive = hardware.Drives[i]
+			if drive.Name != expected.ID || drive.Model != expected.Model || drive.SerialNumber != expected.SerialNumber || drive.MediaType != expected.MediaType || drive.Protocol != expected.Protocol || drive.CapacityGB != expected.CapacityGiB {
+				t.Fatalf("Unexpected drive %+v, expected %+v", drive, expected)
+			}
+		}
+	})
+
+	t.Run("Hosts in JBOD mode still report storage", func(t *testing.T) {
+		var hardware bmcsim.Hardware = bmcsim.DefaultHardware()
+		hardware.VolumeSizesGiB = nil
+		hardware.Drives[2].FailurePredicted = true
+
+		var host *db.Host = collect(t, hardware)
+		if len(host.Specs.Storage) != 0 || host.Specs.StorageCapacityGB() != 480+480+1920 {
+			t.Fatalf("Expected raw drive capacity without volumes, got %+v", host.Specs)
+		} else if !host.Specs.Drives[2].FailurePredicted {
+			t.Fatalf("Expected the predicted failure to be reported: %+v", host.Specs.Drives[2])
+		}
+	})
+}
+
+func TestCartHostFilter(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator)
+
+	bobCookies, err := loginAndGetCookies(t, "bob", "bob")
+	if err != nil {
+		t.Fatalf("Failed to login as bob: %v", err)
+	}
+
+	var hosts []*db.Host = []*db.Host{
+		{ManagementIP: "10.0.5.1", ManagementType: db.ManagementTypeRedfish, Specs: db.HostSpecs{Drives: []db.HostDriveSpecs{
+			{Name: "0", Model: "Samsung PM9A3", MediaType: "SSD", Protocol: "NVMe", CapacityGB: 3840},
+			{Name: "1", Model: "Samsung PM9A3", MediaType: "SSD", Protocol: "NVMe", CapacityGB: 3840},
+		}}},
+		{ManagementIP: "10.0.5.2", ManagementType: db.ManagementTypeRedfish, Specs: db.HostSpecs{Drives: []db.HostDriveSpecs{
+			{Name: "0", Model: "Micron 5400", MediaType: "SSD", Protocol: "SATA", CapacityGB: 480},
+			{Name: "1", Model: "Seagate Exos", MediaType: "HDD", Protocol: "SAS", CapacityGB: 16000, FailurePredicted: true},
+		}}},
+		{ManagementIP: "10.0.5.3", ManagementType: db.ManagementTypeIPMI, Specs: db.HostSpecs{Storage: []db.HostStorageSpecs{{CapacityGB: 960, MediaType: "RawDevice"}}}},
+	}
+
+	for _, host := range hosts {
+		if err := db.Hosts.Insert(host); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"No filter", "", []string{"10.0.5.1", "10.0.5.2", "10.0.5.3"}},
+		{"Media type", "?drive_media_type=hdd", []string{"10.0.5.2"}},
+		{"Protocol and count", "?drive_protocol=NVMe&min_drives=2", []string{"10.0.5.1"}},
+		{"Drive model", "?drive_model=micron", []string{"10.0.5.2"}},
+		{"Drive capacity", "?drive_media_type=SSD&min_drive_capacity_gb=1000", []string{"10.0.5.1"}},
+		{"Total storage", "?min_storage_gb=900", []string{"10.0.5.1", "10.0.5.2", "10.0.5.3"}},
+		{"Healthy drives only", "?healthy_drives_only=true", []string{"10.0.5.1", "10.0.5.3"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body, err := makeHTTPGetRequestWithCookies(t, "http://"+config.Config.WebServer.Address+"/api/bookings/cart/hosts/available"+tc.query, bobCookies)
+			if err != nil || status != fiber.StatusOK {
+				t.Fatalf("Available hosts request failed (%d): %v %s", status, err, body)
+			}
+
+			var available []*db.Host
+			if err = json.Unmarshal([]byte(body), &available); err != nil {
+				t.Fatalf("Failed to unmarshal hosts: %v", err)
+			}
+
+			var found []string
+			for _, host := range available {
+				found = append(found, host.ManagementIP)
+			}
+
+			if len(found) != len(tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, found)
+			}
+
+			for i := range found {
+				if found[i] != tc.expected[i] {
+					t.Fatalf("Expected %v, got %v", tc.expected, found)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func TestFirmwareInventoryAndUpdates(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	var previous = config.Config.Firmware
+	defer func() { config.Config.Firmware = previous }()
+	config.Config.Firmware.StorageDir = t.TempDir()
+	config.Config.Firmware.BaseURL = "http://" + config.Config.WebServer.Address
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	var (
+		sim         *bmcsim.RedfishServer = newSimulatedRedfish(t)
+		baseURL     string                = "http://" + config.Config.WebServer.Address
+		packagesURL string                = baseURL + "/api/firmware/packages"
+	)
+
+	defer sim.Close()
+
+	upload := func(t *testing.T, category db.FirmwareCategory, version, models string, image []byte) (pkg db.FirmwarePackage) {
+		status, body, err := makeHTTPMultipartRequest(t, packagesURL, map[string]string{
+			"name":     fmt.Sprintf("%s %s", category.String(), version),
+			"category": fmt.Sprintf("%d", category),
+			"version":  version,
+			"models":   models,
+		}, "firmware_image", "firmware.bin", image, aliceCookies)
+
+		if err != nil {
+			t.Fatalf("Package upload failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+
+		if err = json.Unmarshal([]byte(body), &pkg); err != nil {
+			t.Fatalf("Failed to unmarshal package: %v", err)
+		}
+
+		return
+	}
+
+	apply := func(t *testing.T, pkg db.FirmwarePackage, method db.FirmwareUpdateMethod) (status int, jobID int) {
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("%s/%d/apply", packagesURL, pkg.ID), fmt.Sprintf(`{"management_ips":[%q],"method":%d}`, sim.Address(), method), aliceCookies)
+		if err != nil {
+			t.Fatalf("Apply request failed: %v", err)
+		}
+
+		var response struct {
+			JobID int `json:"job_id"`
+		}
+
+		json.Unmarshal([]byte(body), &response)
+		jobID = response.JobID
+		return
+	}
+
+	outcome := func(t *testing.T, jobID int) (result db.FirmwareOutcome) {
+		job, err := db.WaitForJob(jobID, 30*time.Second)
+		if err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		} else if job.Status != db.JobStatusSucceeded {
+			t.Fatalf("Expected job to succeed, got %s: %s", job.Status.String(), job.Message)
+		}
+
+		var outcomes []db.FirmwareOutcome
+		if err = json.Unmarshal(job.Result, &outcomes); err != nil || len(outcomes) != 1 {
+			t.Fatalf("Unexpected job result %s: %v", job.Result, err)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		} else if host.FirmwareUpdating {
+			t.Fatalf("Expected host to be released after the update")
+		}
+
+		return outcomes[0]
+	}
+
+	t.Run("Registering a host collects its firmware inventory", func(t *testing.T) {
+		if status, body, err := makeHTTPPostRequest(t, baseURL+"/api/hosts", fmt.Sprintf(`{"management_ip":%q,"management_type":%d}`, sim.Address(), db.ManagementTypeRedfish), aliceCookies); err != nil {
+			t.Fatalf("Host create request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, fmt.Sprintf("%s/api/hosts/%s/firmware", baseURL, sim.Address()), aliceCookies)
+		if err != nil {
+			t.Fatalf("Firmware request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+
+		var response struct {
+			Firmware []db.HostFirmware `json:"firmware"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to unmarshal firmware: %v", err)
+		}
+
+		var categories map[db.FirmwareCategory]string = map[db.FirmwareCategory]string{}
+		for _, record := range response.Firmware {
+			categories[record.Category] = record.Version
+		}
+
+		if len(response.Firmware) != 3 || categories[db.FirmwareCategoryBIOS] != "1.10.2" || categories[db.FirmwareCategoryBMC] != "6.10.00.00" || categories[db.FirmwareCategoryNIC] != "22.31.6" {
+			t.Fatalf("Unexpected firmware inventory: %s", body)
+		}
+	})
+
+	var biosPackage db.FirmwarePackage
+
+	t.Run("Outdated firmware is reported for matching models", func(t *testing.T) {
+		biosPackage = upload(t, db.FirmwareCategoryBIOS, "1.12.0", bmcsim.DefaultHardware().Model, bmcsim.FirmwareImage(bmcsim.FirmwareBIOS, "1.12.0"))
+		upload(t, db.FirmwareCategoryBMC, "7.00.00.00", "PowerEdge R760", bmcsim.FirmwareImage(bmcsim.FirmwareBMC, "7.00.00.00"))
+
+		if biosPackage.SHA256 == "" || biosPackage.Size == 0 {
+			t.Fatalf("Expected package size and checksum, got %+v", biosPackage)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/firmware/outdated", aliceCookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Outdated request failed (%d): %v %s", status, err, body)
+		}
+
+		var outdated []db.OutdatedFirmware
+		if err = json.Unmarshal([]byte(body), &outdated); err != nil {
+			t.Fatalf("Failed to unmarshal outdated firmware: %v", err)
+		} else if len(outdated) != 1 || outdated[0].Category != db.FirmwareCategoryBIOS || outdated[0].InstalledVersion != "1.10.2" || outdated[0].PackageID != biosPackage.ID {
+			t.Fatalf("Expected only the BIOS to be outdated, got %s", body)
+		}
+	})
+
+	t.Run("SimpleUpdate installs a package and blocks the cart meanwhile", func(t *testing.T) {
+		status, jobID := apply(t, biosPackage, db.FirmwareUpdateMethodSimpleUpdate)
+		if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusAccepted, status)
+		}
+
+		if err := db.AddHostToCart("bob", nil, db.BookingRequestHost{ManagementIP: sim.Address()}); !errors.Is(err, db.ErrHostFirmwareUpdating) {
+			t.Fatalf("Expected updating host to be refused by the cart, got %v", err)
+		}
+
+		if result := outcome(t, jobID); !result.Success || result.PreviousVersion != "1.10.2" || result.Version != "1.12.0" {
+			t.Fatalf("Unexpected update outcome %+v", result)
+		}
+
+		if sim.FirmwareVersion(bmcsim.FirmwareBIOS) != "1.12.0" || sim.FirmwareUpdates()["SimpleUpdate"] != 1 {
+			t.Fatalf("Expected the simulator to download and install the image, got %s", sim.FirmwareVersion(bmcsim.FirmwareBIOS))
+		}
+
+		if err := db.AddHostToCart("bob", nil, db.BookingRequestHost{ManagementIP: sim.Address()}); err != nil {
+			t.Fatalf("Expected host to be available again, got %v", err)
+		}
+	})
+
+	t.Run("Hosts in a cart are not updated", func(t *testing.T) {
+		defer db.RemoveHostFromCart("bob", sim.Address())
+
+		if status, _ := apply(t, biosPackage, db.FirmwareUpdateMethodMultipartPush); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusConflict, status)
+		}
+	})
+
+	t.Run("A failed reservation releases the hosts reserved before it", func(t *testing.T) {
+		status, _, err := makeHTTPPostRequest(t, fmt.Sprintf("%s/%d/apply", packagesURL, biosPackage.ID), fmt.Sprintf(`{"management_ips":[%q,"10.0.77.1"],"method":%d}`, sim.Address(), db.FirmwareUpdateMethodMultipartPush), aliceCookies)
+		if err != nil || status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d: %v", fiber.StatusNotFound, status, err)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil || host.FirmwareUpdating {
+			t.Fatalf("Expected the first host to be released, got %+v (%v)", host, err)
+		}
+	})
+
+	t.Run("Multipart push installs a package", func(t *testing.T) {
+		var nicPackage db.FirmwarePackage = upload(t, db.FirmwareCategoryNIC, "22.40.1", "", bmcsim.FirmwareImage(bmcsim.FirmwareNIC, "22.40.1"))
+
+		status, jobID := apply(t, nicPackage, db.FirmwareUpdateMethodMultipartPush)
+		if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusAccepted, status)
+		}
+
+		if result := outcome(t, jobID); !result.Success || result.Version != "22.40.1" {
+			t.Fatalf("Unexpected update outcome %+v", result)
+		} else if sim.FirmwareUpdates()["Multipart"] != 1 {
+			t.Fatalf("Expected a multipart upload, got %v", sim.FirmwareUpdates())
+		}
+	})
+
+	t.Run("Failed update tasks are reported", func(t *testing.T) {
+		var broken db.FirmwarePackage = upload(t, db.FirmwareCategoryOther, "1.0", "", bmcsim.FirmwareImage("CPLD", "1.0"))
+
+		status, jobID := apply(t, broken, db.FirmwareUpdateMethodMultipartPush)
+		if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusAccepted, status)
+		}
+
+		if result := outcome(t, jobID); result.Success || !strings.Contains(result.Error, db.ErrFirmwareTaskFailed.Error()) {
+			t.Fatalf("Expected a failed task, got %+v", result)
+		}
+	})
+
+	t.Run("SimpleUpdate needs a base URL", func(t *testing.T) {
+		config.Config.Firmware.BaseURL = ""
+
+		if status, _ := apply(t, biosPackage, db.FirmwareUpdateMethodSimpleUpdate); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Deleting a package removes it", func(t *testing.T) {
+		if status, _, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/%d", packagesURL, biosPackage.ID), aliceCookies); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Delete request failed (%d): %v", status, err)
+		}
+
+		if _, err := db.FirmwarePackageByID(biosPackage.ID); !errors.Is(err, db.ErrFirmwarePackageNotFound) {
+			t.Fatalf("Expected package to be gone, got %v", err)
+		}
+	})
+}
+
+func TestIPMIFirmwareInventory(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var sim *bmcsim.IPMIServer = newSimulatedIPMI(t)
+	defer sim.Close()
+
+	sim.SetFirmwareRevision(3, 45)
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: sim.Address(), ManagementType: db.ManagementTypeIPMI}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	records, err := db.RefreshHostFirmware(sim.Address())
+	if err != nil {
+		t.Fatalf("Failed to refresh firmware: %v", err)
+	} else if len(records) != 1 || records[0].Category != db.FirmwareCategoryBMC || records[0].Version != "3.45" {
+		t.Fatalf("Expected the BMC revision, got %+v", records)
+	}
+
+	if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil || host.FirmwareCollectedAt.IsZero() {
+		t.Fatalf("Expected the collection time to be stored, got %+v (%v)", host, err)
+	}
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func TestRedfishEventSubscriptions(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	var previous string = config.Config.Management.EventListenerURL
+	defer func() { config.Config.Management.EventListenerURL = previous }()
+	config.Config.Management.EventListenerURL = fmt.Sprintf("http://%s/api/events/redfish", config.Config.WebServer.Address)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	var (
+		sim       *bmcsim.RedfishServer = newSimulatedRedfish(t)
+		rejecting *bmcsim.RedfishServer = newSimulatedRedfish(t)
+		hostsURL  string                = fmt.Sprintf("http://%s/api/hosts", config.Config.WebServer.Address)
+	)
+
+	defer sim.Close()
+	defer rejecting.Close()
+	rejecting.SetRejectSubscriptions(true)
+
+	register := func(t *testing.T, address string) {
+		if status, body, err := makeHTTPPostRequest(t, hostsURL, fmt.Sprintf(`{"management_ip":%q,"management_type":%d}`, address, db.ManagementTypeRedfish), aliceCookies); err != nil {
+			t.Fatalf("Host create request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+	}
+
+	t.Run("Registering a host subscribes to its events", func(t *testing.T) {
+		register(t, sim.Address())
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		} else if host.EventSubscriptionURI == "" || host.EventContext == "" {
+			t.Fatalf("Expected host to be subscribed, got %+v", host)
+		}
+
+		if destinations := sim.Subscriptions(); len(destinations) != 1 || destinations[0] != config.Config.Management.EventListenerURL {
+			t.Fatalf("Unexpected simulator subscriptions: %v", destinations)
+		}
+	})
+
+	t.Run("Power events update the host in real time", func(t *testing.T) {
+		sim.SetPowerState(bmcsim.PowerOn)
+
+		var deadline time.Time = time.Now().Add(10 * time.Second)
+		for {
+			host, err := db.Hosts.Select(sim.Address())
+			if err != nil {
+				t.Fatalf("Failed to select host: %v", err)
+			}
+
+			if host.LastKnownPowerState == db.PowerStateOn && !host.LastEventTime.IsZero() {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("Host power state not updated from event: %+v", host)
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	t.Run("Alerts are recorded", func(t *testing.T) {
+		sim.SendEvent("Simulator.1.0.FanFailed", "Fan 1 has failed.", "Critical")
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, fmt.Sprintf("%s/%s/events", hostsURL, sim.Address()), aliceCookies)
+		if err != nil {
+			t.Fatalf("Events request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+
+		var response struct {
+			Subscribed bool           `json:"subscribed"`
+			Events     []db.HostEvent `json:"events"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to unmarshal events: %v", err)
+		} else if !response.Subscribed || len(response.Events) < 2 {
+			t.Fatalf("Expected at least two events for a subscribed host, got %s", body)
+		} else if response.Events[0].MessageID != "Simulator.1.0.FanFailed" || response.Events[0].Severity != "Critical" {
+			t.Fatalf("Expected newest event to be the fan alert, got %+v", response.Events[0])
+		}
+	})
+
+	t.Run("Events with an unknown context are refused", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, config.Config.Management.EventListenerURL, `{"Context":"nope","Events":[]}`, nil); err != nil {
+			t.Fatalf("Event request failed: %v", err)
+		} else if status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Lost subscriptions are renewed", func(t *testing.T) {
+		sim.DropSubscriptions()
+
+		host, err := db.Hosts.Select(sim.Address())
+		if err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		}
+
+		if host.Management, err = db.NewHostManagementClient(host); err != nil {
+			t.Fatalf("Failed to connect to host: %v", err)
+		}
+
+		defer host.Management.Close()
+
+		if !db.EnsureHostEventSubscription(host) {
+			t.Fatalf("Expected host to be subscribed again")
+		} else if len(sim.Subscriptions()) != 1 {
+			t.Fatalf("Expected one simulator subscription, got %v", sim.Subscriptions())
+		}
+
+		if err = db.Hosts.Update(host); err != nil {
+			t.Fatalf("Failed to save host: %v", err)
+		}
+	})
+
+	t.Run("BMCs rejecting subscriptions fall back to polling", func(t *testing.T) {
+		register(t, rejecting.Address())
+
+		if host, err := db.Hosts.Select(rejecting.Address()); err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		} else if host.EventSubscriptionURI != "" {
+			t.Fatalf("Expected host not to be subscribed, got %q", host.EventSubscriptionURI)
+		}
+	})
+
+	t.Run("Deleting a host removes its subscription", func(t *testing.T) {
+		if status, _, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/%s", hostsURL, sim.Address()), aliceCookies); err != nil {
+			t.Fatalf("Delete request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusOK, status)
+		}
+
+		if destinations := sim.Subscriptions(); len(destinations) != 0 {
+			t.Fatalf("Expected subscription to be removed, got %v", destinations)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestHostRemoval(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	var hostsURL string = "http://" + config.Config.WebServer.Address + "/api/hosts"
+
+	for _, ip := range []string{"10.0.9.1", "10.0.9.2", "10.0.9.3", "10.0.9.4"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	var booking *db.Booking = &db.Booking{Name: "removal", DNSName: "removal.lab", CIDRBlock: "10.50.0.0/24", StartTime: time.Now(), EndTime: time.Now().Add(24 * time.Hour)}
+	if err := db.CreateBooking(booking); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	if err := db.AssignHostToBooking(booking.ID, "10.0.9.1"); err != nil {
+		t.Fatalf("Failed to assign host: %v", err)
+	}
+
+	if err := db.AddHostToCart("carol", nil, db.BookingRequestHost{ManagementIP: "10.0.9.2"}); err != nil {
+		t.Fatalf("Failed to add host to cart: %v", err)
+	}
+	defer db.ResetBookingCart("carol")
+
+	var request *db.BookingRequest = &db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob", Hosts: []db.BookingRequestHost{{ManagementIP: "10.0.9.3"}, {ManagementIP: "10.0.9.4"}}}
+	if err := db.AddBookingRequest(request); err != nil {
+		t.Fatalf("Failed to add booking request: %v", err)
+	}
+
+	remove := func(t *testing.T, ip string, force bool, cookies []*http.Cookie) (status int, archived db.ArchivedHost) {
+		status, body, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/%s?force=%t", hostsURL, ip, force), cookies)
+		if err != nil {
+			t.Fatalf("Delete request failed: %v", err)
+		}
+
+		json.Unmarshal([]byte(body), &archived)
+		return
+	}
+
+	t.Run("Hosts in use are refused", func(t *testing.T) {
+		for _, ip := range []string{"10.0.9.1", "10.0.9.2", "10.0.9.3"} {
+			if status, _ := remove(t, ip, false, aliceCookies); status != fiber.StatusConflict {
+				t.Fatalf("Expected status %d for host %s, got %d", fiber.StatusConflict, ip, status)
+			}
+
+			if host, err := db.Hosts.Select(ip); err != nil || host == nil {
+				t.Fatalf("Expected host %s to be kept: %v", ip, err)
+			}
+		}
+
+		if status, _ := remove(t, "10.0.9.9", false, aliceCookies); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for an unknown host, got %d", fiber.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Forced removal releases booked hosts", func(t *testing.T) {
+		status, archived := remove(t, "10.0.9.1", true, aliceCookies)
+		if status != fiber.StatusOK || archived.ReleasedBookingID != booking.ID || archived.ArchivedBy != "alice" {
+			t.Fatalf("Unexpected removal (%d): %+v", status, archived)
+		}
+
+		var record db.Host
+		if err := json.Unmarshal(archived.Record, &record); err != nil || !record.IsBooked || record.ActiveBookingID != booking.ID {
+			t.Fatalf("Expected the archive to keep the host as it was, got %s (%v)", archived.Record, err)
+		}
+
+		if current, err := db.BookingByID(booking.ID); err != nil || slices.Contains(current.OwnedHostManagementIPs, "10.0.9.1") {
+			t.Fatalf("Expected the booking to no longer own the host, got %+v (%v)", current, err)
+		}
+
+		notices, err := db.BookingNoticesForBooking(booking.ID)
+		if err != nil || len(notices) != 1 || notices[0].Kind != db.BookingNoticeHostRemoved {
+			t.Fatalf("Expected the booking to be notified, got %+v (%v)", notices, err)
+		}
+	})
+
+	t.Run("Forced removal empties carts and pending requests", func(t *testing.T) {
+		if status, archived := remove(t, "10.0.9.2", true, aliceCookies); status != fiber.StatusOK || archived.CartOwner != "carol" {
+			t.Fatalf("Unexpected removal (%d): %+v", status, archived)
+		}
+
+		if cart, err := db.BookingCartSnapshot("carol"); err != nil || len(cart.Hosts) != 0 {
+			t.Fatalf("Expected the host to be taken out of the cart, got %+v (%v)", cart, err)
+		}
+
+		if status, archived := remove(t, "10.0.9.3", true, aliceCookies); status != fiber.StatusOK || !slices.Equal(archived.RequestIDs, []int{request.ID}) {
+			t.Fatalf("Unexpected removal (%d): %+v", status, archived)
+		}
+
+		requests, err := db.BookingRequestsForBooking(booking.ID)
+		if err != nil || len(requests) != 1 || len(requests[0].Hosts) != 1 || requests[0].Hosts[0].ManagementIP != "10.0.9.4" {
+			t.Fatalf("Expected the request to keep only the remaining host, got %+v (%v)", requests, err)
+		}
+	})
+
+	t.Run("Removed hosts are archived", func(t *testing.T) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, hostsURL+"/archived", aliceCookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Archive request failed (%d): %v", status, err)
+		}
+
+		var archived []*db.ArchivedHost
+		if err = json.Unmarshal([]byte(body), &archived); err != nil || len(archived) != 3 || archived[0].ManagementIP != "10.0.9.3" {
+			t.Fatalf("Unexpected archive %s: %v", body, err)
+		}
+
+		if host, err := db.Hosts.Select("10.0.9.1"); err != nil || host != nil {
+			t.Fatalf("Expected the host to be gone, got %+v (%v)", host, err)
+		}
+
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: "10.0.9.1", ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Expected a removed host to be registrable again: %v", err)
+		}
+	})
+
+	t.Run("Hosts assigned while being removed are never left dangling", func(t *testing.T) {
+		for i := 10; i < 30; i++ {
+			var ip string = fmt.Sprintf("10.0.9.%d", i)
+			if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+				t.Fatalf("Failed to insert host: %v", err)
+			}
+
+			var (
+				wg                   sync.WaitGroup
+				removeErr, assignErr error
+			)
+
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				_, removeErr = db.RemoveHost(ip, "alice", false)
+			}()
+			go func() {
+				defer wg.Done()
+				assignErr = db.AssignHostToBooking(booking.ID, ip)
+			}()
+			wg.Wait()
+
+			if removeErr == nil && assignErr == nil {
+				t.Fatalf("Expected host %s to be either removed or assigned, not both", ip)
+			}
+
+			host, err := db.Hosts.Select(ip)
+			if err != nil {
+				t.Fatalf("Failed to read host %s: %v", ip, err)
+			}
+
+			current, err := db.BookingByID(booking.ID)
+			if err != nil {
+				t.Fatalf("Failed to read booking: %v", err)
+			}
+
+			if host == nil && slices.Contains(current.OwnedHostManagementIPs, ip) {
+				t.Fatalf("Expected the booking not to own the removed host %s", ip)
+			}
+		}
+	})
+}
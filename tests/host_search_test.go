@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestHostSearch(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator)
+
+	bobCookies, err := loginAndGetCookies(t, "bob", "bob")
+	if err != nil {
+		t.Fatalf("Failed to login as bob: %v", err)
+	}
+
+	var hosts []*db.Host = []*db.Host{
+		{
+			ManagementIP: "10.0.6.1", Vendor: db.VendorDELL, FormFactor: db.FormFactorRackmount, Model: "PowerEdge R750", LastKnownPowerState: db.PowerStateOff,
+			Specs: db.HostSpecs{
+				Processor: db.HostCPUSpecs{Manufacturer: "Intel", Count: 2, Cores: 28, Threads: 112},
+				Memory:    db.HostMemorySpecs{SizeGB: 512},
+				Drives:    []db.HostDriveSpecs{{Name: "0", MediaType: "SSD", Protocol: "NVMe", CapacityGB: 3840}},
+			},
+		},
+		{
+			ManagementIP: "10.0.6.2", Vendor: db.VendorDELL, FormFactor: db.FormFactorRackmount, Model: "PowerEdge R650", LastKnownPowerState: db.PowerStateOn,
+			Specs: db.HostSpecs{
+				Processor: db.HostCPUSpecs{Manufacturer: "Intel", Count: 2, Cores: 16, Threads: 64},
+				Memory:    db.HostMemorySpecs{SizeGB: 256},
+				Drives:    []db.HostDriveSpecs{{Name: "0", MediaType: "SSD", Protocol: "NVMe", CapacityGB: 1920}},
+			},
+		},
+		{
+			ManagementIP: "10.0.6.3", Vendor: db.VendorHPE, FormFactor: db.FormFactorTower, Model: "ProLiant ML350", LastKnownPowerState: db.PowerStateOff,
+			Specs: db.HostSpecs{
+				Processor: db.HostCPUSpecs{Manufacturer: "AMD", Count: 1, Cores: 64, Threads: 128},
+				Memory:    db.HostMemorySpecs{SizeGB: 1024},
+				Drives:    []db.HostDriveSpecs{{Name: "0", MediaType: "HDD", Protocol: "SAS", CapacityGB: 8000}},
+			},
+		},
+		{
+			ManagementIP: "10.0.6.4", Vendor: db.VendorDELL, FormFactor: db.FormFactorRackmount, Model: "PowerEdge R760", LastKnownPowerState: db.PowerStateOff,
+			IsBooked: true, ActiveBookingID: 42,
+			Specs: db.HostSpecs{
+				Processor: db.HostCPUSpecs{Manufacturer: "Intel", Count: 2, Cores: 32, Threads: 128},
+				Memory:    db.HostMemorySpecs{SizeGB: 768},
+				Drives:    []db.HostDriveSpecs{{Name: "0", MediaType: "SSD", Protocol: "NVMe", CapacityGB: 7680}},
+			},
+		},
+	}
+
+	for _, host := range hosts {
+		if err := db.Hosts.Insert(host); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	search := func(t *testing.T, path string) (status int, found []string, total string) {
+		request, err := http.NewRequest("GET", "http://"+config.Config.WebServer.Address+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+
+		for _, cookie := range bobCookies {
+			request.AddCookie(cookie)
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Search request failed: %v", err)
+		}
+
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+		status, total = response.StatusCode, response.Header.Get("X-Total-Count")
+
+		var results []*db.Host
+		if status == fiber.StatusOK {
+			if err = json.Unmarshal(body, &results); err != nil {
+				t.Fatalf("Failed to unmarshal hosts: %v", err)
+			}
+		}
+
+		for _, host := range results {
+			found = append(found, host.ManagementIP)
+		}
+
+		return
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"Memory, cores, NVMe, Dell and powered off", "?min_memory_gb=256&min_cores=32&drive_protocol=nvme&vendor=1&power_state=2", []string{"10.0.6.1", "10.0.6.4"}},
+		{"Several vendors", "?vendor=1,2&form_factor=2", []string{"10.0.6.3"}},
+		{"Model and CPU", "?model=poweredge&cpu_manufacturer=intel&min_threads=100", []string{"10.0.6.1", "10.0.6.4"}},
+		{"Available only", "?available=true", []string{"10.0.6.1", "10.0.6.2", "10.0.6.3"}},
+		{"Unavailable only", "?available=false", []string{"10.0.6.4"}},
+		{"Sorted by memory, descending", "?sort=-memory", []string{"10.0.6.3", "10.0.6.4", "10.0.6.1", "10.0.6.2"}},
+		{"Sorted by cores", "?sort=cores&vendor=1", []string{"10.0.6.2", "10.0.6.1", "10.0.6.4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if status, found, _ := search(t, "/api/hosts"+tc.query); status != fiber.StatusOK || !slices.Equal(found, tc.expected) {
+				t.Fatalf("Expected %v, got %v (%d)", tc.expected, found, status)
+			}
+		})
+	}
+
+	t.Run("Pagination reports the total", func(t *testing.T) {
+		if status, found, total := search(t, "/api/hosts?sort=storage&per_page=3&page=2"); status != fiber.StatusOK || total != "4" || !slices.Equal(found, []string{"10.0.6.3"}) {
+			t.Fatalf("Unexpected page %v with total %q (%d)", found, total, status)
+		}
+
+		if _, found, total := search(t, "/api/hosts?per_page=3&page=5"); len(found) != 0 || total != "4" {
+			t.Fatalf("Expected an empty page past the end, got %v with total %q", found, total)
+		}
+	})
+
+	t.Run("Bad queries are rejected", func(t *testing.T) {
+		if status, _, _ := search(t, "/api/hosts?sort=price"); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d for an unknown sort key, got %d", fiber.StatusBadRequest, status)
+		}
+
+		if status, _, _ := search(t, "/api/hosts?vendor=dell"); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d for a malformed vendor, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("The cart accepts the same filters", func(t *testing.T) {
+		if status, found, total := search(t, "/api/bookings/cart/hosts/available?vendor=1&sort=-memory&per_page=1"); status != fiber.StatusOK || total != "2" || !slices.Equal(found, []string{"10.0.6.1"}) {
+			t.Fatalf("Unexpected cart page %v with total %q (%d)", found, total, status)
+		}
+	})
+}
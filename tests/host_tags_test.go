@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestHostTagsAndLocations(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator, "cs450")
+	auth.AddUserInjection("carol", "carol", auth.AuthPermsBookingCreator)
+
+	var (
+		baseURL string = "http://" + config.Config.WebServer.Address
+		cookies        = map[string][]*http.Cookie{}
+	)
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+	}
+
+	for _, ip := range []string{"10.0.7.1", "10.0.7.2", "10.0.7.3"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	hostIPs := func(t *testing.T, username, path string) (found []string) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+path, cookies[username])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Request %s failed (%d): %v %s", path, status, err, body)
+		}
+
+		var hosts []*db.Host
+		if err = json.Unmarshal([]byte(body), &hosts); err != nil {
+			t.Fatalf("Failed to unmarshal hosts: %v", err)
+		}
+
+		for _, host := range hosts {
+			found = append(found, host.ManagementIP)
+		}
+
+		return
+	}
+
+	t.Run("Admins edit host tags", func(t *testing.T) {
+		if status, body, err := makeHTTPPutRequest(t, baseURL+"/api/hosts/10.0.7.1/tags", `{"tags":["Course-CS450"," gpu-less-hpc ","course-cs450"]}`, cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Set tags failed (%d): %v %s", status, err, body)
+		}
+
+		if status, _, err := makeHTTPPostRequest(t, baseURL+"/api/hosts/10.0.7.2/tags/do-not-book", "", cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Add tag failed (%d): %v", status, err)
+		}
+
+		if status, _, err := makeHTTPPostRequest(t, baseURL+"/api/hosts/10.0.7.3/tags/gpu-less-hpc", "", cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Add tag failed (%d): %v", status, err)
+		}
+
+		if status, _, _ := makeHTTPPutRequest(t, baseURL+"/api/hosts/10.0.7.3/tags", `{"tags":["not a tag!"]}`, cookies["alice"]); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d for an invalid tag, got %d", fiber.StatusBadRequest, status)
+		}
+
+		if status, _, _ := makeHTTPPostRequest(t, baseURL+"/api/hosts/10.0.7.3/tags/extra", "", cookies["bob"]); status == fiber.StatusOK {
+			t.Fatalf("Expected users to be unable to tag hosts")
+		}
+
+		if host, err := db.Hosts.Select("10.0.7.1"); err != nil || host == nil || !slices.Equal(host.Tags, []string{"course-cs450", "gpu-less-hpc"}) {
+			t.Fatalf("Expected normalized tags, got %+v (%v)", host, err)
+		}
+	})
+
+	t.Run("Tags are searchable", func(t *testing.T) {
+		if found := hostIPs(t, "alice", "/api/hosts?tag=gpu-less-hpc"); !slices.Equal(found, []string{"10.0.7.1", "10.0.7.3"}) {
+			t.Fatalf("Unexpected hosts %v", found)
+		}
+
+		if found := hostIPs(t, "alice", "/api/hosts?tag=gpu-less-hpc&exclude_tag=course-cs450"); !slices.Equal(found, []string{"10.0.7.3"}) {
+			t.Fatalf("Unexpected hosts %v", found)
+		}
+	})
+
+	t.Run("Hosts are placed in racks", func(t *testing.T) {
+		for ip, location := range map[string]string{
+			"10.0.7.1": `{"site":"DC1","rack":"R01","unit":10,"pdu":"pdu-r01-a","pdu_port":"7"}`,
+			"10.0.7.2": `{"site":"DC1","rack":"R01","unit":12,"pdu":"pdu-r01-a","pdu_port":"8"}`,
+		} {
+			if status, body, err := makeHTTPPutRequest(t, baseURL+"/api/hosts/"+ip+"/location", location, cookies["alice"]); err != nil || status != fiber.StatusOK {
+				t.Fatalf("Set location failed (%d): %v %s", status, err, body)
+			}
+		}
+
+		if status, _, _ := makeHTTPPutRequest(t, baseURL+"/api/hosts/10.0.7.3/location", `{"site":"DC1","rack":"R01","unit":10}`, cookies["alice"]); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a taken unit, got %d", fiber.StatusConflict, status)
+		}
+
+		if status, _, _ := makeHTTPPutRequest(t, baseURL+"/api/hosts/10.0.7.3/location", `{"site":"DC1","rack":"R02","pdu":"pdu-r01-a","pdu_port":"7"}`, cookies["alice"]); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a taken PDU port, got %d", fiber.StatusConflict, status)
+		}
+
+		if status, _, _ := makeHTTPPutRequest(t, baseURL+"/api/hosts/10.0.7.3/location", `{"site":"DC2","unit":4}`, cookies["alice"]); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d for a unit without a rack, got %d", fiber.StatusBadRequest, status)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/racks", cookies["bob"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Racks request failed (%d): %v", status, err)
+		}
+
+		var racks []*db.Rack
+		if err = json.Unmarshal([]byte(body), &racks); err != nil {
+			t.Fatalf("Failed to unmarshal racks: %v", err)
+		} else if len(racks) != 1 || len(racks[0].Hosts) != 2 || racks[0].Hosts[0].ManagementIP != "10.0.7.2" || racks[0].Hosts[1].PDUPort != "7" {
+			t.Fatalf("Unexpected rack layout %s", body)
+		}
+
+		if found := hostIPs(t, "alice", "/api/hosts?site=dc1&rack=r01"); !slices.Equal(found, []string{"10.0.7.1", "10.0.7.2"}) {
+			t.Fatalf("Unexpected hosts %v", found)
+		}
+	})
+
+	t.Run("Restricted tags limit booking to groups", func(t *testing.T) {
+		if status, body, err := makeHTTPPutRequest(t, baseURL+"/api/tags/restrictions/course-cs450", `{"allowed_groups":["cs450"]}`, cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Set restriction failed (%d): %v %s", status, err, body)
+		}
+
+		if status, _, err := makeHTTPPutRequest(t, baseURL+"/api/tags/restrictions/do-not-book", `{"allowed_groups":[]}`, cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Set restriction failed (%d): %v", status, err)
+		}
+
+		if found := hostIPs(t, "bob", "/api/bookings/cart/hosts/available"); !slices.Equal(found, []string{"10.0.7.1", "10.0.7.3"}) {
+			t.Fatalf("Expected bob to see the course host, got %v", found)
+		}
+
+		if found := hostIPs(t, "carol", "/api/bookings/cart/hosts/available"); !slices.Equal(found, []string{"10.0.7.3"}) {
+			t.Fatalf("Expected carol to only see unrestricted hosts, got %v", found)
+		}
+
+		if found := hostIPs(t, "carol", "/api/hosts?available=false"); !slices.Equal(found, []string{"10.0.7.1", "10.0.7.2"}) {
+			t.Fatalf("Expected restricted hosts to be listed as unavailable, got %v", found)
+		}
+
+		if status, _, _ := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", `{"management_ip":"10.0.7.1"}`, cookies["carol"]); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a restricted host, got %d", fiber.StatusForbidden, status)
+		}
+
+		if status, body, err := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", `{"management_ip":"10.0.7.1"}`, cookies["bob"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Expected bob to add the course host (%d): %v %s", status, err, body)
+		}
+
+		if status, _, _ := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", `{"management_ip":"10.0.7.2"}`, cookies["bob"]); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a do-not-book host, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Tags are summarized with their restrictions", func(t *testing.T) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/tags", cookies["bob"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Tags request failed (%d): %v", status, err)
+		}
+
+		var summaries []*db.TagSummary
+		if err = json.Unmarshal([]byte(body), &summaries); err != nil {
+			t.Fatalf("Failed to unmarshal tags: %v", err)
+		}
+
+		var counts map[string]string = map[string]string{}
+		for _, summary := range summaries {
+			counts[summary.Tag] = fmt.Sprintf("%d/%v", summary.Hosts, summary.Restriction != nil)
+		}
+
+		if len(counts) != 3 || counts["gpu-less-hpc"] != "2/false" || counts["course-cs450"] != "1/true" || counts["do-not-book"] != "1/true" {
+			t.Fatalf("Unexpected tag summary %s", body)
+		}
+	})
+
+	t.Run("Lifting a restriction", func(t *testing.T) {
+		if status, _, err := makeHTTPDeleteRequest(t, baseURL+"/api/tags/restrictions/do-not-book", cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Delete restriction failed (%d): %v", status, err)
+		}
+
+		if status, _, _ := makeHTTPDeleteRequest(t, baseURL+"/api/tags/restrictions/do-not-book", cookies["alice"]); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for a missing restriction, got %d", fiber.StatusNotFound, status)
+		}
+
+		if status, _, err := makeHTTPDeleteRequest(t, baseURL+"/api/hosts/10.0.7.2/tags/do-not-book", cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Remove tag failed (%d): %v", status, err)
+		}
+
+		if found := hostIPs(t, "carol", "/api/bookings/cart/hosts/available"); !slices.Equal(found, []string{"10.0.7.2", "10.0.7.3"}) {
+			t.Fatalf("Expected the host to be bookable again, got %v", found)
+		}
+	})
+}
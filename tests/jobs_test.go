@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestJobs(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	t.Run("Successful job records progress and result", func(t *testing.T) {
+		job, err := db.EnqueueJob(db.JobKindHostPower, "10.0.0.1", "alice", func(handle *db.JobHandle) error {
+			handle.Progress(50, "Halfway")
+			return handle.SetResult(map[string]int{"answer": 42})
+		})
+
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+
+		if job.ID == 0 || job.Status != db.JobStatusQueued || job.CreatedBy != "alice" {
+			t.Fatalf("Unexpected queued job: %+v", job)
+		}
+
+		if job, err = db.WaitForJob(job.ID, 5*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		}
+
+		if job.Status != db.JobStatusSucceeded || job.Progress != 100 {
+			t.Fatalf("Expected succeeded job at 100%%, got %s at %d%%", job.Status, job.Progress)
+		}
+
+		var result map[string]int
+		if err = json.Unmarshal(job.Result, &result); err != nil || result["answer"] != 42 {
+			t.Fatalf("Unexpected job result %s: %v", job.Result, err)
+		}
+	})
+
+	t.Run("Failed job stores the error", func(t *testing.T) {
+		job, err := db.EnqueueJob(db.JobKindHostPower, "10.0.0.2", "bob", func(handle *db.JobHandle) error {
+			return errors.New("bmc exploded")
+		})
+
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+
+		if job, err = db.WaitForJob(job.ID, 5*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		}
+
+		if job.Status != db.JobStatusFailed || job.Message != "bmc exploded" {
+			t.Fatalf("Expected failed job with message, got %s: %s", job.Status, job.Message)
+		}
+	})
+
+	t.Run("Jobs are listed per creator", func(t *testing.T) {
+		if records, err := db.JobsCreatedBy("alice"); err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		} else if len(records) != 1 || records[0].Target != "10.0.0.1" {
+			t.Fatalf("Expected one job for alice, got %+v", records)
+		}
+	})
+}
+
+func TestJobsAPI(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsUser)
+	auth.AddUserInjection("dave", "dave", auth.AuthPermsUser)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	bobCookies, err := loginAndGetCookies(t, "bob", "bob")
+	if err != nil {
+		t.Fatalf("Failed to login as bob: %v", err)
+	}
+
+	daveCookies, err := loginAndGetCookies(t, "dave", "dave")
+	if err != nil {
+		t.Fatalf("Failed to login as dave: %v", err)
+	}
+
+	job, err := db.EnqueueJob(db.JobKindHostPower, "10.0.0.1", "bob", func(handle *db.JobHandle) error { return nil })
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	var jobURL string = fmt.Sprintf("http://%s/api/jobs/%d", config.Config.WebServer.Address, job.ID)
+
+	t.Run("Creator and admin can read the job", func(t *testing.T) {
+		for _, cookies := range [][]*http.Cookie{bobCookies, aliceCookies} {
+			if status, body, err := makeHTTPGetRequestWithCookies(t, jobURL, cookies); err != nil {
+				t.Fatalf("Job request failed: %v", err)
+			} else if status != fiber.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+			}
+		}
+	})
+
+	t.Run("Other users cannot read the job", func(t *testing.T) {
+		if status, _, err := makeHTTPGetRequestWithCookies(t, jobURL, daveCookies); err != nil {
+			t.Fatalf("Job request failed: %v", err)
+		} else if status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Unknown job is not found", func(t *testing.T) {
+		if status, _, err := makeHTTPGetRequestWithCookies(t, fmt.Sprintf("http://%s/api/jobs/9999", config.Config.WebServer.Address), aliceCookies); err != nil {
+			t.Fatalf("Job request failed: %v", err)
+		} else if status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Power action on unknown host is not found", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, fmt.Sprintf("http://%s/api/hosts/10.9.9.9/power/%d", config.Config.WebServer.Address, db.PowerActionPowerOn), "", aliceCookies); err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Power action is queued as a job", func(t *testing.T) {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: "127.0.0.1", ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("http://%s/api/hosts/127.0.0.1/power/%d", config.Config.WebServer.Address, db.PowerActionPowerOn), "", aliceCookies)
+		if err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusAccepted, status, body)
+		}
+
+		var queued struct {
+			JobID int `json:"job_id"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &queued); err != nil {
+			t.Fatalf("Failed to unmarshal queued job: %v", err)
+		}
+
+		// Nothing listens on the loopback BMC, so the job must fail rather than hang the request
+		if finished, err := db.WaitForJob(queued.JobID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for power job: %v", err)
+		} else if finished.Status != db.JobStatusFailed || finished.CreatedBy != "alice" {
+			t.Fatalf("Expected failed power job created by alice, got %+v", finished)
+		}
+	})
+}
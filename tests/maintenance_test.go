@@ -0,0 +1,233 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestHostMaintenance(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator)
+
+	var (
+		baseURL string    = "http://" + config.Config.WebServer.Address
+		cookies           = map[string][]*http.Cookie{}
+		now     time.Time = time.Now()
+	)
+
+	for _, username := range []string{"alice", "bob"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+	}
+
+	for _, ip := range []string{"10.0.8.1", "10.0.8.2", "10.0.8.3"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	var held *db.Booking = &db.Booking{Name: "held", DNSName: "held.lab", CIDRBlock: "10.30.0.0/24", StartTime: now, EndTime: now.Add(48 * time.Hour)}
+	if err := db.CreateBooking(held); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	if err := db.AssignHostToBooking(held.ID, "10.0.8.3"); err != nil {
+		t.Fatalf("Failed to assign host: %v", err)
+	}
+
+	schedule := func(t *testing.T, ip, body string) (status int, window db.MaintenanceWindow) {
+		status, response, err := makeHTTPPostRequest(t, baseURL+"/api/hosts/"+ip+"/maintenance", body, cookies["alice"])
+		if err != nil {
+			t.Fatalf("Schedule request failed: %v", err)
+		}
+
+		json.Unmarshal([]byte(response), &window)
+		return
+	}
+
+	available := func(t *testing.T) (found []string) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/bookings/cart/hosts/available", cookies["bob"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Available hosts request failed (%d): %v", status, err)
+		}
+
+		var hosts []*db.Host
+		json.Unmarshal([]byte(body), &hosts)
+		for _, host := range hosts {
+			found = append(found, host.ManagementIP)
+		}
+
+		return
+	}
+
+	var immediate db.MaintenanceWindow
+
+	t.Run("Windows are validated", func(t *testing.T) {
+		for body, expected := range map[string]int{
+			`{"reason":""}`: fiber.StatusBadRequest,
+			fmt.Sprintf(`{"reason":"psu","start_time":%q,"end_time":%q}`, now.Add(2*time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)): fiber.StatusBadRequest,
+		} {
+			if status, _ := schedule(t, "10.0.8.1", body); status != expected {
+				t.Fatalf("Expected status %d for %s, got %d", expected, body, status)
+			}
+		}
+
+		if status, _ := schedule(t, "10.9.9.9", `{"reason":"psu"}`); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for an unknown host, got %d", fiber.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Hosts in maintenance are drained from the cart", func(t *testing.T) {
+		var status int
+		if status, immediate = schedule(t, "10.0.8.1", `{"reason":"replacing a DIMM"}`); status != fiber.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusCreated, status)
+		}
+
+		if host, err := db.Hosts.Select("10.0.8.1"); err != nil || host == nil || !host.InMaintenance() || host.Maintenance.SetBy != "alice" || host.Maintenance.Reason != "replacing a DIMM" {
+			t.Fatalf("Expected the host to be in maintenance, got %+v (%v)", host, err)
+		}
+
+		if found := available(t); !slices.Equal(found, []string{"10.0.8.2"}) {
+			t.Fatalf("Expected only the free host to be available, got %v", found)
+		}
+
+		if status, _, _ := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", `{"management_ip":"10.0.8.1"}`, cookies["bob"]); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a host in maintenance, got %d", fiber.StatusConflict, status)
+		}
+
+		if err := db.AssignHostToBooking(held.ID, "10.0.8.1"); !errors.Is(err, db.ErrHostInMaintenance) {
+			t.Fatalf("Expected the host to be refused for bookings, got %v", err)
+		}
+	})
+
+	t.Run("Overlapping windows on a host are refused", func(t *testing.T) {
+		// 10.0.8.1 is in maintenance until further notice
+		if status, _ := schedule(t, "10.0.8.1", fmt.Sprintf(`{"reason":"psu","start_time":%q,"end_time":%q}`, now.Add(24*time.Hour).Format(time.RFC3339), now.Add(26*time.Hour).Format(time.RFC3339))); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusConflict, status)
+		}
+
+		if windows, err := db.MaintenanceWindowsForHost("10.0.8.1"); err != nil || len(windows) != 1 {
+			t.Fatalf("Expected a single window, got %+v (%v)", windows, err)
+		}
+	})
+
+	t.Run("Scheduled maintenance blocks overlapping bookings", func(t *testing.T) {
+		status, future := schedule(t, "10.0.8.2", fmt.Sprintf(`{"reason":"firmware","start_time":%q,"end_time":%q}`, now.Add(time.Hour).Format(time.RFC3339), now.Add(3*time.Hour).Format(time.RFC3339)))
+		if status != fiber.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusCreated, status)
+		}
+
+		if status, _, err := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", `{"management_ip":"10.0.8.2"}`, cookies["bob"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Expected the host to be available until its window starts (%d): %v", status, err)
+		}
+
+		status, body, err := makeHTTPPostRequest(t, baseURL+"/api/bookings", `{"name":"bob's lab","duration_days":1}`, cookies["bob"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Booking create failed (%d): %v %s", status, err, body)
+		}
+
+		var booking db.Booking
+		json.Unmarshal([]byte(body), &booking)
+
+		var requestURL string = fmt.Sprintf("%s/api/bookings/%d/requests", baseURL, booking.ID)
+		if status, _, _ := makeHTTPPostRequest(t, requestURL, `{"justification":"class"}`, cookies["bob"]); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a booking overlapping maintenance, got %d", fiber.StatusConflict, status)
+		}
+
+		if status, _, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/api/maintenance/%d", baseURL, future.ID), cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Cancel maintenance failed (%d): %v", status, err)
+		}
+
+		if status, body, err := makeHTTPPostRequest(t, requestURL, `{"justification":"class"}`, cookies["bob"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Expected the request once maintenance was cancelled (%d): %v %s", status, err, body)
+		}
+	})
+
+	t.Run("Bookings holding a host are notified", func(t *testing.T) {
+		var start, end time.Time = now.Add(2 * time.Hour), now.Add(4 * time.Hour)
+		if status, _ := schedule(t, "10.0.8.3", fmt.Sprintf(`{"reason":"rack move","start_time":%q,"end_time":%q}`, start.Format(time.RFC3339), end.Format(time.RFC3339))); status != fiber.StatusCreated {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusCreated, status)
+		}
+
+		for _, at := range []time.Time{start.Add(time.Minute), end.Add(time.Minute)} {
+			if err := db.RefreshMaintenance(at); err != nil {
+				t.Fatalf("Failed to refresh maintenance: %v", err)
+			}
+		}
+
+		if host, err := db.Hosts.Select("10.0.8.3"); err != nil || host == nil || host.InMaintenance() || host.ActiveBookingID != held.ID {
+			t.Fatalf("Expected the host back in service and still booked, got %+v (%v)", host, err)
+		}
+
+		var noticesURL string = fmt.Sprintf("%s/api/bookings/%d/notices", baseURL, held.ID)
+		if status, _, _ := makeHTTPGetRequestWithCookies(t, noticesURL, cookies["bob"]); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a non-member, got %d", fiber.StatusForbidden, status)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, noticesURL, cookies["alice"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Notices request failed (%d): %v", status, err)
+		}
+
+		var (
+			notices []*db.BookingNotice
+			kinds   []db.BookingNoticeKind
+		)
+
+		if err = json.Unmarshal([]byte(body), &notices); err != nil {
+			t.Fatalf("Failed to unmarshal notices: %v", err)
+		}
+
+		for _, notice := range notices {
+			kinds = append(kinds, notice.Kind)
+		}
+
+		if !slices.Equal(kinds, []db.BookingNoticeKind{db.BookingNoticeMaintenanceScheduled, db.BookingNoticeMaintenanceStarted, db.BookingNoticeMaintenanceEnded}) {
+			t.Fatalf("Unexpected notices %s", body)
+		}
+	})
+
+	t.Run("Ending maintenance returns the host to service", func(t *testing.T) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/maintenance", cookies["alice"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Maintenance list failed (%d): %v", status, err)
+		}
+
+		var windows []*db.MaintenanceWindow
+		if json.Unmarshal([]byte(body), &windows); len(windows) != 2 {
+			t.Fatalf("Expected the open window and the rack move, got %s", body)
+		}
+
+		if status, _, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/api/maintenance/%d", baseURL, immediate.ID), cookies["alice"]); err != nil || status != fiber.StatusOK {
+			t.Fatalf("End maintenance failed (%d): %v", status, err)
+		}
+
+		if found := available(t); !slices.Contains(found, "10.0.8.1") {
+			t.Fatalf("Expected the host to be available again, got %v", found)
+		}
+
+		if status, _, _ := makeHTTPDeleteRequest(t, baseURL+"/api/maintenance/999", cookies["alice"]); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for an unknown window, got %d", fiber.StatusNotFound, status)
+		}
+	})
+}
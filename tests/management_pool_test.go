@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func TestManagementPoolReusesSessions(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var sim *bmcsim.RedfishServer = newSimulatedRedfish(t)
+	defer sim.Close()
+
+	var previous = config.Config.Management
+	defer func() { config.Config.Management = previous }()
+	config.Config.Management.PoolMaxSessionsPerBMC = 1
+
+	// An old BMC with a single session slot
+	sim.SetMaxSessions(1)
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: sim.Address(), ManagementType: db.ManagementTypeRedfish}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	t.Run("Sequential callers share one session", func(t *testing.T) {
+		for range 5 {
+			host, err := db.Hosts.Select(sim.Address())
+			if err != nil || host == nil {
+				t.Fatalf("Failed to select host: %v", err)
+			}
+
+			if host.Management, err = db.AcquireHostManagementClient(host); err != nil {
+				t.Fatalf("Failed to acquire client: %v", err)
+			}
+
+			if _, err = host.Management.PowerState(true); err != nil {
+				t.Fatalf("Failed to read power state: %v", err)
+			}
+
+			host.Management.Close()
+		}
+
+		if logins := sim.SessionLogins(); logins != 1 {
+			t.Fatalf("Expected one login, got %d", logins)
+		}
+	})
+
+	t.Run("Concurrent callers wait for the session slot", func(t *testing.T) {
+		var (
+			wg     sync.WaitGroup
+			errs   []error
+			errsMu sync.Mutex
+		)
+
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if _, err := db.RunHostPowerAction(sim.Address(), db.PowerActionPowerOn, nil); err != nil {
+					errsMu.Lock()
+					errs = append(errs, err)
+					errsMu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if len(errs) != 0 {
+			t.Fatalf("Expected all power actions to succeed, got %v", errs)
+		} else if sim.PowerState() != bmcsim.PowerOn {
+			t.Fatalf("Expected simulator to be on, got %s", sim.PowerState())
+		}
+	})
+
+	t.Run("Reused sessions see power changes made since they logged in", func(t *testing.T) {
+		// Powered off behind the pooled session's back, which still has the host cached as on
+		sim.SetPowerState(bmcsim.PowerOff)
+
+		if state, err := db.RunHostPowerAction(sim.Address(), db.PowerActionPowerOn, nil); err != nil || state != db.PowerStateOn {
+			t.Fatalf("Expected the host to be powered on, got %s: %v", state.String(), err)
+		} else if sim.PowerState() != bmcsim.PowerOn {
+			t.Fatalf("Expected simulator to be on, got %s", sim.PowerState())
+		}
+
+		if logins := sim.SessionLogins(); logins != 1 {
+			t.Fatalf("Expected the pooled session to be reused, got %d logins", logins)
+		}
+	})
+
+	t.Run("Idle sessions are logged out", func(t *testing.T) {
+		if sim.ActiveSessions() != 1 {
+			t.Fatalf("Expected the pooled session to still be open, got %d", sim.ActiveSessions())
+		}
+
+		db.ExpireIdleManagementClients(time.Now().Add(time.Duration(config.Config.Management.PoolIdleSeconds+1) * time.Second))
+
+		if sim.ActiveSessions() != 0 {
+			t.Fatalf("Expected idle session to be logged out, got %d", sim.ActiveSessions())
+		}
+	})
+}
+
+func TestManagementPoolBackoff(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var previous = config.Config.Management
+	defer func() { config.Config.Management = previous }()
+	config.Config.Management.BackoffBaseSeconds = 1
+	config.Config.Management.BackoffMaxSeconds = 60
+
+	// Grab a port and close the simulator so nothing answers on it
+	var (
+		sim     *bmcsim.RedfishServer = newSimulatedRedfish(t)
+		address string                = sim.Address()
+	)
+
+	sim.Close()
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: address, ManagementType: db.ManagementTypeRedfish, BMCReachable: true}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	acquire := func() error {
+		host, err := db.Hosts.Select(address)
+		if err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		}
+
+		if host.Management, err = db.AcquireHostManagementClient(host); err == nil {
+			host.Management.Close()
+		}
+
+		return err
+	}
+
+	t.Run("Unreachable BMCs are flagged and backed off", func(t *testing.T) {
+		if err := acquire(); err == nil {
+			t.Fatalf("Expected a connection error")
+		}
+
+		if err := acquire(); !errors.Is(err, db.ErrBMCBackoff) {
+			t.Fatalf("Expected backoff error, got %v", err)
+		}
+
+		if host, err := db.Hosts.Select(address); err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		} else if host.BMCReachable || host.BMCLastError == "" {
+			t.Fatalf("Expected host to be flagged unreachable, got %+v", host)
+		}
+	})
+
+	t.Run("Backoff grows with consecutive failures", func(t *testing.T) {
+		stat := func() (found db.ManagementPoolStats) {
+			for _, stat := range db.ManagementPoolSnapshot() {
+				if stat.ManagementIP == address {
+					found = stat
+				}
+			}
+
+			return
+		}
+
+		// The periodic refresh may also retry the host, so keep going until this test made the attempt
+		for range 5 {
+			time.Sleep(time.Until(stat().BackoffUntil) + 50*time.Millisecond)
+
+			if err := acquire(); errors.Is(err, db.ErrBMCBackoff) {
+				continue
+			} else if err == nil {
+				t.Fatalf("Expected a connection error after backoff")
+			}
+
+			var (
+				current  db.ManagementPoolStats = stat()
+				expected time.Duration          = time.Second << (current.Failures - 1)
+				window   time.Duration          = time.Until(current.BackoffUntil)
+			)
+
+			if current.Failures < 2 || window > expected || window < expected-500*time.Millisecond {
+				t.Fatalf("Expected a %s backoff after %d failures, got %s", expected, current.Failures, window)
+			}
+
+			return
+		}
+
+		t.Fatalf("Never got to retry the host after backoff")
+	})
+
+	t.Run("Reset backoff allows an immediate retry", func(t *testing.T) {
+		db.ResetBMCBackoff(address)
+
+		if err := acquire(); err == nil || errors.Is(err, db.ErrBMCBackoff) {
+			t.Fatalf("Expected a connection attempt after reset, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func TestNICInventoryAndProvisioning(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	var (
+		sim      *bmcsim.RedfishServer = newSimulatedRedfish(t)
+		hardware bmcsim.Hardware       = bmcsim.DefaultHardware()
+		baseURL  string                = "http://" + config.Config.WebServer.Address
+		nicURL   string                = fmt.Sprintf("%s/api/hosts/%s/provisioning-nic", baseURL, sim.Address())
+	)
+
+	defer sim.Close()
+
+	lookup := func(t *testing.T, mac string) (status int, response struct {
+		ManagementIP string  `json:"management_ip"`
+		Provisioning bool    `json:"provisioning"`
+		Host         db.Host `json:"host"`
+	}) {
+		status, body, err := makeHTTPGetRequest(t, baseURL+"/api/hosts/by-mac/"+url.PathEscape(mac))
+		if err != nil {
+			t.Fatalf("Lookup request failed: %v", err)
+		}
+
+		json.Unmarshal([]byte(body), &response)
+		return
+	}
+
+	t.Run("Registering a host collects its NICs", func(t *testing.T) {
+		if status, body, err := makeHTTPPostRequest(t, baseURL+"/api/hosts", fmt.Sprintf(`{"management_ip":%q,"management_type":%d}`, sim.Address(), db.ManagementTypeRedfish), aliceCookies); err != nil {
+			t.Fatalf("Host create request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		}
+
+		host, err := db.Hosts.Select(sim.Address())
+		if err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		}
+
+		if len(host.Specs.NICs) != len(hardware.NICs) {
+			t.Fatalf("Expected %d NICs, got %+v", len(hardware.NICs), host.Specs.NICs)
+		}
+
+		for i, nic := range host.Specs.NICs {
+			var expected string = hardware.NICs[i].MACAddress
+			if normalized, _ := db.NormalizeMACAddress(expected); nic.MACAddress != normalized || nic.Name != hardware.NICs[i].ID || nic.SpeedMbps != hardware.NICs[i].SpeedMbps {
+				t.Fatalf("Unexpected NIC %+v, expected %+v", nic, hardware.NICs[i])
+			}
+		}
+
+		if host.Specs.NICs[0].LinkStatus != "LinkUp" || host.Specs.NICs[1].LinkStatus != "LinkDown" {
+			t.Fatalf("Unexpected link status: %+v", host.Specs.NICs)
+		}
+	})
+
+	t.Run("Any NIC resolves to its host", func(t *testing.T) {
+		if status, response := lookup(t, hardware.NICs[1].MACAddress); status != fiber.StatusOK || response.ManagementIP != sim.Address() || response.Provisioning {
+			t.Fatalf("Unexpected lookup (%d): %+v", status, response)
+		}
+
+		if status, _ := lookup(t, "00:11:22:33:44:55"); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for an unknown MAC, got %d", fiber.StatusNotFound, status)
+		}
+
+		if status, _ := lookup(t, "not-a-mac"); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d for a malformed MAC, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Admins mark the provisioning NIC", func(t *testing.T) {
+		if status, _, err := makeHTTPPutRequest(t, nicURL, `{"mac_address":"00:11:22:33:44:55"}`, aliceCookies); err != nil || status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for a foreign MAC, got %d (%v)", fiber.StatusNotFound, status, err)
+		}
+
+		// Dashed and uppercase forms are accepted and stored normalized
+		if status, body, err := makeHTTPPutRequest(t, nicURL, `{"mac_address":"B4-96-91-0A-10-01"}`, aliceCookies); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Set provisioning NIC failed (%d): %v %s", status, err, body)
+		}
+
+		if status, response := lookup(t, "b4:96:91:0a:10:01"); status != fiber.StatusOK || !response.Provisioning || response.Host.ProvisioningMAC != "b4:96:91:0a:10:01" {
+			t.Fatalf("Unexpected lookup (%d): %+v", status, response)
+		}
+	})
+
+	t.Run("Refreshing specs keeps the provisioning NIC", func(t *testing.T) {
+		if status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("%s/api/hosts/%s/specs/refresh", baseURL, sim.Address()), "", aliceCookies); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Specs refresh failed (%d): %v %s", status, err, body)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil {
+			t.Fatalf("Failed to select host: %v", err)
+		} else if len(host.Specs.NICs) != len(hardware.NICs) || len(host.Specs.Storage) != len(hardware.VolumeSizesGiB) || host.ProvisioningMAC != "b4:96:91:0a:10:01" {
+			t.Fatalf("Unexpected host after refresh: %+v", host)
+		}
+	})
+
+	t.Run("Refreshing specs drops a provisioning NIC that is gone", func(t *testing.T) {
+		sim.SetNICs(hardware.NICs[1:])
+		defer sim.SetNICs(hardware.NICs)
+
+		if host, err := db.RefreshHostSpecs(sim.Address()); err != nil {
+			t.Fatalf("Failed to refresh specs: %v", err)
+		} else if host.ProvisioningMAC != "" {
+			t.Fatalf("Expected the provisioning NIC to be cleared, got %s", host.ProvisioningMAC)
+		}
+
+		if status, _ := lookup(t, hardware.NICs[0].MACAddress); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for the removed NIC, got %d", fiber.StatusNotFound, status)
+		}
+
+		if _, err := db.RefreshHostSpecs(sim.Address()); err != nil {
+			t.Fatalf("Failed to refresh specs: %v", err)
+		}
+	})
+
+	t.Run("Clearing the provisioning NIC", func(t *testing.T) {
+		if status, _, err := makeHTTPPutRequest(t, nicURL, `{"mac_address":""}`, aliceCookies); err != nil || status != fiber.StatusOK {
+			t.Fatalf("Clear provisioning NIC failed (%d): %v", status, err)
+		}
+
+		if _, response := lookup(t, hardware.NICs[0].MACAddress); response.Provisioning {
+			t.Fatalf("Expected the NIC to no longer be the provisioning NIC")
+		}
+	})
+}
+
+func TestIPMINICInventory(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var sim *bmcsim.IPMIServer = newSimulatedIPMI(t)
+	defer sim.Close()
+
+	sim.SetLANMAC(net.HardwareAddr{0x0c, 0xc4, 0x7a, 0x01, 0x02, 0x03})
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: sim.Address(), ManagementType: db.ManagementTypeIPMI}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	host, err := db.RefreshHostSpecs(sim.Address())
+	if err != nil {
+		t.Fatalf("Failed to refresh specs: %v", err)
+	} else if len(host.Specs.NICs) != 1 || host.Specs.NICs[0].MACAddress != "0c:c4:7a:01:02:03" || !host.Specs.NICs[0].Management {
+		t.Fatalf("Expected the BMC's LAN MAC, got %+v", host.Specs.NICs)
+	}
+
+	if _, err = db.SetHostProvisioningNIC(sim.Address(), "0c:c4:7a:01:02:03"); !errors.Is(err, db.ErrNICNotProvisioning) {
+		t.Fatalf("Expected the BMC NIC to be refused for provisioning, got %v", err)
+	}
+}
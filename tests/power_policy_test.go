@@ -0,0 +1,323 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestCronSpec(t *testing.T) {
+	var at = func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+		if err != nil {
+			t.Fatalf("Bad test time %q: %v", value, err)
+		}
+
+		return parsed
+	}
+
+	var cases = []struct {
+		spec    string
+		when    string
+		matches bool
+	}{
+		{"* * * * *", "2030-01-01 03:30", true},
+		{"30 3 * * *", "2030-01-01 03:30", true},
+		{"30 3 * * *", "2030-01-01 03:31", false},
+		{"*/15 * * * *", "2030-01-01 10:45", true},
+		{"*/15 * * * *", "2030-01-01 10:46", false},
+		{"0 22 * * 1-5", "2030-01-07 22:00", true},  // monday
+		{"0 22 * * 1-5", "2030-01-06 22:00", false}, // sunday
+		{"0 0 * * 7", "2030-01-06 00:00", true},     // sunday as 7
+		{"0 8 1,15 * *", "2030-03-15 08:00", true},
+		{"0 8 1 * 1", "2030-01-07 08:00", true}, // either day field may match
+		{"0 0 1 6 *", "2030-01-01 00:00", false},
+	}
+
+	for _, c := range cases {
+		spec, err := db.ParseCronSpec(c.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", c.spec, err)
+		}
+
+		if spec.Matches(at(c.when)) != c.matches {
+			t.Fatalf("Expected %q matching %s to be %v", c.spec, c.when, c.matches)
+		}
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := db.ParseCronSpec(bad); err == nil {
+			t.Fatalf("Expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestPowerPolicies(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var previous = config.Config.PowerPolicy
+	defer func() { config.Config.PowerPolicy = previous }()
+
+	config.Config.PowerPolicy.Enabled = true
+	config.Config.PowerPolicy.IdleOffMinutes = 60
+	config.Config.PowerPolicy.PreStartOnMinutes = 15
+
+	var now time.Time = time.Date(2030, time.January, 1, 3, 30, 0, 0, time.Local)
+
+	waitAll := func(t *testing.T, queued []*db.Job) {
+		for _, job := range queued {
+			if _, err := db.WaitForJob(job.ID, 30*time.Second); err != nil {
+				t.Fatalf("Failed waiting for policy job: %v", err)
+			}
+		}
+	}
+
+	t.Run("Idle hosts are powered off after the idle period", func(t *testing.T) {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: "127.0.0.1", ManagementType: db.ManagementTypeRedfish, LastKnownPowerState: db.PowerStateOn}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+
+		// The first pass only starts the idle clock
+		if queued, err := db.EvaluatePowerPolicies(now); err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		} else if len(queued) != 0 {
+			t.Fatalf("Expected no actions on first pass, got %d", len(queued))
+		}
+
+		queued, err := db.EvaluatePowerPolicies(now.Add(61 * time.Minute))
+		if err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		} else if len(queued) != 1 || queued[0].CreatedBy != db.PowerPolicyCreatorIdle || queued[0].Target != "127.0.0.1" {
+			t.Fatalf("Expected one idle power off job, got %+v", queued)
+		}
+
+		waitAll(t, queued)
+	})
+
+	t.Run("Booked hosts are powered on before the booking starts", func(t *testing.T) {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: "127.0.0.2", ManagementType: db.ManagementTypeRedfish, LastKnownPowerState: db.PowerStateOff}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+
+		var booking *db.Booking = &db.Booking{Name: "prestart", DNSName: "prestart.lab", CIDRBlock: "10.20.0.0/24", StartTime: now.Add(10 * time.Minute)}
+		if err := db.CreateBooking(booking); err != nil {
+			t.Fatalf("Failed to create booking: %v", err)
+		}
+
+		if err := db.AssignHostToBooking(booking.ID, "127.0.0.2"); err != nil {
+			t.Fatalf("Failed to assign host: %v", err)
+		}
+
+		queued, err := db.EvaluatePowerPolicies(now)
+		if err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		}
+
+		var found bool
+		for _, job := range queued {
+			if job.CreatedBy == db.PowerPolicyCreatorPreStart && job.Target == "127.0.0.2" {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Fatalf("Expected a pre-start power on job, got %+v", queued)
+		}
+
+		waitAll(t, queued)
+	})
+
+	t.Run("Schedules fire once per matching minute", func(t *testing.T) {
+		config.Config.PowerPolicy.Enabled = false
+
+		var schedule *db.PowerSchedule = &db.PowerSchedule{ManagementIP: "127.0.0.1", Cron: "30 3 1 1 *", Action: db.PowerActionPowerOn, Enabled: true}
+		if err := db.CreatePowerSchedule(schedule); err != nil {
+			t.Fatalf("Failed to create schedule: %v", err)
+		}
+
+		queued, err := db.EvaluatePowerPolicies(now)
+		if err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		} else if len(queued) != 1 || queued[0].CreatedBy != db.PowerScheduleCreator(schedule.ID) {
+			t.Fatalf("Expected one scheduled job, got %+v", queued)
+		}
+
+		waitAll(t, queued)
+
+		if again, err := db.EvaluatePowerPolicies(now.Add(20 * time.Second)); err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		} else if len(again) != 0 {
+			t.Fatalf("Expected schedule not to fire twice in one minute, got %+v", again)
+		}
+
+		if history, err := db.PowerPolicyJobs(); err != nil {
+			t.Fatalf("Failed to list policy jobs: %v", err)
+		} else if len(history) != 3 {
+			t.Fatalf("Expected 3 policy jobs in history, got %d", len(history))
+		}
+	})
+
+	t.Run("Invalid schedules are rejected", func(t *testing.T) {
+		if err := db.CreatePowerSchedule(&db.PowerSchedule{ManagementIP: "127.0.0.1", Cron: "not cron", Action: db.PowerActionPowerOn}); err == nil {
+			t.Fatalf("Expected invalid cron to be rejected")
+		}
+
+		if err := db.CreatePowerSchedule(&db.PowerSchedule{ManagementIP: "10.9.9.9", Cron: "* * * * *", Action: db.PowerActionPowerOn}); err == nil {
+			t.Fatalf("Expected unknown host to be rejected")
+		}
+	})
+
+	t.Run("Reserved hosts are kept on for their booking", func(t *testing.T) {
+		config.Config.PowerPolicy.Enabled = true
+
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: "127.0.0.3", ManagementType: db.ManagementTypeRedfish, LastKnownPowerState: db.PowerStateOff, IdleSince: now.Add(-2 * time.Hour)}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+
+		var booking *db.Booking = &db.Booking{Name: "reserved", DNSName: "reserved.lab", Status: db.BookingStatusScheduled, StartTime: now.Add(10 * time.Minute), EndTime: now.Add(24 * time.Hour)}
+		if err := db.CreateBooking(booking); err != nil {
+			t.Fatalf("Failed to create booking: %v", err)
+		}
+
+		var request *db.BookingRequest = &db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob", Hosts: []db.BookingRequestHost{{ManagementIP: "127.0.0.3"}}}
+		if err := db.AddBookingRequest(request); err != nil {
+			t.Fatalf("Failed to add booking request: %v", err)
+		}
+
+		if _, _, err := db.ApproveBookingRequest(request.ID, "alice", ""); err != nil {
+			t.Fatalf("Failed to approve request: %v", err)
+		} else if reservations, err := db.HostReservationsForBooking(booking.ID); err != nil || len(reservations) != 1 {
+			t.Fatalf("Expected the host to be reserved, got %+v (%v)", reservations, err)
+		}
+
+		queued, err := db.EvaluatePowerPolicies(now)
+		if err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		}
+
+		var actions []string
+		for _, job := range queued {
+			if job.Target == "127.0.0.3" {
+				actions = append(actions, job.CreatedBy)
+			}
+		}
+
+		if !slices.Equal(actions, []string{db.PowerPolicyCreatorPreStart}) {
+			t.Fatalf("Expected only a pre-start power on for the reserved host, got %v", actions)
+		}
+
+		waitAll(t, queued)
+
+		if host, err := db.Hosts.Select("127.0.0.3"); err != nil || !host.IdleSince.Equal(now) {
+			t.Fatalf("Expected pre-start to restart the idle clock, got %+v (%v)", host, err)
+		}
+
+		// Even once idle for long enough, the host stays on until its booking starts
+		if _, err := db.UpdateHost("127.0.0.3", func(host *db.Host) error {
+			host.LastKnownPowerState, host.IdleSince = db.PowerStateOn, now.Add(-2*time.Hour)
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to update host: %v", err)
+		}
+
+		if queued, err := db.EvaluatePowerPolicies(now.Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to evaluate policies: %v", err)
+		} else {
+			for _, job := range queued {
+				if job.Target == "127.0.0.3" {
+					t.Fatalf("Expected the reserved host to be left alone, got %+v", job)
+				}
+			}
+
+			waitAll(t, queued)
+		}
+	})
+}
+
+func TestPowerSchedulesAPI(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsUser)
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: "10.0.0.1", ManagementType: db.ManagementTypeIPMI}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	bobCookies, err := loginAndGetCookies(t, "bob", "bob")
+	if err != nil {
+		t.Fatalf("Failed to login as bob: %v", err)
+	}
+
+	var url string = fmt.Sprintf("http://%s/api/power/schedules", config.Config.WebServer.Address)
+
+	t.Run("Non-admin is forbidden", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, url, `{"management_ip":"10.0.0.1","cron":"0 22 * * *","action":1}`, bobCookies); err != nil {
+			t.Fatalf("Schedule request failed: %v", err)
+		} else if status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Invalid cron is a bad request", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, url, `{"management_ip":"10.0.0.1","cron":"nightly","action":1}`, aliceCookies); err != nil {
+			t.Fatalf("Schedule request failed: %v", err)
+		} else if status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Admin can create, list and delete schedules", func(t *testing.T) {
+		status, body, err := makeHTTPPostRequest(t, url, `{"management_ip":"10.0.0.1","cron":"0 22 * * *","action":1,"enabled":true}`, aliceCookies)
+		if err != nil {
+			t.Fatalf("Schedule request failed: %v", err)
+		} else if status != fiber.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusCreated, status, body)
+		}
+
+		var created db.PowerSchedule
+		if err = json.Unmarshal([]byte(body), &created); err != nil {
+			t.Fatalf("Failed to unmarshal schedule: %v", err)
+		} else if created.ID == 0 || created.CreatedBy != "alice" {
+			t.Fatalf("Unexpected schedule: %+v", created)
+		}
+
+		var schedules []db.PowerSchedule
+		if status, body, err := makeHTTPGetRequestWithCookies(t, url, aliceCookies); err != nil {
+			t.Fatalf("List request failed: %v", err)
+		} else if status != fiber.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusOK, status, body)
+		} else if err = json.Unmarshal([]byte(body), &schedules); err != nil || len(schedules) != 1 {
+			t.Fatalf("Expected one schedule, got %s: %v", body, err)
+		}
+
+		if status, _, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/%d", url, created.ID), aliceCookies); err != nil {
+			t.Fatalf("Delete request failed: %v", err)
+		} else if status != fiber.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusNoContent, status)
+		}
+
+		if status, _, err := makeHTTPDeleteRequest(t, fmt.Sprintf("%s/%d", url, created.ID), aliceCookies); err != nil {
+			t.Fatalf("Delete request failed: %v", err)
+		} else if status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusNotFound, status)
+		}
+	})
+}
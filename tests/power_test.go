@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestContainerPowerActionWithoutProxmox(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	if config.Config.Proxmox.Enabled {
+		t.Skip("Proxmox is enabled, skipping disabled path")
+	}
+
+	outcomes := db.ContainerPowerAction([]int{101, 102}, db.PowerActionPowerOn)
+	if len(outcomes) != 2 {
+		t.Fatalf("Expected 2 outcomes, got %+v", outcomes)
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.Success || outcome.ResourceType != db.PowerResourceContainer || outcome.Error == "" {
+			t.Fatalf("Expected failed container outcome, got %+v", outcome)
+		}
+	}
+}
+
+func TestBulkPowerAPI(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsUser)
+	auth.AddUserInjection("dave", "dave", auth.AuthPermsUser)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	bobCookies, err := loginAndGetCookies(t, "bob", "bob")
+	if err != nil {
+		t.Fatalf("Failed to login as bob: %v", err)
+	}
+
+	daveCookies, err := loginAndGetCookies(t, "dave", "dave")
+	if err != nil {
+		t.Fatalf("Failed to login as dave: %v", err)
+	}
+
+	var booking *db.Booking = &db.Booking{Name: "power", DNSName: "power.lab", CIDRBlock: "10.10.0.0/24"}
+	if err = db.CreateBooking(booking); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	if err = db.AddBookingPerson(&db.BookingPerson{Username: "bob", BookingID: booking.ID, PermissionLevel: db.BookingPermissionLevelOperator}); err != nil {
+		t.Fatalf("Failed to add bob to booking: %v", err)
+	}
+
+	var (
+		hostsURL   string = fmt.Sprintf("http://%s/api/hosts/power", config.Config.WebServer.Address)
+		bookingURL string = fmt.Sprintf("http://%s/api/bookings/%d/power/%d", config.Config.WebServer.Address, booking.ID, db.PowerActionPowerOn)
+	)
+
+	t.Run("Bulk host power requires admin", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, hostsURL, `{"management_ips":["10.9.9.9"],"action":0}`, bobCookies); err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Bulk host power rejects empty host list", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, hostsURL, `{"management_ips":[],"action":0}`, aliceCookies); err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Bulk host power reports per-host outcomes", func(t *testing.T) {
+		status, body, err := makeHTTPPostRequest(t, hostsURL, fmt.Sprintf(`{"management_ips":["10.9.9.9"],"action":%d}`, db.PowerActionPowerOn), aliceCookies)
+		if err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusAccepted, status, body)
+		}
+
+		var queued struct {
+			JobID int `json:"job_id"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &queued); err != nil {
+			t.Fatalf("Failed to unmarshal queued job: %v", err)
+		}
+
+		finished, err := db.WaitForJob(queued.JobID, 10*time.Second)
+		if err != nil {
+			t.Fatalf("Failed waiting for bulk power job: %v", err)
+		} else if finished.Status != db.JobStatusSucceeded || finished.Kind != db.JobKindBulkPower {
+			t.Fatalf("Expected succeeded bulk power job, got %+v", finished)
+		}
+
+		var outcomes []db.PowerOutcome
+		if err = json.Unmarshal(finished.Result, &outcomes); err != nil {
+			t.Fatalf("Failed to unmarshal outcomes: %v", err)
+		} else if len(outcomes) != 1 || outcomes[0].Success || outcomes[0].ResourceID != "10.9.9.9" {
+			t.Fatalf("Expected one failed outcome for unknown host, got %+v", outcomes)
+		}
+	})
+
+	t.Run("Booking power requires operator", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, bookingURL, "", daveCookies); err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusForbidden, status)
+		}
+	})
+
+	t.Run("Booking power on unknown booking is not found", func(t *testing.T) {
+		if status, _, err := makeHTTPPostRequest(t, fmt.Sprintf("http://%s/api/bookings/9999/power/%d", config.Config.WebServer.Address, db.PowerActionPowerOn), "", aliceCookies); err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", fiber.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Booking operator can queue booking power", func(t *testing.T) {
+		if status, body, err := makeHTTPPostRequest(t, bookingURL, "", bobCookies); err != nil {
+			t.Fatalf("Power request failed: %v", err)
+		} else if status != fiber.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d: %s", fiber.StatusAccepted, status, body)
+		}
+	})
+}
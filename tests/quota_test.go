@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestBookingQuotas(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	config.Config.Proxmox.Templates = []string{"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst"}
+
+	auth.AddUserInjection("quinn", "quinn", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("quentin", "quentin", auth.AuthPermsBookingCreator, "students")
+
+	var (
+		baseURL string = "http://" + config.Config.WebServer.Address
+		cookies        = map[string][]*http.Cookie{}
+	)
+
+	for _, username := range []string{"quinn", "quentin"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+		defer db.ResetBookingCart(username)
+	}
+
+	for _, ip := range []string{"10.0.14.1", "10.0.14.2"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	post := func(t *testing.T, username, path, payload string, expected int) string {
+		status, body, err := makeHTTPPostRequest(t, baseURL+path, payload, cookies[username])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s, got %d: %v %s", expected, path, status, err, body)
+		}
+
+		return body
+	}
+
+	setPolicy := func(t *testing.T, username, path, payload string, expected int) {
+		status, body, err := makeHTTPPutRequest(t, baseURL+path, payload, cookies[username])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s, got %d: %v %s", expected, path, status, err, body)
+		}
+	}
+
+	quota := func(t *testing.T) (found db.Quota) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/auth/me/quota", cookies["quentin"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Quota failed (%d): %v %s", status, err, body)
+		}
+
+		if err = json.Unmarshal([]byte(body), &found); err != nil {
+			t.Fatalf("Failed to unmarshal quota: %v", err)
+		}
+
+		return
+	}
+
+	var booking db.Booking
+
+	t.Run("Admins set quota policies", func(t *testing.T) {
+		setPolicy(t, "quentin", "/api/quotas/group/students", `{"max_hosts":1}`, fiber.StatusForbidden)
+		setPolicy(t, "quinn", "/api/quotas/team/students", `{"max_hosts":1}`, fiber.StatusBadRequest)
+		setPolicy(t, "quinn", "/api/quotas/group/students", `{"max_hosts":-1}`, fiber.StatusBadRequest)
+		setPolicy(t, "quinn", "/api/quotas/group/students", `{"max_hosts":1,"max_cores":2,"max_duration_days":7,"max_active_bookings":1}`, fiber.StatusOK)
+		setPolicy(t, "quinn", "/api/quotas/group/staff", `{"max_hosts":10}`, fiber.StatusOK)
+
+		if found := quota(t); found.Limits.Hosts != 1 || found.Limits.Cores != 2 || found.Remaining.Hosts != 1 || found.Remaining.MemoryMB != -1 || found.Remaining.ActiveBookings != 1 {
+			t.Fatalf("Unexpected quota %+v", found)
+		}
+	})
+
+	t.Run("Bookings are limited in duration and number", func(t *testing.T) {
+		post(t, "quentin", "/api/bookings", `{"name":"long","duration_days":10}`, fiber.StatusForbidden)
+		post(t, "quentin", "/api/bookings", `{"name":"open"}`, fiber.StatusForbidden)
+
+		if err := json.Unmarshal([]byte(post(t, "quentin", "/api/bookings", `{"name":"quentin's lab","duration_days":3}`, fiber.StatusOK)), &booking); err != nil {
+			t.Fatalf("Failed to unmarshal booking: %v", err)
+		}
+
+		post(t, "quentin", "/api/bookings", fmt.Sprintf(`{"name":"another","start_time":%q,"duration_days":1}`, time.Now().Add(24*time.Hour).Format(time.RFC3339)), fiber.StatusForbidden)
+	})
+
+	t.Run("Carts and requests are limited", func(t *testing.T) {
+		post(t, "quentin", "/api/bookings/cart/hosts", `{"management_ip":"10.0.14.1"}`, fiber.StatusOK)
+		post(t, "quentin", "/api/bookings/cart/hosts", `{"management_ip":"10.0.14.1"}`, fiber.StatusOK)
+		post(t, "quentin", "/api/bookings/cart/hosts", `{"management_ip":"10.0.14.2"}`, fiber.StatusForbidden)
+
+		var requestURL string = fmt.Sprintf("/api/bookings/%d/requests", booking.ID)
+		post(t, "quentin", requestURL, `{"containers":[{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":3,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}]}`, fiber.StatusForbidden)
+		post(t, "quentin", requestURL, `{"containers":[{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":2,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}]}`, fiber.StatusOK)
+
+		if found := quota(t); found.Usage.Hosts != 1 || found.Usage.Cores != 2 || found.Usage.ActiveBookings != 1 || found.Remaining.Hosts != 0 || found.Remaining.Cores != 0 {
+			t.Fatalf("Expected the pending request to count against the quota, got %+v", found)
+		}
+	})
+
+	t.Run("Approval checks the requester's quota", func(t *testing.T) {
+		requests, err := db.BookingRequestsForBooking(booking.ID)
+		if err != nil || len(requests) != 1 {
+			t.Fatalf("Expected a request, got %+v (%v)", requests, err)
+		}
+
+		var approveURL string = fmt.Sprintf("/api/review/requests/%d/approve", requests[0].ID)
+		setPolicy(t, "quinn", "/api/quotas/group/students", `{"max_hosts":1,"max_cores":1}`, fiber.StatusOK)
+		post(t, "quinn", approveURL, `{}`, fiber.StatusForbidden)
+
+		setPolicy(t, "quinn", "/api/quotas/user/quentin", `{"max_cores":4}`, fiber.StatusOK)
+		if found := quota(t); found.Limits.Cores != 4 || found.Limits.Hosts != 0 || len(found.Limits.PolicyIDs) != 1 {
+			t.Fatalf("Expected the user policy to replace the group's, got %+v", found.Limits)
+		}
+
+		var response struct {
+			JobID int `json:"job_id"`
+		}
+
+		if err = json.Unmarshal([]byte(post(t, "quinn", approveURL, `{}`, fiber.StatusAccepted)), &response); err != nil {
+			t.Fatalf("Failed to unmarshal approval: %v", err)
+		}
+
+		if _, err = db.WaitForJob(response.JobID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/quotas", cookies["quinn"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Policy list failed (%d): %v", status, err)
+		}
+
+		var policies []*db.QuotaPolicy
+		if err = json.Unmarshal([]byte(body), &policies); err != nil || len(policies) != 3 || policies[0].Scope != db.QuotaScopeUser {
+			t.Fatalf("Unexpected policies %s: %v", body, err)
+		}
+
+		if status, _, _ := makeHTTPDeleteRequest(t, baseURL+"/api/quotas/user/nobody", cookies["quinn"]); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for a missing policy, got %d", fiber.StatusNotFound, status)
+		}
+	})
+}
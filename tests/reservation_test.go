@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestScheduledBookings(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	config.Config.Expiry.GraceHours = 1
+	config.Config.Proxmox.CapacityCores = 4
+	config.Config.Proxmox.Templates = []string{"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst"}
+
+	auth.AddUserInjection("ruth", "ruth", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("rick", "rick", auth.AuthPermsBookingCreator)
+	auth.AddUserInjection("rosa", "rosa", auth.AuthPermsBookingCreator)
+
+	var (
+		baseURL string = "http://" + config.Config.WebServer.Address
+		cookies        = map[string][]*http.Cookie{}
+		start   time.Time
+		end     time.Time
+	)
+
+	for _, username := range []string{"ruth", "rick", "rosa"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+		defer db.ResetBookingCart(username)
+	}
+
+	for _, ip := range []string{"10.0.13.1", "10.0.13.2"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	post := func(t *testing.T, username, path, payload string, expected int) string {
+		status, body, err := makeHTTPPostRequest(t, baseURL+path, payload, cookies[username])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for %s, got %d: %v %s", expected, path, status, err, body)
+		}
+
+		return body
+	}
+
+	setWindow := func(t *testing.T, username string, from, to time.Time, expected int) {
+		payload := fmt.Sprintf(`{"start_time":%q,"end_time":%q}`, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		status, body, err := makeHTTPPutRequest(t, baseURL+"/api/bookings/cart/window", payload, cookies[username])
+		if err != nil || status != expected {
+			t.Fatalf("Expected status %d for the cart window, got %d: %v %s", expected, status, err, body)
+		}
+	}
+
+	var booking db.Booking
+
+	t.Run("Bookings can start later", func(t *testing.T) {
+		var past time.Time = time.Now().Add(-time.Hour)
+		post(t, "rick", "/api/bookings", fmt.Sprintf(`{"name":"later","start_time":%q}`, past.Format(time.RFC3339)), fiber.StatusBadRequest)
+
+		start = time.Now().Add(48 * time.Hour).Truncate(time.Second)
+		end = start.Add(24 * time.Hour)
+		post(t, "rick", "/api/bookings", fmt.Sprintf(`{"name":"later","start_time":%q,"end_time":%q}`, start.Format(time.RFC3339), start.Add(-time.Hour).Format(time.RFC3339)), fiber.StatusBadRequest)
+
+		body := post(t, "rick", "/api/bookings", fmt.Sprintf(`{"name":"later","start_time":%q,"end_time":%q}`, start.Format(time.RFC3339), end.Format(time.RFC3339)), fiber.StatusOK)
+		if err := json.Unmarshal([]byte(body), &booking); err != nil {
+			t.Fatalf("Failed to unmarshal booking: %v", err)
+		}
+
+		if booking.Status != db.BookingStatusScheduled || !booking.StartTime.Equal(start) || !booking.EndTime.Equal(end) {
+			t.Fatalf("Expected a scheduled booking, got %+v", booking)
+		}
+	})
+
+	t.Run("Approved requests reserve their hosts", func(t *testing.T) {
+		setWindow(t, "rick", start, end, fiber.StatusOK)
+		post(t, "rick", "/api/bookings/cart/hosts", `{"management_ip":"10.0.13.1"}`, fiber.StatusOK)
+
+		var request db.BookingRequest
+		if err := json.Unmarshal([]byte(post(t, "rick", fmt.Sprintf("/api/bookings/%d/requests", booking.ID), `{"justification":"demo","containers":[{"name":"web","template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":3,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}]}`, fiber.StatusOK)), &request); err != nil {
+			t.Fatalf("Failed to unmarshal request: %v", err)
+		}
+
+		post(t, "ruth", fmt.Sprintf("/api/review/requests/%d/approve", request.ID), `{}`, fiber.StatusOK)
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current.Status != db.BookingStatusScheduled || len(current.OwnedHostManagementIPs) != 0 {
+			t.Fatalf("Expected the booking to stay scheduled, got %+v (%v)", current, err)
+		}
+
+		reservations, err := db.HostReservationsForBooking(booking.ID)
+		if err != nil || len(reservations) != 1 || reservations[0].ManagementIP != "10.0.13.1" || !reservations[0].StartTime.Equal(start) {
+			t.Fatalf("Expected the host to be reserved, got %+v (%v)", reservations, err)
+		}
+	})
+
+	t.Run("Reserved hosts and capacity are refused to overlapping bookings", func(t *testing.T) {
+		var overlapping *db.Booking = &db.Booking{Name: "overlapping", DNSName: "overlapping.lab", CIDRBlock: "10.80.0.0/24", Status: db.BookingStatusActive, EndTime: start.Add(time.Hour)}
+		if err := db.CreateBooking(overlapping); err != nil {
+			t.Fatalf("Failed to create booking: %v", err)
+		}
+
+		if err := db.AddBookingPerson(&db.BookingPerson{Username: "rosa", BookingID: overlapping.ID, PermissionLevel: db.BookingPermissionLevelOwner}); err != nil {
+			t.Fatalf("Failed to add booking owner: %v", err)
+		}
+
+		post(t, "rosa", "/api/bookings/cart/hosts", `{"management_ip":"10.0.13.1"}`, fiber.StatusOK)
+		post(t, "rosa", fmt.Sprintf("/api/bookings/%d/requests", overlapping.ID), `{}`, fiber.StatusConflict)
+		db.RemoveHostFromCart("rosa", "10.0.13.1")
+
+		post(t, "rosa", fmt.Sprintf("/api/bookings/%d/requests", overlapping.ID), `{"containers":[{"template":"local:vztmpl/debian-12-standard_12.7-1_amd64.tar.zst","cores":2,"memory_mb":512,"disk_gb":8,"ssh_public_key":"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDua5FkjaY6jhvUbg9Pq6SoOuIy8aVX/dGwsDBB+pghr test"}]}`, fiber.StatusConflict)
+
+		setWindow(t, "rosa", start.Add(-time.Hour), end, fiber.StatusOK)
+		post(t, "rosa", "/api/bookings/cart/hosts", `{"management_ip":"10.0.13.1"}`, fiber.StatusConflict)
+
+		setWindow(t, "rosa", end.Add(2*time.Hour), end.Add(24*time.Hour), fiber.StatusOK)
+		post(t, "rosa", "/api/bookings/cart/hosts", `{"management_ip":"10.0.13.1"}`, fiber.StatusOK)
+		setWindow(t, "rosa", start, end, fiber.StatusConflict)
+	})
+
+	t.Run("The calendar shows reservations", func(t *testing.T) {
+		query := url.Values{"from": {time.Now().Format(time.RFC3339)}, "to": {end.Format(time.RFC3339)}}
+		status, body, err := makeHTTPGetRequestWithCookies(t, baseURL+"/api/calendar?"+query.Encode(), cookies["rosa"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Calendar failed (%d): %v %s", status, err, body)
+		}
+
+		var calendar db.Calendar
+		if err = json.Unmarshal([]byte(body), &calendar); err != nil {
+			t.Fatalf("Failed to unmarshal calendar: %v", err)
+		}
+
+		var entries map[string][]db.CalendarEntry = map[string][]db.CalendarEntry{}
+		for _, host := range calendar.Hosts {
+			entries[host.ManagementIP] = host.Entries
+		}
+
+		if found := entries["10.0.13.1"]; len(found) != 1 || found[0].Kind != db.CalendarEntryReservation || found[0].BookingID != booking.ID {
+			t.Fatalf("Expected the reservation on the calendar, got %+v", found)
+		}
+
+		if found, ok := entries["10.0.13.2"]; !ok || len(found) != 0 {
+			t.Fatalf("Expected the free host with no entries, got %+v", found)
+		}
+
+		if calendar.Proxmox.Cores != 3 || calendar.Proxmox.CapacityCores != 4 {
+			t.Fatalf("Expected the approved container to count against capacity, got %+v", calendar.Proxmox)
+		}
+
+		query.Set("to", query.Get("from"))
+		if status, _, _ := makeHTTPGetRequestWithCookies(t, baseURL+"/api/calendar?"+query.Encode(), cookies["rosa"]); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d for an empty range, got %d", fiber.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("Scheduled bookings start on time", func(t *testing.T) {
+		if queued, err := db.ActivateScheduledBookings(start.Add(-time.Minute)); err != nil || len(queued) != 0 {
+			t.Fatalf("Expected nothing to start early, got %+v (%v)", queued, err)
+		}
+
+		queued, err := db.ActivateScheduledBookings(start)
+		if err != nil || len(queued) != 1 || queued[0].Kind != db.JobKindBookingFulfillment {
+			t.Fatalf("Expected a fulfillment job, got %+v (%v)", queued, err)
+		}
+
+		if _, err = db.WaitForJob(queued[0].ID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		}
+
+		current, err := db.BookingByID(booking.ID)
+		if err != nil || current.Status != db.BookingStatusActive || len(current.OwnedHostManagementIPs) != 1 || current.OwnedHostManagementIPs[0] != "10.0.13.1" {
+			t.Fatalf("Expected the booking to start with its host, got %+v (%v)", current, err)
+		}
+
+		if reservations, err := db.HostReservationsForBooking(booking.ID); err != nil || len(reservations) != 0 {
+			t.Fatalf("Expected the reservation to be dropped, got %+v (%v)", reservations, err)
+		}
+
+		notices, err := db.BookingNoticesForBooking(booking.ID)
+		if err != nil {
+			t.Fatalf("Failed to list notices: %v", err)
+		}
+
+		var started bool
+		for _, notice := range notices {
+			started = started || notice.Kind == db.BookingNoticeStarted
+		}
+
+		if !started {
+			t.Fatalf("Expected a started notice, got %+v", notices)
+		}
+	})
+}
+
+func TestProxmoxUsagePeak(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	config.Config.Expiry.GraceHours = 0
+
+	var start time.Time = time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+
+	for i, span := range []struct {
+		from, to        time.Duration
+		cores, memoryMB int
+	}{
+		{0, 2 * time.Hour, 2, 512},
+		{2 * time.Hour, 4 * time.Hour, 3, 1024},
+		{time.Hour, 3 * time.Hour, 1, 256},
+	} {
+		var booking *db.Booking = &db.Booking{Name: fmt.Sprintf("peak-%d", i), DNSName: fmt.Sprintf("peak-%d.lab", i), CIDRBlock: fmt.Sprintf("10.71.%d.0/24", i), StartTime: start.Add(span.from), EndTime: start.Add(span.to)}
+		if err := db.CreateBooking(booking); err != nil {
+			t.Fatalf("Failed to create booking: %v", err)
+		}
+
+		if err := db.AddBookingContainer(&db.BookingContainer{ProxmoxID: 9100 + i, BookingID: booking.ID, Template: "debian", Cores: span.cores, MemoryMB: span.memoryMB}); err != nil {
+			t.Fatalf("Failed to add container: %v", err)
+		}
+	}
+
+	t.Run("Bookings back to back don't add up", func(t *testing.T) {
+		usage, err := db.ProxmoxUsageDuring(start, start.Add(4*time.Hour))
+		if err != nil || usage.Cores != 4 || usage.MemoryMB != 1280 {
+			t.Fatalf("Expected the peak of 4 cores and 1280 MB, got %+v (%v)", usage, err)
+		}
+	})
+
+	t.Run("Only bookings running in the window count", func(t *testing.T) {
+		usage, err := db.ProxmoxUsageDuring(start, start.Add(90*time.Minute))
+		if err != nil || usage.Cores != 3 || usage.MemoryMB != 768 {
+			t.Fatalf("Expected the peak of 3 cores and 768 MB, got %+v (%v)", usage, err)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+)
+
+func TestBookingRequestReview(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+	auth.AddUserInjection("bob", "bob", auth.AuthPermsBookingCreator)
+
+	var (
+		reviewURL string = "http://" + config.Config.WebServer.Address + "/api/review/requests"
+		cookies          = map[string][]*http.Cookie{}
+	)
+
+	for _, username := range []string{"alice", "bob"} {
+		userCookies, err := loginAndGetCookies(t, username, username)
+		if err != nil {
+			t.Fatalf("Failed to login as %s: %v", username, err)
+		}
+
+		cookies[username] = userCookies
+	}
+
+	for _, ip := range []string{"10.0.10.1", "10.0.10.2"} {
+		if err := db.Hosts.Insert(&db.Host{ManagementIP: ip, ManagementType: db.ManagementTypeRedfish}); err != nil {
+			t.Fatalf("Failed to insert host: %v", err)
+		}
+	}
+
+	status, body, err := makeHTTPPostRequest(t, "http://"+config.Config.WebServer.Address+"/api/bookings", `{"name":"review","duration_days":1}`, cookies["bob"])
+	if err != nil || status != fiber.StatusOK {
+		t.Fatalf("Booking create failed (%d): %v %s", status, err, body)
+	}
+
+	var booking *db.Booking
+	if err = json.Unmarshal([]byte(body), &booking); err != nil {
+		t.Fatalf("Failed to unmarshal booking: %v", err)
+	}
+
+	var (
+		approved *db.BookingRequest = &db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob", Justification: "class", Hosts: []db.BookingRequestHost{{ManagementIP: "10.0.10.1"}}, Containers: []db.BookingRequestCT{{Name: "web", Template: "debian", Cores: 1, MemoryMB: 512, DiskGB: 8}}}
+		rejected *db.BookingRequest = &db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob", Justification: "more", Hosts: []db.BookingRequestHost{{ManagementIP: "10.0.10.2"}}}
+	)
+
+	for _, request := range []*db.BookingRequest{approved, rejected} {
+		if err := db.AddBookingRequest(request); err != nil {
+			t.Fatalf("Failed to add booking request: %v", err)
+		}
+	}
+
+	t.Run("Bookings are given their own network", func(t *testing.T) {
+		if booking.CIDRBlock != "172.16.0.0/24" {
+			t.Fatalf("Expected the first block of the booking network, got %q", booking.CIDRBlock)
+		}
+
+		var other *db.Booking = &db.Booking{Name: "other", DNSName: "other.lab"}
+		if err := db.CreateBooking(other); err != nil || other.CIDRBlock != "172.16.1.0/24" {
+			t.Fatalf("Expected the next block for another booking, got %q (%v)", other.CIDRBlock, err)
+		}
+	})
+
+	t.Run("Only admins see the queue", func(t *testing.T) {
+		if status, _, _ := makeHTTPGetRequestWithCookies(t, reviewURL, cookies["bob"]); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a regular user, got %d", fiber.StatusForbidden, status)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, reviewURL, cookies["alice"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Queue request failed (%d): %v", status, err)
+		}
+
+		var queue []*db.BookingRequest
+		if err = json.Unmarshal([]byte(body), &queue); err != nil || len(queue) != 2 || queue[0].ID != approved.ID || queue[1].ID != rejected.ID {
+			t.Fatalf("Unexpected queue %s: %v", body, err)
+		}
+
+		if status, _, _ := makeHTTPGetRequestWithCookies(t, reviewURL+"/999", cookies["alice"]); status != fiber.StatusNotFound {
+			t.Fatalf("Expected status %d for an unknown request, got %d", fiber.StatusNotFound, status)
+		}
+	})
+
+	t.Run("Rejections need a comment", func(t *testing.T) {
+		var rejectURL string = fmt.Sprintf("%s/%d/reject", reviewURL, rejected.ID)
+		if status, _, _ := makeHTTPPostRequest(t, rejectURL, `{}`, cookies["alice"]); status != fiber.StatusBadRequest {
+			t.Fatalf("Expected status %d without a comment, got %d", fiber.StatusBadRequest, status)
+		}
+
+		status, body, err := makeHTTPPostRequest(t, rejectURL, `{"comment":"no spare hosts this week"}`, cookies["alice"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Reject request failed (%d): %v %s", status, err, body)
+		}
+
+		var request db.BookingRequest
+		if err = json.Unmarshal([]byte(body), &request); err != nil || request.Status != db.BookingRequestStatusRejected || request.Reviewer != "alice" || request.ReviewerComment != "no spare hosts this week" {
+			t.Fatalf("Unexpected rejection %s: %v", body, err)
+		}
+
+		if status, _, _ := makeHTTPPostRequest(t, rejectURL, `{"comment":"again"}`, cookies["alice"]); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a reviewed request, got %d", fiber.StatusConflict, status)
+		}
+
+		if current, err := db.BookingByID(booking.ID); err != nil || current.Status != db.BookingStatusActiveWithRequestPending {
+			t.Fatalf("Expected the booking to stay pending while a request awaits review, got %+v (%v)", current, err)
+		}
+	})
+
+	t.Run("Approvals are fulfilled", func(t *testing.T) {
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("%s/%d/approve", reviewURL, approved.ID), `{"comment":"enjoy"}`, cookies["alice"])
+		if err != nil || status != fiber.StatusAccepted {
+			t.Fatalf("Approve request failed (%d): %v %s", status, err, body)
+		}
+
+		var response struct {
+			JobID int `json:"job_id"`
+		}
+
+		if err = json.Unmarshal([]byte(body), &response); err != nil || response.JobID == 0 {
+			t.Fatalf("Expected a fulfillment job, got %s: %v", body, err)
+		}
+
+		if job, err := db.WaitForJob(response.JobID, 30*time.Second); err != nil {
+			t.Fatalf("Failed waiting for job: %v", err)
+		} else if job.Status != db.JobStatusSucceeded {
+			t.Fatalf("Expected job to succeed, got %s: %s", job.Status.String(), job.Message)
+		}
+
+		request, err := db.BookingRequestByID(approved.ID)
+		if err != nil || request.Status != db.BookingRequestStatusApproved || request.Reviewer != "alice" || request.FulfilledAt.IsZero() || request.JobID != response.JobID {
+			t.Fatalf("Unexpected request %+v (%v)", request, err)
+		}
+
+		if len(request.Fulfillment) != 2 {
+			t.Fatalf("Expected an outcome per resource, got %+v", request.Fulfillment)
+		}
+
+		if host := request.Fulfillment[0]; host.ResourceType != db.FulfillmentResourceHost || host.Resource != "10.0.10.1" || !host.Success {
+			t.Fatalf("Expected the host to be assigned, got %+v", host)
+		}
+
+		if ct := request.Fulfillment[1]; ct.ResourceType != db.FulfillmentResourceContainer || ct.Success || !strings.Contains(ct.Error, "disabled") {
+			t.Fatalf("Expected the container to fail without proxmox, got %+v", ct)
+		}
+
+		if host, err := db.Hosts.Select("10.0.10.1"); err != nil || host == nil || !host.IsBooked || host.ActiveBookingID != booking.ID {
+			t.Fatalf("Expected the host to be booked, got %+v (%v)", host, err)
+		}
+
+		if current, err := db.BookingByID(booking.ID); err != nil || current.Status != db.BookingStatusActive {
+			t.Fatalf("Expected the booking to leave the pending state, got %+v (%v)", current, err)
+		}
+
+		notices, err := db.BookingNoticesForBooking(booking.ID)
+		if err != nil {
+			t.Fatalf("Failed to list notices: %v", err)
+		}
+
+		var kinds []db.BookingNoticeKind
+		for _, notice := range notices {
+			kinds = append(kinds, notice.Kind)
+		}
+
+		if !slices.Equal(kinds, []db.BookingNoticeKind{db.BookingNoticeRequestRejected, db.BookingNoticeRequestApproved, db.BookingNoticeRequestFulfilled}) {
+			t.Fatalf("Unexpected notices %+v", notices)
+		}
+	})
+
+	t.Run("Booking requests are listed", func(t *testing.T) {
+		status, body, err := makeHTTPGetRequestWithCookies(t, fmt.Sprintf("http://%s/api/bookings/%d/requests", config.Config.WebServer.Address, booking.ID), cookies["alice"])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Requests list failed (%d): %v", status, err)
+		}
+
+		var requests []*db.BookingRequest
+		if err = json.Unmarshal([]byte(body), &requests); err != nil || len(requests) != 2 {
+			t.Fatalf("Unexpected requests %s: %v", body, err)
+		}
+
+		if status, body, _ := makeHTTPGetRequestWithCookies(t, reviewURL, cookies["alice"]); status != fiber.StatusOK || strings.TrimSpace(body) != "[]" {
+			t.Fatalf("Expected an empty queue, got %d %s", status, body)
+		}
+	})
+}
+
+func TestFulfillmentAfterRelease(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	if err := db.Hosts.Insert(&db.Host{ManagementIP: "10.0.10.9", ManagementType: db.ManagementTypeRedfish}); err != nil {
+		t.Fatalf("Failed to insert host: %v", err)
+	}
+
+	var booking *db.Booking = &db.Booking{Name: "released", DNSName: "released.lab", Status: db.BookingStatusActive, EndTime: time.Now().Add(24 * time.Hour)}
+	if err := db.CreateBooking(booking); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	var request *db.BookingRequest = &db.BookingRequest{BookingID: booking.ID, RequestedBy: "bob", Status: db.BookingRequestStatusApproved, Hosts: []db.BookingRequestHost{{ManagementIP: "10.0.10.9"}}}
+	if err := db.AddBookingRequest(request); err != nil {
+		t.Fatalf("Failed to add booking request: %v", err)
+	}
+
+	job, err := db.ReleaseBooking(booking.ID, "bob")
+	if err != nil {
+		t.Fatalf("Failed to release booking: %v", err)
+	}
+
+	if _, err = db.WaitForJob(job.ID, 30*time.Second); err != nil {
+		t.Fatalf("Failed waiting for teardown: %v", err)
+	}
+
+	outcomes, err := db.FulfillBookingRequest(request.ID, nil)
+	if err != nil || len(outcomes) != 1 || outcomes[0].Success || !strings.Contains(outcomes[0].Error, db.ErrBookingEnded.Error()) {
+		t.Fatalf("Expected the released booking to get nothing, got %+v (%v)", outcomes, err)
+	}
+
+	if host, err := db.Hosts.Select("10.0.10.9"); err != nil || host == nil || host.IsBooked || host.ActiveBookingID != 0 {
+		t.Fatalf("Expected the host to stay free, got %+v (%v)", host, err)
+	}
+}
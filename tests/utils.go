@@ -1,9 +1,11 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"os"
@@ -103,6 +105,34 @@ func makeHTTPGetRequest(t *testing.T, url string) (statusCode int, body string,
 	return
 }
 
+func makeHTTPGetRequestWithCookies(t *testing.T, url string, cookies []*http.Cookie) (statusCode int, body string, err error) {
+	var request *http.Request
+	if request, err = http.NewRequest("GET", url, nil); err != nil {
+		return
+	}
+
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	var client http.Client
+	var response *http.Response
+	if response, err = client.Do(request); err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	statusCode = response.StatusCode
+
+	var bodyBytes []byte
+	if bodyBytes, err = io.ReadAll(response.Body); err != nil {
+		return
+	}
+	body = string(bodyBytes)
+
+	return
+}
+
 func makeHTTPGetRequestJSON(t *testing.T, url string) (body any, err error) {
 	var (
 		status  int
@@ -182,6 +212,88 @@ func makeHTTPPostRequest(t *testing.T, url, jsonData string, cookies []*http.Coo
 	return
 }
 
+func makeHTTPPutRequest(t *testing.T, url, jsonData string, cookies []*http.Cookie) (statusCode int, body string, err error) {
+	var request *http.Request
+	if request, err = http.NewRequest("PUT", url, strings.NewReader(jsonData)); err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	var client http.Client
+	var response *http.Response
+	if response, err = client.Do(request); err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	statusCode = response.StatusCode
+
+	var bodyBytes []byte
+	if bodyBytes, err = io.ReadAll(response.Body); err != nil {
+		return
+	}
+	body = string(bodyBytes)
+
+	return
+}
+
+func makeHTTPMultipartRequest(t *testing.T, url string, fields map[string]string, fileField, fileName string, fileData []byte, cookies []*http.Cookie) (statusCode int, body string, err error) {
+	var (
+		payload bytes.Buffer
+		writer  *multipart.Writer = multipart.NewWriter(&payload)
+		part    io.Writer
+	)
+
+	for key, value := range fields {
+		if err = writer.WriteField(key, value); err != nil {
+			return
+		}
+	}
+
+	if part, err = writer.CreateFormFile(fileField, fileName); err != nil {
+		return
+	}
+
+	if _, err = part.Write(fileData); err != nil {
+		return
+	}
+
+	if err = writer.Close(); err != nil {
+		return
+	}
+
+	var request *http.Request
+	if request, err = http.NewRequest("POST", url, &payload); err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	var client http.Client
+	var response *http.Response
+	if response, err = client.Do(request); err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	statusCode = response.StatusCode
+
+	var bodyBytes []byte
+	if bodyBytes, err = io.ReadAll(response.Body); err != nil {
+		return
+	}
+	body = string(bodyBytes)
+
+	return
+}
+
 func makeHTTPDeleteRequest(t *testing.T, url string, cookies []*http.Cookie) (statusCode int, body string, err error) {
 	var request *http.Request
 	if request, err = http.NewRequest("DELETE", url, nil); err != nil {
@@ -0,0 +1,295 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/opnlaas/opnlaas/auth"
+	"github.com/opnlaas/opnlaas/config"
+	"github.com/opnlaas/opnlaas/db"
+	"github.com/opnlaas/opnlaas/tests/bmcsim"
+)
+
+func TestHostWipeOnRelease(t *testing.T) {
+	setup(t)
+	defer cleanup(t)
+
+	var app *fiber.App = setupAppServer(t)
+	defer cleanupAppServer(t, app)
+
+	var (
+		baseURL  string = "http://" + config.Config.WebServer.Address
+		previous        = config.Config.Wipe
+	)
+
+	defer func() { config.Config.Wipe = previous }()
+	config.Config.Wipe.Enabled = true
+	config.Config.Wipe.BaseURL = baseURL
+	config.Config.Wipe.KernelURL = "http://images.lab/wipe/vmlinuz"
+	config.Config.Wipe.InitrdURL = "http://images.lab/wipe/initrd.img"
+	config.Config.Wipe.ImageNetworks = []string{"127.0.0.0/8"}
+
+	auth.AddUserInjection("alice", "alice", auth.AuthPermsAdministrator)
+
+	aliceCookies, err := loginAndGetCookies(t, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Failed to login as alice: %v", err)
+	}
+
+	var sim *bmcsim.RedfishServer = newSimulatedRedfish(t)
+	defer sim.Close()
+
+	if status, body, err := makeHTTPPostRequest(t, baseURL+"/api/hosts", fmt.Sprintf(`{"management_ip":%q,"management_type":%d}`, sim.Address(), db.ManagementTypeRedfish), aliceCookies); err != nil || status != fiber.StatusOK {
+		t.Fatalf("Host create failed (%d): %v %s", status, err, body)
+	}
+
+	var booking *db.Booking = &db.Booking{Name: "wiped", DNSName: "wiped.lab", CIDRBlock: "10.40.0.0/24", StartTime: time.Now(), EndTime: time.Now().Add(24 * time.Hour)}
+	if err := db.CreateBooking(booking); err != nil {
+		t.Fatalf("Failed to create booking: %v", err)
+	}
+
+	// release books the host, lets the tenant change a BIOS setting and releases it into a wipe
+	release := func(t *testing.T) (wipe *db.HostWipe) {
+		if err := db.AssignHostToBooking(booking.ID, sim.Address()); err != nil {
+			t.Fatalf("Failed to assign host: %v", err)
+		}
+
+		sim.SetBIOSAttribute("SriovGlobalEnable", "Enabled")
+
+		if err := db.ReleaseHostFromBooking(booking.ID, sim.Address()); err != nil {
+			t.Fatalf("Failed to release host: %v", err)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil || !host.Wiping || host.IsBooked {
+			t.Fatalf("Expected the host to be held for a wipe, got %+v (%v)", host, err)
+		}
+
+		history, err := db.HostWipeHistory(sim.Address())
+		if err != nil || len(history) == 0 {
+			t.Fatalf("Expected a wipe to be started: %v", err)
+		}
+
+		return history[0]
+	}
+
+	// bootImage plays the PXE chain and the wipe image fetching its plan
+	bootImage := func(t *testing.T) (plan db.WipePlan, reportURL string) {
+		status, script, err := makeHTTPGetRequest(t, baseURL+"/api/wipe/boot/"+bmcsim.DefaultHardware().NICs[0].MACAddress)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Boot script request failed (%d): %v %s", status, err, script)
+		} else if !strings.HasPrefix(script, "#!ipxe") || !strings.Contains(script, config.Config.Wipe.KernelURL) {
+			t.Fatalf("Unexpected boot script %q", script)
+		}
+
+		match := regexp.MustCompile(`laas\.wipe_plan=(\S+)`).FindStringSubmatch(script)
+		if match == nil {
+			t.Fatalf("Boot script has no plan URL: %q", script)
+		}
+
+		status, body, err := makeHTTPGetRequest(t, match[1])
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Plan request failed (%d): %v %s", status, err, body)
+		}
+
+		if err = json.Unmarshal([]byte(body), &plan); err != nil {
+			t.Fatalf("Failed to unmarshal plan: %v", err)
+		}
+
+		return plan, plan.ReportURL
+	}
+
+	report := func(t *testing.T, reportURL string, drives []db.WipeReportDrive) int {
+		body, _ := json.Marshal(db.WipeReport{Drives: drives})
+		status, _, err := makeHTTPPostRequest(t, reportURL, string(body), nil)
+		if err != nil {
+			t.Fatalf("Report request failed: %v", err)
+		}
+
+		return status
+	}
+
+	// elsewhere makes a request from another address of the image network, like a tenant who kept the boot script
+	elsewhere := func(t *testing.T, method, url, body string) int {
+		var client *http.Client = &http.Client{Transport: &http.Transport{DialContext: (&net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}}).DialContext}}
+
+		request, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("Request from another address failed: %v", err)
+		}
+
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	t.Run("Capturing the BIOS profile", func(t *testing.T) {
+		status, body, err := makeHTTPPostRequest(t, fmt.Sprintf("%s/api/hosts/%s/bios/profile", baseURL, sim.Address()), "", aliceCookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Profile capture failed (%d): %v %s", status, err, body)
+		}
+
+		var profile db.BIOSProfile
+		if err = json.Unmarshal([]byte(body), &profile); err != nil || !strings.Contains(string(profile.Attributes), `"SriovGlobalEnable":"Disabled"`) {
+			t.Fatalf("Unexpected profile %s: %v", body, err)
+		}
+	})
+
+	t.Run("Releasing without a wipe configuration changes nothing", func(t *testing.T) {
+		var kernelURL string = config.Config.Wipe.KernelURL
+		config.Config.Wipe.KernelURL = ""
+		defer func() { config.Config.Wipe.KernelURL = kernelURL }()
+
+		if err := db.AssignHostToBooking(booking.ID, sim.Address()); err != nil {
+			t.Fatalf("Failed to assign host: %v", err)
+		}
+
+		if err := db.ReleaseHostFromBooking(booking.ID, sim.Address()); !errors.Is(err, db.ErrWipeNotConfigured) {
+			t.Fatalf("Expected the release to be refused, got %v", err)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil || host.Wiping || !host.IsBooked || host.ActiveBookingID != booking.ID {
+			t.Fatalf("Expected the host to stay booked, got %+v (%v)", host, err)
+		}
+
+		if current, err := db.BookingByID(booking.ID); err != nil || !slices.Contains(current.OwnedHostManagementIPs, sim.Address()) {
+			t.Fatalf("Expected the booking to keep the host, got %+v (%v)", current, err)
+		}
+
+		config.Config.Wipe.Enabled = false
+		defer func() { config.Config.Wipe.Enabled = true }()
+
+		if err := db.ReleaseHostFromBooking(booking.ID, sim.Address()); err != nil {
+			t.Fatalf("Failed to release host: %v", err)
+		}
+	})
+
+	t.Run("Released hosts are wiped before returning to the pool", func(t *testing.T) {
+		var wipe *db.HostWipe = release(t)
+
+		if status, body, _ := makeHTTPPostRequest(t, baseURL+"/api/bookings/cart/hosts", fmt.Sprintf(`{"management_ip":%q}`, sim.Address()), aliceCookies); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a host being wiped, got %d: %s", fiber.StatusConflict, status, body)
+		}
+
+		plan, reportURL := bootImage(t)
+
+		var drives []db.WipeReportDrive
+		for i, expected := range []db.WipeMethod{db.WipeMethodDiscard, db.WipeMethodDiscard, db.WipeMethodOverwrite} {
+			if plan.Drives[i].Method != expected {
+				t.Fatalf("Expected drive %s to be wiped with %s, got %s", plan.Drives[i].Name, expected, plan.Drives[i].Method)
+			}
+
+			drives = append(drives, db.WipeReportDrive{Name: plan.Drives[i].Name, SerialNumber: plan.Drives[i].SerialNumber, Method: plan.Drives[i].Method, Success: true})
+		}
+
+		// The token is in the boot script, only the address that booted the image may use it
+		forged, _ := json.Marshal(db.WipeReport{Drives: drives})
+		if status := elsewhere(t, "POST", reportURL, string(forged)); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for a report from another address, got %d", fiber.StatusForbidden, status)
+		}
+
+		if status := elsewhere(t, "GET", baseURL+"/api/wipe/boot/"+bmcsim.DefaultHardware().NICs[0].MACAddress, ""); status != fiber.StatusForbidden {
+			t.Fatalf("Expected status %d for the boot script from another address, got %d", fiber.StatusForbidden, status)
+		}
+
+		if current, err := db.HostWipeByID(wipe.ID); err != nil || current.Status != db.WipeStatusWiping || current.Certificate != "" {
+			t.Fatalf("Expected the forged report to be ignored, got %+v (%v)", current, err)
+		}
+
+		if status := report(t, reportURL, drives); status != fiber.StatusOK {
+			t.Fatalf("Expected status %d for the report, got %d", fiber.StatusOK, status)
+		}
+
+		job, err := db.WaitForJob(wipe.JobID, 30*time.Second)
+		if err != nil || job.Status != db.JobStatusSucceeded {
+			t.Fatalf("Expected the wipe job to succeed, got %+v (%v)", job, err)
+		}
+
+		if wipe, err = db.HostWipeByID(wipe.ID); err != nil || wipe.Status != db.WipeStatusCompleted || wipe.Certificate == "" || !wipe.BIOSReverted || wipe.BookingID != booking.ID {
+			t.Fatalf("Expected a certified wipe, got %+v (%v)", wipe, err)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil || host.Wiping || host.IdleSince.IsZero() {
+			t.Fatalf("Expected the host back in the pool, got %+v (%v)", host, err)
+		}
+
+		if boot := sim.BootOverride(); boot.Target != "Pxe" {
+			t.Fatalf("Expected the host to PXE boot the wipe image, got %+v", boot)
+		}
+
+		if sim.PowerState() != bmcsim.PowerOff {
+			t.Fatalf("Expected the host to be powered off after the wipe")
+		}
+
+		if pending := sim.PendingBIOSAttributes(); pending["SriovGlobalEnable"] != "Disabled" {
+			t.Fatalf("Expected the BIOS profile to be staged, got %v", pending)
+		}
+
+		if status, _, _ := makeHTTPGetRequest(t, baseURL+"/api/wipe/boot/"+bmcsim.DefaultHardware().NICs[0].MACAddress); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d for a host no longer being wiped, got %d", fiber.StatusConflict, status)
+		}
+	})
+
+	t.Run("Unverified wipes keep the host out of the pool", func(t *testing.T) {
+		var wipe *db.HostWipe = release(t)
+
+		plan, reportURL := bootImage(t)
+		if status := report(t, reportURL, []db.WipeReportDrive{{Name: plan.Drives[0].Name, SerialNumber: plan.Drives[0].SerialNumber, Method: plan.Drives[0].Method, Success: true}}); status != fiber.StatusUnprocessableEntity {
+			t.Fatalf("Expected status %d for an incomplete report, got %d", fiber.StatusUnprocessableEntity, status)
+		}
+
+		if job, err := db.WaitForJob(wipe.JobID, 30*time.Second); err != nil || job.Status != db.JobStatusFailed {
+			t.Fatalf("Expected the wipe job to fail, got %+v (%v)", job, err)
+		}
+
+		if host, err := db.Hosts.Select(sim.Address()); err != nil || host == nil || !host.Wiping {
+			t.Fatalf("Expected the host to stay out of the pool, got %+v (%v)", host, err)
+		}
+
+		status, body, err := makeHTTPGetRequestWithCookies(t, fmt.Sprintf("%s/api/hosts/%s/wipes", baseURL, sim.Address()), aliceCookies)
+		if err != nil || status != fiber.StatusOK {
+			t.Fatalf("Wipe history request failed (%d): %v", status, err)
+		}
+
+		var history []*db.HostWipe
+		if json.Unmarshal([]byte(body), &history); len(history) != 2 || history[0].Status != db.WipeStatusFailed || !strings.Contains(history[0].Message, "not reported") {
+			t.Fatalf("Unexpected wipe history %s", body)
+		}
+
+		status, body, _ = makeHTTPPostRequest(t, fmt.Sprintf("%s/api/hosts/%s/wipe", baseURL, sim.Address()), "", aliceCookies)
+		if status != fiber.StatusAccepted {
+			t.Fatalf("Expected a manual retry to be accepted, got %d: %s", status, body)
+		}
+
+		var retry struct {
+			JobID int `json:"job_id"`
+		}
+
+		json.Unmarshal([]byte(body), &retry)
+
+		if status, _, _ := makeHTTPPostRequest(t, fmt.Sprintf("%s/api/hosts/%s/wipe", baseURL, sim.Address()), "", aliceCookies); status != fiber.StatusConflict {
+			t.Fatalf("Expected status %d while a wipe is running, got %d", fiber.StatusConflict, status)
+		}
+
+		plan, reportURL = bootImage(t)
+		report(t, reportURL, nil)
+
+		if job, err := db.WaitForJob(retry.JobID, 30*time.Second); err != nil || job.Status != db.JobStatusFailed {
+			t.Fatalf("Expected the retried wipe to fail, got %+v (%v)", job, err)
+		}
+	})
+}
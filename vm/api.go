@@ -3,6 +3,7 @@ package vm
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -21,6 +22,13 @@ type ProxmoxAPI struct {
 	nodeRotator int
 }
 
+var (
+	ErrProxmoxDisabled = errors.New("proxmox integration is disabled")
+
+	sharedAPI     *ProxmoxAPI
+	sharedAPILock sync.Mutex
+)
+
 type ProxmoxAPICreateResult struct {
 	Container *proxmox.Container
 	CTID      int
@@ -82,3 +90,25 @@ func (api *ProxmoxAPI) NextNode() *proxmox.Node {
 	api.nodeRotator = (api.nodeRotator + 1) % len(api.Nodes)
 	return api.Nodes[api.nodeRotator]
 }
+
+// SharedProxmox returns the application-wide ProxmoxAPI, connecting on first use.
+// A failed connection is not cached so the next caller will retry.
+func SharedProxmox() (api *ProxmoxAPI, err error) {
+	if !config.Config.Proxmox.Enabled {
+		err = ErrProxmoxDisabled
+		return
+	}
+
+	sharedAPILock.Lock()
+	defer sharedAPILock.Unlock()
+
+	if sharedAPI == nil {
+		if sharedAPI, err = InitProxmox(); err != nil {
+			sharedAPI = nil
+			return
+		}
+	}
+
+	api = sharedAPI
+	return
+}
@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"time"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+func (api *ProxmoxAPI) NodeForVirtualMachine(vmID int) (node *proxmox.Node, err error) {
+	for _, node = range api.Nodes {
+		if _, err = node.VirtualMachine(api.bg, vmID); err == nil {
+			return
+		}
+	}
+
+	err = proxmox.ErrNotFound
+	return
+}
+
+func (api *ProxmoxAPI) VirtualMachine(vmID int) (machine *proxmox.VirtualMachine, err error) {
+	var node *proxmox.Node
+	if node, err = api.NodeForVirtualMachine(vmID); err != nil {
+		return
+	}
+
+	machine, err = node.VirtualMachine(api.bg, vmID)
+	return
+}
+
+func (api *ProxmoxAPI) StopVirtualMachine(machine *proxmox.VirtualMachine) (err error) {
+	var task *proxmox.Task
+	if task, err = machine.Stop(api.bg); err == nil {
+		err = task.Wait(api.bg, time.Second, time.Minute*3)
+	}
+
+	return
+}
+
+func (api *ProxmoxAPI) DeleteVirtualMachine(machine *proxmox.VirtualMachine) (err error) {
+	var task *proxmox.Task
+	if task, err = machine.Delete(api.bg); err == nil {
+		err = task.Wait(api.bg, time.Second, time.Minute*3)
+	}
+
+	return
+}
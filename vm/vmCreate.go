@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+type ProxmoxAPICreateVMResult struct {
+	VirtualMachine *proxmox.VirtualMachine
+	VMID           int
+}
+
+// EnsureISO uploads a local ISO to the node's storage unless it is already there, and returns its volume ID.
+func (api *ProxmoxAPI) EnsureISO(node *proxmox.Node, storageName, isoPath string) (volume string, err error) {
+	var storage *proxmox.Storage
+	if storage, err = node.Storage(api.bg, storageName); err != nil {
+		err = fmt.Errorf("failed to get storage %s: %w", storageName, err)
+		return
+	}
+
+	var fileName string = filepath.Base(isoPath)
+	if iso, errISO := storage.ISO(api.bg, fileName); errISO == nil && iso != nil {
+		volume = iso.VolID
+		return
+	}
+
+	var task *proxmox.Task
+	if task, err = storage.Upload("iso", isoPath); err != nil {
+		err = fmt.Errorf("failed to upload iso: %w", err)
+		return
+	}
+
+	if err = task.Wait(api.bg, time.Second, time.Minute*30); err != nil {
+		err = fmt.Errorf("failed to wait for iso upload task: %w", err)
+		return
+	}
+
+	volume = fmt.Sprintf("%s:iso/%s", storageName, fileName)
+	return
+}
+
+func (api *ProxmoxAPI) CreateVirtualMachine(node *proxmox.Node, conf *VirtualMachineCreateOptions) (result *ProxmoxAPICreateVMResult, err error) {
+	api.createLock.Lock()
+	defer api.createLock.Unlock()
+
+	result = &ProxmoxAPICreateVMResult{}
+
+	if result.VMID, err = api.Cluster.NextID(api.bg); err != nil {
+		err = fmt.Errorf("failed to get next virtual machine ID: %w", err)
+		return
+	}
+
+	var task *proxmox.Task
+	if task, err = node.NewVirtualMachine(api.bg, result.VMID, conf.GoProxmoxOptions()...); err != nil {
+		err = fmt.Errorf("failed to create virtual machine: %w", err)
+		return
+	}
+
+	if err = task.Wait(api.bg, time.Second, time.Minute*5); err != nil {
+		err = fmt.Errorf("failed to wait for virtual machine creation task: %w", err)
+		return
+	}
+
+	if result.VirtualMachine, err = node.VirtualMachine(api.bg, result.VMID); err != nil {
+		err = fmt.Errorf("failed to get created virtual machine info: %w", err)
+		return
+	}
+
+	return
+}
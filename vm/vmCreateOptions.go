@@ -0,0 +1,62 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/luthermonson/go-proxmox"
+)
+
+type VirtualMachineCreateOptions struct {
+	Name          string
+	StoragePool   string
+	ISOVolume     string
+	StorageSizeGB int
+	MemoryMB      int
+	Cores         int
+}
+
+func (c *VirtualMachineCreateOptions) GoProxmoxOptions() (opts []proxmox.VirtualMachineOption) {
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "name",
+		Value: c.Name,
+	})
+
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "cores",
+		Value: c.Cores,
+	})
+
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "memory",
+		Value: c.MemoryMB,
+	})
+
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "scsihw",
+		Value: "virtio-scsi-pci",
+	})
+
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "scsi0",
+		Value: fmt.Sprintf("%s:%d", c.StoragePool, c.StorageSizeGB),
+	})
+
+	if c.ISOVolume != "" {
+		opts = append(opts, proxmox.VirtualMachineOption{
+			Name:  "ide2",
+			Value: fmt.Sprintf("%s,media=cdrom", c.ISOVolume),
+		})
+	}
+
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "boot",
+		Value: "order=scsi0;ide2",
+	})
+
+	opts = append(opts, proxmox.VirtualMachineOption{
+		Name:  "net0",
+		Value: "virtio,bridge=vmbr0,firewall=1",
+	})
+
+	return
+}